@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// loadResult totals the replies of a load test.
+type loadResult struct {
+	Requests         int
+	Failures         int
+	PromptTokens     int
+	CompletionTokens int
+	Elapsed          time.Duration
+}
+
+// CompletionTokensPerSecond is the generation throughput across all workers.
+func (r loadResult) CompletionTokensPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.CompletionTokens) / r.Elapsed.Seconds()
+}
+
+// runLoad sends requests copies of a single turn chat request from a pool
+// of concurrency workers and totals the usage the server reports.
+func runLoad(client *http.Client, out *logger, retry retryPolicy, apiURL, modelName, prompt string, concurrency, requests int) loadResult {
+	jobs := make(chan int)
+	var mu sync.Mutex
+	res := loadResult{Requests: requests}
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				reqBody := ChatRequest{
+					Model:    modelName,
+					Messages: []Message{{Role: "user", Content: prompt}},
+				}
+
+				reqStart := time.Now()
+				var chatResp *ChatResponse
+				err := retry.do(func() (err error) {
+					chatResp, err = Chat(client, apiURL, reqBody)
+					return err
+				})
+
+				mu.Lock()
+				if err != nil {
+					res.Failures++
+					out.fail(logEntry{Msg: "request failed", DurationMs: time.Since(reqStart).Milliseconds()}, err, "Request %d failed", i)
+				} else {
+					res.PromptTokens += chatResp.Usage.PromptTokens
+					res.CompletionTokens += chatResp.Usage.CompletionTokens
+					out.info(logEntry{
+						Msg:              "request succeeded",
+						RequestID:        chatResp.RequestID,
+						Status:           http.StatusOK,
+						DurationMs:       time.Since(reqStart).Milliseconds(),
+						PromptTokens:     chatResp.Usage.PromptTokens,
+						CompletionTokens: chatResp.Usage.CompletionTokens,
+					}, "Request %d: took %v, %d completion tokens", i, time.Since(reqStart), chatResp.Usage.CompletionTokens)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := 1; i <= requests; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	res.Elapsed = time.Since(start)
+	return res
+}
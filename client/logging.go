@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// logEntry is one JSON line of the client's structured output. Empty fields
+// are left out.
+type logEntry struct {
+	Time             string  `json:"time"`
+	Level            string  `json:"level"`
+	Msg              string  `json:"msg"`
+	RequestID        string  `json:"request_id,omitempty"`
+	Status           int     `json:"status,omitempty"`
+	DurationMs       int64   `json:"duration_ms,omitempty"`
+	PromptTokens     int     `json:"prompt_tokens,omitempty"`
+	CompletionTokens int     `json:"completion_tokens,omitempty"`
+	TokensPerSecond  float64 `json:"tokens_per_second,omitempty"`
+	Requests         int     `json:"requests,omitempty"`
+	Failures         int     `json:"failures,omitempty"`
+	Reply            string  `json:"reply,omitempty"`
+	Error            string  `json:"error,omitempty"`
+}
+
+// logger writes the client's output either for people, the default, or as
+// JSON lines for pipelines.
+type logger struct {
+	json bool
+	out  io.Writer
+}
+
+// info reports e, printing format with args in human-readable mode.
+func (l *logger) info(e logEntry, format string, args ...any) {
+	if !l.json {
+		fmt.Fprintf(l.out, format+"\n", args...)
+		return
+	}
+	e.Level = "info"
+	l.write(e)
+}
+
+// fail reports err, printing format with args followed by the error in
+// human-readable mode. The status and request id of API errors are added
+// to e.
+func (l *logger) fail(e logEntry, err error, format string, args ...any) {
+	if !l.json {
+		log.Printf(format+": %v", append(args, err)...)
+		return
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		e.Status = apiErr.StatusCode
+		e.RequestID = apiErr.RequestID
+	}
+	e.Level = "error"
+	e.Error = err.Error()
+	l.write(e)
+}
+
+func (l *logger) write(e logEntry) {
+	e.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Error encoding log entry: %v", err)
+		return
+	}
+	l.out.Write(append(line, '\n'))
+}
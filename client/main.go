@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 )
 
@@ -37,72 +41,324 @@ type ChatResponse struct {
 		CompletionTokens int `json:"completion_tokens"`
 		TotalTokens      int `json:"total_tokens"`
 	} `json:"usage"`
+	// RequestID is the X-Request-Id the server answered with.
+	RequestID string `json:"-"`
 }
 
-func main() {
-	// Configuration
-	apiURL := "http://localhost:5002/v1/chat/completions"
-	modelName := "default" // Llama.cpp server usually ignores this or treats as default
+// APIError is returned when the server answers with a status other than 200.
+type APIError struct {
+	StatusCode int
+	RequestID  string
+	Body       string
+}
 
-	// Prepare the request payload
-	reqBody := ChatRequest{
-		Model: modelName,
-		Messages: []Message{
-			{Role: "user", Content: "Hello! Who are you?"},
-		},
-		Stream: false,
-	}
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API Error: Status %d\nBody: %s", e.StatusCode, e.Body)
+}
 
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	return &APIError{StatusCode: resp.StatusCode, RequestID: resp.Header.Get("X-Request-Id"), Body: string(body)}
+}
+
+// Streaming chunk structure (one per SSE "data:" event)
+type ChatStreamChunk struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+func newChatRequest(apiURL string, reqBody ChatRequest) (*http.Request, error) {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		log.Fatalf("Error marshaling request: %v", err)
+		return nil, fmt.Errorf("marshaling request: %w", err)
 	}
 
-	// Create HTTP request
 	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		log.Fatalf("Error creating request: %v", err)
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer sk-no-key-required") // Llama.cpp doesn't strictly need this but good practice
+	if reqBody.Stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
 
-	// Send request
-	client := &http.Client{Timeout: 120 * time.Second} // Increased timeout for large model loading/thinking
-	fmt.Printf("Sending request to %s...\n", apiURL)
+	return req, nil
+}
+
+// Chat sends a non-streaming request and returns the parsed response.
+func Chat(client *http.Client, apiURL string, reqBody ChatRequest) (*ChatResponse, error) {
+	reqBody.Stream = false
+
+	req, err := newChatRequest(apiURL, reqBody)
+	if err != nil {
+		return nil, err
+	}
 
-	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Fatalf("Error sending request: %v", err)
+		return nil, fmt.Errorf("sending request: %w", err)
 	}
 	defer resp.Body.Close()
-	duration := time.Since(start)
 
-	// Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatalf("Error reading response: %v", err)
+		return nil, fmt.Errorf("reading response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		log.Fatalf("API Error: Status %d\nBody: %s", resp.StatusCode, string(body))
+		return nil, newAPIError(resp, body)
 	}
 
-	// Parse response
 	var chatResp ChatResponse
 	if err := json.Unmarshal(body, &chatResp); err != nil {
-		log.Fatalf("Error parsing JSON response: %v", err)
-	}
-
-	// Print result
-	if len(chatResp.Choices) > 0 {
-		fmt.Printf("\n--- Model Response (took %v) ---\n", duration)
-		fmt.Println(chatResp.Choices[0].Message.Content)
-		fmt.Println("-------------------------------------")
-		fmt.Printf("Usage: %d prompt tokens, %d completion tokens\n",
-			chatResp.Usage.PromptTokens, chatResp.Usage.CompletionTokens)
-	} else {
-		fmt.Println("No choices returned in response.")
+		return nil, fmt.Errorf("parsing JSON response: %w", err)
+	}
+	chatResp.RequestID = resp.Header.Get("X-Request-Id")
+
+	return &chatResp, nil
+}
+
+// StreamChat sends a streaming request and calls onDelta with each piece of
+// content as it arrives. It returns the full assembled reply once the server
+// sends [DONE] or closes the stream.
+func StreamChat(client *http.Client, apiURL string, reqBody ChatRequest, onDelta func(string)) (string, error) {
+	reqBody.Stream = true
+
+	req, err := newChatRequest(apiURL, reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", newAPIError(resp, body)
+	}
+
+	var full strings.Builder
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return full.String(), fmt.Errorf("reading stream: %w", err)
+		}
+
+		line = strings.TrimSpace(line)
+		if data, ok := strings.CutPrefix(line, "data:"); ok {
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				return full.String(), nil
+			}
+
+			var chunk ChatStreamChunk
+			if jsonErr := json.Unmarshal([]byte(data), &chunk); jsonErr != nil {
+				return full.String(), fmt.Errorf("parsing stream chunk: %w", jsonErr)
+			}
+
+			for _, choice := range chunk.Choices {
+				if len(choice.Delta.Content) != 0 {
+					full.WriteString(choice.Delta.Content)
+					onDelta(choice.Delta.Content)
+				}
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return full.String(), nil
+		}
+	}
+}
+
+// newTransport returns the transport for the client. With http2 every
+// request is multiplexed over HTTP/2, negotiated for https:// URLs and spoken
+// in cleartext (h2c) for http:// ones, so the server has to support it.
+// Otherwise HTTP/1.1 is used with up to maxConns connections per host.
+func newTransport(http2 bool, maxConns int) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = maxConns
+
+	if http2 {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		t.Protocols = protocols
+	}
+
+	return t
+}
+
+// sendTurn sends the whole history and returns the assistant reply.
+func sendTurn(client *http.Client, out *logger, retry retryPolicy, apiURL, modelName string, stream bool, history []Message) (string, error) {
+	reqBody := ChatRequest{
+		Model:    modelName,
+		Messages: history,
+	}
+
+	start := time.Now()
+
+	if stream {
+		// transient failures happen before the stream starts, so nothing
+		// printed is repeated
+		var reply string
+		err := retry.do(func() (err error) {
+			reply, err = StreamChat(client, apiURL, reqBody, func(delta string) {
+				if !out.json {
+					fmt.Print(delta)
+				}
+			})
+			return err
+		})
+		if !out.json {
+			fmt.Println()
+		}
+		if err != nil {
+			return "", err
+		}
+		out.info(logEntry{Msg: "reply", DurationMs: time.Since(start).Milliseconds(), Reply: reply}, "(streamed in %v)", time.Since(start))
+		return reply, nil
+	}
+
+	var chatResp *ChatResponse
+	err := retry.do(func() (err error) {
+		chatResp, err = Chat(client, apiURL, reqBody)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return "", errors.New("no choices returned in response")
+	}
+
+	reply := chatResp.Choices[0].Message.Content
+	if !out.json {
+		fmt.Println(reply)
+	}
+	out.info(logEntry{
+		Msg:              "reply",
+		RequestID:        chatResp.RequestID,
+		Status:           http.StatusOK,
+		DurationMs:       time.Since(start).Milliseconds(),
+		PromptTokens:     chatResp.Usage.PromptTokens,
+		CompletionTokens: chatResp.Usage.CompletionTokens,
+		Reply:            reply,
+	}, "(took %v, %d prompt tokens, %d completion tokens)",
+		time.Since(start), chatResp.Usage.PromptTokens, chatResp.Usage.CompletionTokens)
+	return reply, nil
+}
+
+func main() {
+	// Configuration
+	apiURLFlag := flag.String("url", "http://localhost:5002/v1/chat/completions", "OpenAI-compatible chat completions endpoint")
+	modelFlag := flag.String("model", "default", "model name to request (llama.cpp usually ignores this or treats it as default)")
+	timeoutFlag := flag.Duration("timeout", 120*time.Second, "per-request timeout (large models can take a while to load/think)")
+	streamFlag := flag.Bool("stream", false, "stream the reply token by token")
+	http2Flag := flag.Bool("http2", false, "multiplex requests over HTTP/2 (h2c for http:// URLs)")
+	concurrencyFlag := flag.Int("concurrency", 0, "run a load test with this many concurrent workers instead of the chat prompt")
+	requestsFlag := flag.Int("requests", 0, "number of load test requests (defaults to -concurrency)")
+	promptFlag := flag.String("prompt", "Write a haiku about the sea.", "user message sent by every load test request")
+	jsonFlag := flag.Bool("json", false, "log structured JSON lines instead of human-readable output")
+	retriesFlag := flag.Int("retries", 0, "retry connection failures and 502/503/504 replies this many times, e.g. while the model loads")
+	retryBackoffFlag := flag.Duration("retry-backoff", time.Second, "wait before the first retry, doubled after every attempt")
+	flag.Parse()
+
+	apiURL := *apiURLFlag
+	modelName := *modelFlag
+	stream := *streamFlag
+
+	client := &http.Client{
+		Timeout:   *timeoutFlag,
+		Transport: newTransport(*http2Flag, max(*concurrencyFlag, 2)),
+	}
+	out := &logger{json: *jsonFlag, out: os.Stdout}
+	retry := retryPolicy{retries: *retriesFlag, backoff: *retryBackoffFlag, out: out}
+
+	if *concurrencyFlag > 0 {
+		requests := *requestsFlag
+		if requests <= 0 {
+			requests = *concurrencyFlag
+		}
+
+		out.info(logEntry{Msg: "load test started", Requests: requests}, "Load test: url=%s model=%s concurrency=%d requests=%d http2=%t", apiURL, modelName, *concurrencyFlag, requests, *http2Flag)
+		res := runLoad(client, out, retry, apiURL, modelName, *promptFlag, *concurrencyFlag, requests)
+		out.info(logEntry{
+			Msg:              "load test finished",
+			DurationMs:       res.Elapsed.Milliseconds(),
+			PromptTokens:     res.PromptTokens,
+			CompletionTokens: res.CompletionTokens,
+			TokensPerSecond:  res.CompletionTokensPerSecond(),
+			Requests:         res.Requests,
+			Failures:         res.Failures,
+		}, "\n%d requests (%d failed) in %v: %d prompt tokens, %d completion tokens, %.1f completion tokens/sec",
+			res.Requests, res.Failures, res.Elapsed.Round(time.Millisecond), res.PromptTokens, res.CompletionTokens, res.CompletionTokensPerSecond())
+		if res.Failures > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// prompts are for people, pipelines feed stdin and read the JSON lines
+	prompt := func(text string) {
+		if !out.json {
+			fmt.Print(text)
+		}
+	}
+
+	out.info(logEntry{Msg: "started"}, "Config: url=%s model=%s timeout=%v stream=%t http2=%t\nType /reset to clear history, /exit to quit.", apiURL, modelName, *timeoutFlag, stream, *http2Flag)
+
+	// Conversation history grows with every turn and is sent in full each time
+	var history []Message
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		prompt("\nYou: ")
+		if !scanner.Scan() {
+			break
+		}
+
+		input := strings.TrimSpace(scanner.Text())
+		switch input {
+		case "":
+			continue
+		case "/exit":
+			return
+		case "/reset":
+			history = nil
+			out.info(logEntry{Msg: "history cleared"}, "History cleared.")
+			continue
+		}
+
+		history = append(history, Message{Role: "user", Content: input})
+
+		prompt("\nAssistant: ")
+		reply, err := sendTurn(client, out, retry, apiURL, modelName, stream, history)
+		if err != nil {
+			// Drop the unanswered user message so the history stays consistent
+			history = history[:len(history)-1]
+			out.fail(logEntry{Msg: "request failed"}, err, "Error")
+			continue
+		}
+
+		history = append(history, Message{Role: "assistant", Content: reply})
+	}
+
+	if err := scanner.Err(); err != nil {
+		out.fail(logEntry{Msg: "reading input failed"}, err, "Error reading input")
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// maxRetryBackoff caps the doubling wait between attempts.
+const maxRetryBackoff = 30 * time.Second
+
+// retryPolicy retries requests that failed for reasons that go away on
+// their own, like llama.cpp refusing connections or answering 503 while it
+// is still loading a large model.
+type retryPolicy struct {
+	retries int
+	backoff time.Duration
+	out     *logger
+}
+
+// isTransient reports whether err is worth retrying.
+func isTransient(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	// only failures to send, a stream breaking off mid-way is not retried
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// do calls fn until it succeeds, fails for good or runs out of retries,
+// doubling the wait after every attempt.
+func (p retryPolicy) do(fn func() error) error {
+	wait := p.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > p.retries || !isTransient(err) {
+			return err
+		}
+
+		p.out.fail(logEntry{Msg: "retrying", DurationMs: wait.Milliseconds()}, err, "Attempt %d of %d failed, retrying in %v", attempt, p.retries+1, wait)
+		time.Sleep(wait)
+		wait = min(2*wait, maxRetryBackoff)
+	}
+}
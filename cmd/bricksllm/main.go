@@ -52,13 +52,14 @@ func main() {
 		log.Sugar().Fatalf("cannot parse environment variables: %v", err)
 	}
 
-	err = telemetry.Init(cfg)
+	err = telemetry.Init(cfg, log)
 	if err != nil {
 		log.Sugar().Fatalf("cannot connect to telemetry provider: %v", err)
 	}
 
+	pgConnStr := fmt.Sprintf("postgresql:///%s?sslmode=%s&user=%s&password=%s&host=%s&port=%s", cfg.PostgresqlDbName, cfg.PostgresqlSslMode, cfg.PostgresqlUsername, cfg.PostgresqlPassword, cfg.PostgresqlHosts, cfg.PostgresqlPort)
 	store, err := postgresql.NewStore(
-		fmt.Sprintf("postgresql:///%s?sslmode=%s&user=%s&password=%s&host=%s&port=%s", cfg.PostgresqlDbName, cfg.PostgresqlSslMode, cfg.PostgresqlUsername, cfg.PostgresqlPassword, cfg.PostgresqlHosts, cfg.PostgresqlPort),
+		pgConnStr,
 		cfg.PostgresqlWriteTimeout,
 		cfg.PostgresqlReadTimeout,
 	)
@@ -66,6 +67,7 @@ func main() {
 	if err != nil {
 		log.Sugar().Fatalf("cannot connect to postgresql: %v", err)
 	}
+	store.SetMaxMessageContentLength(cfg.MaxMessageContentLength)
 
 	err = store.CreateCustomProvidersTable()
 	if err != nil {
@@ -153,9 +155,18 @@ func main() {
 	}
 
 	// conversations/messages for Chat UI
-	err = store.CreateConversationTables()
+	err = store.Migrate()
 	if err != nil {
-		log.Sugar().Fatalf("error creating conversation tables: %v", err)
+		log.Sugar().Fatalf("error migrating conversation tables: %v", err)
+	}
+
+	// replies still streaming past the stream timeout died with a previous process
+	recovered, err := store.CompleteStaleStreamingMessages(cfg.AliasStreamRequestTimeout)
+	if err != nil {
+		log.Sugar().Fatalf("error recovering interrupted streaming messages: %v", err)
+	}
+	if recovered != 0 {
+		log.Sugar().Infof("marked %d interrupted streaming messages as complete", recovered)
 	}
 
 	err = store.CreateCreatedAtIndexForUsers()
@@ -180,6 +191,13 @@ func main() {
 	}
 	rMemStore.Listen()
 
+	// trashed conversations are only ever erased when a purge interval is set
+	var trashPurger *postgresql.TrashPurger
+	if cfg.TrashPurgeInterval > 0 {
+		trashPurger = postgresql.NewTrashPurger(store, cfg.TrashPurgeInterval, cfg.TrashRetention, log)
+		trashPurger.Run()
+	}
+
 	defaultRedisOption := func(cfg *config.Config, dbIndex int) *redis.Options {
 
 		options := &redis.Options{
@@ -305,7 +323,7 @@ func main() {
 	pm := manager.NewPolicyManager(store, rMemStore)
 	um := manager.NewUserManager(store, store)
 
-	as, err := admin.NewAdminServer(log, *modePtr, m, krm, psm, cpm, rm, pm, um, cfg.AdminPass)
+	as, err := admin.NewAdminServer(log, *modePtr, m, krm, psm, cpm, rm, pm, um, postgresql.NewInstrumentedStore(store), cfg.AdminPass)
 	if err != nil {
 		log.Sugar().Fatalf("error creating admin http server: %v", err)
 	}
@@ -358,7 +376,81 @@ func main() {
 	scanner := pii.NewScanner(detector)
 	cd := custompolicy.NewOpenAiDetector(cfg.CustomPolicyDetectionTimeout, cfg.OpenAiApiKey)
 
-	ps, err := proxy.NewProxyServer(log, *modePtr, *privacyPtr, c, m, rm, a, psm, cpm, store, ce, ace, aoe, v, rec, messageBus, rlm, cfg.ProxyTimeout, accessCache, userAccessCache, pm, scanner, cd, die, um, cfg.RemoveUserAgent)
+	// exchanges are only captured when debugging, never by default
+	debugCaptureSize := 0
+	if cfg.DebugCapture {
+		debugCaptureSize = cfg.DebugCaptureSize
+	}
+
+	// new messages are only pushed to WebSocket clients when enabled
+	var messageEvents proxy.MessageSubscriber
+	if cfg.MessageStreaming {
+		listener, err := postgresql.NewMessageListener(pgConnStr, log)
+		if err != nil {
+			log.Sugar().Fatalf("cannot listen for conversation messages: %v", err)
+		}
+		defer listener.Close()
+		messageEvents = listener
+	}
+
+	ps, err := proxy.NewProxyServer(log, *modePtr, *privacyPtr, c, m, rm, a, psm, cpm, store, ce, ace, aoe, v, rec, messageBus, rlm, cfg.ProxyTimeout, accessCache, userAccessCache, pm, scanner, cd, die, um, cfg.RemoveUserAgent, cfg.ProxyShutdownGracePeriod, proxy.AliasConfig{
+		LogBodies:                cfg.AliasLogBodies,
+		MaxIdleConns:             cfg.AliasMaxIdleConns,
+		MaxIdleConnsPerHost:      cfg.AliasMaxIdleConnsPerHost,
+		IdleConnTimeout:          cfg.AliasIdleConnTimeout,
+		RequestTimeout:           cfg.AliasRequestTimeout,
+		StreamRequestTimeout:     cfg.AliasStreamRequestTimeout,
+		ModelTimeouts:            cfg.AliasModelTimeouts,
+		BaseUrls:                 cfg.AliasBaseUrls,
+		BaseUrlWeights:           cfg.AliasBaseUrlWeights,
+		UpstreamApiKey:           cfg.AliasUpstreamApiKey,
+		UpstreamDefaultHeaders:   cfg.AliasUpstreamDefaultHeaders,
+		UpstreamMaxConcurrency:   cfg.AliasUpstreamMaxConcurrency,
+		UpstreamQueueTimeout:     cfg.AliasUpstreamQueueTimeout,
+		MockMode:                 cfg.AliasMockMode,
+		MockTokenDelay:           cfg.AliasMockTokenDelay,
+		AnthropicBaseUrl:         cfg.AliasAnthropicBaseUrl,
+		AnthropicPromptCaching:   cfg.AliasAnthropicPromptCaching,
+		UpstreamFailureThreshold: cfg.AliasUpstreamFailureThreshold,
+		UpstreamCooldown:         cfg.AliasUpstreamCooldown,
+		StreamSaveInterval:       cfg.AliasStreamSaveInterval,
+		DefaultModel:             cfg.AliasDefaultModel,
+		AllowedModels:            cfg.AliasAllowedModels,
+		MaxBodyBytes:             cfg.AliasMaxBodyBytes,
+		TitleModel:               cfg.AliasTitleModel,
+		TitlePrompt:              cfg.AliasTitlePrompt,
+		RateLimit:                cfg.AliasRateLimit,
+		RateBurst:                cfg.AliasRateBurst,
+		HistoryMaxMessages:       cfg.AliasHistoryMaxMessages,
+		HistoryMaxTokens:         cfg.AliasHistoryMaxTokens,
+		HistorySummarize:         cfg.AliasHistorySummarize,
+		JSONModeRetries:          cfg.AliasJSONModeRetries,
+		DebugCaptureSize:         debugCaptureSize,
+		DebugCaptureMaxBodyBytes: cfg.DebugCaptureMaxBodyBytes,
+		DebugCaptureToken:        cfg.AdminPass,
+		RetryPayloadMaxCount:     cfg.RetryPayloadMaxCount,
+		RetryPayloadTTL:          cfg.RetryPayloadTTL,
+		MetadataSchema:           cfg.AliasMetadataSchema,
+		DefaultMetadata:          cfg.AliasDefaultMetadata,
+		MessageDedupWindow:       cfg.MessageDedupWindow,
+		MaxMessageContentLength:  cfg.MaxMessageContentLength,
+		MessageEvents:            messageEvents,
+		CORS: proxy.CORSConfig{
+			AllowedOrigins:   cfg.CorsAllowedOrigins,
+			AllowedMethods:   cfg.CorsAllowedMethods,
+			AllowedHeaders:   cfg.CorsAllowedHeaders,
+			AllowCredentials: cfg.CorsAllowCredentials,
+			MaxAge:           cfg.CorsMaxAge,
+		},
+		UpstreamHeaders: proxy.UpstreamHeaderPolicy{
+			Allow: cfg.UpstreamHeaderAllowlist,
+			Deny:  cfg.UpstreamHeaderDenylist,
+		},
+		Signature: proxy.SignatureConfig{
+			Secret: cfg.RequestSignatureSecret,
+			Header: cfg.RequestSignatureHeader,
+		},
+	})
 	if err != nil {
 		log.Sugar().Fatalf("error creating proxy http server: %v", err)
 	}
@@ -369,9 +461,15 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	// in-flight requests still record events, so drain them first
+	ps.Drain()
+
 	eventConsumer.Stop()
 	cpMemStore.Stop()
 	rMemStore.Stop()
+	if trashPurger != nil {
+		trashPurger.Stop()
+	}
 
 	log.Sugar().Infof("shutting down server...")
 
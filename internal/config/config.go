@@ -39,6 +39,14 @@ type Config struct {
 	PrometheusPort                string        `koanf:"prometheus_port" env:"PROMETHEUS_PORT" envDefault:"2112"`
 	AdminPass                     string        `koanf:"admin_pass" env:"ADMIN_PASS"`
 	ProxyTimeout                  time.Duration `koanf:"proxy_timeout" env:"PROXY_TIMEOUT" envDefault:"600s"`
+	ProxyShutdownGracePeriod      time.Duration `koanf:"proxy_shutdown_grace_period" env:"PROXY_SHUTDOWN_GRACE_PERIOD" envDefault:"30s"`
+	CorsAllowedOrigins            []string      `koanf:"cors_allowed_origins" env:"CORS_ALLOWED_ORIGINS" envSeparator:"," envDefault:"*"`
+	CorsAllowedMethods            []string      `koanf:"cors_allowed_methods" env:"CORS_ALLOWED_METHODS" envSeparator:","`
+	CorsAllowedHeaders            []string      `koanf:"cors_allowed_headers" env:"CORS_ALLOWED_HEADERS" envSeparator:","`
+	CorsAllowCredentials          bool          `koanf:"cors_allow_credentials" env:"CORS_ALLOW_CREDENTIALS" envDefault:"false"`
+	CorsMaxAge                    time.Duration `koanf:"cors_max_age" env:"CORS_MAX_AGE" envDefault:"1h"`
+	UpstreamHeaderAllowlist       []string      `koanf:"upstream_header_allowlist" env:"UPSTREAM_HEADER_ALLOWLIST" envSeparator:","`
+	UpstreamHeaderDenylist        []string      `koanf:"upstream_header_denylist" env:"UPSTREAM_HEADER_DENYLIST" envSeparator:","`
 	NumberOfEventMessageConsumers int           `koanf:"number_of_event_message_consumers" env:"NUMBER_OF_EVENT_MESSAGE_CONSUMERS" envDefault:"3"`
 	OpenAiApiKey                  string        `koanf:"openai_api_key" env:"OPENAI_API_KEY"`
 	CustomPolicyDetectionTimeout  time.Duration `koanf:"custom_policy_detection_timeout" env:"CUSTOM_POLICY_DETECTION_TIMEOUT" envDefault:"10m"`
@@ -51,6 +59,51 @@ type Config struct {
 	DecryptionEndpoint            string        `koanf:"decryption_endpoint" env:"DECRYPTION_ENDPOINT"`
 	EncryptionTimeout             time.Duration `koanf:"encryption_timeout" env:"ENCRYPTION_TIMEOUT" envDefault:"5s"`
 	Audience                      string        `koanf:"audience" env:"AUDIENCE"`
+	AliasLogBodies                bool          `koanf:"alias_log_bodies" env:"ALIAS_LOG_BODIES" envDefault:"false"`
+	AliasMaxIdleConns             int           `koanf:"alias_max_idle_conns" env:"ALIAS_MAX_IDLE_CONNS" envDefault:"100"`
+	AliasMaxIdleConnsPerHost      int           `koanf:"alias_max_idle_conns_per_host" env:"ALIAS_MAX_IDLE_CONNS_PER_HOST" envDefault:"32"`
+	AliasIdleConnTimeout          time.Duration `koanf:"alias_idle_conn_timeout" env:"ALIAS_IDLE_CONN_TIMEOUT" envDefault:"90s"`
+	AliasRequestTimeout           time.Duration `koanf:"alias_request_timeout" env:"ALIAS_REQUEST_TIMEOUT" envDefault:"120s"`
+	AliasStreamRequestTimeout     time.Duration `koanf:"alias_stream_request_timeout" env:"ALIAS_STREAM_REQUEST_TIMEOUT" envDefault:"600s"`
+	AliasModelTimeouts            []string      `koanf:"alias_model_timeouts" env:"ALIAS_MODEL_TIMEOUTS" envSeparator:","`
+	AliasBaseUrls                 []string      `koanf:"alias_base_urls" env:"ALIAS_BASE_URLS" envSeparator:","`
+	AliasBaseUrlWeights           []int         `koanf:"alias_base_url_weights" env:"ALIAS_BASE_URL_WEIGHTS" envSeparator:","`
+	AliasUpstreamApiKey           string        `koanf:"alias_upstream_api_key" env:"ALIAS_UPSTREAM_API_KEY"`
+	AliasUpstreamDefaultHeaders   []string      `koanf:"alias_upstream_default_headers" env:"ALIAS_UPSTREAM_DEFAULT_HEADERS" envSeparator:","`
+	AliasUpstreamMaxConcurrency   int           `koanf:"alias_upstream_max_concurrency" env:"ALIAS_UPSTREAM_MAX_CONCURRENCY" envDefault:"0"`
+	AliasUpstreamQueueTimeout     time.Duration `koanf:"alias_upstream_queue_timeout" env:"ALIAS_UPSTREAM_QUEUE_TIMEOUT" envDefault:"30s"`
+	AliasMockMode                 bool          `koanf:"alias_mock_mode" env:"ALIAS_MOCK_MODE" envDefault:"false"`
+	AliasMockTokenDelay           time.Duration `koanf:"alias_mock_token_delay" env:"ALIAS_MOCK_TOKEN_DELAY" envDefault:"50ms"`
+	AliasAnthropicBaseUrl         string        `koanf:"alias_anthropic_base_url" env:"ALIAS_ANTHROPIC_BASE_URL"`
+	AliasAnthropicPromptCaching   bool          `koanf:"alias_anthropic_prompt_caching" env:"ALIAS_ANTHROPIC_PROMPT_CACHING" envDefault:"false"`
+	AliasUpstreamFailureThreshold int           `koanf:"alias_upstream_failure_threshold" env:"ALIAS_UPSTREAM_FAILURE_THRESHOLD" envDefault:"3"`
+	AliasUpstreamCooldown         time.Duration `koanf:"alias_upstream_cooldown" env:"ALIAS_UPSTREAM_COOLDOWN" envDefault:"30s"`
+	AliasStreamSaveInterval       time.Duration `koanf:"alias_stream_save_interval" env:"ALIAS_STREAM_SAVE_INTERVAL" envDefault:"2s"`
+	AliasDefaultModel             string        `koanf:"alias_default_model" env:"ALIAS_DEFAULT_MODEL"`
+	AliasAllowedModels            []string      `koanf:"alias_allowed_models" env:"ALIAS_ALLOWED_MODELS" envSeparator:","`
+	AliasMaxBodyBytes             int64         `koanf:"alias_max_body_bytes" env:"ALIAS_MAX_BODY_BYTES" envDefault:"10485760"`
+	AliasTitleModel               string        `koanf:"alias_title_model" env:"ALIAS_TITLE_MODEL"`
+	AliasTitlePrompt              string        `koanf:"alias_title_prompt" env:"ALIAS_TITLE_PROMPT"`
+	AliasRateLimit                float64       `koanf:"alias_rate_limit" env:"ALIAS_RATE_LIMIT" envDefault:"0"`
+	AliasRateBurst                int           `koanf:"alias_rate_burst" env:"ALIAS_RATE_BURST" envDefault:"10"`
+	AliasHistoryMaxMessages       int           `koanf:"alias_history_max_messages" env:"ALIAS_HISTORY_MAX_MESSAGES" envDefault:"100"`
+	AliasHistoryMaxTokens         int           `koanf:"alias_history_max_tokens" env:"ALIAS_HISTORY_MAX_TOKENS" envDefault:"0"`
+	AliasHistorySummarize         bool          `koanf:"alias_history_summarize" env:"ALIAS_HISTORY_SUMMARIZE" envDefault:"false"`
+	AliasJSONModeRetries          int           `koanf:"alias_json_mode_retries" env:"ALIAS_JSON_MODE_RETRIES" envDefault:"1"`
+	DebugCapture                  bool          `koanf:"debug_capture" env:"DEBUG_CAPTURE" envDefault:"false"`
+	DebugCaptureSize              int           `koanf:"debug_capture_size" env:"DEBUG_CAPTURE_SIZE" envDefault:"50"`
+	DebugCaptureMaxBodyBytes      int           `koanf:"debug_capture_max_body_bytes" env:"DEBUG_CAPTURE_MAX_BODY_BYTES" envDefault:"16384"`
+	RetryPayloadMaxCount          int           `koanf:"retry_payload_max_count" env:"RETRY_PAYLOAD_MAX_COUNT" envDefault:"0"`
+	RetryPayloadTTL               time.Duration `koanf:"retry_payload_ttl" env:"RETRY_PAYLOAD_TTL" envDefault:"10m"`
+	AliasMetadataSchema           []string      `koanf:"alias_metadata_schema" env:"ALIAS_METADATA_SCHEMA" envSeparator:","`
+	AliasDefaultMetadata          []string      `koanf:"alias_default_metadata" env:"ALIAS_DEFAULT_METADATA" envSeparator:","`
+	MessageDedupWindow            time.Duration `koanf:"message_dedup_window" env:"MESSAGE_DEDUP_WINDOW" envDefault:"0s"`
+	MaxMessageContentLength       int           `koanf:"max_message_content_length" env:"MAX_MESSAGE_CONTENT_LENGTH" envDefault:"0"`
+	MessageStreaming              bool          `koanf:"message_streaming" env:"MESSAGE_STREAMING" envDefault:"false"`
+	TrashPurgeInterval            time.Duration `koanf:"trash_purge_interval" env:"TRASH_PURGE_INTERVAL" envDefault:"1h"`
+	TrashRetention                time.Duration `koanf:"trash_retention" env:"TRASH_RETENTION" envDefault:"720h"`
+	RequestSignatureSecret        string        `koanf:"request_signature_secret" env:"REQUEST_SIGNATURE_SECRET"`
+	RequestSignatureHeader        string        `koanf:"request_signature_header" env:"REQUEST_SIGNATURE_HEADER" envDefault:"X-Signature"`
 }
 
 func prepareDotEnv(envFilePath string) error {
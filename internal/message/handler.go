@@ -398,6 +398,8 @@ func (h *Handler) HandleEventWithRequestAndResponse(m Message) error {
 	}
 
 	telemetry.Timing("bricksllm.message.handler.handle_event_with_request_and_response.latency", time.Since(start), nil, 1)
+	telemetry.Count("bricksllm.message.handler.handle_event_with_request_and_response.prompt_tokens", int64(e.Event.PromptTokenCount), nil, 1)
+	telemetry.Count("bricksllm.message.handler.handle_event_with_request_and_response.completion_tokens", int64(e.Event.CompletionTokenCount), nil, 1)
 	telemetry.Incr("bricksllm.message.handler.handle_event_with_request_and_response.success", nil, 1)
 
 	return nil
@@ -65,7 +65,7 @@ type AdminServer struct {
 	m      KeyManager
 }
 
-func NewAdminServer(log *zap.Logger, mode string, m KeyManager, krm KeyReportingManager, psm ProviderSettingsManager, cpm CustomProvidersManager, rm RouteManager, pm PoliciesManager, um UserManager, adminPass string) (*AdminServer, error) {
+func NewAdminServer(log *zap.Logger, mode string, m KeyManager, krm KeyReportingManager, psm ProviderSettingsManager, cpm CustomProvidersManager, rm RouteManager, pm PoliciesManager, um UserManager, aum AuditManager, adminPass string) (*AdminServer, error) {
 	router := gin.New()
 
 	prod := mode == "production"
@@ -111,6 +111,8 @@ func NewAdminServer(log *zap.Logger, mode string, m KeyManager, krm KeyReporting
 	router.PATCH("/api/users", getUpdateUserViaTagsAndUserIdHandler(um, prod))
 	router.GET("/api/users", getGetUsersHandler(um, prod))
 
+	router.GET("/api/audit-log", getGetAuditEntriesHandler(aum, prod))
+
 	srv := &http.Server{
 		Addr:    ":8001",
 		Handler: router,
@@ -150,6 +152,7 @@ func (as *AdminServer) Run() {
 		as.log.Info("PORT 8001 | POST   | /api/users is set up for creating a user")
 		as.log.Info("PORT 8001 | GET    | /api/users is set up for retrieving users")
 		as.log.Info("PORT 8001 | PATCH  | /api/users is set up for updating a user")
+		as.log.Info("PORT 8001 | GET    | /api/audit-log is set up for retrieving audit entries by user or target")
 
 		if err := as.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			as.log.Sugar().Fatalf("error admin server listening: %v", err)
@@ -0,0 +1,82 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/bricks-cloud/bricksllm/internal/util"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultAuditLimit caps audit log reads that do not ask for a limit.
+const defaultAuditLimit = 100
+
+type AuditManager interface {
+	GetAuditEntries(userID, targetID string, limit int) ([]postgresql.AuditEntry, error)
+}
+
+func getGetAuditEntriesHandler(m AuditManager, prod bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := util.GetLogFromCtx(c)
+		telemetry.Incr("bricksllm.admin.get_get_audit_entries_handler.requests", nil, 1)
+
+		start := time.Now()
+		defer func() {
+			dur := time.Since(start)
+			telemetry.Timing("bricksllm.admin.get_get_audit_entries_handler.latency", dur, nil, 1)
+		}()
+
+		path := "/api/audit-log"
+
+		userID := c.Query("user_id")
+		targetID := c.Query("target_id")
+		if len(userID) == 0 && len(targetID) == 0 {
+			c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Type:     "/errors/missing-filteres",
+				Title:    "filters are not found",
+				Status:   http.StatusBadRequest,
+				Detail:   "user_id or target_id is required for retrieving audit entries.",
+				Instance: path,
+			})
+			return
+		}
+
+		limit := defaultAuditLimit
+		if limitStr, ok := c.GetQuery("limit"); ok {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed <= 0 {
+				c.JSON(http.StatusBadRequest, &ErrorResponse{
+					Type:     "/errors/bad-filters",
+					Title:    "bad limit query param",
+					Status:   http.StatusBadRequest,
+					Detail:   "limit query param must be a positive integer",
+					Instance: path,
+				})
+				return
+			}
+
+			limit = parsed
+		}
+
+		entries, err := m.GetAuditEntries(userID, targetID, limit)
+		if err != nil {
+			telemetry.Incr("bricksllm.admin.get_get_audit_entries_handler.get_audit_entries_err", nil, 1)
+
+			logError(log, "error when getting audit entries", prod, err)
+			c.JSON(http.StatusInternalServerError, &ErrorResponse{
+				Type:     "/errors/getting-audit-entries",
+				Title:    "getting audit entries errored out",
+				Status:   http.StatusInternalServerError,
+				Detail:   err.Error(),
+				Instance: path,
+			})
+			return
+		}
+
+		telemetry.Incr("bricksllm.admin.get_get_audit_entries_handler.success", nil, 1)
+		c.JSON(http.StatusOK, entries)
+	}
+}
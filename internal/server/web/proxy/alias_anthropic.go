@@ -0,0 +1,500 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/bricks-cloud/bricksllm/internal/util"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	anthropicAliasBaseUrl = "https://api.anthropic.com"
+	anthropicAliasVersion = "2023-06-01"
+	// defaultAnthropicMaxTokens fills in max_tokens, which Anthropic requires
+	// and OpenAI clients usually leave out.
+	defaultAnthropicMaxTokens = 4096
+)
+
+// anthropicFinishReasons maps Anthropic stop reasons to OpenAI finish
+// reasons. Unknown ones become "stop".
+var anthropicFinishReasons = map[string]string{
+	"end_turn":      "stop",
+	"stop_sequence": "stop",
+	"max_tokens":    "length",
+	"tool_use":      "tool_calls",
+	"refusal":       "content_filter",
+}
+
+func anthropicFinishReason(stopReason string) string {
+	if reason, ok := anthropicFinishReasons[stopReason]; ok {
+		return reason
+	}
+	return "stop"
+}
+
+// toAnthropicRequest rewrites an OpenAI chat completion request as an
+// Anthropic messages request. System messages become the system prompt, and
+// text and image content parts are carried over along with their
+// cache_control breakpoints. Tools are not translated and are rejected.
+func toAnthropicRequest(body []byte) ([]byte, error) {
+	if !gjson.ValidBytes(body) || !gjson.ParseBytes(body).IsObject() {
+		return nil, errors.New("request body must be a JSON object")
+	}
+	if gjson.GetBytes(body, "tools").Exists() || gjson.GetBytes(body, "functions").Exists() {
+		return nil, errors.New("tools are not supported for anthropic upstreams")
+	}
+
+	system := []string{}
+	messages := []map[string]any{}
+	var err error
+	gjson.GetBytes(body, "messages").ForEach(func(_, m gjson.Result) bool {
+		role := m.Get("role").String()
+		switch role {
+		case "system", "developer":
+			system = append(system, contentText(m.Get("content")))
+		case "user", "assistant":
+			var content any
+			content, err = toAnthropicContent(m.Get("content"))
+			if err != nil {
+				return false
+			}
+			messages = append(messages, map[string]any{"role": role, "content": content})
+		default:
+			err = fmt.Errorf("role %q is not supported for anthropic upstreams", role)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req := map[string]any{
+		"model":      gjson.GetBytes(body, "model").String(),
+		"messages":   messages,
+		"max_tokens": defaultAnthropicMaxTokens,
+	}
+	if len(system) != 0 {
+		req["system"] = strings.Join(system, "\n\n")
+	}
+	for _, key := range []string{"max_completion_tokens", "max_tokens"} {
+		if v := gjson.GetBytes(body, key); v.Exists() {
+			req["max_tokens"] = v.Int()
+			break
+		}
+	}
+	for _, key := range []string{"temperature", "top_p"} {
+		if v := gjson.GetBytes(body, key); v.Exists() {
+			req[key] = v.Float()
+		}
+	}
+	if stop := gjson.GetBytes(body, "stop"); stop.Exists() {
+		sequences := []string{}
+		if stop.IsArray() {
+			stop.ForEach(func(_, s gjson.Result) bool {
+				sequences = append(sequences, s.String())
+				return true
+			})
+		} else if len(stop.String()) != 0 {
+			sequences = append(sequences, stop.String())
+		}
+		if len(sequences) != 0 {
+			req["stop_sequences"] = sequences
+		}
+	}
+	if gjson.GetBytes(body, "stream").Bool() {
+		req["stream"] = true
+	}
+	if user := gjson.GetBytes(body, "user").String(); len(user) != 0 {
+		req["metadata"] = map[string]any{"user_id": user}
+	}
+
+	return json.Marshal(req)
+}
+
+// contentText joins the text of a string or content part array.
+func contentText(content gjson.Result) string {
+	if !content.IsArray() {
+		return content.String()
+	}
+
+	texts := []string{}
+	content.ForEach(func(_, part gjson.Result) bool {
+		if part.Get("type").String() == "text" {
+			texts = append(texts, part.Get("text").String())
+		}
+		return true
+	})
+	return strings.Join(texts, "\n")
+}
+
+func toAnthropicContent(content gjson.Result) (any, error) {
+	if !content.IsArray() {
+		return content.String(), nil
+	}
+
+	blocks := []map[string]any{}
+	var err error
+	content.ForEach(func(_, part gjson.Result) bool {
+		var block map[string]any
+		switch part.Get("type").String() {
+		case "text":
+			block = map[string]any{"type": "text", "text": part.Get("text").String()}
+		case "image_url":
+			url := part.Get("image_url.url").String()
+			if mediaType, data, ok := parseDataUrl(url); ok {
+				block = map[string]any{"type": "image", "source": map[string]any{"type": "base64", "media_type": mediaType, "data": data}}
+			} else {
+				block = map[string]any{"type": "image", "source": map[string]any{"type": "url", "url": url}}
+			}
+		default:
+			err = fmt.Errorf("content part type %q is not supported for anthropic upstreams", part.Get("type").String())
+			return false
+		}
+		// cache breakpoints set by the client pass through as they are
+		if cacheControl := part.Get("cache_control"); cacheControl.IsObject() {
+			block["cache_control"] = json.RawMessage(cacheControl.Raw)
+		}
+		blocks = append(blocks, block)
+		return true
+	})
+
+	return blocks, err
+}
+
+// parseDataUrl splits a base64 data URL, e.g. "data:image/png;base64,...".
+func parseDataUrl(url string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", "", false
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", false
+	}
+	mediaType, ok := strings.CutSuffix(meta, ";base64")
+	return mediaType, data, ok
+}
+
+// fromAnthropicResponse rewrites an Anthropic message as an OpenAI chat
+// completion.
+func fromAnthropicResponse(data []byte) ([]byte, error) {
+	if !gjson.ValidBytes(data) {
+		return nil, errors.New("anthropic response is not valid JSON")
+	}
+
+	msg := gjson.ParseBytes(data)
+	promptTokens := int(msg.Get("usage.input_tokens").Int())
+	completionTokens := int(msg.Get("usage.output_tokens").Int())
+
+	return json.Marshal(map[string]any{
+		"id":      msg.Get("id").String(),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   msg.Get("model").String(),
+		"choices": []any{
+			map[string]any{
+				"index":         0,
+				"message":       map[string]any{"role": "assistant", "content": contentText(msg.Get("content"))},
+				"finish_reason": anthropicFinishReason(msg.Get("stop_reason").String()),
+			},
+		},
+		"usage": map[string]any{
+			"prompt_tokens":     promptTokens,
+			"completion_tokens": completionTokens,
+			"total_tokens":      promptTokens + completionTokens,
+		},
+	})
+}
+
+// fromAnthropicError rewrites an Anthropic error body in the OpenAI error
+// shape, keeping the body as the message when it is not an Anthropic error.
+func fromAnthropicError(data []byte) []byte {
+	message := gjson.GetBytes(data, "error.message").String()
+	typ := gjson.GetBytes(data, "error.type").String()
+	if len(message) == 0 {
+		message = string(data)
+	}
+	if len(typ) == 0 {
+		typ = "upstream_error"
+	}
+
+	res, _ := json.Marshal(map[string]any{
+		"error": map[string]any{"message": message, "type": typ, "code": nil},
+	})
+	return res
+}
+
+// anthropicStreamTranslator turns the events of an Anthropic messages
+// stream into OpenAI chat.completion.chunk events.
+type anthropicStreamTranslator struct {
+	includeUsage     bool
+	created          int64
+	id               string
+	model            string
+	promptTokens     int
+	completionTokens int
+}
+
+// chunk renders a chat.completion.chunk with one choice.
+func (t *anthropicStreamTranslator) chunk(delta map[string]any, finishReason any) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"id":      t.id,
+		"object":  "chat.completion.chunk",
+		"created": t.created,
+		"model":   t.model,
+		"choices": []any{
+			map[string]any{"index": 0, "delta": delta, "finish_reason": finishReason},
+		},
+	})
+	return sseData(data)
+}
+
+func sseData(data []byte) []byte {
+	return append(append([]byte("data: "), data...), '\n', '\n')
+}
+
+// translate returns the OpenAI events for one Anthropic event, and whether
+// the stream is over.
+func (t *anthropicStreamTranslator) translate(event string, data []byte) ([][]byte, bool) {
+	switch event {
+	case "message_start":
+		t.id = gjson.GetBytes(data, "message.id").String()
+		t.model = gjson.GetBytes(data, "message.model").String()
+		t.promptTokens = int(gjson.GetBytes(data, "message.usage.input_tokens").Int())
+		t.completionTokens = int(gjson.GetBytes(data, "message.usage.output_tokens").Int())
+		return [][]byte{t.chunk(map[string]any{"role": "assistant", "content": ""}, nil)}, false
+	case "content_block_delta":
+		if gjson.GetBytes(data, "delta.type").String() != "text_delta" {
+			return nil, false
+		}
+		return [][]byte{t.chunk(map[string]any{"content": gjson.GetBytes(data, "delta.text").String()}, nil)}, false
+	case "message_delta":
+		if usage := gjson.GetBytes(data, "usage.output_tokens"); usage.Exists() {
+			t.completionTokens = int(usage.Int())
+		}
+		stopReason := gjson.GetBytes(data, "delta.stop_reason").String()
+		if len(stopReason) == 0 {
+			return nil, false
+		}
+		return [][]byte{t.chunk(map[string]any{}, anthropicFinishReason(stopReason))}, false
+	case "message_stop":
+		events := [][]byte{}
+		if t.includeUsage {
+			usage, _ := json.Marshal(map[string]any{
+				"id":      t.id,
+				"object":  "chat.completion.chunk",
+				"created": t.created,
+				"model":   t.model,
+				"choices": []any{},
+				"usage": map[string]any{
+					"prompt_tokens":     t.promptTokens,
+					"completion_tokens": t.completionTokens,
+					"total_tokens":      t.promptTokens + t.completionTokens,
+				},
+			})
+			events = append(events, sseData(usage))
+		}
+		return append(events, append(append([]byte{}, doneEvent...), '\n', '\n')), true
+	case "error":
+		return [][]byte{sseData(fromAnthropicError(data))}, true
+	}
+
+	// ping, content_block_start and content_block_stop carry nothing to relay
+	return nil, false
+}
+
+// translateAnthropicStream reads an Anthropic SSE body and writes its
+// OpenAI translation to w, flushing after every event. Read errors are
+// wrapped in streamReadError, as relayAliasStream does.
+func translateAnthropicStream(w io.Writer, body io.Reader, t *anthropicStreamTranslator) error {
+	flusher, _ := w.(http.Flusher)
+	reader := bufio.NewReader(body)
+	event := ""
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		line = bytes.TrimRight(line, "\r\n")
+
+		if name, ok := bytes.CutPrefix(line, []byte("event:")); ok {
+			event = string(bytes.TrimSpace(name))
+		} else if data, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			events, done := t.translate(event, bytes.TrimSpace(data))
+			for _, e := range events {
+				if _, werr := w.Write(e); werr != nil {
+					return werr
+				}
+			}
+			if flusher != nil && len(events) != 0 {
+				flusher.Flush()
+			}
+			if done {
+				return nil
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// a stream without message_stop was cut off
+				return &streamReadError{err: io.ErrUnexpectedEOF}
+			}
+			return &streamReadError{err: err}
+		}
+	}
+}
+
+// anthropicAliasUpstream is the configured Anthropic base URL, defaulting to
+// Anthropic's API.
+func anthropicAliasUpstream(cfg AliasConfig) string {
+	if u := strings.TrimRight(strings.TrimSpace(cfg.AnthropicBaseUrl), "/"); len(u) != 0 {
+		return u
+	}
+	return anthropicAliasBaseUrl
+}
+
+// setAnthropicAuth moves a bearer token to x-api-key, which is where
+// Anthropic expects it, and pins the API version unless the client chose
+// one.
+func setAnthropicAuth(req *http.Request) {
+	if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok && len(req.Header.Get("x-api-key")) == 0 {
+		req.Header.Set("x-api-key", token)
+	}
+	req.Header.Del("Authorization")
+	if len(req.Header.Get("anthropic-version")) == 0 {
+		req.Header.Set("anthropic-version", anthropicAliasVersion)
+	}
+}
+
+// getAnthropicChatCompletionAliasHandler serves OpenAI chat completions from
+// Anthropic's messages API, so OpenAI SDK clients can use Claude models.
+// Requests, replies, errors and streams are translated both ways.
+func getAnthropicChatCompletionAliasHandler(prod bool, client http.Client, baseUrl string, cfg AliasConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := util.GetLogFromCtx(c)
+		telemetry.Incr("bricksllm.proxy.anthropic_chat_completion_alias.requests", requestIdTags(c), 1)
+
+		if c == nil || c.Request == nil {
+			JSON(c, http.StatusInternalServerError, "[BricksLLM] context is empty")
+			return
+		}
+
+		limitAliasBody(c, cfg)
+		body, err := io.ReadAll(c.Request.Body)
+		if isBodyTooLarge(err) {
+			JSON(c, http.StatusRequestEntityTooLarge, "[BricksLLM] request body is too large")
+			return
+		}
+		if err != nil {
+			logError(log, "error when reading anthropic chat completion alias request body", prod, err)
+			JSON(c, http.StatusBadRequest, "[BricksLLM] failed to read request body")
+			return
+		}
+
+		if !checkAllowedModel(c, body, cfg.AllowedModels) {
+			return
+		}
+
+		upstreamBody, err := toAnthropicRequest(body)
+		if err != nil {
+			JSON(c, http.StatusBadRequest, "[BricksLLM] "+err.Error())
+			return
+		}
+
+		if cfg.AnthropicPromptCaching {
+			upstreamBody, err = markSystemPromptCacheable(upstreamBody)
+			if err != nil {
+				logError(log, "error when marking anthropic system prompt cacheable", prod, err)
+				JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to mark system prompt cacheable")
+				return
+			}
+		}
+
+		isStreaming := gjson.GetBytes(body, "stream").Bool()
+		applyModelTimeout(c, cfg.modelTimeouts, gjson.GetBytes(body, "model").String())
+		ctx, cancel := aliasRequestContext(c, isStreaming)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseUrl+"/v1/messages", bytes.NewReader(upstreamBody))
+		if err != nil {
+			logError(log, "error when creating anthropic chat completion alias http request", prod, err)
+			JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to create anthropic chat completion alias http request")
+			return
+		}
+
+		copyHttpHeaders(c.Request, req, c.GetBool("removeUserAgent"))
+		forwardRequestId(c, req)
+		setAnthropicAuth(req)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Del("Accept-Encoding")
+		if isStreaming {
+			req.Header.Set("Accept", "text/event-stream")
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			logError(log, "error when sending http request to anthropic chat completion alias upstream", prod, err)
+			JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to send http request to anthropic chat completion alias upstream")
+			return
+		}
+		defer res.Body.Close()
+
+		resBody, err := decodedAliasBody(res)
+		if err != nil {
+			logError(log, "error when decoding anthropic chat completion alias response body", prod, err)
+			JSON(c, http.StatusBadGateway, "[BricksLLM] failed to decode anthropic chat completion alias response body")
+			return
+		}
+		defer resBody.Close()
+
+		if res.StatusCode != http.StatusOK {
+			telemetry.Incr("bricksllm.proxy.anthropic_chat_completion_alias.error_response", nil, 1)
+			data, _ := io.ReadAll(resBody)
+			c.Data(res.StatusCode, "application/json", fromAnthropicError(data))
+			return
+		}
+
+		if isStreaming {
+			c.Header("Content-Type", "text/event-stream")
+			c.Header("Cache-Control", "no-cache")
+			c.Status(http.StatusOK)
+
+			t := &anthropicStreamTranslator{
+				includeUsage: gjson.GetBytes(body, "stream_options.include_usage").Bool(),
+				created:      time.Now().Unix(),
+			}
+			if err := translateAnthropicStream(c.Writer, resBody, t); err != nil {
+				logError(log, "error when translating anthropic chat completion alias stream", prod, err)
+				writeStreamErrorEvent(c.Writer, ctx, err)
+			}
+			c.Set("promptTokenCount", t.promptTokens)
+			c.Set("completionTokenCount", t.completionTokens)
+			return
+		}
+
+		data, err := io.ReadAll(resBody)
+		if err != nil {
+			logError(log, "error when reading anthropic chat completion alias response body", prod, err)
+			JSON(c, http.StatusBadGateway, "[BricksLLM] failed to read anthropic chat completion alias response body")
+			return
+		}
+		translated, err := fromAnthropicResponse(data)
+		if err != nil {
+			logError(log, "error when translating anthropic chat completion alias response", prod, err)
+			JSON(c, http.StatusBadGateway, "[BricksLLM] failed to translate anthropic chat completion alias response")
+			return
+		}
+		c.Set("promptTokenCount", int(gjson.GetBytes(data, "usage.input_tokens").Int()))
+		c.Set("completionTokenCount", int(gjson.GetBytes(data, "usage.output_tokens").Int()))
+		c.Data(http.StatusOK, "application/json", translated)
+	}
+}
@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// translatedStream sums up the OpenAI events written for an Anthropic
+// stream.
+type translatedStream struct {
+	role         string
+	content      string
+	finishReason string
+	totalTokens  int64
+	errorType    string
+	done         bool
+}
+
+func parseTranslatedStream(t *testing.T, body string) translatedStream {
+	t.Helper()
+
+	res := translatedStream{}
+	for _, event := range strings.Split(body, "\n\n") {
+		data, ok := strings.CutPrefix(strings.TrimSpace(event), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			res.done = true
+			continue
+		}
+		if !gjson.Valid(data) {
+			t.Fatalf("invalid event data %s", data)
+		}
+
+		chunk := gjson.Parse(data)
+		if chunk.Get("error").Exists() {
+			res.errorType = chunk.Get("error.type").String()
+			continue
+		}
+		if chunk.Get("object").String() != "chat.completion.chunk" || len(chunk.Get("id").String()) == 0 {
+			t.Fatalf("unexpected chunk %s", data)
+		}
+		if role := chunk.Get("choices.0.delta.role").String(); len(role) != 0 {
+			res.role = role
+		}
+		res.content += chunk.Get("choices.0.delta.content").String()
+		if reason := chunk.Get("choices.0.finish_reason").String(); len(reason) != 0 {
+			res.finishReason = reason
+		}
+		if usage := chunk.Get("usage.total_tokens"); usage.Exists() {
+			res.totalTokens = usage.Int()
+		}
+	}
+	return res
+}
+
+func TestAnthropicChatCompletionAliasHandler_Stream(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		body     string
+		expected translatedStream
+	}{
+		{
+			name:     "text reply",
+			fixture:  "testdata/anthropic_stream_text.sse",
+			body:     `{"model":"claude-3-5-sonnet-20241022","stream":true,"messages":[{"role":"user","content":"hi"}]}`,
+			expected: translatedStream{role: "assistant", content: "Hello, שלום!", finishReason: "stop", done: true},
+		},
+		{
+			name:     "text reply with usage",
+			fixture:  "testdata/anthropic_stream_text.sse",
+			body:     `{"model":"claude-3-5-sonnet-20241022","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`,
+			expected: translatedStream{role: "assistant", content: "Hello, שלום!", finishReason: "stop", totalTokens: 40, done: true},
+		},
+		{
+			name:     "reply cut at max tokens",
+			fixture:  "testdata/anthropic_stream_max_tokens.sse",
+			body:     `{"model":"claude-3-haiku-20240307","stream":true,"max_tokens":2,"messages":[{"role":"user","content":"tell me a story"}]}`,
+			expected: translatedStream{role: "assistant", content: "Once upon", finishReason: "length", done: true},
+		},
+		{
+			name:     "error mid stream",
+			fixture:  "testdata/anthropic_stream_error.sse",
+			body:     `{"model":"claude-3-5-sonnet-20241022","stream":true,"messages":[{"role":"user","content":"hi"}]}`,
+			expected: translatedStream{role: "assistant", content: "Partial", errorType: "overloaded_error"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorded, err := os.ReadFile(tt.fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var upstreamReq *http.Request
+			var upstreamBody []byte
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamReq = r
+				upstreamBody, _ = io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Write(recorded)
+			}))
+			defer upstream.Close()
+
+			router := newAliasTestRouter(http.MethodPost, "/v1/anthropic/chat/completions", getAnthropicChatCompletionAliasHandler(false, http.Client{}, upstream.URL, AliasConfig{}))
+			req := httptest.NewRequest(http.MethodPost, "/v1/anthropic/chat/completions", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer sk-ant-test")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if upstreamReq.URL.Path != "/v1/messages" || upstreamReq.Header.Get("x-api-key") != "sk-ant-test" || upstreamReq.Header.Get("anthropic-version") != anthropicAliasVersion {
+				t.Fatalf("unexpected upstream request %s %v", upstreamReq.URL.Path, upstreamReq.Header)
+			}
+			if !gjson.GetBytes(upstreamBody, "stream").Bool() {
+				t.Fatalf("expected the upstream request to stream, got %s", upstreamBody)
+			}
+			if got := parseTranslatedStream(t, rec.Body.String()); got != tt.expected {
+				t.Fatalf("expected stream %+v, got %+v\n%s", tt.expected, got, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAnthropicChatCompletionAliasHandler_NonStreaming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_01","type":"message","role":"assistant","model":"claude-3-5-sonnet-20241022","content":[{"type":"text","text":"Hi there"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":3}}`))
+	}))
+	defer upstream.Close()
+
+	router := newAliasTestRouter(http.MethodPost, "/v1/anthropic/chat/completions", getAnthropicChatCompletionAliasHandler(false, http.Client{}, upstream.URL, AliasConfig{}))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/anthropic/chat/completions", strings.NewReader(`{"model":"claude-3-5-sonnet-20241022","messages":[{"role":"user","content":"hi"}]}`)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	res := gjson.Parse(rec.Body.String())
+	if res.Get("object").String() != "chat.completion" || res.Get("choices.0.message.content").String() != "Hi there" || res.Get("choices.0.finish_reason").String() != "stop" || res.Get("usage.total_tokens").Int() != 13 {
+		t.Fatalf("unexpected completion %s", rec.Body.String())
+	}
+}
+
+func TestAnthropicChatCompletionAliasHandler_Errors(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"type":"error","error":{"type":"rate_limit_error","message":"Number of request tokens has exceeded your per-minute rate limit"}}`))
+	}))
+	defer upstream.Close()
+
+	router := newAliasTestRouter(http.MethodPost, "/v1/anthropic/chat/completions", getAnthropicChatCompletionAliasHandler(false, http.Client{}, upstream.URL, AliasConfig{}))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/anthropic/chat/completions", strings.NewReader(`{"model":"claude-3-5-sonnet-20241022","messages":[{"role":"user","content":"hi"}]}`)))
+	if rec.Code != http.StatusTooManyRequests || gjson.Get(rec.Body.String(), "error.type").String() != "rate_limit_error" {
+		t.Fatalf("expected the translated 429, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/anthropic/chat/completions", strings.NewReader(`{"model":"claude-3-5-sonnet-20241022","messages":[{"role":"tool","content":"42"}]}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected tool messages to be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestToAnthropicRequest(t *testing.T) {
+	body := `{
+		"model": "claude-3-5-sonnet-20241022",
+		"max_completion_tokens": 256,
+		"temperature": 0.2,
+		"stop": "END",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "What is this?"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0KGgo="}}]},
+			{"role": "assistant", "content": "A logo."},
+			{"role": "user", "content": "Thanks"}
+		]
+	}`
+
+	req, err := toAnthropicRequest([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"system":                                 "Be brief.",
+		"max_tokens":                             "256",
+		"temperature":                            "0.2",
+		"stop_sequences.0":                       "END",
+		"messages.#":                             "3",
+		"messages.0.content.0.text":              "What is this?",
+		"messages.0.content.1.source.type":       "base64",
+		"messages.0.content.1.source.media_type": "image/png",
+		"messages.1.role":                        "assistant",
+		"messages.2.content":                     "Thanks",
+	}
+	for path, value := range expected {
+		if got := gjson.GetBytes(req, path).String(); got != value {
+			t.Fatalf("expected %s to be %q, got %q in %s", path, value, got, req)
+		}
+	}
+
+	req, err = toAnthropicRequest([]byte(`{"model":"claude-3-5-sonnet-20241022","messages":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gjson.GetBytes(req, "max_tokens").Int() != defaultAnthropicMaxTokens {
+		t.Fatalf("expected the default max_tokens, got %s", req)
+	}
+
+	if _, err := toAnthropicRequest([]byte(`{"model":"claude-3-5-sonnet-20241022","tools":[],"messages":[]}`)); err == nil {
+		t.Fatal("expected tools to be rejected")
+	}
+}
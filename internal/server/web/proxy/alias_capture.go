@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/tidwall/gjson"
+)
+
+// aliasChoice is one of the replies of a completion requested with n > 1.
+type aliasChoice struct {
+	content      string
+	finishReason string
+}
+
+// aliasCompletion is what the alias handlers recover from an upstream chat
+// completion, whether it arrived as a single JSON body or as an SSE stream.
+// content and finishReason are those of choice 0; variants holds choices 1
+// and up, by index, when more than one was requested.
+type aliasCompletion struct {
+	content          string
+	promptTokens     int
+	completionTokens int
+	hasUsage         bool
+	estimated        bool
+	finishReason     string
+	variants         []aliasChoice
+}
+
+// maxAliasChoices bounds the choices kept from one completion, matching the
+// largest n OpenAI accepts.
+const maxAliasChoices = 128
+
+// setChoice records the choice at index, growing variants as needed.
+func (ac *aliasCompletion) setChoice(index int, choice aliasChoice) {
+	if index >= maxAliasChoices {
+		return
+	}
+	if index == 0 {
+		ac.content = choice.content
+		ac.finishReason = choice.finishReason
+		return
+	}
+	for len(ac.variants) < index {
+		ac.variants = append(ac.variants, aliasChoice{})
+	}
+	ac.variants[index-1] = choice
+}
+
+// estimateUsage fills in token counts from the request and the assembled
+// reply when the upstream did not report usage itself.
+func (ac *aliasCompletion) estimateUsage(request []byte) {
+	if ac.hasUsage {
+		return
+	}
+
+	ac.promptTokens = estimatePromptTokens(request)
+	ac.completionTokens = estimateTokens(ac.content)
+	for _, v := range ac.variants {
+		ac.completionTokens += estimateTokens(v.content)
+	}
+	ac.estimated = true
+}
+
+func parseAliasCompletion(body []byte, streaming bool) aliasCompletion {
+	if !streaming {
+		usage := gjson.GetBytes(body, "usage")
+		res := aliasCompletion{
+			promptTokens:     int(usage.Get("prompt_tokens").Int()),
+			completionTokens: int(usage.Get("completion_tokens").Int()),
+			hasUsage:         usage.IsObject(),
+		}
+		for i, choice := range gjson.GetBytes(body, "choices").Array() {
+			res.setChoice(choiceIndex(choice, i), aliasChoice{
+				content:      choice.Get("message.content").String(),
+				finishReason: choice.Get("finish_reason").String(),
+			})
+		}
+		return res
+	}
+
+	res := aliasCompletion{}
+	contents := map[int]*strings.Builder{}
+	reasons := map[int]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if !bytes.HasPrefix(line, headerData) {
+			continue
+		}
+
+		data := bytes.TrimSpace(bytes.TrimPrefix(line, headerData))
+		if !gjson.ValidBytes(data) {
+			continue
+		}
+
+		for i, choice := range gjson.GetBytes(data, "choices").Array() {
+			index := choiceIndex(choice, i)
+			content, ok := contents[index]
+			if !ok {
+				content = &strings.Builder{}
+				contents[index] = content
+			}
+			content.WriteString(choice.Get("delta.content").String())
+			if reason := choice.Get("finish_reason").String(); len(reason) != 0 {
+				reasons[index] = reason
+			}
+		}
+
+		usage := gjson.GetBytes(data, "usage")
+		if usage.IsObject() {
+			res.hasUsage = true
+			res.estimated = usage.Get("estimated").Bool()
+			res.promptTokens = int(usage.Get("prompt_tokens").Int())
+			res.completionTokens = int(usage.Get("completion_tokens").Int())
+		}
+	}
+
+	for index, content := range contents {
+		res.setChoice(index, aliasChoice{content: content.String(), finishReason: reasons[index]})
+	}
+	return res
+}
+
+// choiceIndex is the index a choice reports, or its position when it has
+// none.
+func choiceIndex(choice gjson.Result, position int) int {
+	if index := choice.Get("index"); index.Exists() && index.Int() >= 0 {
+		return int(index.Int())
+	}
+	return position
+}
+
+// lastUserMessage returns the content of the final user turn in a chat
+// completion request body.
+func lastUserMessage(body []byte) (string, bool) {
+	users := gjson.GetBytes(body, `messages.#(role=="user")#`).Array()
+	if len(users) == 0 {
+		return "", false
+	}
+
+	return users[len(users)-1].Get("content").String(), true
+}
+
+// newTurnMessages returns the messages a client appended since the last
+// assistant reply, i.e. the user prompt and any tool or function results
+// answering the assistant's calls.
+func newTurnMessages(body []byte) []postgresql.Message {
+	messages := gjson.GetBytes(body, "messages").Array()
+	start := 0
+	for i, m := range messages {
+		if m.Get("role").String() == "assistant" {
+			start = i + 1
+		}
+	}
+
+	res := []postgresql.Message{}
+	for _, m := range messages[start:] {
+		role := m.Get("role").String()
+		if role != "user" && role != "tool" && role != "function" {
+			continue
+		}
+
+		content := m.Get("content")
+		text := content.String()
+		var parts json.RawMessage
+		if content.IsArray() {
+			parts = json.RawMessage(content.Raw)
+			text = postgresql.ContentText(parts)
+		} else if content.IsObject() {
+			text = content.Raw
+		}
+
+		msg := newConversationMessage("", role, text)
+		msg.ContentJSON = parts
+		msg.Name = m.Get("name").String()
+		msg.ToolCallID = m.Get("tool_call_id").String()
+		res = append(res, msg)
+	}
+
+	return res
+}
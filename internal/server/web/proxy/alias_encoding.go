@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// decodedAliasBody returns the upstream body with any gzip or deflate
+// encoding removed, and drops the encoding headers so they are not copied
+// onto the identity encoded reply. The alias handlers parse upstream bodies
+// for persistence and logging, and SSE must never reach clients compressed,
+// so they always re-serve plain bodies. Unknown encodings pass through
+// untouched together with their headers.
+func decodedAliasBody(res *http.Response) (io.ReadCloser, error) {
+	var decoded io.ReadCloser
+	switch strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		decoded = zr
+	case "deflate":
+		zr, err := zlib.NewReader(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		decoded = zr
+	default:
+		return res.Body, nil
+	}
+
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	return decoded, nil
+}
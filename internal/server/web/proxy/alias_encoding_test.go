@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+)
+
+func encodeBody(t *testing.T, encoding string, body []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(buf)
+	case "deflate":
+		w = zlib.NewWriter(buf)
+	default:
+		return body
+	}
+
+	if _, err := w.Write(body); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestChatCompletionAliasHandler_DecodesCompressedUpstreams(t *testing.T) {
+	plain := `{"choices":[{"message":{"role":"assistant","content":"שלום!"}}]}`
+	sse := "data: {\"choices\":[{\"delta\":{\"content\":\"שלום!\"}}]}\n\ndata: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":2}}\n\ndata: [DONE]\n\n"
+
+	tests := []struct {
+		name     string
+		encoding string
+		stream   bool
+	}{
+		{name: "uncompressed"},
+		{name: "gzip", encoding: "gzip"},
+		{name: "deflate", encoding: "deflate"},
+		{name: "uncompressed stream", stream: true},
+		{name: "gzip stream", encoding: "gzip", stream: true},
+		{name: "deflate stream", encoding: "deflate", stream: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := plain
+			contentType := "application/json"
+			if tt.stream {
+				response = sse
+				contentType = "text/event-stream"
+			}
+
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", contentType)
+				if len(tt.encoding) != 0 {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(encodeBody(t, tt.encoding, []byte(response)))
+			}))
+			defer upstream.Close()
+
+			store := &persistingStore{conv: postgresql.Conversation{ID: "conv-1"}}
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{}))
+
+			body := `{"model":"default","stream":` + strconv.FormatBool(tt.stream) + `,"messages":[{"role":"user","content":"hi"}]}`
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set(conversationIdHeader, "conv-1")
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if ce := rec.Header().Get("Content-Encoding"); len(ce) != 0 {
+				t.Fatalf("expected the reply to be served without an encoding, got %s", ce)
+			}
+			if !strings.Contains(rec.Body.String(), "שלום!") {
+				t.Fatalf("expected a plain reply, got %q", rec.Body.String())
+			}
+			if len(store.messages) != 2 || store.messages[1].Content != "שלום!" {
+				t.Fatalf("expected the decoded reply to be persisted, got %+v", store.messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// maxErrorPageBytes is how much of a non-JSON error reply is read.
+	maxErrorPageBytes = 64 << 10
+	// maxErrorPageSnippet is how much of it is quoted in the error message.
+	maxErrorPageSnippet = 300
+)
+
+// isJSONMediaType accepts application/json and the +json types.
+func isJSONMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// wrapNonJSONErrorReply replaces an error reply that is not JSON, such as
+// the HTML page of a load balancer in front of the upstream, with the
+// OpenAI error envelope SDKs know how to parse. The page is quoted,
+// truncated, in the message. Other replies are returned as they are.
+func wrapNonJSONErrorReply(res *http.Response, body io.ReadCloser) (io.ReadCloser, error) {
+	if res.StatusCode < http.StatusBadRequest || isJSONMediaType(res.Header.Get("Content-Type")) {
+		return body, nil
+	}
+
+	page, err := io.ReadAll(io.LimitReader(body, maxErrorPageBytes))
+	if err != nil {
+		return nil, err
+	}
+	// no content type at all may still be JSON
+	if len(res.Header.Get("Content-Type")) == 0 && gjson.ValidBytes(page) {
+		return io.NopCloser(bytes.NewReader(page)), nil
+	}
+
+	telemetry.Incr("bricksllm.proxy.alias.non_json_error_reply", []string{"status:" + strconv.Itoa(res.StatusCode)}, 1)
+
+	data, err := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"message": fmt.Sprintf("[BricksLLM] upstream replied with a non-JSON %d error: %s", res.StatusCode, errorPageSnippet(page)),
+			"type":    "upstream_error",
+			"code":    strconv.Itoa(res.StatusCode),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res.Header.Set("Content-Type", "application/json")
+	res.Header.Del("Content-Length")
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// errorPageSnippet collapses the whitespace of page and cuts it down to
+// maxErrorPageSnippet bytes without splitting a rune.
+func errorPageSnippet(page []byte) string {
+	snippet := strings.Join(strings.Fields(string(page)), " ")
+	if len(snippet) <= maxErrorPageSnippet {
+		return snippet
+	}
+
+	cut := maxErrorPageSnippet
+	for cut > 0 && !utf8.RuneStart(snippet[cut]) {
+		cut--
+	}
+	return snippet[:cut] + "..."
+}
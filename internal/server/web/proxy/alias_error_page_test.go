@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+const badGatewayPage = `<html>
+<head><title>502 Bad Gateway</title></head>
+<body>
+<center><h1>502 Bad Gateway</h1></center>
+<hr><center>nginx/1.25.3</center>
+</body>
+</html>`
+
+func TestChatCompletionAliasHandler_NonJSONErrorReply(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		contentType     string
+		body            string
+		expectedMessage string
+		expectedBody    string
+	}{
+		{
+			name:            "html 502 is wrapped",
+			status:          http.StatusBadGateway,
+			contentType:     "text/html",
+			body:            badGatewayPage,
+			expectedMessage: "[BricksLLM] upstream replied with a non-JSON 502 error: <html> <head><title>502 Bad Gateway</title></head>",
+		},
+		{
+			name:            "long pages are truncated",
+			status:          http.StatusServiceUnavailable,
+			contentType:     "text/html; charset=utf-8",
+			body:            "<p>" + strings.Repeat("שלום ", 200) + "</p>",
+			expectedMessage: "[BricksLLM] upstream replied with a non-JSON 503 error: <p>שלום",
+		},
+		{
+			name:         "json errors are forwarded",
+			status:       http.StatusTooManyRequests,
+			contentType:  "application/json",
+			body:         `{"error":{"message":"slow down"}}`,
+			expectedBody: `{"error":{"message":"slow down"}}`,
+		},
+		{
+			name:         "json errors without a content type are forwarded",
+			status:       http.StatusBadRequest,
+			body:         `{"error":{"message":"bad request"}}`,
+			expectedBody: `{"error":{"message":"bad request"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if len(tt.contentType) != 0 {
+					w.Header().Set("Content-Type", tt.contentType)
+				} else {
+					w.Header()["Content-Type"] = nil
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer upstream.Close()
+
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, AliasConfig{}))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[]}`)))
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if len(tt.expectedBody) != 0 {
+				if rec.Body.String() != tt.expectedBody {
+					t.Fatalf("expected %s to be forwarded, got %s", tt.expectedBody, rec.Body.String())
+				}
+				return
+			}
+
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("expected a JSON content type, got %s", ct)
+			}
+			message := gjson.Get(rec.Body.String(), "error.message").String()
+			if !strings.HasPrefix(message, tt.expectedMessage) {
+				t.Fatalf("expected message to start with %q, got %q", tt.expectedMessage, message)
+			}
+			if len(message) > len("[BricksLLM] upstream replied with a non-JSON 503 error: ")+maxErrorPageSnippet+len("...") {
+				t.Fatalf("expected the page to be truncated, got %d bytes", len(message))
+			}
+			if gjson.Get(rec.Body.String(), "error.type").String() != "upstream_error" {
+				t.Fatalf("expected an upstream_error, got %s", rec.Body.String())
+			}
+		})
+	}
+}
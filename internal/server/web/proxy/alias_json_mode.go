@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/tidwall/gjson"
+)
+
+// jsonModeRequested reports whether a chat completion request asks for a
+// JSON reply through response_format.
+func jsonModeRequested(body []byte) bool {
+	switch gjson.GetBytes(body, "response_format.type").String() {
+	case "json_object", "json_schema":
+		return true
+	}
+	return false
+}
+
+// validJSONModeReply reports whether the content of every choice of a
+// non-streaming chat completion parses as JSON. Choices that only carry tool
+// calls have no content to check.
+func validJSONModeReply(data []byte) bool {
+	choices := gjson.GetBytes(data, "choices").Array()
+	if len(choices) == 0 {
+		return false
+	}
+
+	for _, choice := range choices {
+		content := choice.Get("message.content")
+		if content.Type == gjson.Null && choice.Get("message.tool_calls").IsArray() {
+			continue
+		}
+		if !gjson.Valid(strings.TrimSpace(content.String())) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// retryJSONModeReply reads a JSON mode reply and, while its content does not
+// parse as JSON, sends the request again up to retries more times. It
+// returns the last response together with its body, already read and
+// closed, and whether that body is valid. Non 200 replies are returned for
+// the caller to relay, resent ones with their error pages wrapped the way
+// wrapNonJSONErrorReply wraps the first.
+func retryJSONModeReply(resend func() (*http.Response, error), res *http.Response, body io.ReadCloser, retries int) (*http.Response, []byte, bool, error) {
+	for attempt := 0; ; attempt++ {
+		data, err := io.ReadAll(body)
+		body.Close()
+		res.Body.Close()
+		if err != nil {
+			return res, nil, false, err
+		}
+
+		if res.StatusCode != http.StatusOK || validJSONModeReply(data) {
+			return res, data, true, nil
+		}
+
+		if attempt >= retries {
+			return res, data, false, nil
+		}
+
+		telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.json_mode_retry", nil, 1)
+		res, err = resend()
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		body, err = decodedAliasBody(res)
+		if err != nil {
+			res.Body.Close()
+			return nil, nil, false, err
+		}
+
+		body, err = wrapNonJSONErrorReply(res, body)
+		if err != nil {
+			res.Body.Close()
+			return nil, nil, false, err
+		}
+	}
+}
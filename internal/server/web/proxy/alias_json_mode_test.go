@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestChatCompletionAliasHandler_JSONMode(t *testing.T) {
+	const (
+		jsonMode = `{"model":"gpt-4o-mini","response_format":{"type":"json_object"},"messages":[]}`
+		valid    = `{"choices":[{"message":{"role":"assistant","content":"{\"ok\":true}"},"finish_reason":"stop"}]}`
+		invalid  = `{"choices":[{"message":{"role":"assistant","content":"sure! {\"ok\":true}"},"finish_reason":"stop"}]}`
+	)
+
+	tests := []struct {
+		name           string
+		body           string
+		retries        int
+		replies        []string
+		status         int
+		expectedStatus int
+		expectedCalls  int
+	}{
+		{
+			name:           "valid reply",
+			body:           jsonMode,
+			retries:        1,
+			replies:        []string{valid},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  1,
+		},
+		{
+			name:           "invalid reply is retried",
+			body:           jsonMode,
+			retries:        1,
+			replies:        []string{invalid, valid},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  2,
+		},
+		{
+			name:           "retries exhausted",
+			body:           jsonMode,
+			retries:        1,
+			replies:        []string{invalid, invalid},
+			expectedStatus: http.StatusBadGateway,
+			expectedCalls:  2,
+		},
+		{
+			name:           "retries disabled",
+			body:           jsonMode,
+			replies:        []string{invalid},
+			expectedStatus: http.StatusBadGateway,
+			expectedCalls:  1,
+		},
+		{
+			name:           "json mode not requested",
+			body:           `{"model":"gpt-4o-mini","messages":[]}`,
+			retries:        1,
+			replies:        []string{invalid},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  1,
+		},
+		{
+			name:           "upstream error is relayed",
+			body:           jsonMode,
+			retries:        1,
+			replies:        []string{`{"error":{"message":"bad request"}}`},
+			status:         http.StatusBadRequest,
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reply := tt.replies[len(tt.replies)-1]
+				if calls < len(tt.replies) {
+					reply = tt.replies[calls]
+				}
+				calls++
+
+				w.Header().Set("Content-Type", "application/json")
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				w.Write([]byte(reply))
+			}))
+			defer upstream.Close()
+
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, AliasConfig{JSONModeRetries: tt.retries}))
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if calls != tt.expectedCalls {
+				t.Fatalf("expected %d upstream calls, got %d", tt.expectedCalls, calls)
+			}
+			if tt.expectedStatus == http.StatusOK && tt.expectedCalls == 2 && rec.Body.String() != valid {
+				t.Fatalf("expected the retried reply to be relayed, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestChatCompletionAliasHandler_JSONModeRetryErrorPage(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"not json"},"finish_reason":"stop"}]}`))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("<html><body><h1>502 Bad Gateway</h1></body></html>"))
+	}))
+	defer upstream.Close()
+
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, AliasConfig{JSONModeRetries: 1}))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o-mini","response_format":{"type":"json_object"},"messages":[]}`)))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected status 502, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("expected the resent error page to be wrapped as JSON, got %s", ct)
+	}
+	if msg := gjson.Get(rec.Body.String(), "error.message").String(); !strings.Contains(msg, "502 Bad Gateway") {
+		t.Fatalf("expected the error page in the wrapped message, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const aliasLogMaxContentLength = 256
+
+var redactedHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"x-api-key":           true,
+	"api-key":             true,
+	"cookie":              true,
+}
+
+type aliasExchange struct {
+	method       string
+	path         string
+	header       http.Header
+	request      []byte
+	response     []byte
+	status       int
+	duration     time.Duration
+	streaming    bool
+	conversation string
+}
+
+func truncateContent(content string, limit int) string {
+	runes := []rune(content)
+	if limit <= 0 || len(runes) <= limit {
+		return content
+	}
+
+	return string(runes[:limit]) + "..."
+}
+
+func logAliasExchange(log *zap.Logger, private bool, ex *aliasExchange) {
+	completion := parseAliasCompletion(ex.response, ex.streaming)
+
+	fields := []zap.Field{
+		zap.String("method", ex.method),
+		zap.String("path", ex.path),
+		zap.Int("upstreamStatus", ex.status),
+		zap.Int64("durationInMs", ex.duration.Milliseconds()),
+		zap.Bool("stream", ex.streaming),
+		zap.Int("promptTokenCount", completion.promptTokens),
+		zap.Int("completionTokenCount", completion.completionTokens),
+		zap.Object("headers", zapcore.ObjectMarshalerFunc(
+			func(enc zapcore.ObjectEncoder) error {
+				for name := range ex.header {
+					if redactedHeaders[strings.ToLower(name)] {
+						enc.AddString(name, "[REDACTED]")
+						continue
+					}
+
+					enc.AddString(name, ex.header.Get(name))
+				}
+				return nil
+			},
+		)),
+	}
+
+	if len(ex.conversation) != 0 {
+		fields = append(fields, zap.String("conversationId", ex.conversation))
+	}
+
+	if !private {
+		fields = append(fields, zap.Array("messages", zapcore.ArrayMarshalerFunc(
+			func(enc zapcore.ArrayEncoder) error {
+				for _, m := range gjson.GetBytes(ex.request, "messages").Array() {
+					err := enc.AppendObject(zapcore.ObjectMarshalerFunc(
+						func(enc zapcore.ObjectEncoder) error {
+							enc.AddString("role", m.Get("role").String())
+							enc.AddString("content", truncateContent(m.Get("content").String(), aliasLogMaxContentLength))
+							return nil
+						},
+					))
+
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		)))
+
+		fields = append(fields, zap.String("completion", truncateContent(completion.content, aliasLogMaxContentLength)))
+	}
+
+	log.Info("openai alias exchange", fields...)
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/util"
+	"github.com/tidwall/gjson"
+)
+
+// mockUpstream answers alias requests in place of a model, so clients can
+// be developed without running one. Chat and text completions echo the
+// last prompt back with an estimated usage block, streamed a word every
+// delay when the request asks for a stream. Anything else is a 404.
+type mockUpstream struct {
+	delay time.Duration
+}
+
+func (m *mockUpstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+
+	var object, prompt string
+	var promptTokens int
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/chat/completions"):
+		object = "chat.completion"
+		prompt, _ = lastUserMessage(body)
+		promptTokens = estimatePromptTokens(body)
+	case strings.HasSuffix(req.URL.Path, "/completions"):
+		object = "text_completion"
+		prompt = gjson.GetBytes(body, "prompt").String()
+		promptTokens = estimateTokens(prompt)
+	default:
+		return mockResponse(req, http.StatusNotFound, "application/json", marshalMock(map[string]any{
+			"error": map[string]any{
+				"message": "[BricksLLM] mock mode only serves chat and text completions",
+				"type":    "invalid_request_error",
+			},
+		})), nil
+	}
+
+	reply := "This is a mock reply."
+	if len(prompt) != 0 {
+		reply = "This is a mock reply to: " + prompt
+	}
+
+	c := mockCompletion{
+		id:           "mock-" + util.NewUuid(),
+		object:       object,
+		model:        gjson.GetBytes(body, "model").String(),
+		created:      time.Now().Unix(),
+		promptTokens: promptTokens,
+	}
+	if len(c.model) == 0 {
+		c.model = "mock"
+	}
+
+	if !gjson.GetBytes(body, "stream").Bool() {
+		return mockResponse(req, http.StatusOK, "application/json", c.reply(reply)), nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(c.stream(req, pw, reply, m.delay, gjson.GetBytes(body, "stream_options.include_usage").Bool()))
+	}()
+
+	res := mockResponse(req, http.StatusOK, "text/event-stream", nil)
+	res.Body = pr
+	return res, nil
+}
+
+func mockResponse(req *http.Request, status int, contentType string, body []byte) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{contentType}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// mockCompletion renders the replies of mockUpstream in the shape of the
+// OpenAI object it imitates.
+type mockCompletion struct {
+	id           string
+	object       string
+	model        string
+	created      int64
+	promptTokens int
+}
+
+func (c mockCompletion) usage(completionTokens int) map[string]any {
+	return map[string]any{
+		"prompt_tokens":     c.promptTokens,
+		"completion_tokens": completionTokens,
+		"total_tokens":      c.promptTokens + completionTokens,
+	}
+}
+
+func (c mockCompletion) choice(content string, delta bool, finishReason any) map[string]any {
+	choice := map[string]any{"index": 0, "finish_reason": finishReason}
+	switch {
+	case c.object == "text_completion":
+		choice["text"] = content
+	case delta:
+		choice["delta"] = map[string]any{"role": "assistant", "content": content}
+	default:
+		choice["message"] = map[string]any{"role": "assistant", "content": content}
+	}
+
+	return choice
+}
+
+func (c mockCompletion) chunk(choices []any, usage map[string]any) []byte {
+	object := c.object
+	if object == "chat.completion" {
+		object = "chat.completion.chunk"
+	}
+
+	chunk := map[string]any{"id": c.id, "object": object, "created": c.created, "model": c.model, "choices": choices}
+	if usage != nil {
+		chunk["usage"] = usage
+	}
+
+	return append(append([]byte("data: "), marshalMock(chunk)...), '\n', '\n')
+}
+
+func (c mockCompletion) reply(content string) []byte {
+	return marshalMock(map[string]any{
+		"id":      c.id,
+		"object":  c.object,
+		"created": c.created,
+		"model":   c.model,
+		"choices": []any{c.choice(content, false, "stop")},
+		"usage":   c.usage(estimateTokens(content)),
+	})
+}
+
+// stream writes content a word at a time, pausing delay before each one,
+// until the request is cancelled.
+func (c mockCompletion) stream(req *http.Request, w io.Writer, content string, delay time.Duration, includeUsage bool) error {
+	for _, word := range strings.SplitAfter(content, " ") {
+		select {
+		case <-req.Context().Done():
+			return req.Context().Err()
+		case <-time.After(delay):
+		}
+
+		if _, err := w.Write(c.chunk([]any{c.choice(word, true, nil)}, nil)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.Write(c.chunk([]any{c.choice("", true, "stop")}, nil)); err != nil {
+		return err
+	}
+	if includeUsage {
+		if _, err := w.Write(c.chunk([]any{}, c.usage(estimateTokens(content)))); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write([]byte("data: [DONE]\n\n"))
+	return err
+}
+
+// marshalMock marshals the maps built above, which always succeeds.
+func marshalMock(v any) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
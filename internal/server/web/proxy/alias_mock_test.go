@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestChatCompletionAliasHandler_MockMode(t *testing.T) {
+	cases := []struct {
+		name   string
+		stream bool
+	}{
+		{name: "non streaming"},
+		{name: "streaming", stream: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := AliasConfig{MockMode: true}
+			store := &persistingStore{conv: postgresql.Conversation{ID: "conv-1"}}
+			// nothing listens here, the mock must answer instead
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, newAliasHttpClient(cfg), newUpstreamPool("http://127.0.0.1:1"), store, nil, nil, nil, cfg))
+
+			body := `{"model":"llama","messages":[{"role":"user","content":"hello there"}]}`
+			if tc.stream {
+				body = `{"model":"llama","stream":true,"messages":[{"role":"user","content":"hello there"}]}`
+			}
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set(conversationIdHeader, "conv-1")
+			router.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			if tc.stream {
+				require.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+				require.Contains(t, rec.Body.String(), `"object":"chat.completion.chunk"`)
+				require.True(t, strings.HasSuffix(rec.Body.String(), "data: [DONE]\n\n"))
+			} else {
+				require.Equal(t, "llama", gjson.Get(rec.Body.String(), "model").String())
+				require.Equal(t, "stop", gjson.Get(rec.Body.String(), "choices.0.finish_reason").String())
+				require.Equal(t, gjson.Get(rec.Body.String(), "usage.prompt_tokens").Int()+gjson.Get(rec.Body.String(), "usage.completion_tokens").Int(), gjson.Get(rec.Body.String(), "usage.total_tokens").Int())
+			}
+
+			require.Len(t, store.messages, 2)
+			require.Equal(t, "This is a mock reply to: hello there", store.messages[1].Content)
+			require.False(t, store.messages[1].TokensEstimated)
+			require.NotZero(t, store.messages[1].CompletionTokens)
+		})
+	}
+}
+
+func TestCompletionsAliasHandler_MockMode(t *testing.T) {
+	cfg := AliasConfig{MockMode: true}
+	router := newAliasTestRouter(http.MethodPost, "/v1/completions", getCompletionsAliasHandler(false, newAliasHttpClient(cfg), "http://127.0.0.1:1", cfg))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(`{"model":"llama","prompt":"once upon"}`)))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text_completion", gjson.Get(rec.Body.String(), "object").String())
+	require.Equal(t, "This is a mock reply to: once upon", gjson.Get(rec.Body.String(), "choices.0.text").String())
+	require.True(t, gjson.Get(rec.Body.String(), "usage.total_tokens").Exists())
+}
+
+func TestEmbeddingsAliasHandler_MockMode(t *testing.T) {
+	cfg := AliasConfig{MockMode: true}
+	router := newAliasTestRouter(http.MethodPost, "/v1/embeddings", getEmbeddingsAliasHandler(false, newAliasHttpClient(cfg), "http://127.0.0.1:1", cfg))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(`{"model":"llama","input":"hi"}`)))
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Contains(t, rec.Body.String(), "mock mode")
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+)
+
+// partialReplyWriter saves the reply of a stream every interval while it
+// is relayed. It hooks into the flushes relayAliasStream makes after each
+// event, when captured holds every event so far.
+type partialReplyWriter struct {
+	w        io.Writer
+	captured *bytes.Buffer
+	interval time.Duration
+	save     func(content string)
+	saved    time.Time
+}
+
+func newPartialReplyWriter(w io.Writer, captured *bytes.Buffer, interval time.Duration, save func(content string)) *partialReplyWriter {
+	return &partialReplyWriter{w: w, captured: captured, interval: interval, save: save, saved: time.Now()}
+}
+
+func (p *partialReplyWriter) Write(b []byte) (int, error) {
+	return p.w.Write(b)
+}
+
+func (p *partialReplyWriter) Flush() {
+	if f, ok := p.w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	if time.Since(p.saved) < p.interval {
+		return
+	}
+	p.saved = time.Now()
+	p.save(parseAliasCompletion(p.captured.Bytes(), true).content)
+}
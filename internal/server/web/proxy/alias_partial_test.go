@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+)
+
+func TestChatCompletionAliasHandler_SavesPartialReply(t *testing.T) {
+	events := []string{
+		"data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n",
+		"data: {\"choices\":[{\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n",
+	}
+
+	tests := []struct {
+		name                 string
+		breakOff             bool
+		expectedContent      string
+		expectedFinishReason string
+	}{
+		{
+			name:                 "completed when the stream ends",
+			expectedContent:      "Hello",
+			expectedFinishReason: "stop",
+		},
+		{
+			name:                 "kept as interrupted when the stream breaks off",
+			breakOff:             true,
+			expectedContent:      "Hel",
+			expectedFinishReason: postgresql.FinishReasonInterrupted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.ReadAll(r.Body)
+				if tt.breakOff {
+					conn, buf, err := w.(http.Hijacker).Hijack()
+					if err != nil {
+						return
+					}
+					defer conn.Close()
+
+					// a chunked reply that ends without its terminating chunk
+					buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/event-stream\r\nTransfer-Encoding: chunked\r\n\r\n")
+					buf.WriteString(strconv.FormatInt(int64(len(events[0])), 16) + "\r\n" + events[0] + "\r\n")
+					buf.Flush()
+					return
+				}
+
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, event := range events {
+					w.Write([]byte(event))
+					w.(http.Flusher).Flush()
+				}
+				w.Write([]byte("data: [DONE]\n\n"))
+			}))
+			defer upstream.Close()
+
+			var created []postgresql.Message
+			var saved []string
+			var completed []postgresql.Message
+			store := &mockConversationsStore{
+				getConversationFunc: func(id string) (*postgresql.Conversation, error) {
+					return &postgresql.Conversation{ID: id}, nil
+				},
+				createMessageFunc: func(m postgresql.Message) error {
+					created = append(created, m)
+					return nil
+				},
+				updateStreamingMessageFunc: func(id, content string) error {
+					saved = append(saved, content)
+					return nil
+				},
+				completeStreamingMessageFunc: func(m postgresql.Message) error {
+					completed = append(completed, m)
+					return nil
+				},
+			}
+
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{StreamSaveInterval: time.Nanosecond}))
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o-mini","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+			req.Header.Set(conversationIdHeader, "conv-1")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if len(created) != 2 || created[1].Role != "assistant" || !created[1].Streaming {
+				t.Fatalf("expected the prompt and a streaming assistant message, got %+v", created)
+			}
+			if len(saved) == 0 || saved[0] != "Hel" {
+				t.Fatalf("expected the reply to be saved while streaming, got %q", saved)
+			}
+			if len(completed) != 1 {
+				t.Fatalf("expected the streaming message to be completed once, got %d", len(completed))
+			}
+			if completed[0].ID != created[1].ID || completed[0].Content != tt.expectedContent || completed[0].FinishReason != tt.expectedFinishReason {
+				t.Fatalf("unexpected completed message %+v", completed[0])
+			}
+		})
+	}
+}
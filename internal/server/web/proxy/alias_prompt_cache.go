@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ephemeralCacheControl is the cache breakpoint Anthropic's prompt caching
+// understands.
+const ephemeralCacheControl = `{"type":"ephemeral"}`
+
+// markSystemPromptCacheable adds a cache breakpoint after the system prompt
+// of an Anthropic messages request, so a long prompt repeated across
+// requests is read from the cache. A string system prompt becomes a single
+// text block. Requests without a system prompt, or whose system blocks
+// already carry a breakpoint, are returned unchanged, which makes marking
+// a request twice the same as marking it once.
+func markSystemPromptCacheable(body []byte) ([]byte, error) {
+	system := gjson.GetBytes(body, "system")
+	switch {
+	case system.Type == gjson.String && len(system.String()) != 0:
+		block, err := sjson.SetRaw(`{"type":"text"}`, "text", system.Raw)
+		if err != nil {
+			return nil, err
+		}
+		block, err = sjson.SetRaw(block, "cache_control", ephemeralCacheControl)
+		if err != nil {
+			return nil, err
+		}
+		return sjson.SetRawBytes(body, "system", []byte("["+block+"]"))
+	case system.IsArray():
+		blocks := system.Array()
+		if len(blocks) == 0 {
+			return body, nil
+		}
+		for _, block := range blocks {
+			if block.Get("cache_control").Exists() {
+				return body, nil
+			}
+		}
+		return sjson.SetRawBytes(body, fmt.Sprintf("system.%d.cache_control", len(blocks)-1), []byte(ephemeralCacheControl))
+	}
+
+	return body, nil
+}
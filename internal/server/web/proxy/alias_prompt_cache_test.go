@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestMarkSystemPromptCacheable(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "string system prompt",
+			body:     `{"model":"claude-3-5-sonnet-20241022","system":"Be brief.","messages":[]}`,
+			expected: `{"model":"claude-3-5-sonnet-20241022","system":[{"type":"text","text":"Be brief.","cache_control":{"type":"ephemeral"}}],"messages":[]}`,
+		},
+		{
+			name:     "breakpoint goes on the last system block",
+			body:     `{"system":[{"type":"text","text":"a"},{"type":"text","text":"b"}]}`,
+			expected: `{"system":[{"type":"text","text":"a"},{"type":"text","text":"b","cache_control":{"type":"ephemeral"}}]}`,
+		},
+		{
+			name:     "existing breakpoint is kept",
+			body:     `{"system":[{"type":"text","text":"a","cache_control":{"type":"ephemeral"}},{"type":"text","text":"b"}]}`,
+			expected: `{"system":[{"type":"text","text":"a","cache_control":{"type":"ephemeral"}},{"type":"text","text":"b"}]}`,
+		},
+		{
+			name:     "no system prompt",
+			body:     `{"messages":[]}`,
+			expected: `{"messages":[]}`,
+		},
+		{
+			name:     "empty system prompt",
+			body:     `{"system":"","messages":[]}`,
+			expected: `{"system":"","messages":[]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			once, err := markSystemPromptCacheable([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(once) != tt.expected {
+				t.Fatalf("expected %s, got %s", tt.expected, once)
+			}
+
+			twice, err := markSystemPromptCacheable(once)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(twice) != string(once) {
+				t.Fatalf("expected marking twice to change nothing, got %s", twice)
+			}
+		})
+	}
+}
+
+func TestAnthropicChatCompletionAliasHandler_PromptCaching(t *testing.T) {
+	body := `{"model":"claude-3-5-sonnet-20241022","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":[{"type":"text","text":"long document","cache_control":{"type":"ephemeral"}}]}]}`
+
+	for _, caching := range []bool{false, true} {
+		var upstreamBody []byte
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			upstreamBody, _ = io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"msg_01","type":"message","role":"assistant","content":[],"stop_reason":"end_turn","usage":{}}`))
+		}))
+
+		router := newAliasTestRouter(http.MethodPost, "/v1/anthropic/chat/completions", getAnthropicChatCompletionAliasHandler(false, http.Client{}, upstream.URL, AliasConfig{AnthropicPromptCaching: caching}))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/anthropic/chat/completions", strings.NewReader(body)))
+		upstream.Close()
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if gjson.GetBytes(upstreamBody, "messages.0.content.0.cache_control.type").String() != "ephemeral" {
+			t.Fatalf("expected the client's breakpoint to pass through, got %s", upstreamBody)
+		}
+		if got := gjson.GetBytes(upstreamBody, "system.0.cache_control.type").String() == "ephemeral"; got != caching {
+			t.Fatalf("expected the system prompt to be cacheable only with caching on (%v), got %s", caching, upstreamBody)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/gin-gonic/gin"
+)
+
+// retryPayload is a chat completion request as it was sent upstream. Only
+// the body is kept, never the headers and their credentials.
+type retryPayload struct {
+	body    []byte
+	keyId   string
+	expires time.Time
+}
+
+// retryPayloadStore keeps the payloads of recent chat completions under
+// their request ids, so a client can ask for one to be sent again without
+// rebuilding it. Payloads live for ttl and at most size are kept, the
+// oldest going first.
+type retryPayloadStore struct {
+	mu       sync.Mutex
+	size     int
+	ttl      time.Duration
+	payloads map[string]retryPayload
+	// order holds the ids oldest first.
+	order []string
+	now   func() time.Time
+}
+
+// newRetryPayloadStore returns nil, which keeps nothing, unless size and
+// ttl are positive.
+func newRetryPayloadStore(size int, ttl time.Duration) *retryPayloadStore {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+
+	return &retryPayloadStore{size: size, ttl: ttl, payloads: map[string]retryPayload{}, now: time.Now}
+}
+
+// put stores body under id for the key that sent it.
+func (s *retryPayloadStore) put(id, keyId string, body []byte) {
+	if s == nil || len(id) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if _, ok := s.payloads[id]; !ok {
+		s.order = append(s.order, id)
+	}
+	s.payloads[id] = retryPayload{body: body, keyId: keyId, expires: now.Add(s.ttl)}
+
+	for len(s.order) != 0 {
+		oldest, ok := s.payloads[s.order[0]]
+		if ok && len(s.payloads) <= s.size && now.Before(oldest.expires) {
+			break
+		}
+		delete(s.payloads, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// get returns the payload stored under id if it has not expired and was
+// sent with keyId.
+func (s *retryPayloadStore) get(id, keyId string) ([]byte, bool) {
+	if s == nil {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payloads[id]
+	if !ok || p.keyId != keyId || !s.now().Before(p.expires) {
+		return nil, false
+	}
+
+	return p.body, true
+}
+
+// getChatRetryHandler sends the stored payload of an earlier chat completion
+// through chat again, under a new request id. The payload already holds the
+// conversation's history and system prompt, so the retry is not tied to the
+// conversation and its reply is not stored; /regenerate does that.
+func getChatRetryHandler(payloads *retryPayloadStore, chat gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		telemetry.Incr("bricksllm.proxy.chat_retry_handler.requests", requestIdTags(c), 1)
+
+		body, ok := payloads.get(c.Param("requestId"), callerKeyId(c))
+		if !ok {
+			JSON(c, http.StatusNotFound, "[BricksLLM] no stored request with this id, it may have expired")
+			return
+		}
+
+		c.Request.Header.Del(conversationIdHeader)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		chat(c)
+	}
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/key"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRetryPayloadStore(t *testing.T) {
+	now := time.Date(2024, 5, 14, 0, 0, 0, 0, time.UTC)
+	s := newRetryPayloadStore(2, time.Minute)
+	s.now = func() time.Time { return now }
+
+	s.put("req-1", "key-1", []byte("one"))
+	if body, ok := s.get("req-1", "key-1"); !ok || string(body) != "one" {
+		t.Fatalf("expected req-1 to be stored, got %q %v", body, ok)
+	}
+	if _, ok := s.get("req-1", "key-2"); ok {
+		t.Fatal("expected another key not to see req-1")
+	}
+
+	s.put("req-2", "key-1", []byte("two"))
+	s.put("req-3", "key-1", []byte("three"))
+	if _, ok := s.get("req-1", "key-1"); ok {
+		t.Fatal("expected the oldest payload to be evicted past the max count")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := s.get("req-3", "key-1"); ok {
+		t.Fatal("expected payloads to expire after the ttl")
+	}
+	s.put("req-4", "key-1", []byte("four"))
+	if len(s.payloads) != 1 || len(s.order) != 1 {
+		t.Fatalf("expected expired payloads to be dropped, got %d", len(s.payloads))
+	}
+
+	if newRetryPayloadStore(0, time.Minute) != nil || newRetryPayloadStore(10, 0) != nil {
+		t.Fatal("expected retries to be off without a max count and ttl")
+	}
+}
+
+func TestChatRetryHandler(t *testing.T) {
+	var bodies []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"error":{"message":"upstream is down"}}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer upstream.Close()
+
+	payloads := newRetryPayloadStore(10, time.Minute)
+	chat := getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, payloads, AliasConfig{})
+	auth := func(c *gin.Context) {
+		c.Set("key", &key.ResponseKey{KeyId: c.GetHeader("X-Test-Key")})
+	}
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getRequestIdMiddleware(), auth, chat)
+	router.POST("/chat/retry/:requestId", getRequestIdMiddleware(), auth, getChatRetryHandler(payloads, chat))
+
+	send := func(path, keyId, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("X-Test-Key", keyId)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	payload := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`
+	rec := send("/v1/chat/completions", "key-1", payload)
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected the upstream failure, got %d", rec.Code)
+	}
+	requestId := rec.Header().Get(requestIdHeader)
+	if len(requestId) == 0 {
+		t.Fatal("expected a request id header")
+	}
+
+	if rec := send("/chat/retry/"+requestId, "key-2", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected another key to get a 404, got %d", rec.Code)
+	}
+	if rec := send("/chat/retry/unknown", "key-1", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected an unknown id to get a 404, got %d", rec.Code)
+	}
+
+	rec = send("/chat/retry/"+requestId, "key-1", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the retry to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(bodies) != 2 || bodies[1] != payload {
+		t.Fatalf("expected the stored payload to be replayed, got %v", bodies)
+	}
+}
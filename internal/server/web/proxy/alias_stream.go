@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+)
+
+var doneEvent = []byte("data: [DONE]")
+
+// streamReadError is returned by relayAliasStream when reading the upstream
+// body fails, as opposed to writing to the client.
+type streamReadError struct {
+	err error
+}
+
+func (e *streamReadError) Error() string {
+	return "error reading upstream stream: " + e.err.Error()
+}
+
+func (e *streamReadError) Unwrap() error {
+	return e.err
+}
+
+// relayAliasStream copies an upstream SSE body to the client line by line,
+// flushing after every event and recording everything it relays in captured.
+// The terminating [DONE] event is held back until beforeDone has had a chance
+// to emit an extra event ahead of it. Both captured and beforeDone may be nil.
+func relayAliasStream(w io.Writer, body io.Reader, captured *bytes.Buffer, beforeDone func() []byte) error {
+	flusher, _ := w.(http.Flusher)
+	reader := bufio.NewReader(body)
+	done := false
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) != 0 {
+			if !done && beforeDone != nil && bytes.Equal(bytes.TrimSpace(line), doneEvent) {
+				done = true
+				if extra := beforeDone(); len(extra) != 0 {
+					if _, werr := w.Write(extra); werr != nil {
+						return werr
+					}
+					if captured != nil {
+						captured.Write(extra)
+					}
+				}
+			}
+
+			if _, werr := w.Write(line); werr != nil {
+				return werr
+			}
+			if captured != nil {
+				captured.Write(line)
+			}
+
+			if flusher != nil && len(bytes.TrimSpace(line)) == 0 {
+				flusher.Flush()
+			}
+		}
+
+		if err != nil {
+			if flusher != nil {
+				flusher.Flush()
+			}
+
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return &streamReadError{err: err}
+		}
+	}
+}
+
+// streamErrorEvent renders the final event sent to the client when the
+// upstream stream breaks off mid-way, so it can tell that apart from a
+// finished reply. It returns nil when the relay failed writing to the
+// client, or when ctx was cancelled because the client disconnected or
+// stopped the stream, since nobody is waiting for the event then.
+func streamErrorEvent(ctx context.Context, err error) []byte {
+	var readErr *streamReadError
+	if !errors.As(err, &readErr) || errors.Is(ctx.Err(), context.Canceled) {
+		return nil
+	}
+
+	message := "[BricksLLM] upstream stream ended unexpectedly"
+	var transformErr *streamTransformError
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		message = "[BricksLLM] upstream stream timed out"
+	} else if errors.As(err, &transformErr) {
+		message = "[BricksLLM] failed to transform stream"
+	}
+
+	data, err := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"message": message,
+			"type":    "upstream_error",
+			"code":    "stream_interrupted",
+		},
+	})
+	if err != nil {
+		return nil
+	}
+
+	return append(append([]byte("data: "), data...), '\n', '\n')
+}
+
+// writeStreamErrorEvent sends streamErrorEvent, if any, and flushes it.
+func writeStreamErrorEvent(w io.Writer, ctx context.Context, err error) {
+	event := streamErrorEvent(ctx, err)
+	if len(event) == 0 {
+		return
+	}
+
+	telemetry.Incr("bricksllm.proxy.alias_stream.upstream_error", nil, 1)
+	if _, werr := w.Write(event); werr != nil {
+		return
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// estimatedUsageEvent renders a final chat.completion.chunk carrying a usage
+// block for streams whose upstream did not report one. It returns nil when
+// the stream already included usage.
+func estimatedUsageEvent(request, stream []byte) []byte {
+	completion := parseAliasCompletion(stream, true)
+	if completion.hasUsage {
+		return nil
+	}
+	completion.estimateUsage(request)
+
+	data, err := json.Marshal(map[string]any{
+		"object":  "chat.completion.chunk",
+		"choices": []any{},
+		"usage": map[string]any{
+			"prompt_tokens":     completion.promptTokens,
+			"completion_tokens": completion.completionTokens,
+			"total_tokens":      completion.promptTokens + completion.completionTokens,
+			"estimated":         true,
+		},
+	})
+	if err != nil {
+		return nil
+	}
+
+	return append(append([]byte("data: "), data...), '\n', '\n')
+}
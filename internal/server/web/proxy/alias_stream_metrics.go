@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+)
+
+// streamTimer passes an upstream stream through, noting when its first data
+// event arrives so the latency of streamed replies can be reported.
+type streamTimer struct {
+	io.Reader
+	start time.Time
+	first time.Time
+}
+
+// newStreamTimer times body from start, when the request was sent upstream.
+func newStreamTimer(body io.Reader, start time.Time) *streamTimer {
+	return &streamTimer{Reader: body, start: start}
+}
+
+func (t *streamTimer) Read(p []byte) (int, error) {
+	n, err := t.Reader.Read(p)
+	// comments and keep-alives are not part of the reply
+	if t.first.IsZero() && bytes.Contains(p[:n], []byte("data:")) {
+		t.first = time.Now()
+	}
+	return n, err
+}
+
+// observe reports the time to the first data event, the stream's total
+// duration and, given the reply's completion tokens, the time per token
+// after the first, i.e. the inverse of the token throughput. Streams that
+// never sent data report nothing.
+func (t *streamTimer) observe(completionTokens int, tags []string) {
+	if t.first.IsZero() {
+		return
+	}
+
+	telemetry.Timing("bricksllm.proxy.alias.ttft", t.first.Sub(t.start), tags, 1)
+	telemetry.Timing("bricksllm.proxy.alias.stream_duration", time.Since(t.start), tags, 1)
+	if completionTokens > 0 {
+		telemetry.Timing("bricksllm.proxy.alias.time_per_token", time.Since(t.first)/time.Duration(completionTokens), tags, 1)
+	}
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+)
+
+type timingRecorder map[string]time.Duration
+
+func (r timingRecorder) Incr(name string, tags []string, rate float64) {}
+
+func (r timingRecorder) Count(name string, value int64, tags []string, rate float64) {}
+
+func (r timingRecorder) Timing(name string, value time.Duration, tags []string, rate float64) {
+	r[name] = value
+}
+
+func TestStreamTimer(t *testing.T) {
+	recorded := timingRecorder{}
+	defer func(prev *telemetry.Client) { telemetry.Singleton = prev }(telemetry.Singleton)
+	telemetry.Singleton = &telemetry.Client{Provider: recorded}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte(": keep-alive\n\n"))
+		time.Sleep(20 * time.Millisecond)
+		pw.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n"))
+		pw.Write([]byte("data: [DONE]\n\n"))
+		pw.Close()
+	}()
+
+	timer := newStreamTimer(pr, time.Now())
+	if _, err := io.Copy(io.Discard, timer); err != nil {
+		t.Fatal(err)
+	}
+	timer.observe(4, nil)
+
+	if ttft := recorded["bricksllm.proxy.alias.ttft"]; ttft < 20*time.Millisecond {
+		t.Fatalf("expected the keep-alive not to count as the first token, got a ttft of %s", ttft)
+	}
+	for _, name := range []string{"bricksllm.proxy.alias.stream_duration", "bricksllm.proxy.alias.time_per_token"} {
+		if _, ok := recorded[name]; !ok {
+			t.Fatalf("expected %s to be recorded, got %v", name, recorded)
+		}
+	}
+}
+
+func TestStreamTimer_NoData(t *testing.T) {
+	recorded := timingRecorder{}
+	defer func(prev *telemetry.Client) { telemetry.Singleton = prev }(telemetry.Singleton)
+	telemetry.Singleton = &telemetry.Client{Provider: recorded}
+
+	timer := newStreamTimer(strings.NewReader(": keep-alive\n\n"), time.Now())
+	if _, err := io.Copy(io.Discard, timer); err != nil {
+		t.Fatal(err)
+	}
+	timer.observe(0, nil)
+
+	if len(recorded) != 0 {
+		t.Fatalf("expected nothing to be recorded for a stream without data, got %v", recorded)
+	}
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// StreamTransformer rewrites the data of each event of a streamed chat or
+// text completion before it is relayed, e.g. to mask profanity or inject
+// citations. It always sees the complete data of one event, however the
+// upstream split it into chunks, and never the final [DONE]. Returning
+// empty data drops the event. A nil StreamTransformer relays events as is.
+type StreamTransformer interface {
+	Transform(chunk []byte) ([]byte, error)
+}
+
+// streamTransformError is returned when the StreamTransformer fails, which
+// ends the stream.
+type streamTransformError struct {
+	err error
+}
+
+func (e *streamTransformError) Error() string {
+	return "error transforming stream event: " + e.err.Error()
+}
+
+func (e *streamTransformError) Unwrap() error {
+	return e.err
+}
+
+// streamTransformReader reads an SSE body one event at a time and yields
+// the events as rewritten by a StreamTransformer.
+type streamTransformReader struct {
+	src         *bufio.Reader
+	transformer StreamTransformer
+	pending     []byte
+	err         error
+}
+
+// newStreamTransformReader returns body itself when transformer is nil.
+func newStreamTransformReader(body io.Reader, transformer StreamTransformer) io.Reader {
+	if transformer == nil {
+		return body
+	}
+
+	return &streamTransformReader{src: bufio.NewReader(body), transformer: transformer}
+}
+
+func (r *streamTransformReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		event, err := readSSEEvent(r.src)
+		if len(event) != 0 {
+			out, terr := transformSSEEvent(r.transformer, event)
+			if terr != nil {
+				r.err = &streamTransformError{err: terr}
+				continue
+			}
+			r.pending = out
+		}
+		if err != nil {
+			r.err = err
+		}
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// readSSEEvent reads the lines of one event up to and including the blank
+// line ending it.
+func readSSEEvent(r *bufio.Reader) ([]byte, error) {
+	var event []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		event = append(event, line...)
+		if err != nil {
+			return event, err
+		}
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			return event, nil
+		}
+	}
+}
+
+// transformSSEEvent passes the data of event, its data lines joined by
+// newlines, through transformer. Events without data, such as keep alive
+// comments, and [DONE] are returned unchanged.
+func transformSSEEvent(transformer StreamTransformer, event []byte) ([]byte, error) {
+	var fields, data [][]byte
+	hasData := false
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+
+		value, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			fields = append(fields, line)
+			continue
+		}
+		hasData = true
+		data = append(data, bytes.TrimPrefix(value, []byte(" ")))
+	}
+
+	joined := bytes.Join(data, []byte("\n"))
+	if !hasData || bytes.Equal(joined, []byte("[DONE]")) {
+		return event, nil
+	}
+
+	out, err := transformer.Transform(joined)
+	if err != nil || len(out) == 0 {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	for _, field := range fields {
+		buf.Write(field)
+		buf.WriteByte('\n')
+	}
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/stretchr/testify/require"
+)
+
+// maskingTransformer masks a word and records the data it was given.
+type maskingTransformer struct {
+	word string
+	seen []string
+	err  error
+}
+
+func (m *maskingTransformer) Transform(chunk []byte) ([]byte, error) {
+	m.seen = append(m.seen, string(chunk))
+	if m.err != nil {
+		return nil, m.err
+	}
+	if bytes.Contains(chunk, []byte(`"drop"`)) {
+		return nil, nil
+	}
+	return bytes.ReplaceAll(chunk, []byte(m.word), []byte(strings.Repeat("*", len(m.word)))), nil
+}
+
+func TestStreamTransformReader(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		expected string
+		seen     []string
+	}{
+		{
+			name:     "rewrites each event",
+			body:     "data: {\"a\":\"darn\"}\n\ndata: {\"b\":1}\n\ndata: [DONE]\n\n",
+			expected: "data: {\"a\":\"****\"}\n\ndata: {\"b\":1}\n\ndata: [DONE]\n\n",
+			seen:     []string{`{"a":"darn"}`, `{"b":1}`},
+		},
+		{
+			name:     "joins multi line data and keeps other fields",
+			body:     "event: message\r\ndata: {\"a\":\r\ndata: \"darn\"}\r\n\r\n",
+			expected: "event: message\ndata: {\"a\":\ndata: \"****\"}\n\n",
+			seen:     []string{"{\"a\":\n\"darn\"}"},
+		},
+		{
+			name:     "passes comments through",
+			body:     ": keep alive\n\ndata: {}\n\n",
+			expected: ": keep alive\n\ndata: {}\n\n",
+			seen:     []string{`{}`},
+		},
+		{
+			name:     "drops events transformed to nothing",
+			body:     "data: \"drop\"\n\ndata: {}\n\n",
+			expected: "data: {}\n\n",
+			seen:     []string{`"drop"`, `{}`},
+		},
+		{
+			name:     "transforms an unterminated last event",
+			body:     "data: {\"a\":\"darn\"}",
+			expected: "data: {\"a\":\"****\"}\n\n",
+			seen:     []string{`{"a":"darn"}`},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			transformer := &maskingTransformer{word: "darn"}
+			out, err := io.ReadAll(newStreamTransformReader(iotest.OneByteReader(strings.NewReader(tc.body)), transformer))
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(out))
+			require.Equal(t, tc.seen, transformer.seen)
+		})
+	}
+}
+
+func TestStreamTransformReader_NilTransformer(t *testing.T) {
+	body := strings.NewReader("data: {}\n\n")
+	require.True(t, newStreamTransformReader(body, nil) == io.Reader(body))
+}
+
+func TestChatCompletionAliasHandler_StreamTransformer(t *testing.T) {
+	events := []string{
+		`{"choices":[{"delta":{"content":"oh "},"finish_reason":null}]}`,
+		`{"choices":[{"delta":{"content":"darn"},"finish_reason":null}]}`,
+		`{"choices":[{"delta":{"content":"!"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":3,"total_tokens":6}}`,
+	}
+	stream := ""
+	for _, e := range events {
+		stream += "data: " + e + "\n\n"
+	}
+	stream += "data: [DONE]\n\n"
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// split the stream mid event so frames have to be reassembled
+		for i := 0; i < len(stream); i += 7 {
+			w.Write([]byte(stream[i:min(i+7, len(stream))]))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	transformer := &maskingTransformer{word: "darn"}
+	store := &persistingStore{conv: postgresql.Conversation{ID: "conv-1"}}
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{StreamTransformer: transformer}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"default","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set(conversationIdHeader, "conv-1")
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Len(t, transformer.seen, len(events))
+	for _, chunk := range transformer.seen {
+		require.True(t, json.Valid([]byte(chunk)), "transformer saw a partial event: %s", chunk)
+	}
+	require.NotContains(t, rec.Body.String(), "darn")
+	require.Contains(t, rec.Body.String(), "data: [DONE]")
+	require.Len(t, store.messages, 2)
+	require.Equal(t, "oh ****!", store.messages[1].Content)
+}
+
+func TestChatCompletionAliasHandler_StreamTransformerError(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	transformer := &maskingTransformer{err: errors.New("boom")}
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, AliasConfig{StreamTransformer: transformer}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"default","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "failed to transform stream")
+	require.NotContains(t, rec.Body.String(), "[DONE]")
+}
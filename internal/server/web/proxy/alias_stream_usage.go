@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// injectStreamUsage asks the upstream for a final usage chunk by setting
+// stream_options.include_usage, unless the client already decided either
+// way. It reports whether the option was added.
+func injectStreamUsage(body []byte) ([]byte, bool, error) {
+	if gjson.GetBytes(body, "stream_options.include_usage").Exists() {
+		return body, false, nil
+	}
+
+	res, err := sjson.SetBytes(body, "stream_options.include_usage", true)
+	if err != nil {
+		return body, false, err
+	}
+
+	return res, true, nil
+}
+
+// rejectsStreamOptions reads an error reply and reports whether the
+// upstream turned the request down over stream_options, as older OpenAI
+// compatible servers do. body is handed back unread for relaying otherwise.
+func rejectsStreamOptions(res *http.Response, body io.ReadCloser) (bool, io.ReadCloser, error) {
+	if res.StatusCode != http.StatusBadRequest && res.StatusCode != http.StatusUnprocessableEntity {
+		return false, body, nil
+	}
+
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return false, nil, err
+	}
+
+	return bytes.Contains(data, []byte("stream_options")), io.NopCloser(bytes.NewReader(data)), nil
+}
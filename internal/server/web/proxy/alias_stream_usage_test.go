@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/tidwall/gjson"
+)
+
+func TestChatCompletionAliasHandler_StreamUsage(t *testing.T) {
+	tests := []struct {
+		name                   string
+		streamOptions          string
+		rejectsStreamOptions   bool
+		expectedIncludeUsage   []string
+		expectedPromptTokens   int
+		expectedTokensEstimate bool
+	}{
+		{
+			name:                 "usage is requested and stored",
+			expectedIncludeUsage: []string{"true", "true"},
+			expectedPromptTokens: 11,
+		},
+		{
+			name:                 "client choice is kept",
+			streamOptions:        `"stream_options":{"include_usage":false},`,
+			expectedIncludeUsage: []string{"false", "false"},
+			// the upstream sends no usage, so it is estimated
+			expectedTokensEstimate: true,
+		},
+		{
+			name:                   "upstreams rejecting the option are retried and remembered",
+			rejectsStreamOptions:   true,
+			expectedIncludeUsage:   []string{"true", "", ""},
+			expectedTokensEstimate: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			includeUsage := []string{}
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				option := gjson.GetBytes(data, "stream_options.include_usage")
+				includeUsage = append(includeUsage, option.Raw)
+				if option.Exists() && tt.rejectsStreamOptions {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"error":{"message":"Unrecognized request argument supplied: stream_options"}}`))
+					return
+				}
+
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"},\"finish_reason\":\"stop\"}]}\n\n"))
+				if option.Bool() {
+					w.Write([]byte("data: {\"choices\":[],\"usage\":{\"prompt_tokens\":11,\"completion_tokens\":1,\"total_tokens\":12}}\n\n"))
+				}
+				w.Write([]byte("data: [DONE]\n\n"))
+			}))
+			defer upstream.Close()
+
+			var assistant []postgresql.Message
+			store := &mockConversationsStore{
+				getConversationFunc: func(id string) (*postgresql.Conversation, error) {
+					return &postgresql.Conversation{ID: id}, nil
+				},
+				createMessageFunc: func(m postgresql.Message) error {
+					if m.Role == "assistant" {
+						assistant = append(assistant, m)
+					}
+					return nil
+				},
+			}
+
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{}))
+
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o-mini","stream":true,`+tt.streamOptions+`"messages":[{"role":"user","content":"hi"}]}`))
+				req.Header.Set(conversationIdHeader, "conv-1")
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+
+				if rec.Code != http.StatusOK {
+					t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+				}
+				if strings.Count(rec.Body.String(), `"usage"`) != 1 {
+					t.Fatalf("expected a single usage chunk, got %s", rec.Body.String())
+				}
+			}
+
+			if strings.Join(includeUsage, ",") != strings.Join(tt.expectedIncludeUsage, ",") {
+				t.Fatalf("expected include_usage %v upstream, got %v", tt.expectedIncludeUsage, includeUsage)
+			}
+			if len(assistant) != 2 {
+				t.Fatalf("expected both replies to be stored, got %d", len(assistant))
+			}
+			if assistant[0].TokensEstimated != tt.expectedTokensEstimate {
+				t.Fatalf("expected tokens estimated %v, got %+v", tt.expectedTokensEstimate, assistant[0])
+			}
+			if tt.expectedPromptTokens != 0 && assistant[0].PromptTokens != tt.expectedPromptTokens {
+				t.Fatalf("expected %d prompt tokens, got %d", tt.expectedPromptTokens, assistant[0].PromptTokens)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap"
+)
+
+// persistAliasVariants stores the choices after the first of a completion
+// requested with n > 1 as variants of the reply. The usage of the request
+// is already on choice 0, so variants carry no tokens of their own.
+func persistAliasVariants(log *zap.Logger, prod bool, cs conversationsStore, conversationID string, body []byte, completion aliasCompletion) {
+	for i, v := range completion.variants {
+		msg := newConversationMessage(conversationID, "assistant", v.content)
+		msg.Model = gjson.GetBytes(body, "model").String()
+		msg.FinishReason = v.finishReason
+		msg.VariantIndex = i + 1
+		if err := cs.CreateMessage(msg); err != nil {
+			telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.persist_assistant_message_error", nil, 1)
+			logError(log, "error when persisting assistant message variant for openai alias", prod, err)
+		}
+	}
+}
+
+// primaryMessages leaves out reply variants, so a conversation is sent
+// upstream as the single line of replies it goes on from.
+func primaryMessages(msgs []postgresql.Message) []postgresql.Message {
+	res := make([]postgresql.Message, 0, len(msgs))
+	for _, m := range msgs {
+		if m.VariantIndex == 0 {
+			res = append(res, m)
+		}
+	}
+	return res
+}
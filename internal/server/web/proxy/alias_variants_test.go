@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+)
+
+const (
+	twoChoicesReply = `{"choices":[` +
+		`{"index":0,"message":{"role":"assistant","content":"Bonjour"},"finish_reason":"stop"},` +
+		`{"index":1,"message":{"role":"assistant","content":"Salut"},"finish_reason":"length"}` +
+		`],"usage":{"prompt_tokens":5,"completion_tokens":4}}`
+	twoChoicesStream = "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Bon\"}},{\"index\":1,\"delta\":{\"content\":\"Sa\"}}]}\n\n" +
+		"data: {\"choices\":[{\"index\":1,\"delta\":{\"content\":\"lut\"},\"finish_reason\":\"length\"}]}\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"jour\"},\"finish_reason\":\"stop\"}]}\n\n" +
+		"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":4}}\n\n" +
+		"data: [DONE]\n\n"
+)
+
+func TestParseAliasCompletion_Choices(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		streaming bool
+	}{
+		{name: "non streaming", body: twoChoicesReply},
+		{name: "streaming with interleaved choices", body: twoChoicesStream, streaming: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completion := parseAliasCompletion([]byte(tt.body), tt.streaming)
+
+			if completion.content != "Bonjour" || completion.finishReason != "stop" {
+				t.Fatalf("expected choice 0 as the reply, got %q (%s)", completion.content, completion.finishReason)
+			}
+			if len(completion.variants) != 1 || completion.variants[0].content != "Salut" || completion.variants[0].finishReason != "length" {
+				t.Fatalf("expected choice 1 as the only variant, got %+v", completion.variants)
+			}
+			if completion.promptTokens != 5 || completion.completionTokens != 4 {
+				t.Fatalf("expected the reported usage, got %d/%d", completion.promptTokens, completion.completionTokens)
+			}
+		})
+	}
+}
+
+func TestParseAliasCompletion_EstimatesEveryChoice(t *testing.T) {
+	completion := parseAliasCompletion([]byte(`{"choices":[{"message":{"content":"Bonjour"}},{"message":{"content":"Salut"}}]}`), false)
+	completion.estimateUsage([]byte(`{"n":2,"messages":[{"role":"user","content":"hi"}]}`))
+
+	if expected := estimateTokens("Bonjour") + estimateTokens("Salut"); completion.completionTokens != expected {
+		t.Fatalf("expected %d completion tokens for both choices, got %d", expected, completion.completionTokens)
+	}
+}
+
+func TestChatCompletionAliasHandler_PersistsVariants(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		stream   bool
+	}{
+		{name: "non streaming", response: twoChoicesReply},
+		{name: "streaming", response: twoChoicesStream, stream: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.stream {
+					w.Header().Set("Content-Type", "text/event-stream")
+				}
+				w.Write([]byte(tt.response))
+			}))
+			defer upstream.Close()
+
+			store := &persistingStore{conv: postgresql.Conversation{ID: "conv-1"}}
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{}))
+
+			body := `{"model":"gpt-4o-mini","n":2,"messages":[{"role":"user","content":"Say hello in French"}]}`
+			if tt.stream {
+				body = `{"model":"gpt-4o-mini","n":2,"stream":true,"messages":[{"role":"user","content":"Say hello in French"}]}`
+			}
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set(conversationIdHeader, "conv-1")
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if len(store.messages) != 3 {
+				t.Fatalf("expected the prompt and both choices to be stored, got %+v", store.messages)
+			}
+
+			reply, variant := store.messages[1], store.messages[2]
+			if reply.Content != "Bonjour" || reply.VariantIndex != 0 || reply.PromptTokens != 5 || reply.CompletionTokens != 4 {
+				t.Fatalf("expected choice 0 with the request's usage as the reply, got %+v", reply)
+			}
+			if variant.Content != "Salut" || variant.VariantIndex != 1 || variant.FinishReason != "length" || variant.Model != "gpt-4o-mini" {
+				t.Fatalf("expected choice 1 as variant 1, got %+v", variant)
+			}
+			if variant.PromptTokens != 0 || variant.CompletionTokens != 0 {
+				t.Fatalf("expected the usage not to be counted twice, got %+v", variant)
+			}
+		})
+	}
+}
+
+func TestPrimaryMessages(t *testing.T) {
+	msgs := primaryMessages([]postgresql.Message{
+		{ID: "m1", Role: "user"},
+		{ID: "m2", Role: "assistant"},
+		{ID: "m3", Role: "assistant", VariantIndex: 1},
+		{ID: "m4", Role: "user"},
+	})
+
+	ids := []string{}
+	for _, m := range msgs {
+		ids = append(ids, m.ID)
+	}
+	if strings.Join(ids, ",") != "m1,m2,m4" {
+		t.Fatalf("expected variants to be left out, got %v", ids)
+	}
+}
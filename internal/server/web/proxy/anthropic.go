@@ -8,7 +8,6 @@ import (
 	"errors"
 	"io"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/bricks-cloud/bricksllm/internal/key"
@@ -29,10 +28,8 @@ type anthropicEstimator interface {
 }
 
 func copyHttpHeaders(source *http.Request, dest *http.Request, removeUseAgent bool) {
-	for k := range source.Header {
-		if strings.ToLower(k) != "x-custom-event-id" {
-			dest.Header.Set(k, source.Header.Get(k))
-		}
+	for _, k := range forwardedHeaders(source) {
+		dest.Header.Set(k, source.Header.Get(k))
 	}
 
 	if removeUseAgent {
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/bricks-cloud/bricksllm/internal/util"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	auditConversationCreate     = "conversation.create"
+	auditConversationRename     = "conversation.rename"
+	auditConversationMetadata   = "conversation.metadata"
+	auditConversationPin        = "conversation.pin"
+	auditConversationArchive    = "conversation.archive"
+	auditConversationRead       = "conversation.read"
+	auditConversationDeleteAll  = "conversation.delete_all"
+	auditConversationBulkDelete = "conversation.bulk_delete"
+	auditConversationFork       = "conversation.fork"
+	auditConversationShare      = "conversation.share"
+	auditConversationUnshare    = "conversation.unshare"
+	auditConversationFolder     = "conversation.folder"
+	auditConversationParams     = "conversation.params"
+	auditConversationTrash      = "conversation.trash"
+	auditConversationRestore    = "conversation.restore"
+	auditConversationMerge      = "conversation.merge"
+	auditConversationGrant      = "conversation.grant"
+	auditConversationRevoke     = "conversation.revoke"
+	auditMessageCreate          = "message.create"
+	auditMessageReact           = "message.react"
+	auditMessageMetadata        = "message.metadata"
+	auditFolderCreate           = "folder.create"
+	auditFolderRename           = "folder.rename"
+	auditFolderDelete           = "folder.delete"
+	auditTemplateCreate         = "template.create"
+	auditTemplateDelete         = "template.delete"
+)
+
+type auditLog interface {
+	RecordAudit(e postgresql.AuditEntry) error
+}
+
+// WithAuditLog records the caller's mutating conversation, message and
+// folder actions in audit.
+func WithAuditLog(audit auditLog) ConversationHandlerOption {
+	return func(h *ConversationHandler) {
+		h.audit = audit
+	}
+}
+
+// recordAudit writes an entry for an action that already succeeded. It is
+// best-effort: a failed write is logged and counted but never fails the
+// request. A nil audit records nothing.
+func recordAudit(c *gin.Context, audit auditLog, action, targetID string, detail gin.H) {
+	if audit == nil {
+		return
+	}
+
+	e := postgresql.AuditEntry{
+		UserID:    c.GetString("userId"),
+		Action:    action,
+		TargetID:  targetID,
+		CreatedAt: time.Now(),
+	}
+	if len(detail) != 0 {
+		if data, err := json.Marshal(detail); err == nil {
+			e.Detail = data
+		}
+	}
+
+	if err := audit.RecordAudit(e); err != nil {
+		telemetry.Incr("bricksllm.proxy.record_audit.error", []string{"action:" + action}, 1)
+		util.GetLogFromCtx(c).Warn("error when recording audit entry",
+			zap.String("action", action),
+			zap.String("targetId", targetID),
+			zap.Error(err),
+		)
+	}
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+type recordingAuditLog struct {
+	entries []postgresql.AuditEntry
+	err     error
+}
+
+func (a *recordingAuditLog) RecordAudit(e postgresql.AuditEntry) error {
+	a.entries = append(a.entries, e)
+	return a.err
+}
+
+func TestConversationHandler_RecordsAudit(t *testing.T) {
+	tests := []struct {
+		name           string
+		store          *mockConversationsStore
+		auditErr       error
+		expectedStatus int
+		expectedAudits int
+	}{
+		{
+			name: "recorded after the action succeeds",
+			store: &mockConversationsStore{
+				setConversationPinnedFunc: func(id, userID string, pinned bool) error { return nil },
+			},
+			expectedStatus: http.StatusOK,
+			expectedAudits: 1,
+		},
+		{
+			name: "not recorded when the action fails",
+			store: &mockConversationsStore{
+				setConversationPinnedFunc: func(id, userID string, pinned bool) error { return errors.New("db down") },
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "a failed audit write does not fail the action",
+			store: &mockConversationsStore{
+				setConversationPinnedFunc: func(id, userID string, pinned bool) error { return nil },
+			},
+			auditErr:       errors.New("db down"),
+			expectedStatus: http.StatusOK,
+			expectedAudits: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audit := &recordingAuditLog{err: tt.auditErr}
+			h := NewConversationHandler(tt.store, WithAuditLog(audit))
+			router := newAliasTestRouter(http.MethodPost, "/api/v1/conversations/:id/pin", func(c *gin.Context) {
+				c.Set("userId", "user-1")
+			}, h.PinConversation)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/conversations/conv-1/pin", strings.NewReader(`{"pinned":false}`)))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if len(audit.entries) != tt.expectedAudits {
+				t.Fatalf("expected %d audit entries, got %d", tt.expectedAudits, len(audit.entries))
+			}
+			if tt.expectedAudits == 0 {
+				return
+			}
+
+			e := audit.entries[0]
+			if e.UserID != "user-1" || e.Action != auditConversationPin || e.TargetID != "conv-1" || string(e.Detail) != `{"pinned":false}` {
+				t.Fatalf("unexpected audit entry %+v with detail %s", e, e.Detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+)
+
+// errCircuitOpen is returned instead of calling an upstream whose circuit
+// breaker is open.
+var errCircuitOpen = errors.New("upstream circuit breaker is open")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker fails calls to an upstream fast once it is clearly down.
+// It opens after threshold consecutive failures, lets a single probe through
+// once cooldown has passed (half-open) and closes again when the probe
+// succeeds. A zero threshold disables it.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	name      string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	state    circuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(name string, threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{name: name, threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+func (b *circuitBreaker) transition(to circuitState) {
+	if b.state == to {
+		return
+	}
+
+	telemetry.Incr("bricksllm.proxy.circuit_breaker.transition", append(upstreamTags(b.name), "from:"+b.state.String(), "to:"+to.String()), 1)
+	b.state = to
+}
+
+// available reports whether allow could let a call through, without
+// claiming the half-open probe.
+func (b *circuitBreaker) available() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		return !b.now().Before(b.openedAt.Add(b.cooldown))
+	case circuitHalfOpen:
+		return !b.probing
+	default:
+		return true
+	}
+}
+
+// allow reports whether a call may go ahead. Once the cooldown is over the
+// first caller becomes the half-open probe and everyone else is refused
+// until it reports back.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitOpen {
+		if b.now().Before(b.openedAt.Add(b.cooldown)) {
+			return false
+		}
+		b.transition(circuitHalfOpen)
+	}
+
+	if b.state == circuitHalfOpen {
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+
+	return true
+}
+
+// success closes the circuit.
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	b.transition(circuitClosed)
+}
+
+// failure counts a failed call, opening the circuit once threshold is
+// reached or straight away when the half-open probe fails.
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.threshold <= 0 {
+		return
+	}
+
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.transition(circuitOpen)
+	}
+}
+
+// release gives up an allowed call without an outcome, e.g. because the
+// client went away, so a half-open probe can be retried.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker("http://a", 2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	if !b.allow() || b.state != circuitClosed {
+		t.Fatalf("expected a single failure to keep the circuit closed, got %s", b.state)
+	}
+
+	b.failure()
+	if b.allow() || b.state != circuitOpen {
+		t.Fatalf("expected repeated failures to open the circuit, got %s", b.state)
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() || b.state != circuitHalfOpen {
+		t.Fatalf("expected a probe after the cooldown, got %s", b.state)
+	}
+	if b.allow() {
+		t.Fatal("expected a single probe while half-open")
+	}
+
+	b.failure()
+	if b.allow() || b.state != circuitOpen {
+		t.Fatalf("expected a failed probe to reopen the circuit, got %s", b.state)
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatal("expected a probe after the cooldown")
+	}
+	b.release()
+	if !b.allow() {
+		t.Fatal("expected a released probe to be retried")
+	}
+
+	b.success()
+	if !b.allow() || !b.allow() || b.state != circuitClosed {
+		t.Fatalf("expected a successful probe to close the circuit, got %s", b.state)
+	}
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	b := newCircuitBreaker("http://a", 0, time.Minute)
+	for i := 0; i < 10; i++ {
+		b.failure()
+	}
+
+	if !b.allow() || b.state != circuitClosed {
+		t.Fatalf("expected a zero threshold to never open the circuit, got %s", b.state)
+	}
+}
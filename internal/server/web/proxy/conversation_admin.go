@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminKeyTag marks the keys whose holders may use the admin conversation
+// endpoints, which see the conversations of every user.
+const adminKeyTag = "admin"
+
+const (
+	defaultAdminConversationsLimit = 50
+	maxAdminConversationsLimit     = 500
+)
+
+// AdminListConversations lists the conversations of all users, most
+// recently updated first. Pages hold up to limit conversations, and the
+// next page is requested by passing the returned next_before and
+// next_before_id as before and before_id.
+func (h *ConversationHandler) AdminListConversations(c *gin.Context) {
+	if !c.GetBool("isAdmin") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "an admin key is required"})
+		return
+	}
+
+	limit := defaultAdminConversationsLimit
+	if value := c.Query("limit"); len(value) != 0 {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxAdminConversationsLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxAdminConversationsLimit)})
+			return
+		}
+		limit = n
+	}
+
+	before, ok := parseTimeQuery(c, "before")
+	if !ok {
+		return
+	}
+
+	convs, err := h.store.GetAllConversations(limit, before, c.Query("before_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := gin.H{"conversations": convs}
+	if len(convs) == limit {
+		res["next_before"] = convs[len(convs)-1].UpdatedAt
+		res["next_before_id"] = convs[len(convs)-1].ID
+	}
+	c.JSON(http.StatusOK, res)
+}
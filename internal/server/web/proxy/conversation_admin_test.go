@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConversationHandler_AdminListConversations(t *testing.T) {
+	asAdmin := func(h *ConversationHandler) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("isAdmin", true)
+			h.AdminListConversations(c)
+		}
+	}
+	before := time.Date(2024, 5, 14, 0, 0, 0, 0, time.UTC)
+
+	runConversationHandlerCases(t, http.MethodGet, "/admin/conversations", asAdmin, []conversationHandlerCase{
+		{
+			name:   "default page",
+			userID: "admin-1",
+			path:   "/admin/conversations",
+			store: &mockConversationsStore{getAllConversationsFunc: func(limit int, beforeUpdatedAt time.Time, beforeID string) ([]postgresql.Conversation, error) {
+				if limit != defaultAdminConversationsLimit || !beforeUpdatedAt.IsZero() || len(beforeID) != 0 {
+					return nil, failingStore()
+				}
+				return []postgresql.Conversation{{ID: "conv-1", UserID: "user-1"}, {ID: "conv-2", UserID: "user-2"}}, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetAllConversations"},
+		},
+		{
+			name:   "next page",
+			userID: "admin-1",
+			path:   "/admin/conversations?limit=10&before=2024-05-14T00:00:00Z&before_id=conv-9",
+			store: &mockConversationsStore{getAllConversationsFunc: func(limit int, beforeUpdatedAt time.Time, beforeID string) ([]postgresql.Conversation, error) {
+				if limit != 10 || !beforeUpdatedAt.Equal(before) || beforeID != "conv-9" {
+					return nil, failingStore()
+				}
+				return nil, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetAllConversations"},
+		},
+		{
+			name:           "limit too large",
+			userID:         "admin-1",
+			path:           "/admin/conversations?limit=100000",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "malformed before",
+			userID:         "admin-1",
+			path:           "/admin/conversations?before=yesterday",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "store error",
+			userID: "admin-1",
+			path:   "/admin/conversations",
+			store: &mockConversationsStore{getAllConversationsFunc: func(limit int, beforeUpdatedAt time.Time, beforeID string) ([]postgresql.Conversation, error) {
+				return nil, failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetAllConversations"},
+		},
+	})
+
+	runConversationHandlerCases(t, http.MethodGet, "/admin/conversations", func(h *ConversationHandler) gin.HandlerFunc { return h.AdminListConversations }, []conversationHandlerCase{
+		{
+			name:           "not an admin",
+			userID:         "user-1",
+			path:           "/admin/conversations",
+			expectedStatus: http.StatusForbidden,
+		},
+	})
+}
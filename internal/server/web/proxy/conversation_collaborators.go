@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+// ListCollaborators lists who one of the caller's conversations is shared
+// with.
+func (h *ConversationHandler) ListCollaborators(c *gin.Context) {
+	res, err := h.store.GetConversationShares(c.Param("id"), c.GetString("userId"))
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// GrantCollaborator gives the user userId read or write access to one of
+// the caller's conversations. Granting again changes the permission.
+func (h *ConversationHandler) GrantCollaborator(c *gin.Context) {
+	var req struct {
+		Permission string `json:"permission"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if !postgresql.IsValidSharePermission(req.Permission) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "permission must be read or write"})
+		return
+	}
+	if err := h.store.GrantConversationAccess(c.Param("id"), c.GetString("userId"), c.Param("userId"), req.Permission); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationGrant, c.Param("id"), gin.H{"user_id": c.Param("userId"), "permission": req.Permission})
+	c.JSON(http.StatusOK, gin.H{"conversation_id": c.Param("id"), "shared_with_user_id": c.Param("userId"), "permission": req.Permission})
+}
+
+// RevokeCollaborator takes back a user's access to one of the caller's
+// conversations.
+func (h *ConversationHandler) RevokeCollaborator(c *gin.Context) {
+	if err := h.store.RevokeConversationAccess(c.Param("id"), c.GetString("userId"), c.Param("userId")); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationRevoke, c.Param("id"), gin.H{"user_id": c.Param("userId")})
+	c.JSON(http.StatusOK, gin.H{"conversation_id": c.Param("id"), "shared_with_user_id": c.Param("userId")})
+}
+
+// requireWriteAccess lets owners and write collaborators of a conversation
+// through. Otherwise it writes a 404, or a 403 for read-only collaborators,
+// and returns false.
+func requireWriteAccess(c *gin.Context, store conversationsStore, id string) bool {
+	permission, err := store.GetConversationPermission(id, c.GetString("userId"))
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return false
+	}
+	if permission == postgresql.PermissionRead {
+		c.JSON(http.StatusForbidden, gin.H{"error": "conversation is shared read-only"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConversationHandler_ListCollaborators(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/conversations/:id/collaborators", func(h *ConversationHandler) gin.HandlerFunc { return h.ListCollaborators }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/collaborators",
+			store: &mockConversationsStore{getSharesFunc: func(id, ownerID string) ([]postgresql.ConversationShare, error) {
+				if id != "conv-1" || ownerID != "user-1" {
+					return nil, failingStore()
+				}
+				return []postgresql.ConversationShare{{ConversationID: id, SharedWithUserID: "user-2", Permission: postgresql.PermissionRead}}, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversationShares"},
+		},
+		{
+			name:   "another user's conversation",
+			userID: "user-2",
+			path:   "/api/v1/conversations/conv-1/collaborators",
+			store: &mockConversationsStore{getSharesFunc: func(id, ownerID string) ([]postgresql.ConversationShare, error) {
+				return nil, missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetConversationShares"},
+		},
+	})
+}
+
+func TestConversationHandler_GrantCollaborator(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPut, "/api/v1/conversations/:id/collaborators/:userId", func(h *ConversationHandler) gin.HandlerFunc { return h.GrantCollaborator }, []conversationHandlerCase{
+		{
+			name:   "write access",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/collaborators/user-2",
+			body:   `{"permission":"write"}`,
+			store: &mockConversationsStore{grantAccessFunc: func(id, ownerID, userID, permission string) error {
+				if id != "conv-1" || ownerID != "user-1" || userID != "user-2" || permission != postgresql.PermissionWrite {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GrantConversationAccess"},
+		},
+		{
+			name:           "invalid permission",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/collaborators/user-2",
+			body:           `{"permission":"owner"}`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "sharing with the owner",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/collaborators/user-1",
+			body:   `{"permission":"read"}`,
+			store: &mockConversationsStore{grantAccessFunc: func(id, ownerID, userID, permission string) error {
+				return internal_errors.NewValidationError("a conversation cannot be shared with its owner")
+			}},
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  []string{"GrantConversationAccess"},
+		},
+		{
+			name:   "another user's conversation",
+			userID: "user-3",
+			path:   "/api/v1/conversations/conv-1/collaborators/user-2",
+			body:   `{"permission":"read"}`,
+			store: &mockConversationsStore{grantAccessFunc: func(id, ownerID, userID, permission string) error {
+				return missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GrantConversationAccess"},
+		},
+		{
+			name:           "invalid body",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/collaborators/user-2",
+			body:           `{`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestConversationHandler_RevokeCollaborator(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodDelete, "/api/v1/conversations/:id/collaborators/:userId", func(h *ConversationHandler) gin.HandlerFunc { return h.RevokeCollaborator }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/collaborators/user-2",
+			store: &mockConversationsStore{revokeAccessFunc: func(id, ownerID, userID string) error {
+				if id != "conv-1" || ownerID != "user-1" || userID != "user-2" {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"RevokeConversationAccess"},
+		},
+		{
+			name:   "not a collaborator",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/collaborators/user-3",
+			store: &mockConversationsStore{revokeAccessFunc: func(id, ownerID, userID string) error {
+				return internal_errors.NewNotFoundError("collaborator is not found")
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"RevokeConversationAccess"},
+		},
+	})
+}
+
+func TestChatCompletionAliasHandler_ReadOnlyCollaborator(t *testing.T) {
+	called := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer upstream.Close()
+
+	store := &mockConversationsStore{
+		getConversationFunc: func(id string) (*postgresql.Conversation, error) {
+			return &postgresql.Conversation{ID: id, UserID: "owner"}, nil
+		},
+		getPermissionFunc: func(id, userID string) (string, error) {
+			return postgresql.PermissionRead, nil
+		},
+	}
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set(conversationIdHeader, "conv-1")
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if called {
+		t.Fatal("expected a read-only collaborator not to reach the upstream")
+	}
+	if strings.Join(store.calls, ",") != "GetConversation,GetConversationPermission" {
+		t.Fatalf("unexpected store calls %v", store.calls)
+	}
+}
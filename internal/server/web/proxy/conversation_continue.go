@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/bricks-cloud/bricksllm/internal/util"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// continuePrompt asks the model to pick up a reply that hit the length limit.
+const continuePrompt = "Continue exactly where you left off, without repeating anything."
+
+// continueHistory returns the assistant reply to continue, which must be the
+// last message and must have stopped at the length limit.
+func continueHistory(msgs []postgresql.Message) (postgresql.Message, bool) {
+	if len(msgs) == 0 {
+		return postgresql.Message{}, false
+	}
+
+	last := msgs[len(msgs)-1]
+	return last, last.Role == "assistant" && last.FinishReason == "length"
+}
+
+// getContinueHandler extends the last assistant reply of a conversation when
+// it was cut off at the length limit. The continuation is appended to the
+// stored reply instead of being saved as a new message.
+func getContinueHandler(prod bool, client http.Client, baseUrl string, cs conversationsStore, cfg AliasConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := util.GetLogFromCtx(c)
+		telemetry.Incr("bricksllm.proxy.continue_handler.requests", requestIdTags(c), 1)
+
+		if c == nil || c.Request == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "context is empty"})
+			return
+		}
+
+		params, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+
+		if len(bytes.TrimSpace(params)) == 0 {
+			params = []byte("{}")
+		}
+
+		if !gjson.ValidBytes(params) || !gjson.ParseBytes(params).IsObject() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+
+		if len(gjson.GetBytes(params, "model").String()) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+			return
+		}
+
+		if !checkAllowedModel(c, params, cfg.AllowedModels) {
+			return
+		}
+
+		conv, err := cs.GetConversation(c.Param("id"))
+		if err != nil {
+			writeConversationStoreError(c, err)
+			return
+		}
+
+		if conv.UserID != c.GetString("userId") && !requireWriteAccess(c, cs, conv.ID) {
+			return
+		}
+
+		if conv.OverBudget() {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "conversation token budget exhausted"})
+			return
+		}
+
+		msgs, err := cs.GetMessages(conv.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		msgs = primaryMessages(msgs)
+
+		last, ok := continueHistory(msgs)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "last message is not an assistant reply cut off at the length limit"})
+			return
+		}
+
+		history := append(msgs, postgresql.Message{Role: "user", Content: continuePrompt})
+		systemPrompt, err := conversationSystemPrompt(conv, c.GetString("userId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		body, err := regenerateRequestBody(params, conv.DefaultParams, systemPrompt, history)
+		if err != nil {
+			logError(log, "error when building continue request body", prod, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build continue request"})
+			return
+		}
+
+		ctx, cancel := aliasRequestContext(c, false)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseUrl+"/v1/chat/completions", bytes.NewReader(body))
+		if err != nil {
+			logError(log, "error when creating continue http request", prod, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create continue request"})
+			return
+		}
+
+		copyHttpHeaders(c.Request, req, c.GetBool("removeUserAgent"))
+		setUpstreamDefaultHeaders(req, cfg)
+		setUpstreamApiKey(req, cfg)
+		forwardRequestId(c, req)
+		req.Header.Del("Accept-Encoding")
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := client.Do(req)
+		if err != nil {
+			logError(log, "error when sending continue request upstream", prod, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to send continue request upstream"})
+			return
+		}
+		defer res.Body.Close()
+
+		resBody, err := decodedAliasBody(res)
+		if err != nil {
+			logError(log, "error when decoding continue upstream response", prod, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to decode upstream response"})
+			return
+		}
+		defer resBody.Close()
+
+		data, err := io.ReadAll(resBody)
+		if err != nil {
+			logError(log, "error when reading continue upstream response", prod, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to read upstream response"})
+			return
+		}
+
+		if res.StatusCode != http.StatusOK {
+			telemetry.Incr("bricksllm.proxy.continue_handler.upstream_error", nil, 1)
+			c.Data(res.StatusCode, res.Header.Get("Content-Type"), data)
+			return
+		}
+
+		completion := parseAliasCompletion(data, false)
+		completion.estimateUsage(body)
+
+		last.Content += completion.content
+		last.FinishReason = completion.finishReason
+		last.CompletionTokens += completion.completionTokens
+		if err := cs.UpdateMessageContent(last.ID, last.Content, last.FinishReason, completion.completionTokens); err != nil {
+			if _, ok := err.(notFoundError); ok {
+				c.JSON(http.StatusConflict, gin.H{"error": "conversation changed while continuing"})
+				return
+			}
+
+			logError(log, "error when storing continued assistant message", prod, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, last)
+	}
+}
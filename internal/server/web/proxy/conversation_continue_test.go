@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func TestContinueHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		messages        []postgresql.Message
+		expectedStatus  int
+		expectedContent string
+	}{
+		{
+			name: "appends to a reply cut off at the length limit",
+			messages: []postgresql.Message{
+				{ID: "m1", Role: "user", Content: "tell me a story"},
+				{ID: "m2", Role: "assistant", Content: "once upon", FinishReason: "length", CompletionTokens: 3},
+			},
+			expectedStatus:  http.StatusOK,
+			expectedContent: "once upon a time",
+		},
+		{
+			name: "reply finished normally",
+			messages: []postgresql.Message{
+				{ID: "m1", Role: "user", Content: "hi"},
+				{ID: "m2", Role: "assistant", Content: "hello", FinishReason: "stop"},
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "last message is from the user",
+			messages: []postgresql.Message{
+				{ID: "m1", Role: "user", Content: "hi"},
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "empty conversation",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []byte
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent, _ = io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":" a time"},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":2}}`))
+			}))
+			defer upstream.Close()
+
+			var updatedID, updatedContent, updatedReason string
+			var updatedTokens int
+			store := &mockConversationsStore{
+				getConversationFunc: func(id string) (*postgresql.Conversation, error) {
+					return &postgresql.Conversation{ID: id}, nil
+				},
+				getMessagesFunc: func(conversationID string) ([]postgresql.Message, error) {
+					return tt.messages, nil
+				},
+				updateMessageContentFunc: func(id, content, finishReason string, completionTokens int) error {
+					updatedID, updatedContent, updatedReason, updatedTokens = id, content, finishReason, completionTokens
+					return nil
+				},
+			}
+			router := newAliasTestRouter(http.MethodPost, "/api/v1/conversations/:id/continue", getContinueHandler(false, http.Client{}, upstream.URL, store, AliasConfig{}))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations/conv-1/continue", strings.NewReader(`{"model":"gpt-4o-mini"}`))
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				if sent != nil || len(updatedID) != 0 {
+					t.Fatal("expected a rejected continue not to reach upstream or the store")
+				}
+				return
+			}
+
+			roles := gjson.GetBytes(sent, "messages.#.role").String()
+			if roles != `["user","assistant","user"]` {
+				t.Fatalf("expected the truncated reply and a continue prompt to be sent, got roles %s", roles)
+			}
+
+			if updatedID != "m2" || updatedContent != tt.expectedContent || updatedReason != "stop" || updatedTokens != 2 {
+				t.Fatalf("unexpected update of %q to %q (%q, %d tokens)", updatedID, updatedContent, updatedReason, updatedTokens)
+			}
+			if content := gjson.Get(rec.Body.String(), "content").String(); content != tt.expectedContent {
+				t.Fatalf("expected the continued reply %q in the response, got %q", tt.expectedContent, content)
+			}
+		})
+	}
+}
+
+func TestContinueHandler_Collaborators(t *testing.T) {
+	tests := []struct {
+		name           string
+		permission     string
+		expectedStatus int
+	}{
+		{name: "write collaborator", permission: postgresql.PermissionWrite, expectedStatus: http.StatusOK},
+		{name: "read collaborator", permission: postgresql.PermissionRead, expectedStatus: http.StatusForbidden},
+		{name: "not shared", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":" a time"},"finish_reason":"stop"}]}`))
+			}))
+			defer upstream.Close()
+
+			updated := false
+			store := &mockConversationsStore{
+				getConversationFunc: func(id string) (*postgresql.Conversation, error) {
+					return &postgresql.Conversation{ID: id, UserID: "owner"}, nil
+				},
+				getPermissionFunc: func(id, userID string) (string, error) {
+					if len(tt.permission) == 0 {
+						return "", missingConversation()
+					}
+					return tt.permission, nil
+				},
+				getMessagesFunc: func(conversationID string) ([]postgresql.Message, error) {
+					return []postgresql.Message{{ID: "m1", Role: "user", Content: "tell me a story"}, {ID: "m2", Role: "assistant", Content: "once upon", FinishReason: "length"}}, nil
+				},
+				updateMessageContentFunc: func(id, content, finishReason string, completionTokens int) error {
+					updated = true
+					return nil
+				},
+			}
+			router := newAliasTestRouter(http.MethodPost, "/api/v1/conversations/:id/continue",
+				func(c *gin.Context) { c.Set("userId", "user-2") },
+				getContinueHandler(false, http.Client{}, upstream.URL, store, AliasConfig{}),
+			)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/conversations/conv-1/continue", strings.NewReader(`{"model":"gpt-4o-mini"}`)))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if updated != (tt.expectedStatus == http.StatusOK) {
+				t.Fatalf("expected the reply to be updated only for write access, got %t", updated)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+var markdownRoleHeadings = map[string]string{
+	"user":      "**User:**",
+	"assistant": "**Assistant:**",
+	"system":    "**System:**",
+	"tool":      "**Tool:**",
+	"function":  "**Function:**",
+}
+
+// renderConversationMarkdown writes the title as a heading followed by each
+// message under its role. Content is kept verbatim so code blocks survive.
+func renderConversationMarkdown(conv *postgresql.Conversation, msgs []postgresql.Message) string {
+	b := strings.Builder{}
+	if len(conv.Title) != 0 {
+		b.WriteString("# " + conv.Title + "\n\n")
+	}
+
+	for _, m := range msgs {
+		heading, ok := markdownRoleHeadings[m.Role]
+		if !ok {
+			heading = "**" + m.Role + ":**"
+		}
+		b.WriteString(heading + "\n\n")
+		b.WriteString(strings.TrimRight(m.Content, "\n") + "\n\n")
+	}
+
+	return b.String()
+}
+
+// ExportConversationMarkdown serves a conversation the caller owns or
+// collaborates on as Markdown, ready to paste into documents.
+func (h *ConversationHandler) ExportConversationMarkdown(c *gin.Context) {
+	conv, err := h.store.GetConversation(c.Param("id"))
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	if conv.UserID != c.GetString("userId") {
+		// collaborators can read it too
+		if _, err := h.store.GetConversationPermission(conv.ID, c.GetString("userId")); err != nil {
+			writeConversationStoreError(c, err)
+			return
+		}
+	}
+	msgs, err := h.store.GetMessagesForUser(conv.ID, conv.UserID)
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(renderConversationMarkdown(conv, msgs)))
+}
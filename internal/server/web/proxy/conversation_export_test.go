@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConversationHandler_ExportConversationMarkdown(t *testing.T) {
+	ownMessages := func(conversationID, userID string) ([]postgresql.Message, error) {
+		return nil, nil
+	}
+
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/conversations/:id/export.md", func(h *ConversationHandler) gin.HandlerFunc { return h.ExportConversationMarkdown }, []conversationHandlerCase{
+		{
+			name:           "success",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/export.md",
+			store:          &mockConversationsStore{getConversationFunc: ownConversation, getMessagesForUserFunc: ownMessages},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversation", "GetMessagesForUser"},
+		},
+		{
+			name:   "another user's conversation",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/export.md",
+			store: &mockConversationsStore{getConversationFunc: otherConversation, getPermissionFunc: func(id, userID string) (string, error) {
+				return "", missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetConversation", "GetConversationPermission"},
+		},
+		{
+			name:   "shared with the user",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/export.md",
+			store: &mockConversationsStore{getConversationFunc: otherConversation, getMessagesForUserFunc: ownMessages, getPermissionFunc: func(id, userID string) (string, error) {
+				return postgresql.PermissionRead, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversation", "GetConversationPermission", "GetMessagesForUser"},
+		},
+		{
+			name:   "not found",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/export.md",
+			store: &mockConversationsStore{getConversationFunc: func(id string) (*postgresql.Conversation, error) {
+				return nil, missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetConversation"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/export.md",
+			store: &mockConversationsStore{getConversationFunc: ownConversation, getMessagesForUserFunc: func(conversationID, userID string) ([]postgresql.Message, error) {
+				return nil, failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetConversation", "GetMessagesForUser"},
+		},
+	})
+}
+
+func TestConversationHandler_ExportConversationMarkdown_Body(t *testing.T) {
+	store := &mockConversationsStore{
+		getConversationFunc: func(id string) (*postgresql.Conversation, error) {
+			return &postgresql.Conversation{ID: id, UserID: "user-1", Title: "Sorting"}, nil
+		},
+		getMessagesForUserFunc: func(conversationID, userID string) ([]postgresql.Message, error) {
+			return []postgresql.Message{
+				{Role: "user", Content: "Sort a *list* in Go"},
+				{Role: "assistant", Content: "```go\nsort.Ints(xs)\n```\n"},
+			}, nil
+		},
+	}
+
+	router := newAliasTestRouter(http.MethodGet, "/api/v1/conversations/:id/export.md",
+		func(c *gin.Context) { c.Set("userId", "user-1") },
+		NewConversationHandler(store).ExportConversationMarkdown,
+	)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/conversations/conv-1/export.md", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/markdown; charset=utf-8" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	expected := "# Sorting\n\n**User:**\n\nSort a *list* in Go\n\n**Assistant:**\n\n```go\nsort.Ints(xs)\n```\n\n"
+	if rec.Body.String() != expected {
+		t.Fatalf("expected body %q, got %q", expected, rec.Body.String())
+	}
+}
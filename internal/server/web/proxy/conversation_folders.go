@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// folderName trims name and checks that it fits the folders.name column.
+func folderName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	return name, len(name) != 0 && utf8.RuneCountInString(name) <= postgresql.MaxFolderNameLength
+}
+
+func (h *ConversationHandler) ListFolders(c *gin.Context) {
+	userID := c.GetString("userId")
+	if userID == "" {
+		c.JSON(http.StatusOK, []interface{}{})
+		return
+	}
+	res, err := h.store.GetFoldersByUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *ConversationHandler) CreateFolder(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	name, ok := folderName(req.Name)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required and must be at most 255 characters"})
+		return
+	}
+	now := time.Now()
+	f := postgresql.Folder{
+		ID:        uuid.NewString(),
+		UserID:    c.GetString("userId"),
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := h.store.CreateFolder(f); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAudit(c, h.audit, auditFolderCreate, f.ID, gin.H{"name": f.Name})
+	c.JSON(http.StatusOK, f)
+}
+
+func (h *ConversationHandler) RenameFolder(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	name, ok := folderName(req.Name)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required and must be at most 255 characters"})
+		return
+	}
+	if err := h.store.RenameFolder(c.Param("id"), c.GetString("userId"), name); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditFolderRename, c.Param("id"), gin.H{"name": name})
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "name": name})
+}
+
+// DeleteFolder removes a folder. Its conversations are not deleted, they
+// just no longer belong to a folder.
+func (h *ConversationHandler) DeleteFolder(c *gin.Context) {
+	if err := h.store.DeleteFolder(c.Param("id"), c.GetString("userId")); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditFolderDelete, c.Param("id"), nil)
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "deleted": true})
+}
+
+// SetConversationFolder moves a conversation into the body's folder_id, or
+// out of its folder when folder_id is null or empty.
+func (h *ConversationHandler) SetConversationFolder(c *gin.Context) {
+	var req struct {
+		FolderID *string `json:"folder_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	folderID := ""
+	if req.FolderID != nil {
+		folderID = *req.FolderID
+	}
+	if err := h.store.SetConversationFolder(c.Param("id"), c.GetString("userId"), folderID); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationFolder, c.Param("id"), gin.H{"folder_id": folderID})
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "folder_id": req.FolderID})
+}
@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+func missingFolder() error {
+	return internal_errors.NewNotFoundError("folder is not found")
+}
+
+func TestConversationHandler_ListFolders(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/folders", func(h *ConversationHandler) gin.HandlerFunc { return h.ListFolders }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/folders",
+			store: &mockConversationsStore{getFoldersByUserFunc: func(userID string) ([]postgresql.Folder, error) {
+				return []postgresql.Folder{{ID: "folder-1", UserID: userID, Name: "work"}}, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetFoldersByUser"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/folders",
+			store: &mockConversationsStore{getFoldersByUserFunc: func(userID string) ([]postgresql.Folder, error) {
+				return nil, failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetFoldersByUser"},
+		},
+		{
+			name:           "missing userId",
+			path:           "/api/v1/folders",
+			expectedStatus: http.StatusOK,
+		},
+	})
+}
+
+func TestConversationHandler_CreateFolder(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/folders", func(h *ConversationHandler) gin.HandlerFunc { return h.CreateFolder }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/folders",
+			body:   `{"name":" work "}`,
+			store: &mockConversationsStore{createFolderFunc: func(f postgresql.Folder) error {
+				if f.Name != "work" || f.UserID != "user-1" {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"CreateFolder"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/folders",
+			body:   `{"name":"work"}`,
+			store: &mockConversationsStore{createFolderFunc: func(f postgresql.Folder) error {
+				return failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"CreateFolder"},
+		},
+		{
+			name:           "blank name",
+			userID:         "user-1",
+			path:           "/api/v1/folders",
+			body:           `{"name":"  "}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "bad body",
+			userID:         "user-1",
+			path:           "/api/v1/folders",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestConversationHandler_RenameFolder(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPut, "/api/v1/folders/:id", func(h *ConversationHandler) gin.HandlerFunc { return h.RenameFolder }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/folders/folder-1",
+			body:   `{"name":"personal"}`,
+			store: &mockConversationsStore{renameFolderFunc: func(id, userID, name string) error {
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"RenameFolder"},
+		},
+		{
+			name:   "another user's folder",
+			userID: "user-2",
+			path:   "/api/v1/folders/folder-1",
+			body:   `{"name":"personal"}`,
+			store: &mockConversationsStore{renameFolderFunc: func(id, userID, name string) error {
+				return missingFolder()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"RenameFolder"},
+		},
+		{
+			name:           "blank name",
+			userID:         "user-1",
+			path:           "/api/v1/folders/folder-1",
+			body:           `{"name":""}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestConversationHandler_DeleteFolder(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodDelete, "/api/v1/folders/:id", func(h *ConversationHandler) gin.HandlerFunc { return h.DeleteFolder }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/folders/folder-1",
+			store: &mockConversationsStore{deleteFolderFunc: func(id, userID string) error {
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"DeleteFolder"},
+		},
+		{
+			name:   "another user's folder",
+			userID: "user-2",
+			path:   "/api/v1/folders/folder-1",
+			store: &mockConversationsStore{deleteFolderFunc: func(id, userID string) error {
+				return missingFolder()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"DeleteFolder"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/folders/folder-1",
+			store: &mockConversationsStore{deleteFolderFunc: func(id, userID string) error {
+				return failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"DeleteFolder"},
+		},
+	})
+}
+
+func TestConversationHandler_SetConversationFolder(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPut, "/api/v1/conversations/:id/folder", func(h *ConversationHandler) gin.HandlerFunc { return h.SetConversationFolder }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/folder",
+			body:   `{"folder_id":"folder-1"}`,
+			store: &mockConversationsStore{setConversationFolderFunc: func(id, userID, folderID string) error {
+				if folderID != "folder-1" {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"SetConversationFolder"},
+		},
+		{
+			name:   "null clears the folder",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/folder",
+			body:   `{"folder_id":null}`,
+			store: &mockConversationsStore{setConversationFolderFunc: func(id, userID, folderID string) error {
+				if folderID != "" {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"SetConversationFolder"},
+		},
+		{
+			name:   "another user's folder",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/folder",
+			body:   `{"folder_id":"folder-2"}`,
+			store: &mockConversationsStore{setConversationFolderFunc: func(id, userID, folderID string) error {
+				return missingFolder()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"SetConversationFolder"},
+		},
+		{
+			name:           "bad body",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/folder",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
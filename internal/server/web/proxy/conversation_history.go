@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// isServerHistoryRequest reports whether a chat completion request leaves the
+// history to the server, i.e. names a conversation and carries only the new
+// prompt instead of a messages array.
+func isServerHistoryRequest(body []byte) bool {
+	return len(gjson.GetBytes(body, "conversation_id").String()) != 0 && !gjson.GetBytes(body, "messages").Exists()
+}
+
+// TrimMessages drops the oldest non-system messages until the estimated
+// size of msgs fits in maxTokens, using the default token estimate. See
+// TrimMessagesWith.
+func TrimMessages(msgs []postgresql.Message, maxTokens int) []postgresql.Message {
+	return TrimMessagesWith(msgs, maxTokens, estimateTokens)
+}
+
+// TrimMessagesWith drops the oldest non-system messages until their size,
+// counted with estimate, fits in maxTokens. A zero limit is disabled. System
+// messages and the newest message are always kept, so the result may still
+// exceed maxTokens, and a tool or function result is dropped along with the
+// messages before it since its call would be gone.
+func TrimMessagesWith(msgs []postgresql.Message, maxTokens int, estimate TokenEstimator) []postgresql.Message {
+	if maxTokens <= 0 || len(msgs) == 0 {
+		return msgs
+	}
+
+	total := 0
+	for _, m := range msgs {
+		total += 4 + estimate(m.Content)
+	}
+	if total <= maxTokens {
+		return msgs
+	}
+
+	kept := make([]postgresql.Message, 0, len(msgs))
+	trimming, dropped := true, false
+	for i, m := range msgs {
+		if m.Role == "system" || i == len(msgs)-1 {
+			kept = append(kept, m)
+			continue
+		}
+
+		if trimming && (total > maxTokens || (dropped && isToolResult(m))) {
+			total -= 4 + estimate(m.Content)
+			dropped = true
+			continue
+		}
+
+		trimming = false
+		kept = append(kept, m)
+	}
+
+	return kept
+}
+
+func isToolResult(m postgresql.Message) bool {
+	return m.Role == "tool" || m.Role == "function"
+}
+
+// trimHistory keeps at most the newest maxMessages messages, without a
+// leading tool or function result, and then trims them to maxTokens. A zero
+// limit is disabled.
+func trimHistory(msgs []postgresql.Message, maxMessages, maxTokens int, estimate TokenEstimator) []postgresql.Message {
+	if maxMessages > 0 && len(msgs) > maxMessages {
+		start := len(msgs) - maxMessages
+		for start < len(msgs)-1 && isToolResult(msgs[start]) {
+			start++
+		}
+		msgs = msgs[start:]
+	}
+
+	return TrimMessagesWith(msgs, maxTokens, estimate)
+}
+
+// historyCompressor condenses the messages trimming dropped into a single
+// message sent in their place. It reports false when it cannot, in which
+// case the dropped messages are left out entirely.
+type historyCompressor func(dropped []postgresql.Message) (postgresql.Message, bool)
+
+// serverHistoryRequestBody turns a {"conversation_id", "content"} request
+// into a regular chat completion request whose messages are the stored
+// history followed by the new user prompt. Other parameters, e.g. model or
+// stream, are kept. A non-nil compress is given the messages trimming drops.
+// The conversation's system prompt goes first unless the history has its
+// own, since a summary sent in place of dropped messages is a system message
+// too and would otherwise keep prependSystemPrompt from adding it.
+func serverHistoryRequestBody(body []byte, systemPrompt string, history []postgresql.Message, cfg AliasConfig, compress historyCompressor) ([]byte, error) {
+	content := gjson.GetBytes(body, "content")
+	if !content.Exists() || (content.Type == gjson.String && len(content.String()) == 0) {
+		return nil, errors.New("content is required")
+	}
+	if content.Type != gjson.String && !content.IsArray() {
+		return nil, errors.New("content must be a string or an array of content parts")
+	}
+
+	prompt := newConversationMessage("", "user", content.String())
+	if content.IsArray() {
+		prompt.ContentJSON = json.RawMessage(content.Raw)
+		prompt.Content = postgresql.ContentText(prompt.ContentJSON)
+	}
+	estimate := cfg.TokenEstimator
+	if estimate == nil {
+		estimate = estimateTokens
+	}
+	history = append(history, prompt)
+	trimmed := trimHistory(history, cfg.HistoryMaxMessages, cfg.HistoryMaxTokens, estimate)
+	hasSystem := false
+	for _, m := range trimmed {
+		hasSystem = hasSystem || m.Role == "system"
+	}
+
+	if compress != nil && len(trimmed) < len(history) {
+		if summary, ok := compress(droppedMessages(history, trimmed)); ok {
+			trimmed = append([]postgresql.Message{summary}, trimmed...)
+		}
+	}
+
+	if !hasSystem && len(systemPrompt) != 0 {
+		trimmed = append([]postgresql.Message{{Role: "system", Content: systemPrompt}}, trimmed...)
+	}
+
+	data, err := json.Marshal(historyMessages(trimmed))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range []string{"conversation_id", "content"} {
+		if body, err = sjson.DeleteBytes(body, key); err != nil {
+			return nil, err
+		}
+	}
+
+	return sjson.SetRawBytes(body, "messages", data)
+}
+
+// droppedMessages returns the messages of history, in order, that trimming
+// left out of kept.
+func droppedMessages(history, kept []postgresql.Message) []postgresql.Message {
+	ids := map[string]bool{}
+	for _, m := range kept {
+		ids[m.ID] = true
+	}
+
+	dropped := []postgresql.Message{}
+	for _, m := range history {
+		if !ids[m.ID] {
+			dropped = append(dropped, m)
+		}
+	}
+
+	return dropped
+}
@@ -0,0 +1,308 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func TestTrimHistory(t *testing.T) {
+	msgs := []postgresql.Message{
+		{ID: "m1", Role: "user", Content: strings.Repeat("a", 40)},
+		{ID: "m2", Role: "assistant", Content: strings.Repeat("b", 40)},
+		{ID: "m3", Role: "tool", Content: strings.Repeat("c", 40)},
+		{ID: "m4", Role: "assistant", Content: strings.Repeat("d", 40)},
+		{ID: "m5", Role: "user", Content: strings.Repeat("e", 40)},
+	}
+
+	tests := []struct {
+		name        string
+		maxMessages int
+		maxTokens   int
+		expectedIDs string
+	}{
+		{name: "no limits", expectedIDs: "m1,m2,m3,m4,m5"},
+		{name: "message limit", maxMessages: 4, expectedIDs: "m2,m3,m4,m5"},
+		{name: "orphaned tool result is dropped", maxMessages: 3, expectedIDs: "m4,m5"},
+		{name: "token limit", maxTokens: 30, expectedIDs: "m4,m5"},
+		{name: "newest message is always kept", maxTokens: 1, expectedIDs: "m5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := []string{}
+			for _, m := range trimHistory(msgs, tt.maxMessages, tt.maxTokens, estimateTokens) {
+				ids = append(ids, m.ID)
+			}
+			if strings.Join(ids, ",") != tt.expectedIDs {
+				t.Fatalf("expected %s, got %s", tt.expectedIDs, strings.Join(ids, ","))
+			}
+		})
+	}
+}
+
+func TestTrimMessages_KeepsSystemMessages(t *testing.T) {
+	msgs := []postgresql.Message{
+		{ID: "s1", Role: "system", Content: strings.Repeat("a", 400)},
+		{ID: "m1", Role: "user", Content: strings.Repeat("b", 40)},
+		{ID: "m2", Role: "assistant", Content: strings.Repeat("c", 40)},
+		{ID: "s2", Role: "system", Content: strings.Repeat("d", 40)},
+		{ID: "m3", Role: "user", Content: strings.Repeat("e", 40)},
+	}
+
+	tests := []struct {
+		name        string
+		maxTokens   int
+		estimate    TokenEstimator
+		expectedIDs string
+	}{
+		{name: "fits", maxTokens: 1000, expectedIDs: "s1,m1,m2,s2,m3"},
+		{name: "oldest non-system messages are dropped first", maxTokens: 150, expectedIDs: "s1,m2,s2,m3"},
+		{name: "system messages survive a budget they exceed", maxTokens: 10, expectedIDs: "s1,s2,m3"},
+		{
+			name:        "custom estimator",
+			maxTokens:   24,
+			estimate:    func(string) int { return 1 },
+			expectedIDs: "s1,m2,s2,m3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var trimmed []postgresql.Message
+			if tt.estimate == nil {
+				trimmed = TrimMessages(msgs, tt.maxTokens)
+			} else {
+				trimmed = TrimMessagesWith(msgs, tt.maxTokens, tt.estimate)
+			}
+
+			ids := []string{}
+			for _, m := range trimmed {
+				ids = append(ids, m.ID)
+			}
+			if strings.Join(ids, ",") != tt.expectedIDs {
+				t.Fatalf("expected %s, got %s", tt.expectedIDs, strings.Join(ids, ","))
+			}
+		})
+	}
+}
+
+type historyStore struct {
+	conversationsStore
+	history  []postgresql.Message
+	created  []postgresql.Message
+	metadata json.RawMessage
+	updated  json.RawMessage
+}
+
+func (s *historyStore) GetMessagesForUser(conversationID, userID string) ([]postgresql.Message, error) {
+	if conversationID != "conv-1" || userID != "user-1" {
+		return nil, internal_errors.NewNotFoundError("conversation is not found")
+	}
+	return s.history, nil
+}
+
+func (s *historyStore) GetConversation(id string) (*postgresql.Conversation, error) {
+	return &postgresql.Conversation{ID: id, UserID: "user-1", SystemPrompt: "be brief", Metadata: s.metadata}, nil
+}
+
+func (s *historyStore) UpdateConversationMetadata(id, userID string, metadata json.RawMessage) error {
+	s.updated = metadata
+	return nil
+}
+
+func (s *historyStore) CreateMessage(m postgresql.Message) error {
+	s.created = append(s.created, m)
+	return nil
+}
+
+func TestChatCompletionAliasHandler_ServerHistory(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		body           string
+		expectedStatus int
+		expectedRoles  string
+	}{
+		{
+			name:           "history is loaded and only the prompt is stored",
+			userID:         "user-1",
+			body:           `{"model":"gpt-4o-mini","conversation_id":"conv-1","content":"and now?"}`,
+			expectedStatus: http.StatusOK,
+			expectedRoles:  `["system","user","assistant","user"]`,
+		},
+		{
+			name:           "another user's conversation",
+			userID:         "user-2",
+			body:           `{"model":"gpt-4o-mini","conversation_id":"conv-1","content":"and now?"}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "missing content",
+			userID:         "user-1",
+			body:           `{"model":"gpt-4o-mini","conversation_id":"conv-1"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []byte
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent, _ = io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"done"},"finish_reason":"stop"}]}`))
+			}))
+			defer upstream.Close()
+
+			store := &historyStore{history: []postgresql.Message{
+				{ID: "m1", Role: "user", Content: "hi"},
+				{ID: "m2", Role: "assistant", Content: "hello"},
+			}}
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions",
+				func(c *gin.Context) {
+					c.Set("userId", tt.userID)
+				},
+				getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{}),
+			)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				if sent != nil || len(store.created) != 0 {
+					t.Fatal("expected a rejected request not to reach upstream or the store")
+				}
+				return
+			}
+
+			if roles := gjson.GetBytes(sent, "messages.#.role").Raw; roles != tt.expectedRoles {
+				t.Fatalf("expected roles %s to be sent upstream, got %s", tt.expectedRoles, roles)
+			}
+			if gjson.GetBytes(sent, "conversation_id").Exists() || gjson.GetBytes(sent, "content").Exists() {
+				t.Fatalf("expected the history fields not to be forwarded, got %s", sent)
+			}
+			if len(store.created) != 2 || store.created[0].Content != "and now?" || store.created[1].Content != "done" {
+				t.Fatalf("expected the prompt and the reply to be stored, got %+v", store.created)
+			}
+		})
+	}
+}
+
+func TestChatCompletionAliasHandler_HistorySummary(t *testing.T) {
+	tests := []struct {
+		name              string
+		metadata          string
+		summaryStatus     int
+		expectedSummaries int
+		expectedSummary   string
+		expectedRoles     string
+		expectedUpdate    string
+	}{
+		{
+			name:              "dropped messages are summarized",
+			summaryStatus:     http.StatusOK,
+			expectedSummaries: 1,
+			expectedSummary:   "user: hi\nassistant: hello\n",
+			expectedRoles:     `["system","system","user","assistant","user"]`,
+			expectedUpdate:    `{"folder":"work","history_summary":{"upto":"m2","content":"they greeted"}}`,
+		},
+		{
+			name:          "stored summary is reused",
+			metadata:      `{"history_summary":{"upto":"m2","content":"they greeted"}}`,
+			summaryStatus: http.StatusOK,
+			expectedRoles: `["system","system","user","assistant","user"]`,
+		},
+		{
+			name:              "stored summary is extended",
+			metadata:          `{"history_summary":{"upto":"m1","content":"they said hi"}}`,
+			summaryStatus:     http.StatusOK,
+			expectedSummaries: 1,
+			expectedSummary:   "summary of earlier messages: they said hi\nassistant: hello\n",
+			expectedRoles:     `["system","system","user","assistant","user"]`,
+			expectedUpdate:    `{"history_summary":{"upto":"m2","content":"they greeted"}}`,
+		},
+		{
+			name:              "failed summary falls back to trimming",
+			summaryStatus:     http.StatusInternalServerError,
+			expectedSummaries: 1,
+			expectedSummary:   "user: hi\nassistant: hello\n",
+			expectedRoles:     `["system","user","assistant","user"]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []byte
+			summaries := 0
+			summarized := ""
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				if gjson.GetBytes(data, "messages.0.content").String() == historySummaryPrompt {
+					summaries++
+					summarized = gjson.GetBytes(data, "messages.1.content").String()
+					w.WriteHeader(tt.summaryStatus)
+					w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"they greeted"},"finish_reason":"stop"}]}`))
+					return
+				}
+				sent = data
+				w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"done"},"finish_reason":"stop"}]}`))
+			}))
+			defer upstream.Close()
+
+			metadata := tt.metadata
+			if len(metadata) == 0 {
+				metadata = `{"folder":"work"}`
+			}
+			store := &historyStore{
+				metadata: json.RawMessage(metadata),
+				history: []postgresql.Message{
+					{ID: "m1", Role: "user", Content: "hi"},
+					{ID: "m2", Role: "assistant", Content: "hello"},
+					{ID: "m3", Role: "user", Content: "how are you?"},
+					{ID: "m4", Role: "assistant", Content: "fine"},
+				},
+			}
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions",
+				func(c *gin.Context) {
+					c.Set("userId", "user-1")
+				},
+				getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{HistoryMaxMessages: 3, HistorySummarize: true}),
+			)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o-mini","conversation_id":"conv-1","content":"and now?"}`)))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+			}
+			if summaries != tt.expectedSummaries {
+				t.Fatalf("expected %d summary requests, got %d", tt.expectedSummaries, summaries)
+			}
+			if tt.expectedSummaries != 0 && summarized != strings.ReplaceAll(tt.expectedSummary, "\\n", "\n") {
+				t.Fatalf("expected %q to be summarized, got %q", tt.expectedSummary, summarized)
+			}
+			if roles := gjson.GetBytes(sent, "messages.#.role").Raw; roles != tt.expectedRoles {
+				t.Fatalf("expected roles %s to be sent upstream, got %s", tt.expectedRoles, roles)
+			}
+			if strings.Count(tt.expectedRoles, "system") == 2 && gjson.GetBytes(sent, "messages.1.content").String() != "Summary of the earlier conversation: they greeted" {
+				t.Fatalf("expected the summary to replace the dropped messages, got %s", sent)
+			}
+			if string(store.updated) != tt.expectedUpdate {
+				t.Fatalf("expected metadata %s to be stored, got %s", tt.expectedUpdate, store.updated)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MergeConversation moves the messages of another of the caller's
+// conversations, source_id, into this one and deletes the source for good.
+func (h *ConversationHandler) MergeConversation(c *gin.Context) {
+	var req struct {
+		SourceID string `json:"source_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if len(req.SourceID) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source_id is required"})
+		return
+	}
+	if err := h.store.MergeConversations(c.Param("id"), req.SourceID, c.GetString("userId")); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationMerge, c.Param("id"), gin.H{"source_id": req.SourceID})
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "merged": req.SourceID})
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConversationHandler_MergeConversation(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations/:id/merge", func(h *ConversationHandler) gin.HandlerFunc { return h.MergeConversation }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/merge",
+			body:   `{"source_id":"conv-2"}`,
+			store: &mockConversationsStore{mergeConversationsFunc: func(targetID, sourceID, userID string) error {
+				if targetID != "conv-1" || sourceID != "conv-2" || userID != "user-1" {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"MergeConversations"},
+		},
+		{
+			name:   "another user's conversation",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/merge",
+			body:   `{"source_id":"conv-3"}`,
+			store: &mockConversationsStore{mergeConversationsFunc: func(targetID, sourceID, userID string) error {
+				return missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"MergeConversations"},
+		},
+		{
+			name:   "merging into itself",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/merge",
+			body:   `{"source_id":"conv-1"}`,
+			store: &mockConversationsStore{mergeConversationsFunc: func(targetID, sourceID, userID string) error {
+				return internal_errors.NewValidationError("cannot merge a conversation into itself")
+			}},
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  []string{"MergeConversations"},
+		},
+		{
+			name:           "missing source",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/merge",
+			body:           `{}`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid body",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/merge",
+			body:           `{`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/tidwall/gjson"
+)
+
+var errInvalidMessageContent = errors.New("content must be a string or an array of content parts")
+
+// parseMessageContent accepts a missing/null value, a string, or an array of
+// content parts such as {"type":"text"} and {"type":"image_url"}. Arrays
+// are returned as parts along with their text rendering.
+func parseMessageContent(raw json.RawMessage) (string, json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return "", nil, nil
+	}
+	if !gjson.ValidBytes(trimmed) {
+		return "", nil, errInvalidMessageContent
+	}
+
+	content := gjson.ParseBytes(trimmed)
+	switch {
+	case content.Type == gjson.String:
+		return content.String(), nil, nil
+	case content.IsArray():
+		for _, part := range content.Array() {
+			if !part.IsObject() || part.Get("type").Type != gjson.String || len(part.Get("type").String()) == 0 {
+				return "", nil, errors.New("every content part must be an object with a type")
+			}
+		}
+		parts := json.RawMessage(trimmed)
+		return postgresql.ContentText(parts), parts, nil
+	default:
+		return "", nil, errInvalidMessageContent
+	}
+}
+
+// messageContent is the content of a stored message as a chat completion
+// expects it: its parts when it has them, otherwise its text. Messages
+// stored before parts had a column of their own kept the array as text.
+func messageContent(m postgresql.Message) interface{} {
+	if len(m.ContentJSON) != 0 {
+		return m.ContentJSON
+	}
+	if gjson.Valid(m.Content) && gjson.Parse(m.Content).IsArray() {
+		return json.RawMessage(m.Content)
+	}
+	return m.Content
+}
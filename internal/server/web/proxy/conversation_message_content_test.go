@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const visionParts = `[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}]`
+
+func TestParseMessageContent(t *testing.T) {
+	tests := []struct {
+		name          string
+		raw           string
+		expectedText  string
+		expectedParts string
+		expectedErr   bool
+	}{
+		{name: "missing"},
+		{name: "null", raw: `null`},
+		{name: "string", raw: `"hi"`, expectedText: "hi"},
+		{name: "content parts", raw: visionParts, expectedText: "What is this?\n[image]", expectedParts: visionParts},
+		{name: "other parts are named", raw: `[{"type":"input_audio","input_audio":{"data":"","format":"wav"}}]`, expectedText: "[input_audio]", expectedParts: `[{"type":"input_audio","input_audio":{"data":"","format":"wav"}}]`},
+		{name: "part without a type", raw: `[{"text":"hi"}]`, expectedErr: true},
+		{name: "part that is not an object", raw: `["hi"]`, expectedErr: true},
+		{name: "object", raw: `{"type":"text","text":"hi"}`, expectedErr: true},
+		{name: "number", raw: `1`, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, parts, err := parseMessageContent(json.RawMessage(tt.raw))
+			if tt.expectedErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text != tt.expectedText || string(parts) != tt.expectedParts {
+				t.Fatalf("expected %q and %s, got %q and %s", tt.expectedText, tt.expectedParts, text, parts)
+			}
+		})
+	}
+}
+
+func TestHistoryMessages_Content(t *testing.T) {
+	data, err := json.Marshal(historyMessages([]postgresql.Message{
+		{Role: "user", Content: "What is this?\n[image]", ContentJSON: json.RawMessage(visionParts)},
+		{Role: "user", Content: visionParts},
+		{Role: "assistant", Content: "A cat."},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := gjson.ParseBytes(data).Array()
+	if !messages[0].Get("content").IsArray() || messages[0].Get("content.1.image_url.url").String() != "https://example.com/cat.png" {
+		t.Fatalf("expected the stored parts to be sent, got %s", messages[0].Raw)
+	}
+	if !messages[1].Get("content").IsArray() {
+		t.Fatalf("expected parts stored as text to still be sent as an array, got %s", messages[1].Raw)
+	}
+	if messages[2].Get("content").String() != "A cat." {
+		t.Fatalf("expected plain text content, got %s", messages[2].Raw)
+	}
+}
+
+func TestConversationHandler_CreateMessageContentParts(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations/:id/messages", func(h *ConversationHandler) gin.HandlerFunc { return h.CreateMessage }, []conversationHandlerCase{
+		{
+			name:   "content parts",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages",
+			body:   `{"role":"user","content":` + visionParts + `}`,
+			store: &mockConversationsStore{getPermissionFunc: ownerPermission, createMessageFunc: func(m postgresql.Message) error {
+				if m.Content != "What is this?\n[image]" || string(m.ContentJSON) != visionParts {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversationPermission", "CreateMessage"},
+		},
+		{
+			name:           "invalid content",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/messages",
+			body:           `{"role":"user","content":{"text":"hi"}}`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestChatCompletionAliasHandler_PersistsContentParts(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"A cat."},"finish_reason":"stop"}]}`))
+	}))
+	defer upstream.Close()
+
+	store := &persistingStore{conv: postgresql.Conversation{ID: "conv-1"}}
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":`+visionParts+`}]}`))
+	req.Header.Set(conversationIdHeader, "conv-1")
+	router.ServeHTTP(rec, req)
+
+	if len(store.messages) != 2 {
+		t.Fatalf("expected the prompt and the reply to be stored, got %+v", store.messages)
+	}
+	prompt := store.messages[0]
+	if prompt.Content != "What is this?\n[image]" || string(prompt.ContentJSON) != visionParts {
+		t.Fatalf("expected the parts and their text to be stored, got %+v", prompt)
+	}
+	if len(store.messages[1].ContentJSON) != 0 {
+		t.Fatalf("expected a text reply to have no parts, got %+v", store.messages[1])
+	}
+}
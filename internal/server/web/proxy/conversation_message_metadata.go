@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// parseMessageMetadata accepts a missing/null value or a JSON object, e.g.
+// {"citations":[...]}, and returns the object to store.
+func parseMessageMetadata(raw json.RawMessage) (json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return json.RawMessage(`{}`), nil
+	}
+	if !gjson.ValidBytes(trimmed) || !gjson.ParseBytes(trimmed).IsObject() {
+		return nil, errors.New("message metadata must be a JSON object")
+	}
+	return json.RawMessage(trimmed), nil
+}
+
+// UpdateMessageMetadata replaces the metadata of a message of one of the
+// caller's conversations, e.g. to attach sources to a stored reply.
+func (h *ConversationHandler) UpdateMessageMetadata(c *gin.Context) {
+	var req struct {
+		Meta json.RawMessage `json:"metadata"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	meta, err := parseMessageMetadata(req.Meta)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.store.UpdateMessageMetadata(c.Param("id"), c.Param("messageId"), c.GetString("userId"), meta); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditMessageMetadata, c.Param("messageId"), gin.H{"conversation_id": c.Param("id")})
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("messageId"), "metadata": meta})
+}
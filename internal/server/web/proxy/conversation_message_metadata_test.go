@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseMessageMetadata(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+		err      bool
+	}{
+		{raw: ``, expected: `{}`},
+		{raw: `null`, expected: `{}`},
+		{raw: ` {"sources":["a"]} `, expected: `{"sources":["a"]}`},
+		{raw: `[]`, err: true},
+		{raw: `"sources"`, err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseMessageMetadata(json.RawMessage(tt.raw))
+		if tt.err {
+			if err == nil {
+				t.Fatalf("%q: expected an error", tt.raw)
+			}
+			continue
+		}
+		if err != nil || string(got) != tt.expected {
+			t.Fatalf("%q: expected %s, got %s (%v)", tt.raw, tt.expected, got, err)
+		}
+	}
+}
+
+func TestConversationHandler_UpdateMessageMetadata(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPut, "/api/v1/conversations/:id/messages/:messageId/metadata", func(h *ConversationHandler) gin.HandlerFunc { return h.UpdateMessageMetadata }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages/msg-1/metadata",
+			body:   `{"metadata":{"citations":[1]}}`,
+			store: &mockConversationsStore{updateMessageMetadataFunc: func(conversationID, messageID, userID string, metadata json.RawMessage) error {
+				if conversationID != "conv-1" || messageID != "msg-1" || userID != "user-1" || string(metadata) != `{"citations":[1]}` {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"UpdateMessageMetadata"},
+		},
+		{
+			name:   "another user's message",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-2/messages/msg-1/metadata",
+			body:   `{"metadata":{}}`,
+			store: &mockConversationsStore{updateMessageMetadataFunc: func(conversationID, messageID, userID string, metadata json.RawMessage) error {
+				return missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"UpdateMessageMetadata"},
+		},
+		{
+			name:           "not an object",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/messages/msg-1/metadata",
+			body:           `{"metadata":42}`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid body",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/messages/msg-1/metadata",
+			body:           `{`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
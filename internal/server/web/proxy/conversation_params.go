@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// UpdateConversationParams replaces the sampling defaults of one of the
+// caller's conversations with the body, e.g. {"temperature": 0.2}. Fields
+// left out have no default, so {} clears them all.
+func (h *ConversationHandler) UpdateConversationParams(c *gin.Context) {
+	var params postgresql.SamplingParams
+	if err := c.BindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if err := params.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.store.UpdateConversationDefaultParams(c.Param("id"), c.GetString("userId"), &params); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationParams, c.Param("id"), nil)
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "default_params": params})
+}
+
+// applyDefaultParams sets the conversation's sampling defaults the request
+// body leaves out. Whatever the client sent wins, and max_completion_tokens
+// counts as max_tokens.
+func applyDefaultParams(body []byte, params *postgresql.SamplingParams) ([]byte, error) {
+	if params == nil {
+		return body, nil
+	}
+
+	var err error
+	if params.Temperature != nil && !gjson.GetBytes(body, "temperature").Exists() {
+		if body, err = sjson.SetBytes(body, "temperature", *params.Temperature); err != nil {
+			return nil, err
+		}
+	}
+	if params.TopP != nil && !gjson.GetBytes(body, "top_p").Exists() {
+		if body, err = sjson.SetBytes(body, "top_p", *params.TopP); err != nil {
+			return nil, err
+		}
+	}
+	if params.MaxTokens != nil && !gjson.GetBytes(body, "max_tokens").Exists() && !gjson.GetBytes(body, "max_completion_tokens").Exists() {
+		if body, err = sjson.SetBytes(body, "max_tokens", *params.MaxTokens); err != nil {
+			return nil, err
+		}
+	}
+
+	return body, nil
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConversationHandler_UpdateConversationParams(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPut, "/api/v1/conversations/:id/params", func(h *ConversationHandler) gin.HandlerFunc { return h.UpdateConversationParams }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/params",
+			body:   `{"temperature":0.2,"max_tokens":512}`,
+			store: &mockConversationsStore{updateDefaultParamsFunc: func(id, userID string, params *postgresql.SamplingParams) error {
+				if id != "conv-1" || userID != "user-1" || *params.Temperature != 0.2 || params.TopP != nil || *params.MaxTokens != 512 {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"UpdateConversationDefaultParams"},
+		},
+		{
+			name:   "empty body clears the defaults",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/params",
+			body:   `{}`,
+			store: &mockConversationsStore{updateDefaultParamsFunc: func(id, userID string, params *postgresql.SamplingParams) error {
+				if params.Temperature != nil || params.TopP != nil || params.MaxTokens != nil {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"UpdateConversationDefaultParams"},
+		},
+		{
+			name:           "temperature out of range",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/params",
+			body:           `{"temperature":2.5}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "top_p out of range",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/params",
+			body:           `{"top_p":-0.1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "non-positive max_tokens",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/params",
+			body:           `{"max_tokens":0}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "another user's conversation",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-2/params",
+			body:   `{"top_p":0.9}`,
+			store: &mockConversationsStore{updateDefaultParamsFunc: func(id, userID string, params *postgresql.SamplingParams) error {
+				return missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"UpdateConversationDefaultParams"},
+		},
+		{
+			name:           "bad body",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/params",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestApplyDefaultParams(t *testing.T) {
+	temperature, topP, maxTokens := 0.3, 0.8, 256
+	params := &postgresql.SamplingParams{Temperature: &temperature, TopP: &topP, MaxTokens: &maxTokens}
+
+	cases := []struct {
+		name     string
+		body     string
+		params   *postgresql.SamplingParams
+		expected string
+	}{
+		{
+			name:     "no defaults",
+			body:     `{"model":"gpt-4o"}`,
+			expected: `{"model":"gpt-4o"}`,
+		},
+		{
+			name:     "fills in omitted params",
+			body:     `{"model":"gpt-4o"}`,
+			params:   params,
+			expected: `{"model":"gpt-4o","temperature":0.3,"top_p":0.8,"max_tokens":256}`,
+		},
+		{
+			name:     "client params win",
+			body:     `{"model":"gpt-4o","temperature":1,"max_tokens":10}`,
+			params:   params,
+			expected: `{"model":"gpt-4o","temperature":1,"max_tokens":10,"top_p":0.8}`,
+		},
+		{
+			name:     "max_completion_tokens counts as max_tokens",
+			body:     `{"model":"o1","max_completion_tokens":10}`,
+			params:   &postgresql.SamplingParams{MaxTokens: &maxTokens},
+			expected: `{"model":"o1","max_completion_tokens":10}`,
+		},
+		{
+			name:     "client zero is kept",
+			body:     `{"temperature":0}`,
+			params:   &postgresql.SamplingParams{Temperature: &temperature},
+			expected: `{"temperature":0}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := applyDefaultParams([]byte(tc.body), tc.params)
+			require.NoError(t, err)
+			require.JSONEq(t, tc.expected, string(body))
+		})
+	}
+}
+
+func TestChatCompletionAliasHandler_AppliesConversationDefaultParams(t *testing.T) {
+	var forwarded []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstream.Close()
+
+	temperature, maxTokens := 0.2, 64
+	store := &persistingStore{conv: postgresql.Conversation{ID: "conv-1", DefaultParams: &postgresql.SamplingParams{Temperature: &temperature, MaxTokens: &maxTokens}}}
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"default","max_tokens":8,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set(conversationIdHeader, "conv-1")
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"model":"default","max_tokens":8,"messages":[{"role":"user","content":"hi"}],"temperature":0.2}`, string(forwarded))
+}
@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/bricks-cloud/bricksllm/internal/util"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// regenerateHistory splits a conversation into the messages to resend and
+// the id of the trailing assistant reply to replace, if there is one.
+func regenerateHistory(msgs []postgresql.Message) ([]postgresql.Message, string) {
+	if len(msgs) != 0 && msgs[len(msgs)-1].Role == "assistant" {
+		return msgs[:len(msgs)-1], msgs[len(msgs)-1].ID
+	}
+
+	return msgs, ""
+}
+
+// historyMessages renders stored messages as a chat completion messages
+// array.
+func historyMessages(history []postgresql.Message) []map[string]interface{} {
+	messages := []map[string]interface{}{}
+	for _, m := range history {
+		msg := map[string]interface{}{
+			"role":    m.Role,
+			"content": messageContent(m),
+		}
+
+		if len(m.Name) != 0 {
+			msg["name"] = m.Name
+		}
+
+		if len(m.ToolCallID) != 0 {
+			msg["tool_call_id"] = m.ToolCallID
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages
+}
+
+// regenerateRequestBody builds an upstream chat completion request from the
+// client's request parameters, the conversation's sampling defaults and the
+// stored history.
+func regenerateRequestBody(params []byte, defaults *postgresql.SamplingParams, systemPrompt string, history []postgresql.Message) ([]byte, error) {
+	data, err := json.Marshal(historyMessages(history))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := applyDefaultParams(params, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err = sjson.SetRawBytes(body, "messages", data)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err = sjson.SetBytes(body, "stream", false)
+	if err != nil {
+		return nil, err
+	}
+
+	return prependSystemPrompt(body, systemPrompt)
+}
+
+// getRegenerateHandler replaces the last assistant reply of a conversation
+// with a fresh completion. The history is read, the upstream is called with
+// no transaction open, and only then is the old reply swapped for the new
+// one in a single transaction.
+func getRegenerateHandler(prod bool, client http.Client, baseUrl string, cs conversationsStore, cfg AliasConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := util.GetLogFromCtx(c)
+		telemetry.Incr("bricksllm.proxy.regenerate_handler.requests", requestIdTags(c), 1)
+
+		if c == nil || c.Request == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "context is empty"})
+			return
+		}
+
+		params, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+
+		if len(bytes.TrimSpace(params)) == 0 {
+			params = []byte("{}")
+		}
+
+		if !gjson.ValidBytes(params) || !gjson.ParseBytes(params).IsObject() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+
+		if len(gjson.GetBytes(params, "model").String()) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+			return
+		}
+
+		if !checkAllowedModel(c, params, cfg.AllowedModels) {
+			return
+		}
+
+		conv, err := cs.GetConversation(c.Param("id"))
+		if err != nil {
+			writeConversationStoreError(c, err)
+			return
+		}
+
+		if conv.UserID != c.GetString("userId") && !requireWriteAccess(c, cs, conv.ID) {
+			return
+		}
+
+		if conv.OverBudget() {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "conversation token budget exhausted"})
+			return
+		}
+
+		msgs, err := cs.GetMessages(conv.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		msgs = primaryMessages(msgs)
+
+		history, previousID := regenerateHistory(msgs)
+		if len(history) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "conversation has no messages to regenerate from"})
+			return
+		}
+
+		systemPrompt, err := conversationSystemPrompt(conv, c.GetString("userId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		body, err := regenerateRequestBody(params, conv.DefaultParams, systemPrompt, history)
+		if err != nil {
+			logError(log, "error when building regenerate request body", prod, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build regenerate request"})
+			return
+		}
+
+		ctx, cancel := aliasRequestContext(c, false)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseUrl+"/v1/chat/completions", bytes.NewReader(body))
+		if err != nil {
+			logError(log, "error when creating regenerate http request", prod, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create regenerate request"})
+			return
+		}
+
+		copyHttpHeaders(c.Request, req, c.GetBool("removeUserAgent"))
+		setUpstreamDefaultHeaders(req, cfg)
+		setUpstreamApiKey(req, cfg)
+		forwardRequestId(c, req)
+		// let the transport negotiate and undo compression, the reply is parsed here
+		req.Header.Del("Accept-Encoding")
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := client.Do(req)
+		if err != nil {
+			logError(log, "error when sending regenerate request upstream", prod, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to send regenerate request upstream"})
+			return
+		}
+		defer res.Body.Close()
+
+		resBody, err := decodedAliasBody(res)
+		if err != nil {
+			logError(log, "error when decoding regenerate upstream response", prod, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to decode upstream response"})
+			return
+		}
+		defer resBody.Close()
+
+		data, err := io.ReadAll(resBody)
+		if err != nil {
+			logError(log, "error when reading regenerate upstream response", prod, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to read upstream response"})
+			return
+		}
+
+		if res.StatusCode != http.StatusOK {
+			telemetry.Incr("bricksllm.proxy.regenerate_handler.upstream_error", nil, 1)
+			c.Data(res.StatusCode, res.Header.Get("Content-Type"), data)
+			return
+		}
+
+		completion := parseAliasCompletion(data, false)
+		completion.estimateUsage(body)
+
+		msg := newConversationMessage(conv.ID, "assistant", completion.content)
+		msg.Model = gjson.GetBytes(body, "model").String()
+		msg.PromptTokens = completion.promptTokens
+		msg.CompletionTokens = completion.completionTokens
+		msg.TokensEstimated = completion.estimated
+		msg.FinishReason = completion.finishReason
+		if err := cs.ReplaceLastAssistantMessage(previousID, msg); err != nil {
+			if _, ok := err.(notFoundError); ok {
+				c.JSON(http.StatusConflict, gin.H{"error": "conversation changed while regenerating"})
+				return
+			}
+
+			logError(log, "error when storing regenerated assistant message", prod, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, msg)
+	}
+}
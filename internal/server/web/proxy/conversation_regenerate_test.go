@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+type regeneratingStore struct {
+	conversationsStore
+	conv       postgresql.Conversation
+	messages   []postgresql.Message
+	replacedID string
+	replaced   []postgresql.Message
+	permission string
+}
+
+func (s *regeneratingStore) GetConversation(id string) (*postgresql.Conversation, error) {
+	return &s.conv, nil
+}
+
+func (s *regeneratingStore) GetMessages(conversationID string) ([]postgresql.Message, error) {
+	return s.messages, nil
+}
+
+func (s *regeneratingStore) GetConversationPermission(id, userID string) (string, error) {
+	if len(s.permission) == 0 {
+		return "", missingConversation()
+	}
+	return s.permission, nil
+}
+
+func (s *regeneratingStore) ReplaceLastAssistantMessage(previousID string, m postgresql.Message) error {
+	s.replacedID = previousID
+	s.replaced = append(s.replaced, m)
+	return nil
+}
+
+func TestRegenerateHandler(t *testing.T) {
+	tests := []struct {
+		name               string
+		messages           []postgresql.Message
+		expectedStatus     int
+		expectedReplacedID string
+		expectedSent       []string
+	}{
+		{
+			name: "replaces last assistant reply",
+			messages: []postgresql.Message{
+				{ID: "m1", Role: "user", Content: "hi"},
+				{ID: "m2", Role: "assistant", Content: "old reply"},
+			},
+			expectedStatus:     http.StatusOK,
+			expectedReplacedID: "m2",
+			expectedSent:       []string{"system", "user"},
+		},
+		{
+			name: "last message is from the user",
+			messages: []postgresql.Message{
+				{ID: "m1", Role: "user", Content: "hi"},
+				{ID: "m2", Role: "assistant", Content: "hello"},
+				{ID: "m3", Role: "user", Content: "again"},
+			},
+			expectedStatus:     http.StatusOK,
+			expectedReplacedID: "",
+			expectedSent:       []string{"system", "user", "assistant", "user"},
+		},
+		{
+			name:           "empty conversation",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []byte
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent, _ = io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"new reply"}}],"usage":{"prompt_tokens":5,"completion_tokens":2}}`))
+			}))
+			defer upstream.Close()
+
+			store := &regeneratingStore{
+				conv:     postgresql.Conversation{ID: "conv-1", SystemPrompt: "be brief"},
+				messages: tt.messages,
+			}
+			router := newAliasTestRouter(http.MethodPost, "/api/v1/conversations/:id/regenerate", getRegenerateHandler(false, http.Client{}, upstream.URL, store, AliasConfig{}))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations/conv-1/regenerate", strings.NewReader(`{"model":"gpt-4o-mini"}`))
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				if sent != nil || len(store.replaced) != 0 {
+					t.Fatal("expected a rejected regenerate not to reach upstream or the store")
+				}
+				return
+			}
+
+			roles := []string{}
+			for _, r := range gjson.GetBytes(sent, "messages.#.role").Array() {
+				roles = append(roles, r.String())
+			}
+			if strings.Join(roles, ",") != strings.Join(tt.expectedSent, ",") {
+				t.Fatalf("expected roles %v to be sent upstream, got %v", tt.expectedSent, roles)
+			}
+			if gjson.GetBytes(sent, "stream").Bool() {
+				t.Fatal("expected regenerate to request a non-streaming completion")
+			}
+
+			if store.replacedID != tt.expectedReplacedID {
+				t.Fatalf("expected %q to be replaced, got %q", tt.expectedReplacedID, store.replacedID)
+			}
+			if len(store.replaced) != 1 || store.replaced[0].Content != "new reply" || store.replaced[0].CompletionTokens != 2 {
+				t.Fatalf("unexpected stored reply %+v", store.replaced)
+			}
+		})
+	}
+}
+
+func TestRegenerateHandler_Collaborators(t *testing.T) {
+	tests := []struct {
+		name           string
+		permission     string
+		expectedStatus int
+	}{
+		{name: "write collaborator", permission: postgresql.PermissionWrite, expectedStatus: http.StatusOK},
+		{name: "read collaborator", permission: postgresql.PermissionRead, expectedStatus: http.StatusForbidden},
+		{name: "not shared", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"new reply"}}]}`))
+			}))
+			defer upstream.Close()
+
+			store := &regeneratingStore{
+				conv:       postgresql.Conversation{ID: "conv-1", UserID: "owner"},
+				messages:   []postgresql.Message{{ID: "m1", Role: "user", Content: "hi"}, {ID: "m2", Role: "assistant", Content: "old reply"}},
+				permission: tt.permission,
+			}
+			router := newAliasTestRouter(http.MethodPost, "/api/v1/conversations/:id/regenerate",
+				func(c *gin.Context) { c.Set("userId", "user-2") },
+				getRegenerateHandler(false, http.Client{}, upstream.URL, store, AliasConfig{}),
+			)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/conversations/conv-1/regenerate", strings.NewReader(`{"model":"gpt-4o-mini"}`)))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if replaced := len(store.replaced) != 0; replaced != (tt.expectedStatus == http.StatusOK) {
+				t.Fatalf("expected the reply to be replaced only for write access, got %v", store.replaced)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserStats sums up the caller's conversations, messages and token
+// usage, with their messages per day over the last 30 days.
+func (h *ConversationHandler) GetUserStats(c *gin.Context) {
+	userID := c.GetString("userId")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user is not authenticated"})
+		return
+	}
+	stats, err := h.store.GetUserStats(userID)
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetUserModelUsage breaks the caller's token usage down by model.
+func (h *ConversationHandler) GetUserModelUsage(c *gin.Context) {
+	userID := c.GetString("userId")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user is not authenticated"})
+		return
+	}
+	usage, err := h.store.GetUserModelUsage(userID)
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
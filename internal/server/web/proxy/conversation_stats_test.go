@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConversationHandler_GetUserStats(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/stats", func(h *ConversationHandler) gin.HandlerFunc { return h.GetUserStats }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/stats",
+			store: &mockConversationsStore{getUserStatsFunc: func(userID string) (postgresql.UserStats, error) {
+				return postgresql.UserStats{Conversations: 2, Messages: 5}, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetUserStats"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/stats",
+			store: &mockConversationsStore{getUserStatsFunc: func(userID string) (postgresql.UserStats, error) {
+				return postgresql.UserStats{}, failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetUserStats"},
+		},
+		{
+			name:           "missing userId",
+			path:           "/api/v1/stats",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	})
+}
+
+func TestConversationHandler_GetUserModelUsage(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/stats/models", func(h *ConversationHandler) gin.HandlerFunc { return h.GetUserModelUsage }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/stats/models",
+			store: &mockConversationsStore{getUserModelUsageFunc: func(userID string) ([]postgresql.ModelUsage, error) {
+				return []postgresql.ModelUsage{{Model: "gpt-4o-mini", MessageCount: 2, TotalTokens: 30}}, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetUserModelUsage"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/stats/models",
+			store: &mockConversationsStore{getUserModelUsageFunc: func(userID string) ([]postgresql.ModelUsage, error) {
+				return nil, failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetUserModelUsage"},
+		},
+		{
+			name:           "missing userId",
+			path:           "/api/v1/stats/models",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	})
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/bricks-cloud/bricksllm/internal/util"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	historySummaryPrompt = "Summarize the conversation so far in a short paragraph. Keep names, facts, decisions and open questions. Reply with the summary only."
+	// historySummaryKey is the conversation metadata key summaries are
+	// stored under so later requests can reuse them.
+	historySummaryKey       = "history_summary"
+	historySummaryMaxTokens = 512
+)
+
+// historySummary is a summary of a conversation's messages up to and
+// including the message with ID Upto.
+type historySummary struct {
+	Upto    string `json:"upto"`
+	Content string `json:"content"`
+}
+
+// storedHistorySummary reads the summary kept in conversation metadata, if
+// any.
+func storedHistorySummary(meta json.RawMessage) (historySummary, bool) {
+	summary := historySummary{}
+	raw := gjson.GetBytes(meta, historySummaryKey)
+	if !raw.IsObject() || json.Unmarshal([]byte(raw.Raw), &summary) != nil || len(summary.Upto) == 0 {
+		return historySummary{}, false
+	}
+
+	return summary, true
+}
+
+// summaryRequestBody asks model to summarize msgs, continuing from the
+// earlier summary when there is one.
+func summaryRequestBody(model, previous string, msgs []postgresql.Message) ([]byte, error) {
+	transcript := strings.Builder{}
+	if len(previous) != 0 {
+		fmt.Fprintf(&transcript, "summary of earlier messages: %s\n", previous)
+	}
+	for _, m := range msgs {
+		fmt.Fprintf(&transcript, "%s: %s\n", m.Role, m.Content)
+	}
+
+	return json.Marshal(map[string]any{
+		"model":      model,
+		"max_tokens": historySummaryMaxTokens,
+		"messages": []map[string]string{
+			{"role": "system", "content": historySummaryPrompt},
+			{"role": "user", "content": transcript.String()},
+		},
+	})
+}
+
+func requestHistorySummary(c *gin.Context, client http.Client, baseUrl string, cfg AliasConfig, body []byte) (string, error) {
+	ctx, cancel := aliasRequestContext(c, false)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseUrl+"/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	copyHttpHeaders(c.Request, req, c.GetBool("removeUserAgent"))
+	setUpstreamDefaultHeaders(req, cfg)
+	setUpstreamApiKey(req, cfg)
+	forwardRequestId(c, req)
+	req.Header.Del("Accept-Encoding")
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upstream responded with status %d", res.StatusCode)
+	}
+
+	summary := strings.TrimSpace(parseAliasCompletion(data, false).content)
+	if len(summary) == 0 {
+		return "", fmt.Errorf("upstream returned an empty summary")
+	}
+
+	return summary, nil
+}
+
+// newHistorySummarizer returns a historyCompressor that replaces the dropped
+// messages of conv with a system message summarizing them. The
+// summary is kept in the conversation metadata: when it already covers the
+// dropped messages it is reused as is, and when it covers some of them only
+// the rest are summarized on top of it.
+func newHistorySummarizer(c *gin.Context, client http.Client, baseUrl string, cfg AliasConfig, cs conversationsStore, conv *postgresql.Conversation, model string, prod bool) historyCompressor {
+	return func(dropped []postgresql.Message) (postgresql.Message, bool) {
+		log := util.GetLogFromCtx(c)
+
+		last := dropped[len(dropped)-1]
+		previous, ok := storedHistorySummary(conv.Metadata)
+		if ok && previous.Upto == last.ID {
+			telemetry.Incr("bricksllm.proxy.history_summarizer.reused", nil, 1)
+			return historySummaryMessage(previous.Content), true
+		}
+
+		pending := dropped
+		prior := ""
+		for i, m := range dropped {
+			if ok && m.ID == previous.Upto {
+				pending, prior = dropped[i+1:], previous.Content
+				break
+			}
+		}
+
+		body, err := summaryRequestBody(model, prior, pending)
+		if err == nil {
+			prior, err = requestHistorySummary(c, client, baseUrl, cfg, body)
+		}
+		if err != nil {
+			telemetry.Incr("bricksllm.proxy.history_summarizer.fallback", nil, 1)
+			logError(log, "error when summarizing conversation history, falling back to trimming", prod, err)
+			return postgresql.Message{}, false
+		}
+
+		meta := conv.Metadata
+		if !gjson.ValidBytes(meta) || !gjson.ParseBytes(meta).IsObject() {
+			meta = json.RawMessage("{}")
+		}
+		meta, err = sjson.SetBytes(meta, historySummaryKey, historySummary{Upto: last.ID, Content: prior})
+		if err == nil {
+			err = cs.UpdateConversationMetadata(conv.ID, conv.UserID, meta)
+		}
+		if err != nil {
+			// the summary is still good for this request
+			logError(log, "error when storing conversation history summary", prod, err)
+		}
+
+		return historySummaryMessage(prior), true
+	}
+}
+
+func historySummaryMessage(summary string) postgresql.Message {
+	return postgresql.Message{Role: "system", Content: "Summary of the earlier conversation: " + summary}
+}
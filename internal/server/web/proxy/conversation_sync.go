@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// syncOverlap is how far the next sync cursor reaches back before the time
+// a sync started, so writes still being committed then are not missed.
+// Clients may see such changes twice and should upsert by id.
+const syncOverlap = 5 * time.Second
+
+// SyncConversations returns the caller's conversations and messages changed
+// after the RFC3339 since param, or all of them without it, along with the
+// cursor to pass as since next time. The cursor is taken from the server's
+// clock, so clients never have to compare against their own.
+func (h *ConversationHandler) SyncConversations(c *gin.Context) {
+	since, ok := parseTimeQuery(c, "since")
+	if !ok {
+		return
+	}
+
+	userID := c.GetString("userId")
+	next := time.Now().Add(-syncOverlap)
+	conversations, err := h.store.GetConversationsUpdatedSince(userID, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	messages, err := h.store.GetMessagesUpdatedSince(userID, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conversations": conversations,
+		"messages":      messages,
+		"next_since":    next.UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConversationHandler_SyncConversations(t *testing.T) {
+	since := time.Date(2024, 5, 14, 0, 0, 0, 0, time.UTC)
+	conversationsSince := func(userID string, after time.Time) ([]postgresql.Conversation, error) {
+		if userID != "user-1" || !after.Equal(since) {
+			return nil, failingStore()
+		}
+		return []postgresql.Conversation{{ID: "conv-1"}}, nil
+	}
+
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/conversations/sync", func(h *ConversationHandler) gin.HandlerFunc { return h.SyncConversations }, []conversationHandlerCase{
+		{
+			name:   "changes since the cursor",
+			userID: "user-1",
+			path:   "/api/v1/conversations/sync?since=2024-05-14T00:00:00Z",
+			store: &mockConversationsStore{
+				getConversationsSinceFunc: conversationsSince,
+				getMessagesSinceFunc: func(userID string, after time.Time) ([]postgresql.Message, error) {
+					if !after.Equal(since) {
+						return nil, failingStore()
+					}
+					return []postgresql.Message{{ID: "msg-1", ConversationID: "conv-1"}}, nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversationsUpdatedSince", "GetMessagesUpdatedSince"},
+		},
+		{
+			name:   "full sync without a cursor",
+			userID: "user-1",
+			path:   "/api/v1/conversations/sync",
+			store: &mockConversationsStore{
+				getConversationsSinceFunc: func(userID string, after time.Time) ([]postgresql.Conversation, error) {
+					if !after.IsZero() {
+						return nil, failingStore()
+					}
+					return []postgresql.Conversation{}, nil
+				},
+				getMessagesSinceFunc: func(userID string, after time.Time) ([]postgresql.Message, error) {
+					return []postgresql.Message{}, nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversationsUpdatedSince", "GetMessagesUpdatedSince"},
+		},
+		{
+			name:           "malformed cursor",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/sync?since=yesterday",
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/sync?since=2024-05-14T00:00:00Z",
+			store: &mockConversationsStore{
+				getConversationsSinceFunc: conversationsSince,
+				getMessagesSinceFunc: func(userID string, after time.Time) ([]postgresql.Message, error) {
+					return nil, failingStore()
+				},
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetConversationsUpdatedSince", "GetMessagesUpdatedSince"},
+		},
+	})
+}
+
+func TestConversationHandler_SyncConversations_Cursor(t *testing.T) {
+	store := &mockConversationsStore{
+		getConversationsSinceFunc: func(userID string, since time.Time) ([]postgresql.Conversation, error) {
+			return []postgresql.Conversation{}, nil
+		},
+		getMessagesSinceFunc: func(userID string, since time.Time) ([]postgresql.Message, error) {
+			return []postgresql.Message{}, nil
+		},
+	}
+	router := newAliasTestRouter(http.MethodGet, "/api/v1/conversations/sync", NewConversationHandler(store).SyncConversations)
+
+	before := time.Now().Add(-syncOverlap).Truncate(time.Second)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/conversations/sync", nil))
+
+	var res struct {
+		NextSince time.Time `json:"next_since"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.NextSince.Before(before) || res.NextSince.After(time.Now()) {
+		t.Fatalf("expected the cursor to be the server time less the overlap, got %s", res.NextSince)
+	}
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// templateName trims name and checks that it fits the templates.name column.
+func templateName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	return name, len(name) != 0 && utf8.RuneCountInString(name) <= postgresql.MaxTemplateNameLength
+}
+
+// ListTemplates lists the global templates and the caller's own.
+func (h *ConversationHandler) ListTemplates(c *gin.Context) {
+	res, err := h.store.GetTemplatesForUser(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// CreateTemplate stores a template owned by the caller. Admins may pass
+// global to share it, read-only, with every user.
+func (h *ConversationHandler) CreateTemplate(c *gin.Context) {
+	var req struct {
+		Name         string                       `json:"name"`
+		SystemPrompt string                       `json:"system_prompt"`
+		SeedMessages []postgresql.TemplateMessage `json:"seed_messages"`
+		Global       bool                         `json:"global"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if req.Global && !c.GetBool("isAdmin") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "an admin key is required to create global templates"})
+		return
+	}
+	name, ok := templateName(req.Name)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required and must be at most 255 characters"})
+		return
+	}
+	for _, m := range req.SeedMessages {
+		if !postgresql.IsValidMessageRole(m.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid seed message role: " + m.Role})
+			return
+		}
+	}
+
+	now := time.Now()
+	t := postgresql.Template{
+		ID:           uuid.NewString(),
+		Name:         name,
+		SystemPrompt: req.SystemPrompt,
+		SeedMessages: req.SeedMessages,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if !req.Global {
+		t.UserID = c.GetString("userId")
+	}
+	if t.SeedMessages == nil {
+		t.SeedMessages = []postgresql.TemplateMessage{}
+	}
+	if err := h.store.CreateTemplate(t); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditTemplateCreate, t.ID, gin.H{"name": t.Name, "global": req.Global})
+	c.JSON(http.StatusOK, t)
+}
+
+// DeleteTemplate removes one of the caller's templates. Global templates
+// cannot be removed through it.
+func (h *ConversationHandler) DeleteTemplate(c *gin.Context) {
+	if err := h.store.DeleteTemplate(c.Param("id"), c.GetString("userId")); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditTemplateDelete, c.Param("id"), nil)
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id")})
+}
+
+// CreateConversationFromTemplate starts a conversation with the system
+// prompt and seed messages of a template the caller can read. The title
+// defaults to the template's name.
+func (h *ConversationHandler) CreateConversationFromTemplate(c *gin.Context) {
+	var req struct {
+		Title string          `json:"title"`
+		Meta  json.RawMessage `json:"metadata"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+	}
+	if err := h.metadataSchema.validate(req.Meta); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	meta, err := withDefaultMetadata(req.Meta, h.defaultMetadata)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("userId")
+	t, err := h.store.GetTemplateForUser(c.Param("templateId"), userID)
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	title := req.Title
+	if len(title) == 0 {
+		title = t.Name
+	}
+
+	now := time.Now()
+	id := uuid.NewString()
+	if _, err := RenderSystemPrompt(t.SystemPrompt, systemPromptVars(meta, id, title, userID, now)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	conv := postgresql.Conversation{
+		ID:           id,
+		Title:        title,
+		UserID:       userID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Metadata:     meta,
+		SystemPrompt: t.SystemPrompt,
+	}
+	msgs := make([]postgresql.Message, 0, len(t.SeedMessages))
+	for _, seed := range t.SeedMessages {
+		msgs = append(msgs, newConversationMessage(id, seed.Role, seed.Content))
+	}
+	if err := h.store.CreateConversationWithMessages(conv, msgs); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationCreate, conv.ID, gin.H{"title": conv.Title, "template_id": t.ID})
+	c.JSON(http.StatusOK, gin.H{"conversation": conv, "messages": msgs})
+}
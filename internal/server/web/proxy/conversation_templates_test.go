@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConversationHandler_CreateTemplate(t *testing.T) {
+	asAdmin := func(h *ConversationHandler) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("isAdmin", c.Query("admin") == "true")
+			h.CreateTemplate(c)
+		}
+	}
+
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/templates", asAdmin, []conversationHandlerCase{
+		{
+			name:   "user template",
+			userID: "user-1",
+			path:   "/api/v1/templates",
+			body:   `{"name":" Translator ","system_prompt":"Translate to French.","seed_messages":[{"role":"assistant","content":"What should I translate?"}]}`,
+			store: &mockConversationsStore{createTemplateFunc: func(tmpl postgresql.Template) error {
+				if tmpl.UserID != "user-1" || tmpl.Name != "Translator" || len(tmpl.SeedMessages) != 1 {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"CreateTemplate"},
+		},
+		{
+			name:   "global template by an admin",
+			userID: "admin-1",
+			path:   "/api/v1/templates?admin=true",
+			body:   `{"name":"Code Reviewer","global":true}`,
+			store: &mockConversationsStore{createTemplateFunc: func(tmpl postgresql.Template) error {
+				if len(tmpl.UserID) != 0 {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"CreateTemplate"},
+		},
+		{
+			name:           "global template without an admin key",
+			userID:         "user-1",
+			path:           "/api/v1/templates",
+			body:           `{"name":"Code Reviewer","global":true}`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "missing name",
+			userID:         "user-1",
+			path:           "/api/v1/templates",
+			body:           `{"name":"  "}`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid seed role",
+			userID:         "user-1",
+			path:           "/api/v1/templates",
+			body:           `{"name":"Translator","seed_messages":[{"role":"robot","content":"hi"}]}`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid body",
+			userID:         "user-1",
+			path:           "/api/v1/templates",
+			body:           `{`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestConversationHandler_DeleteTemplate(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodDelete, "/api/v1/templates/:id", func(h *ConversationHandler) gin.HandlerFunc { return h.DeleteTemplate }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/templates/tmpl-1",
+			store: &mockConversationsStore{deleteTemplateFunc: func(id, userID string) error {
+				if id != "tmpl-1" || userID != "user-1" {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"DeleteTemplate"},
+		},
+		{
+			name:   "global or another user's template",
+			userID: "user-1",
+			path:   "/api/v1/templates/tmpl-2",
+			store: &mockConversationsStore{deleteTemplateFunc: func(id, userID string) error {
+				return internal_errors.NewNotFoundError("template is not found")
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"DeleteTemplate"},
+		},
+	})
+}
+
+func TestConversationHandler_CreateConversationFromTemplate(t *testing.T) {
+	translator := func(id, userID string) (*postgresql.Template, error) {
+		return &postgresql.Template{
+			ID:           id,
+			Name:         "Translator",
+			SystemPrompt: "Translate to French.",
+			SeedMessages: []postgresql.TemplateMessage{{Role: "assistant", Content: "What should I translate?"}},
+		}, nil
+	}
+
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations/from-template/:templateId", func(h *ConversationHandler) gin.HandlerFunc { return h.CreateConversationFromTemplate }, []conversationHandlerCase{
+		{
+			name:   "seeded from the template",
+			userID: "user-1",
+			path:   "/api/v1/conversations/from-template/tmpl-1",
+			store: &mockConversationsStore{
+				getTemplateFunc: translator,
+				createWithMessagesFunc: func(c postgresql.Conversation, msgs []postgresql.Message) error {
+					if c.Title != "Translator" || c.SystemPrompt != "Translate to French." || c.UserID != "user-1" {
+						return failingStore()
+					}
+					if len(msgs) != 1 || msgs[0].Role != "assistant" || msgs[0].ConversationID != c.ID {
+						return failingStore()
+					}
+					return nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetTemplateForUser", "CreateConversationWithMessages"},
+		},
+		{
+			name:   "custom title",
+			userID: "user-1",
+			path:   "/api/v1/conversations/from-template/tmpl-1",
+			body:   `{"title":"Menu","metadata":{"lang":"fr"}}`,
+			store: &mockConversationsStore{
+				getTemplateFunc: translator,
+				createWithMessagesFunc: func(c postgresql.Conversation, msgs []postgresql.Message) error {
+					if c.Title != "Menu" {
+						return failingStore()
+					}
+					return nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetTemplateForUser", "CreateConversationWithMessages"},
+		},
+		{
+			name:   "unreadable template",
+			userID: "user-1",
+			path:   "/api/v1/conversations/from-template/tmpl-2",
+			store: &mockConversationsStore{getTemplateFunc: func(id, userID string) (*postgresql.Template, error) {
+				return nil, internal_errors.NewNotFoundError("template is not found")
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetTemplateForUser"},
+		},
+		{
+			name:           "invalid body",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/from-template/tmpl-1",
+			body:           `{`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
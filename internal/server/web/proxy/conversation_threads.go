@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMessageThread returns a message of a conversation the caller can read
+// followed by every reply under it.
+func (h *ConversationHandler) GetMessageThread(c *gin.Context) {
+	if _, err := h.store.GetConversationPermission(c.Param("id"), c.GetString("userId")); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	msgs, err := h.store.GetMessageThread(c.Param("messageId"))
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	if msgs[0].ConversationID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message is not found"})
+		return
+	}
+	c.JSON(http.StatusOK, msgs)
+}
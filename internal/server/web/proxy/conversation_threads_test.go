@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConversationHandler_GetMessageThread(t *testing.T) {
+	thread := func(rootID string) ([]postgresql.Message, error) {
+		return []postgresql.Message{
+			{ID: rootID, ConversationID: "conv-1", Role: "user", Content: "hi"},
+			{ID: "msg-2", ConversationID: "conv-1", Role: "assistant", Content: "hello", ParentMessageID: rootID},
+		}, nil
+	}
+
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/conversations/:id/messages/:messageId/thread", func(h *ConversationHandler) gin.HandlerFunc { return h.GetMessageThread }, []conversationHandlerCase{
+		{
+			name:           "success",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/messages/msg-1/thread",
+			store:          &mockConversationsStore{getPermissionFunc: ownerPermission, getMessageThreadFunc: thread},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversationPermission", "GetMessageThread"},
+		},
+		{
+			name:           "message of another conversation",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-2/messages/msg-1/thread",
+			store:          &mockConversationsStore{getPermissionFunc: ownerPermission, getMessageThreadFunc: thread},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetConversationPermission", "GetMessageThread"},
+		},
+		{
+			name:   "unknown message",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages/msg-9/thread",
+			store: &mockConversationsStore{getPermissionFunc: ownerPermission, getMessageThreadFunc: func(rootID string) ([]postgresql.Message, error) {
+				return nil, internal_errors.NewNotFoundError("message is not found")
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetConversationPermission", "GetMessageThread"},
+		},
+		{
+			name:   "another user's conversation",
+			userID: "user-2",
+			path:   "/api/v1/conversations/conv-1/messages/msg-1/thread",
+			store: &mockConversationsStore{getPermissionFunc: func(id, userID string) (string, error) {
+				return "", missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetConversationPermission"},
+		},
+	})
+}
+
+func TestConversationHandler_CreateMessageReply(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations/:id/messages", func(h *ConversationHandler) gin.HandlerFunc { return h.CreateMessage }, []conversationHandlerCase{
+		{
+			name:   "reply",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages",
+			body:   `{"role":"user","content":"and then?","parent_message_id":"msg-1"}`,
+			store: &mockConversationsStore{getPermissionFunc: ownerPermission, createMessageFunc: func(m postgresql.Message) error {
+				if m.ParentMessageID != "msg-1" {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversationPermission", "CreateMessage"},
+		},
+		{
+			name:   "parent in another conversation",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages",
+			body:   `{"role":"user","content":"and then?","parent_message_id":"msg-9"}`,
+			store: &mockConversationsStore{getPermissionFunc: ownerPermission, createMessageFunc: func(m postgresql.Message) error {
+				return internal_errors.NewValidationError("parent message is not found in the conversation")
+			}},
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  []string{"GetConversationPermission", "CreateMessage"},
+		},
+	})
+}
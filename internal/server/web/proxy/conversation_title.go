@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/bricks-cloud/bricksllm/internal/util"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTitlePrompt   = "Summarize this conversation in 5 words or fewer. Reply with the title only."
+	titleMaxLength       = 80
+	titleFallbackLength  = 50
+	titleContextMessages = 4
+	// autoTitleInterval is how often a single conversation may be retitled.
+	autoTitleInterval = time.Minute
+)
+
+// titleLimiter allows one auto title per conversation per interval.
+type titleLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     map[string]time.Time
+}
+
+func newTitleLimiter(interval time.Duration) *titleLimiter {
+	return &titleLimiter{interval: interval, last: map[string]time.Time{}}
+}
+
+func (l *titleLimiter) allow(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for k, t := range l.last {
+		if now.Sub(t) >= l.interval {
+			delete(l.last, k)
+		}
+	}
+
+	if _, ok := l.last[id]; ok {
+		return false
+	}
+
+	l.last[id] = now
+	return true
+}
+
+// fallbackTitle is the truncation heuristic used when the model cannot
+// produce a title: the start of the first user message.
+func fallbackTitle(msgs []postgresql.Message) string {
+	for _, m := range msgs {
+		if m.Role == "user" {
+			if title := strings.Join(strings.Fields(m.Content), " "); len(title) != 0 {
+				return truncateContent(title, titleFallbackLength)
+			}
+		}
+	}
+
+	return "New Conversation"
+}
+
+func cleanTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	title = strings.Trim(title, `"'`+"`")
+	title = strings.TrimRight(title, ".")
+	return truncateContent(title, titleMaxLength)
+}
+
+func titleRequestBody(model, prompt string, msgs []postgresql.Message) ([]byte, error) {
+	if len(msgs) > titleContextMessages {
+		msgs = msgs[:titleContextMessages]
+	}
+
+	transcript := strings.Builder{}
+	for _, m := range msgs {
+		fmt.Fprintf(&transcript, "%s: %s\n", m.Role, m.Content)
+	}
+
+	return json.Marshal(map[string]any{
+		"model":      model,
+		"max_tokens": 20,
+		"messages": []map[string]string{
+			{"role": "system", "content": prompt},
+			{"role": "user", "content": transcript.String()},
+		},
+	})
+}
+
+// generateTitle asks the upstream model for a title. Any failure is returned
+// so the caller can fall back to the truncation heuristic.
+func generateTitle(c *gin.Context, client http.Client, baseUrl string, cfg AliasConfig, msgs []postgresql.Message) (string, error) {
+	model := cfg.TitleModel
+	if len(model) == 0 {
+		model = cfg.DefaultModel
+	}
+	if len(model) == 0 {
+		model = "default"
+	}
+
+	prompt := cfg.TitlePrompt
+	if len(prompt) == 0 {
+		prompt = defaultTitlePrompt
+	}
+
+	body, err := titleRequestBody(model, prompt, msgs)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := aliasRequestContext(c, false)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseUrl+"/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	copyHttpHeaders(c.Request, req, c.GetBool("removeUserAgent"))
+	setUpstreamDefaultHeaders(req, cfg)
+	setUpstreamApiKey(req, cfg)
+	forwardRequestId(c, req)
+	req.Header.Del("Accept-Encoding")
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upstream responded with status %d", res.StatusCode)
+	}
+
+	title := cleanTitle(parseAliasCompletion(data, false).content)
+	if len(title) == 0 {
+		return "", fmt.Errorf("upstream returned an empty title")
+	}
+
+	return title, nil
+}
+
+// getAutoTitleHandler names a conversation by asking the model to summarize
+// its first messages, falling back to the start of the first user message
+// when the upstream fails.
+func getAutoTitleHandler(prod bool, client http.Client, baseUrl string, cs conversationsStore, audit auditLog, limiter *titleLimiter, cfg AliasConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := util.GetLogFromCtx(c)
+		telemetry.Incr("bricksllm.proxy.auto_title_handler.requests", requestIdTags(c), 1)
+
+		if c == nil || c.Request == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "context is empty"})
+			return
+		}
+
+		conv, err := cs.GetConversation(c.Param("id"))
+		if err != nil {
+			writeConversationStoreError(c, err)
+			return
+		}
+
+		if conv.UserID != c.GetString("userId") && !requireWriteAccess(c, cs, conv.ID) {
+			return
+		}
+
+		msgs, err := cs.GetMessages(conv.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		msgs = primaryMessages(msgs)
+
+		if len(msgs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "conversation has no messages to title"})
+			return
+		}
+
+		if !limiter.allow(conv.ID) {
+			telemetry.Incr("bricksllm.proxy.auto_title_handler.rate_limited", nil, 1)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "conversation was retitled recently"})
+			return
+		}
+
+		generated := true
+		title, err := generateTitle(c, client, baseUrl, cfg, msgs)
+		if err != nil {
+			telemetry.Incr("bricksllm.proxy.auto_title_handler.fallback", nil, 1)
+			logError(log, "error when generating conversation title, falling back to truncation", prod, err)
+			title = fallbackTitle(msgs)
+			generated = false
+		}
+
+		if err := cs.UpdateConversationTitle(conv.ID, conv.UserID, title); err != nil {
+			writeConversationStoreError(c, err)
+			return
+		}
+		recordAudit(c, audit, auditConversationRename, conv.ID, gin.H{"title": title, "generated": generated})
+
+		c.JSON(http.StatusOK, gin.H{"id": conv.ID, "title": title, "generated": generated})
+	}
+}
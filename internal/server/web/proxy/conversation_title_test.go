@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+type titlingStore struct {
+	conversationsStore
+	conv     postgresql.Conversation
+	messages []postgresql.Message
+	titles   []string
+	// owners records the user id each title was written under.
+	owners     []string
+	permission string
+}
+
+func (s *titlingStore) GetConversation(id string) (*postgresql.Conversation, error) {
+	return &s.conv, nil
+}
+
+func (s *titlingStore) GetMessages(conversationID string) ([]postgresql.Message, error) {
+	return s.messages, nil
+}
+
+func (s *titlingStore) GetConversationPermission(id, userID string) (string, error) {
+	if len(s.permission) == 0 {
+		return "", missingConversation()
+	}
+	return s.permission, nil
+}
+
+func (s *titlingStore) UpdateConversationTitle(id, userID, title string) error {
+	s.titles = append(s.titles, title)
+	s.owners = append(s.owners, userID)
+	return nil
+}
+
+func TestAutoTitleHandler(t *testing.T) {
+	messages := []postgresql.Message{
+		{Role: "user", Content: "How do I bake a sourdough loaf at home with a cast iron pot?"},
+		{Role: "assistant", Content: "Preheat the pot..."},
+	}
+
+	tests := []struct {
+		name              string
+		status            int
+		response          string
+		expectedTitle     string
+		expectedGenerated bool
+	}{
+		{
+			name:              "model title is stored",
+			status:            http.StatusOK,
+			response:          `{"choices":[{"message":{"role":"assistant","content":"\"Baking Sourdough At Home.\""}}]}`,
+			expectedTitle:     "Baking Sourdough At Home",
+			expectedGenerated: true,
+		},
+		{
+			name:          "upstream failure falls back to truncation",
+			status:        http.StatusInternalServerError,
+			response:      `{"error":{"message":"boom"}}`,
+			expectedTitle: "How do I bake a sourdough loaf at home with a cast...",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sentModel string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				sentModel = gjson.GetBytes(body, "model").String()
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer upstream.Close()
+
+			store := &titlingStore{conv: postgresql.Conversation{ID: "conv-1"}, messages: messages}
+			handler := getAutoTitleHandler(false, http.Client{}, upstream.URL, store, nil, newTitleLimiter(time.Minute), AliasConfig{TitleModel: "gpt-4o-mini"})
+			router := newAliasTestRouter(http.MethodPost, "/api/v1/conversations/:id/autotitle", handler)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/conversations/conv-1/autotitle", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if sentModel != "gpt-4o-mini" {
+				t.Fatalf("expected the title model to be used, got %s", sentModel)
+			}
+			if len(store.titles) != 1 || store.titles[0] != tt.expectedTitle {
+				t.Fatalf("expected title %q, got %v", tt.expectedTitle, store.titles)
+			}
+			if gjson.Get(rec.Body.String(), "generated").Bool() != tt.expectedGenerated {
+				t.Fatalf("expected generated to be %t, got %s", tt.expectedGenerated, rec.Body.String())
+			}
+
+			rec = httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/conversations/conv-1/autotitle", nil))
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("expected a second call within the interval to be rate limited, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestAutoTitleHandler_Collaborators(t *testing.T) {
+	tests := []struct {
+		name           string
+		permission     string
+		expectedStatus int
+	}{
+		{name: "write collaborator", permission: postgresql.PermissionWrite, expectedStatus: http.StatusOK},
+		{name: "read collaborator", permission: postgresql.PermissionRead, expectedStatus: http.StatusForbidden},
+		{name: "not shared", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Sourdough"}}]}`))
+			}))
+			defer upstream.Close()
+
+			store := &titlingStore{
+				conv:       postgresql.Conversation{ID: "conv-1", UserID: "owner"},
+				messages:   []postgresql.Message{{Role: "user", Content: "How do I bake sourdough?"}},
+				permission: tt.permission,
+			}
+			router := newAliasTestRouter(http.MethodPost, "/api/v1/conversations/:id/autotitle",
+				func(c *gin.Context) { c.Set("userId", "user-2") },
+				getAutoTitleHandler(false, http.Client{}, upstream.URL, store, nil, newTitleLimiter(time.Minute), AliasConfig{}),
+			)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/conversations/conv-1/autotitle", nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				if len(store.titles) != 0 {
+					t.Fatalf("expected no title to be stored, got %v", store.titles)
+				}
+				return
+			}
+			if len(store.owners) != 1 || store.owners[0] != "owner" {
+				t.Fatalf("expected the title to be stored under the owner, got %v", store.owners)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+// DeleteConversation moves one of the caller's conversations to the trash,
+// from which RestoreConversation takes it back until it is purged. Bulk
+// deletes and deleting all conversations erase them for good instead.
+func (h *ConversationHandler) DeleteConversation(c *gin.Context) {
+	if err := h.store.SoftDeleteConversation(c.Param("id"), c.GetString("userId")); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationTrash, c.Param("id"), nil)
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "deleted": true})
+}
+
+// RestoreConversation takes one of the caller's conversations out of the
+// trash.
+func (h *ConversationHandler) RestoreConversation(c *gin.Context) {
+	if err := h.store.RestoreConversation(c.Param("id"), c.GetString("userId")); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationRestore, c.Param("id"), nil)
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "deleted": false})
+}
+
+// listTrash responds with the caller's trashed conversations for
+// ListConversations.
+func (h *ConversationHandler) listTrash(c *gin.Context, userID string) {
+	res, err := h.store.GetTrashedConversationsByUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if res == nil {
+		res = []postgresql.Conversation{}
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConversationHandler_DeleteConversation(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodDelete, "/api/v1/conversations/:id", func(h *ConversationHandler) gin.HandlerFunc { return h.DeleteConversation }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1",
+			store: &mockConversationsStore{softDeleteConversationFunc: func(id, userID string) error {
+				if id != "conv-1" || userID != "user-1" {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"SoftDeleteConversation"},
+		},
+		{
+			name:   "another user's conversation",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-2",
+			store: &mockConversationsStore{softDeleteConversationFunc: func(id, userID string) error {
+				return missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"SoftDeleteConversation"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1",
+			store: &mockConversationsStore{softDeleteConversationFunc: func(id, userID string) error {
+				return failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"SoftDeleteConversation"},
+		},
+	})
+}
+
+func TestConversationHandler_RestoreConversation(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations/:id/restore", func(h *ConversationHandler) gin.HandlerFunc { return h.RestoreConversation }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/restore",
+			store: &mockConversationsStore{restoreConversationFunc: func(id, userID string) error {
+				if id != "conv-1" || userID != "user-1" {
+					return failingStore()
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"RestoreConversation"},
+		},
+		{
+			name:   "not in the trash",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/restore",
+			store: &mockConversationsStore{restoreConversationFunc: func(id, userID string) error {
+				return internal_errors.NewNotFoundError("conversation is not found in the trash")
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"RestoreConversation"},
+		},
+	})
+}
+
+func TestConversationHandler_ListConversationsTrash(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/conversations", func(h *ConversationHandler) gin.HandlerFunc { return h.ListConversations }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations?trash=true",
+			store: &mockConversationsStore{getTrashedConversationsFunc: func(userID string) ([]postgresql.Conversation, error) {
+				deletedAt := time.Now()
+				return []postgresql.Conversation{{ID: "conv-1", UserID: userID, DeletedAt: &deletedAt}}, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetTrashedConversationsByUser"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations?trash=true",
+			store: &mockConversationsStore{getTrashedConversationsFunc: func(userID string) ([]postgresql.Conversation, error) {
+				return nil, failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetTrashedConversationsByUser"},
+		},
+	})
+}
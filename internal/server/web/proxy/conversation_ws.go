@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/bricks-cloud/bricksllm/internal/util"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+// MessageSubscriber wakes the subscribers of a conversation after messages
+// are created in it, e.g. through Postgres LISTEN/NOTIFY. The returned func
+// ends the subscription.
+type MessageSubscriber interface {
+	Subscribe(conversationID string) (<-chan struct{}, func())
+}
+
+// WithMessageSubscriber enables streaming new messages over WebSocket.
+// Without it StreamMessages responds with 503.
+func WithMessageSubscriber(s MessageSubscriber) ConversationHandlerOption {
+	return func(h *ConversationHandler) {
+		h.messageEvents = s
+	}
+}
+
+// StreamMessages upgrades to a WebSocket that receives every message
+// created in one of the caller's conversations from then on, one JSON
+// message per frame, so several tabs of the same chat stay in sync. A
+// client reconnecting passes the seq of the last message it has as
+// after_seq to receive the ones it missed first. The upgrade request goes
+// through the auth middleware like any other, and the conversation is
+// checked before upgrading so failures are plain HTTP errors.
+func (h *ConversationHandler) StreamMessages(c *gin.Context) {
+	if h.messageEvents == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "message streaming is not enabled"})
+		return
+	}
+
+	afterSeq := int64(-1)
+	if value := c.Query("after_seq"); len(value) != 0 {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "after_seq must be a non-negative integer"})
+			return
+		}
+		afterSeq = n
+	}
+
+	id, userID := c.Param("id"), c.GetString("userId")
+
+	// subscribe before reading so no message falls between the two
+	wake, unsubscribe := h.messageEvents.Subscribe(id)
+	defer unsubscribe()
+
+	msgs, err := h.store.GetMessagesForUser(id, userID)
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	if afterSeq < 0 {
+		afterSeq = lastMessageSeq(msgs)
+		msgs = nil
+	}
+
+	log := util.GetLogFromCtx(c)
+	telemetry.Incr("bricksllm.proxy.stream_messages.connections", nil, 1)
+
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		// clients only listen, reading is how a close is noticed
+		closed := make(chan struct{})
+		go func() {
+			io.Copy(io.Discard, ws)
+			close(closed)
+		}()
+
+		for {
+			for _, m := range msgs {
+				if m.Seq <= afterSeq {
+					continue
+				}
+				if err := websocket.JSON.Send(ws, m); err != nil {
+					return
+				}
+				afterSeq = m.Seq
+			}
+
+			select {
+			case <-closed:
+				return
+			case <-wake:
+			}
+
+			msgs, err = h.store.GetMessagesForUser(id, userID)
+			if err != nil {
+				// a deleted conversation ends the stream quietly
+				if _, ok := err.(notFoundError); !ok {
+					log.Info("error when reading messages for websocket", zap.Error(err))
+				}
+				return
+			}
+		}
+	}}.ServeHTTP(c.Writer, c.Request)
+}
+
+func lastMessageSeq(msgs []postgresql.Message) int64 {
+	if len(msgs) == 0 {
+		return 0
+	}
+	return msgs[len(msgs)-1].Seq
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// fakeMessageSubscriber hands out one wake channel per subscription.
+type fakeMessageSubscriber struct {
+	wake chan struct{}
+}
+
+func (s *fakeMessageSubscriber) Subscribe(conversationID string) (<-chan struct{}, func()) {
+	return s.wake, func() {}
+}
+
+func TestConversationHandler_StreamMessages(t *testing.T) {
+	var mu sync.Mutex
+	msgs := []postgresql.Message{{ID: "msg-1", Seq: 1, Role: "user", Content: "hi"}}
+	store := &mockConversationsStore{getMessagesForUserFunc: func(conversationID, userID string) ([]postgresql.Message, error) {
+		if userID != "user-1" {
+			return nil, internal_errors.NewNotFoundError("conversation is not found")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]postgresql.Message{}, msgs...), nil
+	}}
+	sub := &fakeMessageSubscriber{wake: make(chan struct{}, 1)}
+	h := NewConversationHandler(store, WithMessageSubscriber(sub))
+
+	router := newAliasTestRouter(http.MethodGet, "/api/v1/conversations/:id/ws", func(c *gin.Context) {
+		c.Set("userId", "user-1")
+	}, h.StreamMessages)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	receive := func(ws *websocket.Conn) postgresql.Message {
+		t.Helper()
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var m postgresql.Message
+		if err := websocket.JSON.Receive(ws, &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	wsUrl := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/conversations/conv-1/ws"
+	ws, err := websocket.Dial(wsUrl, "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	mu.Lock()
+	msgs = append(msgs, postgresql.Message{ID: "msg-2", Seq: 2, Role: "assistant", Content: "hello"})
+	mu.Unlock()
+	sub.wake <- struct{}{}
+
+	// the existing message is not resent, only the new one arrives
+	if m := receive(ws); m.ID != "msg-2" {
+		t.Fatalf("expected msg-2, got %+v", m)
+	}
+
+	caughtUp, err := websocket.Dial(wsUrl+"?after_seq=0", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer caughtUp.Close()
+
+	if m := receive(caughtUp); m.ID != "msg-1" {
+		t.Fatalf("expected msg-1 first, got %+v", m)
+	}
+	if m := receive(caughtUp); m.ID != "msg-2" {
+		t.Fatalf("expected msg-2 second, got %+v", m)
+	}
+}
+
+func TestConversationHandler_StreamMessages_Errors(t *testing.T) {
+	withSubscriber := func(h *ConversationHandler) gin.HandlerFunc {
+		WithMessageSubscriber(&fakeMessageSubscriber{wake: make(chan struct{})})(h)
+		return h.StreamMessages
+	}
+
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/conversations/:id/ws", withSubscriber, []conversationHandlerCase{
+		{
+			name:   "conversation of another user",
+			userID: "user-2",
+			path:   "/api/v1/conversations/conv-1/ws",
+			store: &mockConversationsStore{getMessagesForUserFunc: func(conversationID, userID string) ([]postgresql.Message, error) {
+				return nil, missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetMessagesForUser"},
+		},
+		{
+			name:           "malformed after_seq",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/ws?after_seq=last",
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/conversations/:id/ws", func(h *ConversationHandler) gin.HandlerFunc { return h.StreamMessages }, []conversationHandlerCase{
+		{
+			name:           "streaming disabled",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/ws",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	})
+}
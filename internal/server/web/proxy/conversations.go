@@ -1,29 +1,137 @@
 package proxy
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/bricks-cloud/bricksllm/internal/util"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"go.uber.org/zap"
 )
 
 type conversationsStore interface {
-	CreateConversationTables() error
-	GetConversationsByUser(userID string) ([]postgresql.Conversation, error)
+	GetConversationPreviewsByUser(userID string, archived bool, metaKey, metaValue, folderID string, createdAfter, createdBefore time.Time) ([]postgresql.ConversationPreview, error)
+	GetAllConversations(limit int, beforeUpdatedAt time.Time, beforeID string) ([]postgresql.Conversation, error)
+	GetConversation(id string) (*postgresql.Conversation, error)
 	CreateConversation(c postgresql.Conversation) error
+	UpdateConversationTitle(id, userID, title string) error
+	UpdateConversationMetadata(id, userID string, metadata json.RawMessage) error
+	SetConversationPinned(id, userID string, pinned bool) error
+	SetConversationArchived(id, userID string, archived bool) error
+	MarkConversationRead(id, userID string) error
+	DeleteConversations(ids []string, userID string) (int, error)
+	DeleteAllConversationsForUser(userID string) (int, error)
+	ForkConversation(id, userID string, uptoMessageID string) (string, error)
+	CreateShareLink(id, userID string) (string, error)
+	RevokeShareLink(id, userID string) error
+	GetConversationByShareToken(token string) (*postgresql.Conversation, error)
 	GetMessages(conversationID string) ([]postgresql.Message, error)
+	GetMessagesForUser(conversationID, userID string) ([]postgresql.Message, error)
+	GetMessagesForUserByRole(conversationID, userID, role string) ([]postgresql.Message, error)
 	CreateMessage(m postgresql.Message) error
+	CreateMessageUnlessDuplicate(m postgresql.Message, window time.Duration) (*postgresql.Message, error)
+	ReplaceLastAssistantMessage(previousID string, m postgresql.Message) error
+	UpdateMessageContent(id, content, finishReason string, completionTokens int) error
+	UpdateStreamingMessage(id, content string) error
+	CompleteStreamingMessage(m postgresql.Message) error
+	SetMessageReaction(conversationID, messageID, userID string, value int) error
+	GetMessageReaction(conversationID, messageID, userID string) (*postgresql.Reaction, error)
+	CreateFolder(f postgresql.Folder) error
+	GetFoldersByUser(userID string) ([]postgresql.Folder, error)
+	RenameFolder(id, userID, name string) error
+	DeleteFolder(id, userID string) error
+	SetConversationFolder(id, userID, folderID string) error
+	UpdateConversationDefaultParams(id, userID string, params *postgresql.SamplingParams) error
+	SoftDeleteConversation(id, userID string) error
+	RestoreConversation(id, userID string) error
+	GetTrashedConversationsByUser(userID string) ([]postgresql.Conversation, error)
+	CreateConversationWithMessages(c postgresql.Conversation, msgs []postgresql.Message) error
+	CreateTemplate(t postgresql.Template) error
+	GetTemplatesForUser(userID string) ([]postgresql.Template, error)
+	GetTemplateForUser(id, userID string) (*postgresql.Template, error)
+	DeleteTemplate(id, userID string) error
+	UpdateMessageMetadata(conversationID, messageID, userID string, metadata json.RawMessage) error
+	MergeConversations(targetID, sourceID, userID string) error
+	GetConversationsUpdatedSince(userID string, since time.Time) ([]postgresql.Conversation, error)
+	GetMessagesUpdatedSince(userID string, since time.Time) ([]postgresql.Message, error)
+	GrantConversationAccess(id, ownerID, userID, permission string) error
+	RevokeConversationAccess(id, ownerID, userID string) error
+	GetConversationShares(id, ownerID string) ([]postgresql.ConversationShare, error)
+	GetConversationPermission(id, userID string) (string, error)
+	GetMessageThread(rootID string) ([]postgresql.Message, error)
+	GetUserStats(userID string) (postgresql.UserStats, error)
+	GetUserModelUsage(userID string) ([]postgresql.ModelUsage, error)
 }
 
+// maxBulkDeleteIDs bounds how many conversations one bulk delete may name.
+const maxBulkDeleteIDs = 1000
+
+// maxFinishReasonLength matches the messages.finish_reason column.
+const maxFinishReasonLength = 50
+
 type ConversationHandler struct {
-	store conversationsStore
+	store          conversationsStore
+	metadataSchema MetadataSchema
+	audit          auditLog
+	dedupWindow    time.Duration
+	// maxContentLength caps message content in runes, zero meaning no cap.
+	maxContentLength int
+	defaultMetadata  map[string]string
+	messageEvents    MessageSubscriber
+}
+
+type ConversationHandlerOption func(h *ConversationHandler)
+
+// WithMetadataSchema makes the handler reject conversation metadata that does
+// not match schema. Without it any metadata is accepted.
+func WithMetadataSchema(schema MetadataSchema) ConversationHandlerOption {
+	return func(h *ConversationHandler) {
+		h.metadataSchema = schema
+	}
+}
+
+// WithDefaultMetadata adds the defaults keys to the metadata of new
+// conversations that do not set them.
+func WithDefaultMetadata(defaults map[string]string) ConversationHandlerOption {
+	return func(h *ConversationHandler) {
+		h.defaultMetadata = defaults
+	}
+}
+
+// WithMessageDedupWindow makes CreateMessage return the conversation's latest
+// message instead of adding a copy of it when it was created within window,
+// which absorbs double submits. A zero window keeps every message.
+func WithMessageDedupWindow(window time.Duration) ConversationHandlerOption {
+	return func(h *ConversationHandler) {
+		h.dedupWindow = window
+	}
+}
+
+// WithMaxMessageContentLength makes CreateMessage reject content longer than
+// n runes with a 400. Zero accepts any length.
+func WithMaxMessageContentLength(n int) ConversationHandlerOption {
+	return func(h *ConversationHandler) {
+		h.maxContentLength = n
+	}
 }
 
-func NewConversationHandler(store conversationsStore) *ConversationHandler {
-	return &ConversationHandler{store: store}
+func NewConversationHandler(store conversationsStore, opts ...ConversationHandlerOption) *ConversationHandler {
+	h := &ConversationHandler{store: store}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *ConversationHandler) ListConversations(c *gin.Context) {
@@ -32,7 +140,31 @@ func (h *ConversationHandler) ListConversations(c *gin.Context) {
 		c.JSON(http.StatusOK, []interface{}{})
 		return
 	}
-	res, err := h.store.GetConversationsByUser(userID)
+	// the trash is listed on its own, the other filters do not apply to it
+	if c.Query("trash") == "true" {
+		h.listTrash(c, userID)
+		return
+	}
+	archived := c.Query("archived") == "true"
+	metaKey, hasKey := c.GetQuery("meta_key")
+	metaValue, hasValue := c.GetQuery("meta_value")
+	if hasKey != hasValue || (hasKey && metaKey == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "meta_key and meta_value must be given together"})
+		return
+	}
+	createdAfter, ok := parseTimeQuery(c, "created_after")
+	if !ok {
+		return
+	}
+	createdBefore, ok := parseTimeQuery(c, "created_before")
+	if !ok {
+		return
+	}
+	if !createdAfter.IsZero() && !createdBefore.IsZero() && !createdAfter.Before(createdBefore) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "created_after must be before created_before"})
+		return
+	}
+	res, err := h.store.GetConversationPreviewsByUser(userID, archived, metaKey, metaValue, c.Query("folder_id"), createdAfter, createdBefore)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -40,65 +172,484 @@ func (h *ConversationHandler) ListConversations(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
+// parseTimeQuery reads the RFC3339 timestamp in the query param name. A
+// missing param is the zero time. On a malformed one it writes a 400 and
+// returns false.
+func parseTimeQuery(c *gin.Context, name string) (time.Time, bool) {
+	value := c.Query(name)
+	if len(value) == 0 {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC3339 timestamp, e.g. 2024-05-14T00:00:00Z", name)})
+		return time.Time{}, false
+	}
+	return t, true
+}
+
 func (h *ConversationHandler) CreateConversation(c *gin.Context) {
 	var req struct {
-		Title string          `json:"title"`
-		Meta  json.RawMessage `json:"metadata"`
+		Title        string          `json:"title"`
+		Meta         json.RawMessage `json:"metadata"`
+		SystemPrompt string          `json:"system_prompt"`
+		TokenBudget  int             `json:"token_budget"`
+		// DefaultParams are sampling parameters applied to requests that leave them out.
+		DefaultParams *postgresql.SamplingParams `json:"default_params"`
 	}
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
 		return
 	}
+	if req.TokenBudget < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token_budget cannot be negative"})
+		return
+	}
+	if err := req.DefaultParams.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.metadataSchema.validate(req.Meta); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	meta, err := withDefaultMetadata(req.Meta, h.defaultMetadata)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	userID := c.GetString("userId")
 	now := time.Now()
+	id := uuid.NewString()
+	if _, err := RenderSystemPrompt(req.SystemPrompt, systemPromptVars(meta, id, req.Title, userID, now)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	conv := postgresql.Conversation{
-		ID:        uuid.NewString(),
-		Title:     req.Title,
-		UserID:    userID,
-		CreatedAt: now,
-		UpdatedAt: now,
-		Metadata:  req.Meta,
+		ID:            id,
+		Title:         req.Title,
+		UserID:        userID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Metadata:      meta,
+		SystemPrompt:  req.SystemPrompt,
+		TokenBudget:   req.TokenBudget,
+		DefaultParams: req.DefaultParams,
 	}
 	if err := h.store.CreateConversation(conv); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordAudit(c, h.audit, auditConversationCreate, conv.ID, gin.H{"title": conv.Title})
 	c.JSON(http.StatusOK, conv)
 }
 
-func (h *ConversationHandler) ListMessages(c *gin.Context) {
-	id := c.Param("id")
-	msgs, err := h.store.GetMessages(id)
+func (h *ConversationHandler) GetConversation(c *gin.Context) {
+	conv, err := h.store.GetConversation(c.Param("id"))
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	if conv.UserID != c.GetString("userId") {
+		// collaborators can read it too
+		if _, err := h.store.GetConversationPermission(conv.ID, c.GetString("userId")); err != nil {
+			writeConversationStoreError(c, err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, conv)
+}
+
+// UpdateConversationMetadata replaces the metadata of one of the caller's
+// conversations.
+func (h *ConversationHandler) UpdateConversationMetadata(c *gin.Context) {
+	var req struct {
+		Meta json.RawMessage `json:"metadata"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if err := h.metadataSchema.validate(req.Meta); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.store.UpdateConversationMetadata(c.Param("id"), c.GetString("userId"), req.Meta); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationMetadata, c.Param("id"), nil)
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "metadata": req.Meta})
+}
+
+func (h *ConversationHandler) PinConversation(c *gin.Context) {
+	var req struct {
+		Pinned *bool `json:"pinned"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+	}
+	pinned := req.Pinned == nil || *req.Pinned
+	if err := h.store.SetConversationPinned(c.Param("id"), c.GetString("userId"), pinned); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationPin, c.Param("id"), gin.H{"pinned": pinned})
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "pinned": pinned})
+}
+
+func (h *ConversationHandler) ArchiveConversation(c *gin.Context) {
+	h.setArchived(c, true)
+}
+
+func (h *ConversationHandler) UnarchiveConversation(c *gin.Context) {
+	h.setArchived(c, false)
+}
+
+func (h *ConversationHandler) setArchived(c *gin.Context, archived bool) {
+	if err := h.store.SetConversationArchived(c.Param("id"), c.GetString("userId"), archived); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationArchive, c.Param("id"), gin.H{"archived": archived})
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "archived": archived})
+}
+
+func (h *ConversationHandler) MarkConversationRead(c *gin.Context) {
+	if err := h.store.MarkConversationRead(c.Param("id"), c.GetString("userId")); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationRead, c.Param("id"), nil)
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "read": true})
+}
+
+// DeleteConversations deletes the caller's conversations among the body's
+// ids. IDs of conversations the caller does not own are skipped, so the
+// response's deleted count can be lower than the number of ids.
+func (h *ConversationHandler) DeleteConversations(c *gin.Context) {
+	userID := c.GetString("userId")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user is not authenticated"})
+		return
+	}
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if len(req.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids is required"})
+		return
+	}
+	if len(req.IDs) > maxBulkDeleteIDs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cannot delete more than %d conversations at once", maxBulkDeleteIDs)})
+		return
+	}
+	n, err := h.store.DeleteConversations(req.IDs, userID)
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationBulkDelete, userID, gin.H{"ids": req.IDs, "count": n})
+	c.JSON(http.StatusOK, gin.H{"deleted": n})
+}
+
+// DeleteAllConversations erases all of the caller's conversations. The
+// explicit confirm parameter guards against accidental calls.
+func (h *ConversationHandler) DeleteAllConversations(c *gin.Context) {
+	userID := c.GetString("userId")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user is not authenticated"})
+		return
+	}
+	if c.Query("confirm") != "true" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "confirm=true is required to delete all conversations"})
+		return
+	}
+	n, err := h.store.DeleteAllConversationsForUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	util.GetLogFromCtx(c).Info("deleted all conversations for user",
+		zap.String("audit", "delete_all_conversations"),
+		zap.String("userId", userID),
+		zap.Int("count", n),
+	)
+	recordAudit(c, h.audit, auditConversationDeleteAll, userID, gin.H{"count": n})
+	c.JSON(http.StatusOK, gin.H{"deleted": n})
+}
+
+// ForkConversation branches a conversation into a new one, optionally
+// keeping only the messages up to the body's upto message id.
+func (h *ConversationHandler) ForkConversation(c *gin.Context) {
+	var req struct {
+		Upto string `json:"upto"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+	}
+	id, err := h.store.ForkConversation(c.Param("id"), c.GetString("userId"), req.Upto)
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationFork, id, gin.H{"forked_from": c.Param("id"), "upto": req.Upto})
+	c.JSON(http.StatusOK, gin.H{"id": id, "forked_from": c.Param("id")})
+}
+
+func (h *ConversationHandler) CreateShareLink(c *gin.Context) {
+	token, err := h.store.CreateShareLink(c.Param("id"), c.GetString("userId"))
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationShare, c.Param("id"), nil)
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "share_token": token, "path": "/shared/" + token})
+}
+
+func (h *ConversationHandler) RevokeShareLink(c *gin.Context) {
+	if err := h.store.RevokeShareLink(c.Param("id"), c.GetString("userId")); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditConversationUnshare, c.Param("id"), nil)
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "shared": false})
+}
+
+// sharedConversation is the public, read-only view of a shared
+// conversation. It leaves out the owner and the private metadata.
+type sharedConversation struct {
+	ID        string               `json:"id"`
+	Title     string               `json:"title"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	Metadata  json.RawMessage      `json:"metadata,omitempty"`
+	Messages  []postgresql.Message `json:"messages"`
+}
+
+// publicMetadata strips the "private" key, where clients keep metadata that
+// must not leave the owner's view, from a conversation's metadata object.
+func publicMetadata(meta json.RawMessage) json.RawMessage {
+	if len(meta) == 0 || !gjson.ValidBytes(meta) {
+		return nil
+	}
+	if !gjson.ParseBytes(meta).IsObject() {
+		return meta
+	}
+	stripped, err := sjson.DeleteBytes(meta, "private")
+	if err != nil {
+		return nil
+	}
+	return stripped
+}
+
+// GetSharedConversation serves a conversation through its share token. The
+// route is public, the token is the only credential.
+func (h *ConversationHandler) GetSharedConversation(c *gin.Context) {
+	conv, err := h.store.GetConversationByShareToken(c.Param("token"))
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	msgs, err := h.store.GetMessages(conv.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if msgs == nil {
+		msgs = []postgresql.Message{}
+	}
+	c.JSON(http.StatusOK, sharedConversation{
+		ID:        conv.ID,
+		Title:     conv.Title,
+		CreatedAt: conv.CreatedAt,
+		UpdatedAt: conv.UpdatedAt,
+		Metadata:  publicMetadata(conv.Metadata),
+		Messages:  msgs,
+	})
+}
+
+type validationError interface {
+	Error() string
+	Validation()
+}
+
+func writeConversationStoreError(c *gin.Context, err error) {
+	if _, ok := err.(notFoundError); ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := err.(validationError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// ListMessages serves the messages of one of the caller's conversations,
+// optionally only those with the ?role= role.
+func (h *ConversationHandler) ListMessages(c *gin.Context) {
+	role, filtered := c.GetQuery("role")
+	if filtered && !postgresql.IsValidMessageRole(role) {
+		writeInvalidRole(c, role)
+		return
+	}
+	var msgs []postgresql.Message
+	var err error
+	if filtered {
+		msgs, err = h.store.GetMessagesForUserByRole(c.Param("id"), c.GetString("userId"), role)
+	} else {
+		msgs, err = h.store.GetMessagesForUser(c.Param("id"), c.GetString("userId"))
+	}
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, msgs)
 }
 
 func (h *ConversationHandler) CreateMessage(c *gin.Context) {
 	var req struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
+		Role         string          `json:"role"`
+		Content      json.RawMessage `json:"content"`
+		Name         string          `json:"name"`
+		ToolCallID   string          `json:"tool_call_id"`
+		Attachments  json.RawMessage `json:"attachments"`
+		FinishReason string          `json:"finish_reason"`
+		Meta         json.RawMessage `json:"metadata"`
+		ParentID     string          `json:"parent_message_id"`
 	}
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
 		return
 	}
-	id := c.Param("id")
+	if !postgresql.IsValidMessageRole(req.Role) {
+		writeInvalidRole(c, req.Role)
+		return
+	}
+	content, parts, err := parseMessageContent(req.Content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	attachments, err := parseAttachments(req.Attachments)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	meta, err := parseMessageMetadata(req.Meta)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.FinishReason) > maxFinishReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("finish_reason cannot be longer than %d characters", maxFinishReasonLength)})
+		return
+	}
+	if h.maxContentLength > 0 && utf8.RuneCountInString(content) > h.maxContentLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": postgresql.ContentTooLongError(h.maxContentLength).Error(), "max_content_length": h.maxContentLength})
+		return
+	}
+	if !requireWriteAccess(c, h.store, c.Param("id")) {
+		return
+	}
+	msg := newConversationMessage(c.Param("id"), req.Role, content)
+	msg.ContentJSON = parts
+	msg.Name = req.Name
+	msg.ToolCallID = req.ToolCallID
+	msg.Attachments = attachments
+	msg.FinishReason = req.FinishReason
+	msg.Metadata = meta
+	msg.ParentMessageID = req.ParentID
+	if h.dedupWindow > 0 {
+		existing, err := h.store.CreateMessageUnlessDuplicate(msg, h.dedupWindow)
+		if err != nil {
+			writeConversationStoreError(c, err)
+			return
+		}
+		if existing != nil {
+			telemetry.Incr("bricksllm.proxy.create_message.deduplicated", nil, 1)
+			c.JSON(http.StatusOK, existing)
+			return
+		}
+	} else if err := h.store.CreateMessage(msg); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditMessageCreate, msg.ID, gin.H{"conversation_id": msg.ConversationID, "role": msg.Role})
+	c.JSON(http.StatusOK, msg)
+}
+
+// ReactToMessage records the caller's thumbs up (1) or down (-1) on a
+// message of one of their conversations. A value of 0 clears it.
+func (h *ConversationHandler) ReactToMessage(c *gin.Context) {
+	var req struct {
+		Value *int `json:"value"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if req.Value == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "value is required"})
+		return
+	}
+	if err := h.store.SetMessageReaction(c.Param("id"), c.Param("messageId"), c.GetString("userId"), *req.Value); err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	recordAudit(c, h.audit, auditMessageReact, c.Param("messageId"), gin.H{"conversation_id": c.Param("id"), "value": *req.Value})
+	c.JSON(http.StatusOK, gin.H{"message_id": c.Param("messageId"), "value": *req.Value})
+}
+
+func (h *ConversationHandler) GetMessageReaction(c *gin.Context) {
+	r, err := h.store.GetMessageReaction(c.Param("id"), c.Param("messageId"), c.GetString("userId"))
+	if err != nil {
+		writeConversationStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func writeInvalidRole(c *gin.Context, role string) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid role %q, valid roles are: %s", role, strings.Join(postgresql.MessageRoles, ", "))})
+}
+
+func newConversationMessage(conversationID, role, content string) postgresql.Message {
 	now := time.Now()
-	msg := postgresql.Message{
+	return postgresql.Message{
 		ID:             uuid.NewString(),
-		ConversationID: id,
-		Role:           req.Role,
-		Content:        req.Content,
+		ConversationID: conversationID,
+		Role:           role,
+		Content:        content,
 		CreatedAt:      now,
 		UpdatedAt:      now,
 	}
-	if err := h.store.CreateMessage(msg); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, msg)
 }
 
+// parseAttachments accepts a missing/null value or a JSON array of
+// attachment objects; objects and scalars are rejected.
+func parseAttachments(raw json.RawMessage) ([]postgresql.Attachment, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return []postgresql.Attachment{}, nil
+	}
+	if trimmed[0] != '[' {
+		return nil, errors.New("attachments must be a JSON array")
+	}
+	attachments := []postgresql.Attachment{}
+	if err := json.Unmarshal(trimmed, &attachments); err != nil {
+		return nil, fmt.Errorf("invalid attachments: %v", err)
+	}
+	return attachments, nil
+}
@@ -0,0 +1,1174 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+type conversationHandlerCase struct {
+	name           string
+	userID         string
+	path           string
+	body           string
+	store          *mockConversationsStore
+	expectedStatus int
+	expectedCalls  []string
+}
+
+func ownConversation(id string) (*postgresql.Conversation, error) {
+	return &postgresql.Conversation{ID: id, UserID: "user-1"}, nil
+}
+
+func otherConversation(id string) (*postgresql.Conversation, error) {
+	return &postgresql.Conversation{ID: id, UserID: "user-2"}, nil
+}
+
+func failingStore() error {
+	return errors.New("database is down")
+}
+
+func missingConversation() error {
+	return internal_errors.NewNotFoundError("conversation is not found")
+}
+
+func ownerPermission(id, userID string) (string, error) {
+	return postgresql.PermissionOwner, nil
+}
+
+// runConversationHandlerCases serves every case through a fresh router on
+// route, with the case's userId set the way the auth middleware would.
+func runConversationHandlerCases(t *testing.T, method, route string, handler func(h *ConversationHandler) gin.HandlerFunc, tests []conversationHandlerCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.store
+			if store == nil {
+				store = &mockConversationsStore{}
+			}
+
+			router := newAliasTestRouter(method, route,
+				func(c *gin.Context) {
+					if len(tt.userID) != 0 {
+						c.Set("userId", tt.userID)
+					}
+				},
+				handler(NewConversationHandler(store)),
+			)
+
+			var body io.Reader
+			if len(tt.body) != 0 {
+				body = strings.NewReader(tt.body)
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(method, tt.path, body))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if strings.Join(store.calls, ",") != strings.Join(tt.expectedCalls, ",") {
+				t.Fatalf("expected store calls %v, got %v", tt.expectedCalls, store.calls)
+			}
+		})
+	}
+}
+
+func TestConversationHandler_ListConversations(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/conversations", func(h *ConversationHandler) gin.HandlerFunc { return h.ListConversations }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations",
+			store: &mockConversationsStore{getConversationPreviewsByUserFunc: func(userID string, archived bool, metaKey, metaValue, folderID string, createdAfter, createdBefore time.Time) ([]postgresql.ConversationPreview, error) {
+				return []postgresql.ConversationPreview{}, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversationPreviewsByUser"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations",
+			store: &mockConversationsStore{getConversationPreviewsByUserFunc: func(userID string, archived bool, metaKey, metaValue, folderID string, createdAfter, createdBefore time.Time) ([]postgresql.ConversationPreview, error) {
+				return nil, failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetConversationPreviewsByUser"},
+		},
+		{
+			name:   "folder filter",
+			userID: "user-1",
+			path:   "/api/v1/conversations?folder_id=folder-1",
+			store: &mockConversationsStore{getConversationPreviewsByUserFunc: func(userID string, archived bool, metaKey, metaValue, folderID string, createdAfter, createdBefore time.Time) ([]postgresql.ConversationPreview, error) {
+				if folderID != "folder-1" {
+					return nil, failingStore()
+				}
+				return []postgresql.ConversationPreview{}, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversationPreviewsByUser"},
+		},
+		{
+			name:   "date range",
+			userID: "user-1",
+			path:   "/api/v1/conversations?created_after=2024-05-14T00:00:00Z&created_before=2024-05-15T00:00:00%2B03:00",
+			store: &mockConversationsStore{getConversationPreviewsByUserFunc: func(userID string, archived bool, metaKey, metaValue, folderID string, createdAfter, createdBefore time.Time) ([]postgresql.ConversationPreview, error) {
+				if !createdAfter.Equal(time.Date(2024, 5, 14, 0, 0, 0, 0, time.UTC)) || !createdBefore.Equal(time.Date(2024, 5, 14, 21, 0, 0, 0, time.UTC)) {
+					return nil, failingStore()
+				}
+				return []postgresql.ConversationPreview{}, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversationPreviewsByUser"},
+		},
+		{
+			name:           "malformed created_after",
+			userID:         "user-1",
+			path:           "/api/v1/conversations?created_after=last-tuesday",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "malformed created_before",
+			userID:         "user-1",
+			path:           "/api/v1/conversations?created_before=2024-05-14",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "empty date range",
+			userID:         "user-1",
+			path:           "/api/v1/conversations?created_after=2024-05-15T00:00:00Z&created_before=2024-05-14T00:00:00Z",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing userId",
+			path:           "/api/v1/conversations",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "meta_key without meta_value",
+			userID:         "user-1",
+			path:           "/api/v1/conversations?meta_key=project",
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestConversationHandler_CreateConversation(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations", func(h *ConversationHandler) gin.HandlerFunc { return h.CreateConversation }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations",
+			body:   `{"title":"hello"}`,
+			store: &mockConversationsStore{createConversationFunc: func(c postgresql.Conversation) error {
+				if c.UserID != "user-1" {
+					return errors.New("conversation is not owned by the caller")
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"CreateConversation"},
+		},
+		{
+			name:   "missing metadata is stored as an empty object",
+			userID: "user-1",
+			path:   "/api/v1/conversations",
+			body:   `{"title":"hello","metadata":null}`,
+			store: &mockConversationsStore{createConversationFunc: func(c postgresql.Conversation) error {
+				if string(c.Metadata) != `{}` {
+					return errors.New("unexpected metadata " + string(c.Metadata))
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"CreateConversation"},
+		},
+		{
+			name:           "system prompt referencing an undefined variable",
+			userID:         "user-1",
+			path:           "/api/v1/conversations",
+			body:           `{"title":"hello","system_prompt":"You are talking to {{user_name}}."}`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "system prompt using a metadata variable",
+			userID: "user-1",
+			path:   "/api/v1/conversations",
+			body:   `{"title":"hello","metadata":{"user_name":"Dana"},"system_prompt":"You are talking to {{user_name}}."}`,
+			store: &mockConversationsStore{createConversationFunc: func(c postgresql.Conversation) error {
+				if c.SystemPrompt != "You are talking to {{user_name}}." {
+					return errors.New("expected the template to be stored unrendered, got " + c.SystemPrompt)
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"CreateConversation"},
+		},
+		{
+			name:   "default params",
+			userID: "user-1",
+			path:   "/api/v1/conversations",
+			body:   `{"title":"hello","default_params":{"temperature":0.7}}`,
+			store: &mockConversationsStore{createConversationFunc: func(c postgresql.Conversation) error {
+				if c.DefaultParams == nil || *c.DefaultParams.Temperature != 0.7 {
+					return errors.New("expected the default params to be stored")
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"CreateConversation"},
+		},
+		{
+			name:           "default temperature out of range",
+			userID:         "user-1",
+			path:           "/api/v1/conversations",
+			body:           `{"title":"hello","default_params":{"temperature":3}}`,
+			store:          &mockConversationsStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations",
+			body:   `{"title":"hello"}`,
+			store: &mockConversationsStore{createConversationFunc: func(c postgresql.Conversation) error {
+				return failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"CreateConversation"},
+		},
+		{
+			name:           "bad body",
+			userID:         "user-1",
+			path:           "/api/v1/conversations",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "negative token budget",
+			userID:         "user-1",
+			path:           "/api/v1/conversations",
+			body:           `{"token_budget":-1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestConversationHandler_GetConversation(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/conversations/:id", func(h *ConversationHandler) gin.HandlerFunc { return h.GetConversation }, []conversationHandlerCase{
+		{
+			name:           "success",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1",
+			store:          &mockConversationsStore{getConversationFunc: ownConversation},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversation"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1",
+			store: &mockConversationsStore{getConversationFunc: func(id string) (*postgresql.Conversation, error) {
+				return nil, failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetConversation"},
+		},
+		{
+			name:   "not found",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1",
+			store: &mockConversationsStore{getConversationFunc: func(id string) (*postgresql.Conversation, error) {
+				return nil, missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetConversation"},
+		},
+		{
+			name:   "another user's conversation",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1",
+			store: &mockConversationsStore{
+				getConversationFunc: otherConversation,
+				getPermissionFunc: func(id, userID string) (string, error) {
+					return "", missingConversation()
+				},
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetConversation", "GetConversationPermission"},
+		},
+		{
+			name:   "shared with the user",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1",
+			store: &mockConversationsStore{
+				getConversationFunc: otherConversation,
+				getPermissionFunc: func(id, userID string) (string, error) {
+					return postgresql.PermissionRead, nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversation", "GetConversationPermission"},
+		},
+		{
+			name: "missing userId",
+			path: "/api/v1/conversations/conv-1",
+			store: &mockConversationsStore{
+				getConversationFunc: ownConversation,
+				getPermissionFunc: func(id, userID string) (string, error) {
+					return "", missingConversation()
+				},
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetConversation", "GetConversationPermission"},
+		},
+	})
+}
+
+func TestConversationHandler_PinConversation(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations/:id/pin", func(h *ConversationHandler) gin.HandlerFunc { return h.PinConversation }, []conversationHandlerCase{
+		{
+			name:   "pins by default",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/pin",
+			store: &mockConversationsStore{setConversationPinnedFunc: func(id, userID string, pinned bool) error {
+				if !pinned {
+					return errors.New("expected the conversation to be pinned")
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"SetConversationPinned"},
+		},
+		{
+			name:   "unpins",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/pin",
+			body:   `{"pinned":false}`,
+			store: &mockConversationsStore{setConversationPinnedFunc: func(id, userID string, pinned bool) error {
+				if pinned {
+					return errors.New("expected the conversation to be unpinned")
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"SetConversationPinned"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/pin",
+			store: &mockConversationsStore{setConversationPinnedFunc: func(id, userID string, pinned bool) error {
+				return failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"SetConversationPinned"},
+		},
+		{
+			name: "missing userId",
+			path: "/api/v1/conversations/conv-1/pin",
+			store: &mockConversationsStore{setConversationPinnedFunc: func(id, userID string, pinned bool) error {
+				return missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"SetConversationPinned"},
+		},
+		{
+			name:           "bad body",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/pin",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestConversationHandler_ArchiveConversation(t *testing.T) {
+	for _, archived := range []bool{true, false} {
+		route, handler := "/api/v1/conversations/:id/archive", func(h *ConversationHandler) gin.HandlerFunc { return h.ArchiveConversation }
+		if !archived {
+			route, handler = "/api/v1/conversations/:id/unarchive", func(h *ConversationHandler) gin.HandlerFunc { return h.UnarchiveConversation }
+		}
+		path := strings.Replace(route, ":id", "conv-1", 1)
+
+		runConversationHandlerCases(t, http.MethodPost, route, handler, []conversationHandlerCase{
+			{
+				name:   path + " success",
+				userID: "user-1",
+				path:   path,
+				store: &mockConversationsStore{setConversationArchivedFunc: func(id, userID string, got bool) error {
+					if got != archived {
+						return errors.New("unexpected archived value")
+					}
+					return nil
+				}},
+				expectedStatus: http.StatusOK,
+				expectedCalls:  []string{"SetConversationArchived"},
+			},
+			{
+				name:   path + " store error",
+				userID: "user-1",
+				path:   path,
+				store: &mockConversationsStore{setConversationArchivedFunc: func(id, userID string, got bool) error {
+					return failingStore()
+				}},
+				expectedStatus: http.StatusInternalServerError,
+				expectedCalls:  []string{"SetConversationArchived"},
+			},
+			{
+				name: path + " missing userId",
+				path: path,
+				store: &mockConversationsStore{setConversationArchivedFunc: func(id, userID string, got bool) error {
+					return missingConversation()
+				}},
+				expectedStatus: http.StatusNotFound,
+				expectedCalls:  []string{"SetConversationArchived"},
+			},
+		})
+	}
+}
+
+func TestConversationHandler_MarkConversationRead(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations/:id/read", func(h *ConversationHandler) gin.HandlerFunc { return h.MarkConversationRead }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/read",
+			store: &mockConversationsStore{markConversationReadFunc: func(id, userID string) error {
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"MarkConversationRead"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/read",
+			store: &mockConversationsStore{markConversationReadFunc: func(id, userID string) error {
+				return failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"MarkConversationRead"},
+		},
+		{
+			name: "missing userId",
+			path: "/api/v1/conversations/conv-1/read",
+			store: &mockConversationsStore{markConversationReadFunc: func(id, userID string) error {
+				return missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"MarkConversationRead"},
+		},
+	})
+}
+
+func TestConversationHandler_DeleteConversations(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations/bulk-delete", func(h *ConversationHandler) gin.HandlerFunc { return h.DeleteConversations }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/bulk-delete",
+			body:   `{"ids":["conv-1","conv-2"]}`,
+			store: &mockConversationsStore{deleteConversationsFunc: func(ids []string, userID string) (int, error) {
+				if strings.Join(ids, ",") != "conv-1,conv-2" || userID != "user-1" {
+					return 0, errors.New("unexpected ids or user")
+				}
+				return 2, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"DeleteConversations"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/bulk-delete",
+			body:   `{"ids":["conv-1"]}`,
+			store: &mockConversationsStore{deleteConversationsFunc: func(ids []string, userID string) (int, error) {
+				return 0, failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"DeleteConversations"},
+		},
+		{
+			name:           "missing userId",
+			path:           "/api/v1/conversations/bulk-delete",
+			body:           `{"ids":["conv-1"]}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "no ids",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/bulk-delete",
+			body:           `{"ids":[]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "bad body",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/bulk-delete",
+			body:           `{"ids":"conv-1"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestConversationHandler_DeleteAllConversations(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodDelete, "/api/v1/conversations/all", func(h *ConversationHandler) gin.HandlerFunc { return h.DeleteAllConversations }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/all?confirm=true",
+			store: &mockConversationsStore{deleteAllConversationsForUserFunc: func(userID string) (int, error) {
+				if userID != "user-1" {
+					return 0, errors.New("expected the caller's conversations to be erased, got " + userID)
+				}
+				return 3, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"DeleteAllConversationsForUser"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/all?confirm=true",
+			store: &mockConversationsStore{deleteAllConversationsForUserFunc: func(userID string) (int, error) {
+				return 0, failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"DeleteAllConversationsForUser"},
+		},
+		{
+			name:           "missing userId",
+			path:           "/api/v1/conversations/all?confirm=true",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing confirm",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/all",
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestConversationHandler_ForkConversation(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations/:id/fork", func(h *ConversationHandler) gin.HandlerFunc { return h.ForkConversation }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/fork",
+			body:   `{"upto":"msg-2"}`,
+			store: &mockConversationsStore{forkConversationFunc: func(id, userID, upto string) (string, error) {
+				if upto != "msg-2" {
+					return "", errors.New("unexpected upto message")
+				}
+				return "conv-2", nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"ForkConversation"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/fork",
+			store: &mockConversationsStore{forkConversationFunc: func(id, userID, upto string) (string, error) {
+				return "", failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"ForkConversation"},
+		},
+		{
+			name: "missing userId",
+			path: "/api/v1/conversations/conv-1/fork",
+			store: &mockConversationsStore{forkConversationFunc: func(id, userID, upto string) (string, error) {
+				return "", missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"ForkConversation"},
+		},
+		{
+			name:           "bad body",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/fork",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestConversationHandler_ShareLinks(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations/:id/share", func(h *ConversationHandler) gin.HandlerFunc { return h.CreateShareLink }, []conversationHandlerCase{
+		{
+			name:   "create success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/share",
+			store: &mockConversationsStore{createShareLinkFunc: func(id, userID string) (string, error) {
+				return "token", nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"CreateShareLink"},
+		},
+		{
+			name:   "create store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/share",
+			store: &mockConversationsStore{createShareLinkFunc: func(id, userID string) (string, error) {
+				return "", failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"CreateShareLink"},
+		},
+		{
+			name: "create missing userId",
+			path: "/api/v1/conversations/conv-1/share",
+			store: &mockConversationsStore{createShareLinkFunc: func(id, userID string) (string, error) {
+				return "", missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"CreateShareLink"},
+		},
+	})
+
+	runConversationHandlerCases(t, http.MethodDelete, "/api/v1/conversations/:id/share", func(h *ConversationHandler) gin.HandlerFunc { return h.RevokeShareLink }, []conversationHandlerCase{
+		{
+			name:   "revoke success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/share",
+			store: &mockConversationsStore{revokeShareLinkFunc: func(id, userID string) error {
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"RevokeShareLink"},
+		},
+		{
+			name:   "revoke store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/share",
+			store: &mockConversationsStore{revokeShareLinkFunc: func(id, userID string) error {
+				return failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"RevokeShareLink"},
+		},
+		{
+			name: "revoke missing userId",
+			path: "/api/v1/conversations/conv-1/share",
+			store: &mockConversationsStore{revokeShareLinkFunc: func(id, userID string) error {
+				return missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"RevokeShareLink"},
+		},
+	})
+}
+
+func TestConversationHandler_SharedConversation(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodGet, "/shared/:token", func(h *ConversationHandler) gin.HandlerFunc { return h.GetSharedConversation }, []conversationHandlerCase{
+		{
+			name: "success without a user",
+			path: "/shared/token",
+			store: &mockConversationsStore{
+				getConversationByShareTokenFunc: func(token string) (*postgresql.Conversation, error) {
+					return otherConversation("conv-1")
+				},
+				getMessagesFunc: func(conversationID string) ([]postgresql.Message, error) {
+					return nil, nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversationByShareToken", "GetMessages"},
+		},
+		{
+			name: "unknown token",
+			path: "/shared/token",
+			store: &mockConversationsStore{getConversationByShareTokenFunc: func(token string) (*postgresql.Conversation, error) {
+				return nil, missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetConversationByShareToken"},
+		},
+		{
+			name: "store error",
+			path: "/shared/token",
+			store: &mockConversationsStore{
+				getConversationByShareTokenFunc: func(token string) (*postgresql.Conversation, error) {
+					return otherConversation("conv-1")
+				},
+				getMessagesFunc: func(conversationID string) ([]postgresql.Message, error) {
+					return nil, failingStore()
+				},
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetConversationByShareToken", "GetMessages"},
+		},
+	})
+}
+
+func TestConversationHandler_ListMessages(t *testing.T) {
+	// the mock owns conv-1 for user-1 only, like the store's joined query
+	messages := func(conversationID, userID string) ([]postgresql.Message, error) {
+		if userID != "user-1" {
+			return nil, missingConversation()
+		}
+		return []postgresql.Message{{ID: "msg-1", ConversationID: conversationID, Role: "user"}}, nil
+	}
+
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/conversations/:id/messages", func(h *ConversationHandler) gin.HandlerFunc { return h.ListMessages }, []conversationHandlerCase{
+		{
+			name:           "success",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/messages",
+			store:          &mockConversationsStore{getMessagesForUserFunc: messages},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetMessagesForUser"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages",
+			store: &mockConversationsStore{getMessagesForUserFunc: func(conversationID, userID string) ([]postgresql.Message, error) {
+				return nil, failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetMessagesForUser"},
+		},
+		{
+			name:   "role filter",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages?role=user",
+			store: &mockConversationsStore{getMessagesForUserByRoleFunc: func(conversationID, userID, role string) ([]postgresql.Message, error) {
+				if conversationID != "conv-1" || userID != "user-1" || role != "user" {
+					return nil, failingStore()
+				}
+				return []postgresql.Message{{ID: "msg-1", ConversationID: conversationID, Role: role}}, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetMessagesForUserByRole"},
+		},
+		{
+			name:           "invalid role",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/messages?role=developer",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "another user's conversation",
+			userID:         "user-2",
+			path:           "/api/v1/conversations/conv-1/messages",
+			store:          &mockConversationsStore{getMessagesForUserFunc: messages},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetMessagesForUser"},
+		},
+		{
+			name:           "missing userId",
+			path:           "/api/v1/conversations/conv-1/messages",
+			store:          &mockConversationsStore{getMessagesForUserFunc: messages},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetMessagesForUser"},
+		},
+	})
+}
+
+func TestConversationHandler_CreateMessage(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations/:id/messages", func(h *ConversationHandler) gin.HandlerFunc { return h.CreateMessage }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages",
+			body:   `{"role":"user","content":"hi"}`,
+			store: &mockConversationsStore{getPermissionFunc: ownerPermission, createMessageFunc: func(m postgresql.Message) error {
+				if m.ConversationID != "conv-1" {
+					return errors.New("unexpected conversation id")
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversationPermission", "CreateMessage"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages",
+			body:   `{"role":"user","content":"hi"}`,
+			store: &mockConversationsStore{getPermissionFunc: ownerPermission, createMessageFunc: func(m postgresql.Message) error {
+				return failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetConversationPermission", "CreateMessage"},
+		},
+		{
+			name:   "unknown conversation",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages",
+			body:   `{"role":"user","content":"hi"}`,
+			store: &mockConversationsStore{getPermissionFunc: func(id, userID string) (string, error) {
+				return "", missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetConversationPermission"},
+		},
+		{
+			name:   "write collaborator",
+			userID: "user-2",
+			path:   "/api/v1/conversations/conv-1/messages",
+			body:   `{"role":"user","content":"hi"}`,
+			store: &mockConversationsStore{
+				getPermissionFunc: func(id, userID string) (string, error) {
+					return postgresql.PermissionWrite, nil
+				},
+				createMessageFunc: func(m postgresql.Message) error {
+					return nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversationPermission", "CreateMessage"},
+		},
+		{
+			name:   "read-only collaborator",
+			userID: "user-2",
+			path:   "/api/v1/conversations/conv-1/messages",
+			body:   `{"role":"user","content":"hi"}`,
+			store: &mockConversationsStore{getPermissionFunc: func(id, userID string) (string, error) {
+				return postgresql.PermissionRead, nil
+			}},
+			expectedStatus: http.StatusForbidden,
+			expectedCalls:  []string{"GetConversationPermission"},
+		},
+		{
+			name:           "bad body",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/messages",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "finish reason too long",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/messages",
+			body:           `{"role":"assistant","content":"hi","finish_reason":"` + strings.Repeat("x", 51) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "bad attachments",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/messages",
+			body:           `{"role":"user","content":"hi","attachments":{}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "metadata",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages",
+			body:   `{"role":"assistant","content":"hi","metadata":{"citations":[{"url":"https://example.com"}]}}`,
+			store: &mockConversationsStore{getPermissionFunc: ownerPermission, createMessageFunc: func(m postgresql.Message) error {
+				if string(m.Metadata) != `{"citations":[{"url":"https://example.com"}]}` {
+					return errors.New("unexpected metadata")
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetConversationPermission", "CreateMessage"},
+		},
+		{
+			name:           "metadata is not an object",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/messages",
+			body:           `{"role":"assistant","content":"hi","metadata":["https://example.com"]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestConversationHandler_CreateMessage_MaxContentLength(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		expectedStatus int
+		expectedCalls  []string
+	}{
+		{name: "at the limit counted in runes", content: "שלום", expectedStatus: http.StatusOK, expectedCalls: []string{"GetConversationPermission", "CreateMessage"}},
+		{name: "over the limit", content: "שלום!", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mockConversationsStore{getPermissionFunc: ownerPermission, createMessageFunc: func(m postgresql.Message) error {
+				return nil
+			}}
+			router := newAliasTestRouter(http.MethodPost, "/api/v1/conversations/:id/messages",
+				NewConversationHandler(store, WithMaxMessageContentLength(4)).CreateMessage,
+			)
+
+			body, _ := json.Marshal(map[string]string{"role": "user", "content": tt.content})
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/conversations/conv-1/messages", strings.NewReader(string(body))))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if strings.Join(store.calls, ",") != strings.Join(tt.expectedCalls, ",") {
+				t.Fatalf("expected store calls %v, got %v", tt.expectedCalls, store.calls)
+			}
+			if tt.expectedStatus == http.StatusBadRequest && !strings.Contains(rec.Body.String(), `"max_content_length":4`) {
+				t.Fatalf("expected the limit in the response, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestConversationHandler_CreateMessage_Dedup(t *testing.T) {
+	tests := []struct {
+		name          string
+		existing      *postgresql.Message
+		expectedID    string
+		expectedCalls []string
+	}{
+		{name: "new message", expectedCalls: []string{"GetConversationPermission", "CreateMessageUnlessDuplicate"}},
+		{name: "duplicate", existing: &postgresql.Message{ID: "msg-1", Role: "user", Content: "hi"}, expectedID: "msg-1", expectedCalls: []string{"GetConversationPermission", "CreateMessageUnlessDuplicate"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var window time.Duration
+			store := &mockConversationsStore{getPermissionFunc: ownerPermission, createMessageUnlessDuplicateFunc: func(m postgresql.Message, w time.Duration) (*postgresql.Message, error) {
+				window = w
+				return tt.existing, nil
+			}}
+			router := newAliasTestRouter(http.MethodPost, "/api/v1/conversations/:id/messages",
+				NewConversationHandler(store, WithMessageDedupWindow(5*time.Second)).CreateMessage,
+			)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/conversations/conv-1/messages", strings.NewReader(`{"role":"user","content":"hi"}`)))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if window != 5*time.Second {
+				t.Fatalf("expected the 5s window to reach the store, got %v", window)
+			}
+			if strings.Join(store.calls, ",") != strings.Join(tt.expectedCalls, ",") {
+				t.Fatalf("expected store calls %v, got %v", tt.expectedCalls, store.calls)
+			}
+
+			var msg postgresql.Message
+			if err := json.Unmarshal(rec.Body.Bytes(), &msg); err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.expectedID) != 0 && msg.ID != tt.expectedID {
+				t.Fatalf("expected the existing message %s, got %s", tt.expectedID, msg.ID)
+			}
+			if len(tt.expectedID) == 0 && (len(msg.ID) == 0 || msg.Content != "hi") {
+				t.Fatalf("expected the new message, got %+v", msg)
+			}
+		})
+	}
+}
+
+func TestConversationHandler_ReactToMessage(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations/:id/messages/:messageId/react", func(h *ConversationHandler) gin.HandlerFunc { return h.ReactToMessage }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages/msg-1/react",
+			body:   `{"value":-1}`,
+			store: &mockConversationsStore{setMessageReactionFunc: func(conversationID, messageID, userID string, value int) error {
+				if conversationID != "conv-1" || messageID != "msg-1" || userID != "user-1" || value != -1 {
+					return errors.New("unexpected reaction")
+				}
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"SetMessageReaction"},
+		},
+		{
+			name:   "invalid value",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages/msg-1/react",
+			body:   `{"value":5}`,
+			store: &mockConversationsStore{setMessageReactionFunc: func(conversationID, messageID, userID string, value int) error {
+				return internal_errors.NewValidationError("reaction value must be 1 or -1, or 0 to clear it")
+			}},
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  []string{"SetMessageReaction"},
+		},
+		{
+			name:   "another user's conversation",
+			userID: "user-2",
+			path:   "/api/v1/conversations/conv-1/messages/msg-1/react",
+			body:   `{"value":1}`,
+			store: &mockConversationsStore{setMessageReactionFunc: func(conversationID, messageID, userID string, value int) error {
+				return internal_errors.NewNotFoundError("message is not found")
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"SetMessageReaction"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages/msg-1/react",
+			body:   `{"value":1}`,
+			store: &mockConversationsStore{setMessageReactionFunc: func(conversationID, messageID, userID string, value int) error {
+				return failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"SetMessageReaction"},
+		},
+		{
+			name:           "missing value",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/messages/msg-1/react",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "bad body",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/messages/msg-1/react",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestConversationHandler_GetMessageReaction(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodGet, "/api/v1/conversations/:id/messages/:messageId/react", func(h *ConversationHandler) gin.HandlerFunc { return h.GetMessageReaction }, []conversationHandlerCase{
+		{
+			name:   "success",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages/msg-1/react",
+			store: &mockConversationsStore{getMessageReactionFunc: func(conversationID, messageID, userID string) (*postgresql.Reaction, error) {
+				return &postgresql.Reaction{MessageID: messageID, UserID: userID, Value: 1}, nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"GetMessageReaction"},
+		},
+		{
+			name:   "no reaction",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages/msg-1/react",
+			store: &mockConversationsStore{getMessageReactionFunc: func(conversationID, messageID, userID string) (*postgresql.Reaction, error) {
+				return nil, internal_errors.NewNotFoundError("reaction is not found")
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetMessageReaction"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/messages/msg-1/react",
+			store: &mockConversationsStore{getMessageReactionFunc: func(conversationID, messageID, userID string) (*postgresql.Reaction, error) {
+				return nil, failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetMessageReaction"},
+		},
+	})
+}
+
+func TestConversationHandler_MetadataSchema(t *testing.T) {
+	withSchema := func(handler func(h *ConversationHandler) gin.HandlerFunc) func(h *ConversationHandler) gin.HandlerFunc {
+		return func(h *ConversationHandler) gin.HandlerFunc {
+			WithMetadataSchema(MetadataSchema{"folder": "string"})(h)
+			return handler(h)
+		}
+	}
+
+	runConversationHandlerCases(t, http.MethodPost, "/api/v1/conversations", withSchema(func(h *ConversationHandler) gin.HandlerFunc { return h.CreateConversation }), []conversationHandlerCase{
+		{
+			name:   "create with allowed metadata",
+			userID: "user-1",
+			path:   "/api/v1/conversations",
+			body:   `{"title":"hello","metadata":{"folder":"work"}}`,
+			store: &mockConversationsStore{createConversationFunc: func(c postgresql.Conversation) error {
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"CreateConversation"},
+		},
+		{
+			name:           "create with an unknown key",
+			userID:         "user-1",
+			path:           "/api/v1/conversations",
+			body:           `{"title":"hello","metadata":{"color":"red"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+
+	runConversationHandlerCases(t, http.MethodPut, "/api/v1/conversations/:id/metadata", withSchema(func(h *ConversationHandler) gin.HandlerFunc { return h.UpdateConversationMetadata }), []conversationHandlerCase{
+		{
+			name:   "update with allowed metadata",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/metadata",
+			body:   `{"metadata":{"folder":"work"}}`,
+			store: &mockConversationsStore{updateConversationMetadataFunc: func(id, userID string, metadata json.RawMessage) error {
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"UpdateConversationMetadata"},
+		},
+		{
+			name:           "update with a wrong type",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/metadata",
+			body:           `{"metadata":{"folder":1}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
+
+func TestConversationHandler_UpdateConversationMetadata(t *testing.T) {
+	runConversationHandlerCases(t, http.MethodPut, "/api/v1/conversations/:id/metadata", func(h *ConversationHandler) gin.HandlerFunc { return h.UpdateConversationMetadata }, []conversationHandlerCase{
+		{
+			name:   "success without a schema",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/metadata",
+			body:   `{"metadata":{"anything":true}}`,
+			store: &mockConversationsStore{updateConversationMetadataFunc: func(id, userID string, metadata json.RawMessage) error {
+				return nil
+			}},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"UpdateConversationMetadata"},
+		},
+		{
+			name:   "store error",
+			userID: "user-1",
+			path:   "/api/v1/conversations/conv-1/metadata",
+			body:   `{"metadata":{}}`,
+			store: &mockConversationsStore{updateConversationMetadataFunc: func(id, userID string, metadata json.RawMessage) error {
+				return failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"UpdateConversationMetadata"},
+		},
+		{
+			name: "missing userId",
+			path: "/api/v1/conversations/conv-1/metadata",
+			body: `{"metadata":{}}`,
+			store: &mockConversationsStore{updateConversationMetadataFunc: func(id, userID string, metadata json.RawMessage) error {
+				return missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"UpdateConversationMetadata"},
+		},
+		{
+			name:           "bad body",
+			userID:         "user-1",
+			path:           "/api/v1/conversations/conv-1/metadata",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	})
+}
@@ -0,0 +1,475 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+)
+
+// mockConversationsStore implements conversationsStore with one optional
+// func per method. Every call is recorded, and calling a method without a
+// func fails with an error naming it.
+type mockConversationsStore struct {
+	calls                             []string
+	getConversationPreviewsByUserFunc func(userID string, archived bool, metaKey, metaValue, folderID string, createdAfter, createdBefore time.Time) ([]postgresql.ConversationPreview, error)
+	getAllConversationsFunc           func(limit int, beforeUpdatedAt time.Time, beforeID string) ([]postgresql.Conversation, error)
+	getConversationFunc               func(id string) (*postgresql.Conversation, error)
+	createConversationFunc            func(c postgresql.Conversation) error
+	updateConversationTitleFunc       func(id, userID, title string) error
+	updateConversationMetadataFunc    func(id, userID string, metadata json.RawMessage) error
+	setConversationPinnedFunc         func(id, userID string, pinned bool) error
+	setConversationArchivedFunc       func(id, userID string, archived bool) error
+	markConversationReadFunc          func(id, userID string) error
+	deleteConversationsFunc           func(ids []string, userID string) (int, error)
+	deleteAllConversationsForUserFunc func(userID string) (int, error)
+	forkConversationFunc              func(id, userID string, uptoMessageID string) (string, error)
+	createShareLinkFunc               func(id, userID string) (string, error)
+	revokeShareLinkFunc               func(id, userID string) error
+	getConversationByShareTokenFunc   func(token string) (*postgresql.Conversation, error)
+	getMessagesFunc                   func(conversationID string) ([]postgresql.Message, error)
+	getMessagesForUserFunc            func(conversationID, userID string) ([]postgresql.Message, error)
+	getMessagesForUserByRoleFunc      func(conversationID, userID, role string) ([]postgresql.Message, error)
+	createMessageFunc                 func(m postgresql.Message) error
+	createMessageUnlessDuplicateFunc  func(m postgresql.Message, window time.Duration) (*postgresql.Message, error)
+	replaceLastAssistantMessageFunc   func(previousID string, m postgresql.Message) error
+	updateMessageContentFunc          func(id, content, finishReason string, completionTokens int) error
+	updateStreamingMessageFunc        func(id, content string) error
+	completeStreamingMessageFunc      func(m postgresql.Message) error
+	getUserStatsFunc                  func(userID string) (postgresql.UserStats, error)
+	getUserModelUsageFunc             func(userID string) ([]postgresql.ModelUsage, error)
+	setMessageReactionFunc            func(conversationID, messageID, userID string, value int) error
+	getMessageReactionFunc            func(conversationID, messageID, userID string) (*postgresql.Reaction, error)
+	createFolderFunc                  func(f postgresql.Folder) error
+	getFoldersByUserFunc              func(userID string) ([]postgresql.Folder, error)
+	renameFolderFunc                  func(id, userID, name string) error
+	deleteFolderFunc                  func(id, userID string) error
+	setConversationFolderFunc         func(id, userID, folderID string) error
+	updateDefaultParamsFunc           func(id, userID string, params *postgresql.SamplingParams) error
+	softDeleteConversationFunc        func(id, userID string) error
+	restoreConversationFunc           func(id, userID string) error
+	getTrashedConversationsFunc       func(userID string) ([]postgresql.Conversation, error)
+	createWithMessagesFunc            func(c postgresql.Conversation, msgs []postgresql.Message) error
+	createTemplateFunc                func(t postgresql.Template) error
+	getTemplatesFunc                  func(userID string) ([]postgresql.Template, error)
+	getTemplateFunc                   func(id, userID string) (*postgresql.Template, error)
+	deleteTemplateFunc                func(id, userID string) error
+	updateMessageMetadataFunc         func(conversationID, messageID, userID string, metadata json.RawMessage) error
+	mergeConversationsFunc            func(targetID, sourceID, userID string) error
+	getConversationsSinceFunc         func(userID string, since time.Time) ([]postgresql.Conversation, error)
+	getMessagesSinceFunc              func(userID string, since time.Time) ([]postgresql.Message, error)
+	grantAccessFunc                   func(id, ownerID, userID, permission string) error
+	revokeAccessFunc                  func(id, ownerID, userID string) error
+	getSharesFunc                     func(id, ownerID string) ([]postgresql.ConversationShare, error)
+	getPermissionFunc                 func(id, userID string) (string, error)
+	getMessageThreadFunc              func(rootID string) ([]postgresql.Message, error)
+}
+
+func (s *mockConversationsStore) GetConversationPreviewsByUser(userID string, archived bool, metaKey, metaValue, folderID string, createdAfter, createdBefore time.Time) ([]postgresql.ConversationPreview, error) {
+	s.calls = append(s.calls, "GetConversationPreviewsByUser")
+	if s.getConversationPreviewsByUserFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetConversationPreviewsByUser")
+	}
+	return s.getConversationPreviewsByUserFunc(userID, archived, metaKey, metaValue, folderID, createdAfter, createdBefore)
+}
+
+func (s *mockConversationsStore) GetAllConversations(limit int, beforeUpdatedAt time.Time, beforeID string) ([]postgresql.Conversation, error) {
+	s.calls = append(s.calls, "GetAllConversations")
+	if s.getAllConversationsFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetAllConversations")
+	}
+	return s.getAllConversationsFunc(limit, beforeUpdatedAt, beforeID)
+}
+
+func (s *mockConversationsStore) GetConversation(id string) (*postgresql.Conversation, error) {
+	s.calls = append(s.calls, "GetConversation")
+	if s.getConversationFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetConversation")
+	}
+	return s.getConversationFunc(id)
+}
+
+func (s *mockConversationsStore) CreateConversation(c postgresql.Conversation) error {
+	s.calls = append(s.calls, "CreateConversation")
+	if s.createConversationFunc == nil {
+		return fmt.Errorf("unexpected call to CreateConversation")
+	}
+	return s.createConversationFunc(c)
+}
+
+func (s *mockConversationsStore) UpdateConversationTitle(id, userID, title string) error {
+	s.calls = append(s.calls, "UpdateConversationTitle")
+	if s.updateConversationTitleFunc == nil {
+		return fmt.Errorf("unexpected call to UpdateConversationTitle")
+	}
+	return s.updateConversationTitleFunc(id, userID, title)
+}
+
+func (s *mockConversationsStore) UpdateConversationMetadata(id, userID string, metadata json.RawMessage) error {
+	s.calls = append(s.calls, "UpdateConversationMetadata")
+	if s.updateConversationMetadataFunc == nil {
+		return fmt.Errorf("unexpected call to UpdateConversationMetadata")
+	}
+	return s.updateConversationMetadataFunc(id, userID, metadata)
+}
+
+func (s *mockConversationsStore) SetConversationPinned(id, userID string, pinned bool) error {
+	s.calls = append(s.calls, "SetConversationPinned")
+	if s.setConversationPinnedFunc == nil {
+		return fmt.Errorf("unexpected call to SetConversationPinned")
+	}
+	return s.setConversationPinnedFunc(id, userID, pinned)
+}
+
+func (s *mockConversationsStore) SetConversationArchived(id, userID string, archived bool) error {
+	s.calls = append(s.calls, "SetConversationArchived")
+	if s.setConversationArchivedFunc == nil {
+		return fmt.Errorf("unexpected call to SetConversationArchived")
+	}
+	return s.setConversationArchivedFunc(id, userID, archived)
+}
+
+func (s *mockConversationsStore) MarkConversationRead(id, userID string) error {
+	s.calls = append(s.calls, "MarkConversationRead")
+	if s.markConversationReadFunc == nil {
+		return fmt.Errorf("unexpected call to MarkConversationRead")
+	}
+	return s.markConversationReadFunc(id, userID)
+}
+
+func (s *mockConversationsStore) DeleteConversations(ids []string, userID string) (int, error) {
+	s.calls = append(s.calls, "DeleteConversations")
+	if s.deleteConversationsFunc == nil {
+		return 0, fmt.Errorf("unexpected call to DeleteConversations")
+	}
+	return s.deleteConversationsFunc(ids, userID)
+}
+
+func (s *mockConversationsStore) DeleteAllConversationsForUser(userID string) (int, error) {
+	s.calls = append(s.calls, "DeleteAllConversationsForUser")
+	if s.deleteAllConversationsForUserFunc == nil {
+		return 0, fmt.Errorf("unexpected call to DeleteAllConversationsForUser")
+	}
+	return s.deleteAllConversationsForUserFunc(userID)
+}
+
+func (s *mockConversationsStore) ForkConversation(id, userID string, uptoMessageID string) (string, error) {
+	s.calls = append(s.calls, "ForkConversation")
+	if s.forkConversationFunc == nil {
+		return "", fmt.Errorf("unexpected call to ForkConversation")
+	}
+	return s.forkConversationFunc(id, userID, uptoMessageID)
+}
+
+func (s *mockConversationsStore) CreateShareLink(id, userID string) (string, error) {
+	s.calls = append(s.calls, "CreateShareLink")
+	if s.createShareLinkFunc == nil {
+		return "", fmt.Errorf("unexpected call to CreateShareLink")
+	}
+	return s.createShareLinkFunc(id, userID)
+}
+
+func (s *mockConversationsStore) RevokeShareLink(id, userID string) error {
+	s.calls = append(s.calls, "RevokeShareLink")
+	if s.revokeShareLinkFunc == nil {
+		return fmt.Errorf("unexpected call to RevokeShareLink")
+	}
+	return s.revokeShareLinkFunc(id, userID)
+}
+
+func (s *mockConversationsStore) GetConversationByShareToken(token string) (*postgresql.Conversation, error) {
+	s.calls = append(s.calls, "GetConversationByShareToken")
+	if s.getConversationByShareTokenFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetConversationByShareToken")
+	}
+	return s.getConversationByShareTokenFunc(token)
+}
+
+func (s *mockConversationsStore) GetMessages(conversationID string) ([]postgresql.Message, error) {
+	s.calls = append(s.calls, "GetMessages")
+	if s.getMessagesFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetMessages")
+	}
+	return s.getMessagesFunc(conversationID)
+}
+
+func (s *mockConversationsStore) GetMessagesForUser(conversationID, userID string) ([]postgresql.Message, error) {
+	s.calls = append(s.calls, "GetMessagesForUser")
+	if s.getMessagesForUserFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetMessagesForUser")
+	}
+	return s.getMessagesForUserFunc(conversationID, userID)
+}
+
+func (s *mockConversationsStore) GetMessagesForUserByRole(conversationID, userID, role string) ([]postgresql.Message, error) {
+	s.calls = append(s.calls, "GetMessagesForUserByRole")
+	if s.getMessagesForUserByRoleFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetMessagesForUserByRole")
+	}
+	return s.getMessagesForUserByRoleFunc(conversationID, userID, role)
+}
+
+func (s *mockConversationsStore) CreateMessage(m postgresql.Message) error {
+	s.calls = append(s.calls, "CreateMessage")
+	if s.createMessageFunc == nil {
+		return fmt.Errorf("unexpected call to CreateMessage")
+	}
+	return s.createMessageFunc(m)
+}
+
+func (s *mockConversationsStore) CreateMessageUnlessDuplicate(m postgresql.Message, window time.Duration) (*postgresql.Message, error) {
+	s.calls = append(s.calls, "CreateMessageUnlessDuplicate")
+	if s.createMessageUnlessDuplicateFunc == nil {
+		return nil, fmt.Errorf("unexpected call to CreateMessageUnlessDuplicate")
+	}
+	return s.createMessageUnlessDuplicateFunc(m, window)
+}
+
+func (s *mockConversationsStore) ReplaceLastAssistantMessage(previousID string, m postgresql.Message) error {
+	s.calls = append(s.calls, "ReplaceLastAssistantMessage")
+	if s.replaceLastAssistantMessageFunc == nil {
+		return fmt.Errorf("unexpected call to ReplaceLastAssistantMessage")
+	}
+	return s.replaceLastAssistantMessageFunc(previousID, m)
+}
+
+func (s *mockConversationsStore) UpdateMessageContent(id, content, finishReason string, completionTokens int) error {
+	s.calls = append(s.calls, "UpdateMessageContent")
+	if s.updateMessageContentFunc == nil {
+		return fmt.Errorf("unexpected call to UpdateMessageContent")
+	}
+	return s.updateMessageContentFunc(id, content, finishReason, completionTokens)
+}
+
+func (s *mockConversationsStore) UpdateStreamingMessage(id, content string) error {
+	s.calls = append(s.calls, "UpdateStreamingMessage")
+	if s.updateStreamingMessageFunc == nil {
+		return fmt.Errorf("unexpected call to UpdateStreamingMessage")
+	}
+	return s.updateStreamingMessageFunc(id, content)
+}
+
+func (s *mockConversationsStore) CompleteStreamingMessage(m postgresql.Message) error {
+	s.calls = append(s.calls, "CompleteStreamingMessage")
+	if s.completeStreamingMessageFunc == nil {
+		return fmt.Errorf("unexpected call to CompleteStreamingMessage")
+	}
+	return s.completeStreamingMessageFunc(m)
+}
+
+func (s *mockConversationsStore) SetMessageReaction(conversationID, messageID, userID string, value int) error {
+	s.calls = append(s.calls, "SetMessageReaction")
+	if s.setMessageReactionFunc == nil {
+		return fmt.Errorf("unexpected call to SetMessageReaction")
+	}
+	return s.setMessageReactionFunc(conversationID, messageID, userID, value)
+}
+
+func (s *mockConversationsStore) GetMessageReaction(conversationID, messageID, userID string) (*postgresql.Reaction, error) {
+	s.calls = append(s.calls, "GetMessageReaction")
+	if s.getMessageReactionFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetMessageReaction")
+	}
+	return s.getMessageReactionFunc(conversationID, messageID, userID)
+}
+
+func (s *mockConversationsStore) CreateFolder(f postgresql.Folder) error {
+	s.calls = append(s.calls, "CreateFolder")
+	if s.createFolderFunc == nil {
+		return fmt.Errorf("unexpected call to CreateFolder")
+	}
+	return s.createFolderFunc(f)
+}
+
+func (s *mockConversationsStore) GetFoldersByUser(userID string) ([]postgresql.Folder, error) {
+	s.calls = append(s.calls, "GetFoldersByUser")
+	if s.getFoldersByUserFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetFoldersByUser")
+	}
+	return s.getFoldersByUserFunc(userID)
+}
+
+func (s *mockConversationsStore) RenameFolder(id, userID, name string) error {
+	s.calls = append(s.calls, "RenameFolder")
+	if s.renameFolderFunc == nil {
+		return fmt.Errorf("unexpected call to RenameFolder")
+	}
+	return s.renameFolderFunc(id, userID, name)
+}
+
+func (s *mockConversationsStore) DeleteFolder(id, userID string) error {
+	s.calls = append(s.calls, "DeleteFolder")
+	if s.deleteFolderFunc == nil {
+		return fmt.Errorf("unexpected call to DeleteFolder")
+	}
+	return s.deleteFolderFunc(id, userID)
+}
+
+func (s *mockConversationsStore) SetConversationFolder(id, userID, folderID string) error {
+	s.calls = append(s.calls, "SetConversationFolder")
+	if s.setConversationFolderFunc == nil {
+		return fmt.Errorf("unexpected call to SetConversationFolder")
+	}
+	return s.setConversationFolderFunc(id, userID, folderID)
+}
+
+func (s *mockConversationsStore) GetUserStats(userID string) (postgresql.UserStats, error) {
+	s.calls = append(s.calls, "GetUserStats")
+	if s.getUserStatsFunc == nil {
+		return postgresql.UserStats{}, fmt.Errorf("unexpected call to GetUserStats")
+	}
+	return s.getUserStatsFunc(userID)
+}
+
+func (s *mockConversationsStore) GetUserModelUsage(userID string) ([]postgresql.ModelUsage, error) {
+	s.calls = append(s.calls, "GetUserModelUsage")
+	if s.getUserModelUsageFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetUserModelUsage")
+	}
+	return s.getUserModelUsageFunc(userID)
+}
+
+func (s *mockConversationsStore) UpdateConversationDefaultParams(id, userID string, params *postgresql.SamplingParams) error {
+	s.calls = append(s.calls, "UpdateConversationDefaultParams")
+	if s.updateDefaultParamsFunc == nil {
+		return fmt.Errorf("unexpected call to UpdateConversationDefaultParams")
+	}
+	return s.updateDefaultParamsFunc(id, userID, params)
+}
+
+func (s *mockConversationsStore) SoftDeleteConversation(id, userID string) error {
+	s.calls = append(s.calls, "SoftDeleteConversation")
+	if s.softDeleteConversationFunc == nil {
+		return fmt.Errorf("unexpected call to SoftDeleteConversation")
+	}
+	return s.softDeleteConversationFunc(id, userID)
+}
+
+func (s *mockConversationsStore) RestoreConversation(id, userID string) error {
+	s.calls = append(s.calls, "RestoreConversation")
+	if s.restoreConversationFunc == nil {
+		return fmt.Errorf("unexpected call to RestoreConversation")
+	}
+	return s.restoreConversationFunc(id, userID)
+}
+
+func (s *mockConversationsStore) GetTrashedConversationsByUser(userID string) ([]postgresql.Conversation, error) {
+	s.calls = append(s.calls, "GetTrashedConversationsByUser")
+	if s.getTrashedConversationsFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetTrashedConversationsByUser")
+	}
+	return s.getTrashedConversationsFunc(userID)
+}
+
+func (s *mockConversationsStore) CreateConversationWithMessages(c postgresql.Conversation, msgs []postgresql.Message) error {
+	s.calls = append(s.calls, "CreateConversationWithMessages")
+	if s.createWithMessagesFunc == nil {
+		return fmt.Errorf("unexpected call to CreateConversationWithMessages")
+	}
+	return s.createWithMessagesFunc(c, msgs)
+}
+
+func (s *mockConversationsStore) CreateTemplate(t postgresql.Template) error {
+	s.calls = append(s.calls, "CreateTemplate")
+	if s.createTemplateFunc == nil {
+		return fmt.Errorf("unexpected call to CreateTemplate")
+	}
+	return s.createTemplateFunc(t)
+}
+
+func (s *mockConversationsStore) GetTemplatesForUser(userID string) ([]postgresql.Template, error) {
+	s.calls = append(s.calls, "GetTemplatesForUser")
+	if s.getTemplatesFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetTemplatesForUser")
+	}
+	return s.getTemplatesFunc(userID)
+}
+
+func (s *mockConversationsStore) GetTemplateForUser(id, userID string) (*postgresql.Template, error) {
+	s.calls = append(s.calls, "GetTemplateForUser")
+	if s.getTemplateFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetTemplateForUser")
+	}
+	return s.getTemplateFunc(id, userID)
+}
+
+func (s *mockConversationsStore) DeleteTemplate(id, userID string) error {
+	s.calls = append(s.calls, "DeleteTemplate")
+	if s.deleteTemplateFunc == nil {
+		return fmt.Errorf("unexpected call to DeleteTemplate")
+	}
+	return s.deleteTemplateFunc(id, userID)
+}
+
+func (s *mockConversationsStore) UpdateMessageMetadata(conversationID, messageID, userID string, metadata json.RawMessage) error {
+	s.calls = append(s.calls, "UpdateMessageMetadata")
+	if s.updateMessageMetadataFunc == nil {
+		return fmt.Errorf("unexpected call to UpdateMessageMetadata")
+	}
+	return s.updateMessageMetadataFunc(conversationID, messageID, userID, metadata)
+}
+
+func (s *mockConversationsStore) MergeConversations(targetID, sourceID, userID string) error {
+	s.calls = append(s.calls, "MergeConversations")
+	if s.mergeConversationsFunc == nil {
+		return fmt.Errorf("unexpected call to MergeConversations")
+	}
+	return s.mergeConversationsFunc(targetID, sourceID, userID)
+}
+
+func (s *mockConversationsStore) GetConversationsUpdatedSince(userID string, since time.Time) ([]postgresql.Conversation, error) {
+	s.calls = append(s.calls, "GetConversationsUpdatedSince")
+	if s.getConversationsSinceFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetConversationsUpdatedSince")
+	}
+	return s.getConversationsSinceFunc(userID, since)
+}
+
+func (s *mockConversationsStore) GetMessagesUpdatedSince(userID string, since time.Time) ([]postgresql.Message, error) {
+	s.calls = append(s.calls, "GetMessagesUpdatedSince")
+	if s.getMessagesSinceFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetMessagesUpdatedSince")
+	}
+	return s.getMessagesSinceFunc(userID, since)
+}
+
+func (s *mockConversationsStore) GrantConversationAccess(id, ownerID, userID, permission string) error {
+	s.calls = append(s.calls, "GrantConversationAccess")
+	if s.grantAccessFunc == nil {
+		return fmt.Errorf("unexpected call to GrantConversationAccess")
+	}
+	return s.grantAccessFunc(id, ownerID, userID, permission)
+}
+
+func (s *mockConversationsStore) RevokeConversationAccess(id, ownerID, userID string) error {
+	s.calls = append(s.calls, "RevokeConversationAccess")
+	if s.revokeAccessFunc == nil {
+		return fmt.Errorf("unexpected call to RevokeConversationAccess")
+	}
+	return s.revokeAccessFunc(id, ownerID, userID)
+}
+
+func (s *mockConversationsStore) GetConversationShares(id, ownerID string) ([]postgresql.ConversationShare, error) {
+	s.calls = append(s.calls, "GetConversationShares")
+	if s.getSharesFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetConversationShares")
+	}
+	return s.getSharesFunc(id, ownerID)
+}
+
+func (s *mockConversationsStore) GetConversationPermission(id, userID string) (string, error) {
+	s.calls = append(s.calls, "GetConversationPermission")
+	if s.getPermissionFunc == nil {
+		return "", fmt.Errorf("unexpected call to GetConversationPermission")
+	}
+	return s.getPermissionFunc(id, userID)
+}
+
+func (s *mockConversationsStore) GetMessageThread(rootID string) ([]postgresql.Message, error) {
+	s.calls = append(s.calls, "GetMessageThread")
+	if s.getMessageThreadFunc == nil {
+		return nil, fmt.Errorf("unexpected call to GetMessageThread")
+	}
+	return s.getMessageThreadFunc(rootID)
+}
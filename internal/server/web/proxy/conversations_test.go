@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/gin-gonic/gin"
+)
+
+type recordingMessageStore struct {
+	conversationsStore
+	created []postgresql.Message
+}
+
+func (s *recordingMessageStore) CreateMessage(m postgresql.Message) error {
+	s.created = append(s.created, m)
+	return nil
+}
+
+func (s *recordingMessageStore) GetConversationPermission(id, userID string) (string, error) {
+	return postgresql.PermissionOwner, nil
+}
+
+func TestConversationHandler_CreateMessageValidatesRole(t *testing.T) {
+	tests := []struct {
+		role           string
+		expectedStatus int
+	}{
+		{role: "user", expectedStatus: http.StatusOK},
+		{role: "assistant", expectedStatus: http.StatusOK},
+		{role: "system", expectedStatus: http.StatusOK},
+		{role: "tool", expectedStatus: http.StatusOK},
+		{role: "function", expectedStatus: http.StatusOK},
+		{role: "developer", expectedStatus: http.StatusBadRequest},
+		{role: "", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run("role "+tt.role, func(t *testing.T) {
+			store := &recordingMessageStore{}
+			h := NewConversationHandler(store)
+			router := newAliasTestRouter(http.MethodPost, "/api/v1/conversations/:id/messages", h.CreateMessage)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations/conv-1/messages", strings.NewReader(`{"role":"`+tt.role+`","content":"hi"}`))
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus == http.StatusBadRequest {
+				if len(store.created) != 0 {
+					t.Fatal("expected an invalid role not to reach the store")
+				}
+				if !strings.Contains(rec.Body.String(), "user, assistant, system, tool, function") {
+					t.Fatalf("expected the valid roles to be listed, got %s", rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestConversationHandler_CreateMessageAttachments(t *testing.T) {
+	tests := []struct {
+		name           string
+		attachments    string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{name: "omitted", attachments: "", expectedStatus: http.StatusOK, expectedCount: 0},
+		{name: "null", attachments: `,"attachments":null`, expectedStatus: http.StatusOK, expectedCount: 0},
+		{name: "array", attachments: `,"attachments":[{"type":"image","url":"https://example.com/a.png","name":"a.png","size":42}]`, expectedStatus: http.StatusOK, expectedCount: 1},
+		{name: "object", attachments: `,"attachments":{"type":"image"}`, expectedStatus: http.StatusBadRequest},
+		{name: "scalar", attachments: `,"attachments":"a.png"`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &recordingMessageStore{}
+			h := NewConversationHandler(store)
+			router := newAliasTestRouter(http.MethodPost, "/api/v1/conversations/:id/messages", h.CreateMessage)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations/conv-1/messages", strings.NewReader(`{"role":"user","content":"hi"`+tt.attachments+`}`))
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				if len(store.created) != 0 {
+					t.Fatal("expected invalid attachments not to reach the store")
+				}
+				return
+			}
+			if got := len(store.created[0].Attachments); got != tt.expectedCount {
+				t.Fatalf("expected %d attachments, got %d", tt.expectedCount, got)
+			}
+		})
+	}
+}
+
+type sharingStore struct {
+	conversationsStore
+	token    string
+	conv     postgresql.Conversation
+	messages []postgresql.Message
+}
+
+func (s *sharingStore) GetConversationByShareToken(token string) (*postgresql.Conversation, error) {
+	if token != s.token {
+		return nil, internal_errors.NewNotFoundError("shared conversation is not found")
+	}
+	return &s.conv, nil
+}
+
+func (s *sharingStore) GetMessages(conversationID string) ([]postgresql.Message, error) {
+	return s.messages, nil
+}
+
+func TestConversationHandler_GetSharedConversation(t *testing.T) {
+	store := &sharingStore{
+		token: "share-token",
+		conv: postgresql.Conversation{
+			ID:       "conv-1",
+			Title:    "shared",
+			UserID:   "owner-1",
+			Metadata: json.RawMessage(`{"tag":"public-tag","private":{"note":"secret-note"}}`),
+		},
+		messages: []postgresql.Message{{ID: "m1", ConversationID: "conv-1", Role: "user", Content: "hi"}},
+	}
+	h := NewConversationHandler(store)
+	router := newAliasTestRouter(http.MethodGet, "/shared/:token", h.GetSharedConversation)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/shared/share-token", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, leaked := range []string{"owner-1", "user_id", "secret-note"} {
+		if strings.Contains(rec.Body.String(), leaked) {
+			t.Fatalf("expected %q not to be exposed, got %s", leaked, rec.Body.String())
+		}
+	}
+	if !strings.Contains(rec.Body.String(), "public-tag") || !strings.Contains(rec.Body.String(), `"content":"hi"`) {
+		t.Fatalf("expected the public metadata and messages, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/shared/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for an unknown token, got %d", rec.Code)
+	}
+}
+
+type filteringStore struct {
+	conversationsStore
+	filter []string
+}
+
+func (s *filteringStore) GetConversationPreviewsByUser(userID string, archived bool, metaKey, metaValue, folderID string, createdAfter, createdBefore time.Time) ([]postgresql.ConversationPreview, error) {
+	s.filter = nil
+	if len(metaKey) != 0 {
+		s.filter = []string{metaKey, metaValue}
+	}
+	return []postgresql.ConversationPreview{}, nil
+}
+
+func TestConversationHandler_ListConversationsMetadataFilter(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedFilter []string
+	}{
+		{name: "no filter", query: "", expectedStatus: http.StatusOK},
+		{name: "folder filter", query: "?meta_key=folder&meta_value=work", expectedStatus: http.StatusOK, expectedFilter: []string{"folder", "work"}},
+		{name: "empty value", query: "?meta_key=folder&meta_value=", expectedStatus: http.StatusOK, expectedFilter: []string{"folder", ""}},
+		{name: "key without value", query: "?meta_key=folder", expectedStatus: http.StatusBadRequest},
+		{name: "value without key", query: "?meta_value=work", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &filteringStore{}
+			h := NewConversationHandler(store)
+			router := newAliasTestRouter(http.MethodGet, "/api/v1/conversations", func(c *gin.Context) {
+				c.Set("userId", "user-1")
+			}, h.ListConversations)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/conversations"+tt.query, nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if strings.Join(store.filter, "=") != strings.Join(tt.expectedFilter, "=") || len(store.filter) != len(tt.expectedFilter) {
+				t.Fatalf("expected filter %v, got %v", tt.expectedFilter, store.filter)
+			}
+		})
+	}
+}
+
+type roleFilteringStore struct {
+	conversationsStore
+}
+
+func (s *roleFilteringStore) GetMessagesForUser(conversationID, userID string) ([]postgresql.Message, error) {
+	return []postgresql.Message{
+		{ID: "m1", Role: "system"},
+		{ID: "m2", Role: "user"},
+		{ID: "m3", Role: "assistant"},
+		{ID: "m4", Role: "user"},
+	}, nil
+}
+
+func (s *roleFilteringStore) GetMessagesForUserByRole(conversationID, userID, role string) ([]postgresql.Message, error) {
+	msgs, _ := s.GetMessagesForUser(conversationID, userID)
+	res := []postgresql.Message{}
+	for _, m := range msgs {
+		if m.Role == role {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+func TestConversationHandler_ListMessagesRoleFilter(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedIDs    []string
+	}{
+		{name: "no filter", query: "", expectedStatus: http.StatusOK, expectedIDs: []string{"m1", "m2", "m3", "m4"}},
+		{name: "user messages", query: "?role=user", expectedStatus: http.StatusOK, expectedIDs: []string{"m2", "m4"}},
+		{name: "assistant messages", query: "?role=assistant", expectedStatus: http.StatusOK, expectedIDs: []string{"m3"}},
+		{name: "tool messages", query: "?role=tool", expectedStatus: http.StatusOK, expectedIDs: []string{}},
+		{name: "invalid role", query: "?role=developer", expectedStatus: http.StatusBadRequest},
+		{name: "empty role", query: "?role=", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &roleFilteringStore{}
+			h := NewConversationHandler(store)
+			router := newAliasTestRouter(http.MethodGet, "/api/v1/conversations/:id/messages", h.ListMessages)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/conversations/conv-1/messages"+tt.query, nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var msgs []postgresql.Message
+			if err := json.Unmarshal(rec.Body.Bytes(), &msgs); err != nil {
+				t.Fatalf("expected a json array of messages: %v", err)
+			}
+			ids := []string{}
+			for _, m := range msgs {
+				ids = append(ids, m.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.expectedIDs, ",") {
+				t.Fatalf("expected messages %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var defaultCorsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+
+// CORSConfig controls the CORS headers the proxy answers browsers with.
+type CORSConfig struct {
+	// AllowedOrigins lists the origins, e.g. https://chat.example.com, that
+	// may call the proxy. "*" allows any origin and empty allows none.
+	AllowedOrigins []string
+	// AllowedMethods defaults to the methods the proxy serves.
+	AllowedMethods []string
+	// AllowedHeaders defaults to whatever headers the preflight asks for.
+	AllowedHeaders []string
+	// AllowCredentials lets browsers send cookies and auth headers. Since
+	// browsers reject "*" together with credentials, a wildcard then echoes
+	// the request's origin instead.
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+func (cfg CORSConfig) allowsOrigin(origin string) (allowed, wildcard bool) {
+	for _, o := range cfg.AllowedOrigins {
+		o = strings.TrimSpace(o)
+		if o == "*" {
+			return true, true
+		}
+		if strings.EqualFold(strings.TrimRight(o, "/"), origin) {
+			return true, false
+		}
+	}
+
+	return false, false
+}
+
+// CorsMiddleware answers preflight requests and adds CORS headers to the
+// responses of allowed origins. Requests from other origins are served
+// without CORS headers, which makes the browser block them, while their
+// preflights are refused outright.
+func CorsMiddleware(cfg CORSConfig) gin.HandlerFunc {
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCorsMethods
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if len(origin) == 0 {
+			c.Next()
+			return
+		}
+
+		preflight := c.Request.Method == http.MethodOptions && len(c.GetHeader("Access-Control-Request-Method")) != 0
+		allowed, wildcard := cfg.allowsOrigin(origin)
+		if !allowed {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+		if wildcard && !cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if len(cfg.AllowedHeaders) != 0 {
+			c.Header("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+		} else if requested := c.GetHeader("Access-Control-Request-Headers"); len(requested) != 0 {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+			c.Header("Access-Control-Allow-Headers", requested)
+		}
+		if cfg.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCorsMiddleware(t *testing.T) {
+	tests := []struct {
+		name                string
+		cfg                 CORSConfig
+		method              string
+		origin              string
+		requestHeaders      string
+		expectedStatus      int
+		expectedOrigin      string
+		expectedCredentials string
+		expectedMethods     string
+		expectedHeaders     string
+		expectedMaxAge      string
+	}{
+		{
+			name:            "preflight from an allowed origin",
+			cfg:             CORSConfig{AllowedOrigins: []string{"https://chat.example.com"}, MaxAge: time.Hour},
+			method:          http.MethodOptions,
+			origin:          "https://chat.example.com",
+			requestHeaders:  "Authorization, Content-Type",
+			expectedStatus:  http.StatusNoContent,
+			expectedOrigin:  "https://chat.example.com",
+			expectedMethods: "GET, POST, PUT, PATCH, DELETE, OPTIONS",
+			expectedHeaders: "Authorization, Content-Type",
+			expectedMaxAge:  "3600",
+		},
+		{
+			name:            "preflight with configured methods and headers",
+			cfg:             CORSConfig{AllowedOrigins: []string{"https://chat.example.com"}, AllowedMethods: []string{"GET", "POST"}, AllowedHeaders: []string{"Authorization"}},
+			method:          http.MethodOptions,
+			origin:          "https://chat.example.com",
+			requestHeaders:  "X-Custom",
+			expectedStatus:  http.StatusNoContent,
+			expectedOrigin:  "https://chat.example.com",
+			expectedMethods: "GET, POST",
+			expectedHeaders: "Authorization",
+		},
+		{
+			name:           "preflight from another origin",
+			cfg:            CORSConfig{AllowedOrigins: []string{"https://chat.example.com"}},
+			method:         http.MethodOptions,
+			origin:         "https://evil.example.com",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "request from an allowed origin",
+			cfg:            CORSConfig{AllowedOrigins: []string{"https://chat.example.com"}},
+			method:         http.MethodGet,
+			origin:         "https://chat.example.com",
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "https://chat.example.com",
+		},
+		{
+			name:           "request from another origin",
+			cfg:            CORSConfig{AllowedOrigins: []string{"https://chat.example.com"}},
+			method:         http.MethodGet,
+			origin:         "https://evil.example.com",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wildcard",
+			cfg:            CORSConfig{AllowedOrigins: []string{"*"}},
+			method:         http.MethodGet,
+			origin:         "https://chat.example.com",
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "*",
+		},
+		{
+			name:                "wildcard with credentials echoes the origin",
+			cfg:                 CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			method:              http.MethodGet,
+			origin:              "https://chat.example.com",
+			expectedStatus:      http.StatusOK,
+			expectedOrigin:      "https://chat.example.com",
+			expectedCredentials: "true",
+		},
+		{
+			name:           "same origin request",
+			cfg:            CORSConfig{AllowedOrigins: []string{"*"}},
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(CorsMiddleware(tt.cfg))
+			router.GET("/api/v1/conversations", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(tt.method, "/api/v1/conversations", nil)
+			if len(tt.origin) != 0 {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			if len(tt.requestHeaders) != 0 {
+				req.Header.Set("Access-Control-Request-Headers", tt.requestHeaders)
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			for header, expected := range map[string]string{
+				"Access-Control-Allow-Origin":      tt.expectedOrigin,
+				"Access-Control-Allow-Credentials": tt.expectedCredentials,
+				"Access-Control-Allow-Methods":     tt.expectedMethods,
+				"Access-Control-Allow-Headers":     tt.expectedHeaders,
+				"Access-Control-Max-Age":           tt.expectedMaxAge,
+			} {
+				if got := rec.Header().Get(header); got != expected {
+					t.Fatalf("expected %s %q, got %q", header, expected, got)
+				}
+			}
+		})
+	}
+}
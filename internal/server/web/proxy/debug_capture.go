@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/gin-gonic/gin"
+)
+
+// capturedExchange is an upstream request/response pair as the debug
+// endpoint shows it.
+type capturedExchange struct {
+	Time              time.Time         `json:"time"`
+	RequestID         string            `json:"request_id"`
+	Method            string            `json:"method"`
+	Path              string            `json:"path"`
+	Conversation      string            `json:"conversation_id,omitempty"`
+	Headers           map[string]string `json:"headers"`
+	Request           string            `json:"request"`
+	RequestTruncated  bool              `json:"request_truncated"`
+	Status            int               `json:"status"`
+	Response          string            `json:"response"`
+	ResponseTruncated bool              `json:"response_truncated"`
+	DurationInMs      int64             `json:"duration_in_ms"`
+	Streaming         bool              `json:"stream"`
+}
+
+// exchangeRecorder keeps the last size chat completion exchanges in memory,
+// with bodies capped at maxBodyBytes each, so odd upstream behavior can be
+// inspected without turning on body logging.
+type exchangeRecorder struct {
+	mu           sync.Mutex
+	maxBodyBytes int
+	entries      []capturedExchange
+	next         int
+	full         bool
+}
+
+// newExchangeRecorder returns nil, which records nothing, unless size is
+// positive.
+func newExchangeRecorder(size, maxBodyBytes int) *exchangeRecorder {
+	if size <= 0 {
+		return nil
+	}
+
+	return &exchangeRecorder{maxBodyBytes: maxBodyBytes, entries: make([]capturedExchange, size)}
+}
+
+func (r *exchangeRecorder) capBody(body []byte) (string, bool) {
+	if r.maxBodyBytes > 0 && len(body) > r.maxBodyBytes {
+		return string(body[:r.maxBodyBytes]), true
+	}
+	return string(body), false
+}
+
+// record stores ex with its auth headers redacted, overwriting the oldest
+// exchange once the buffer is full. Bodies are left out in private mode.
+func (r *exchangeRecorder) record(requestID string, private bool, ex *aliasExchange) {
+	if r == nil {
+		return
+	}
+
+	headers := map[string]string{}
+	for name := range ex.header {
+		if redactedHeaders[strings.ToLower(name)] {
+			headers[name] = "[REDACTED]"
+			continue
+		}
+		headers[name] = ex.header.Get(name)
+	}
+
+	captured := capturedExchange{
+		Time:         time.Now(),
+		RequestID:    requestID,
+		Method:       ex.method,
+		Path:         ex.path,
+		Conversation: ex.conversation,
+		Headers:      headers,
+		Status:       ex.status,
+		DurationInMs: ex.duration.Milliseconds(),
+		Streaming:    ex.streaming,
+	}
+	if !private {
+		captured.Request, captured.RequestTruncated = r.capBody(ex.request)
+		captured.Response, captured.ResponseTruncated = r.capBody(ex.response)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[r.next] = captured
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the recorded exchanges, newest first.
+func (r *exchangeRecorder) list() []capturedExchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.entries)
+	}
+
+	res := make([]capturedExchange, 0, n)
+	for i := 1; i <= n; i++ {
+		res = append(res, r.entries[(r.next-i+len(r.entries))%len(r.entries)])
+	}
+
+	return res
+}
+
+// getDebugExchangesHandler serves the recorded exchanges to callers that
+// present token in the X-API-KEY header. Without a token the endpoint
+// refuses everyone, since exchanges carry other users' prompts.
+func getDebugExchangesHandler(recorder *exchangeRecorder, token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		telemetry.Incr("bricksllm.proxy.debug_exchanges_handler.requests", nil, 1)
+
+		given := c.GetHeader("X-API-KEY")
+		if len(token) == 0 || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			JSON(c, http.StatusUnauthorized, "[BricksLLM] a valid admin key is required")
+			return
+		}
+
+		c.JSON(http.StatusOK, recorder.list())
+	}
+}
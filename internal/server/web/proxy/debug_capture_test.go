@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExchangeRecorder_KeepsTheLastExchanges(t *testing.T) {
+	recorder := newExchangeRecorder(2, 8)
+	for _, path := range []string{"/1", "/2", "/3"} {
+		recorder.record("req"+path, false, &aliasExchange{
+			path:     path,
+			header:   http.Header{"Authorization": {"Bearer secret"}, "Content-Type": {"application/json"}},
+			request:  []byte(`{"model":"gpt-4o-mini"}`),
+			response: []byte(`{}`),
+			status:   http.StatusOK,
+		})
+	}
+
+	got := recorder.list()
+	if len(got) != 2 || got[0].Path != "/3" || got[1].Path != "/2" {
+		t.Fatalf("expected the two newest exchanges newest first, got %+v", got)
+	}
+	if got[0].Headers["Authorization"] != "[REDACTED]" || got[0].Headers["Content-Type"] != "application/json" {
+		t.Fatalf("expected only auth headers to be redacted, got %v", got[0].Headers)
+	}
+	if got[0].Request != `{"model"` || !got[0].RequestTruncated || got[0].Response != `{}` || got[0].ResponseTruncated {
+		t.Fatalf("expected bodies to be capped at 8 bytes, got %+v", got[0])
+	}
+
+	recorder.record("private", true, &aliasExchange{path: "/4", request: []byte(`{"messages":[]}`)})
+	if got := recorder.list(); got[0].Request != "" {
+		t.Fatalf("expected no bodies in private mode, got %q", got[0].Request)
+	}
+}
+
+func TestDebugExchangesHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		token          string
+		key            string
+		expectedStatus int
+	}{
+		{name: "admin key", token: "admin", key: "admin", expectedStatus: http.StatusOK},
+		{name: "wrong key", token: "admin", key: "nope", expectedStatus: http.StatusUnauthorized},
+		{name: "missing key", token: "admin", expectedStatus: http.StatusUnauthorized},
+		{name: "no admin key configured", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+			}))
+			defer upstream.Close()
+
+			recorder := newExchangeRecorder(10, 0)
+			chat := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, recorder, nil, AliasConfig{}))
+			chat.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o-mini","messages":[]}`)))
+
+			router := newAliasTestRouter(http.MethodGet, "/debug/exchanges", getDebugExchangesHandler(recorder, tt.token))
+			req := httptest.NewRequest(http.MethodGet, "/debug/exchanges", nil)
+			if len(tt.key) != 0 {
+				req.Header.Set("X-API-KEY", tt.key)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var exchanges []capturedExchange
+			if err := json.Unmarshal(rec.Body.Bytes(), &exchanges); err != nil {
+				t.Fatal(err)
+			}
+			if len(exchanges) != 1 || exchanges[0].Path != "/v1/chat/completions" || !strings.Contains(exchanges[0].Response, `"hi"`) {
+				t.Fatalf("expected the chat completion exchange, got %+v", exchanges)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hopByHopHeaders only concern a single connection and are never forwarded
+// (RFC 9110, section 7.6.1).
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// defaultDeniedHeaders are client or proxy internal headers upstreams have
+// no use for.
+var defaultDeniedHeaders = []string{
+	"Cookie",
+	"X-Custom-Event-Id",
+	"X-Conversation-Id",
+	"X-Request-Timeout",
+	"X-Forwarded-For",
+	"X-Real-Ip",
+}
+
+// UpstreamHeaderPolicy decides which client request headers are forwarded
+// to upstreams. Entries are case-insensitive header names, or prefixes
+// ending in "*" such as "OpenAI-*".
+type UpstreamHeaderPolicy struct {
+	// Allow, when set, is the only headers that are forwarded, e.g.
+	// Content-Type, Authorization, OpenAI-*. Empty forwards every header
+	// that is not denied.
+	Allow []string
+	// Deny is never forwarded, on top of the hop-by-hop headers and
+	// defaultDeniedHeaders.
+	Deny []string
+}
+
+func matchesHeader(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+			continue
+		}
+		if p == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p UpstreamHeaderPolicy) forwards(name string) bool {
+	if matchesHeader(hopByHopHeaders, name) || matchesHeader(defaultDeniedHeaders, name) || matchesHeader(p.Deny, name) {
+		return false
+	}
+
+	return len(p.Allow) == 0 || matchesHeader(p.Allow, name)
+}
+
+type upstreamHeaderPolicyKey struct{}
+
+func withUpstreamHeaderPolicy(ctx context.Context, policy UpstreamHeaderPolicy) context.Context {
+	return context.WithValue(ctx, upstreamHeaderPolicyKey{}, policy)
+}
+
+// getUpstreamHeaderPolicyMiddleware attaches policy to the request, where
+// copyHttpHeaders picks it up.
+func getUpstreamHeaderPolicyMiddleware(policy UpstreamHeaderPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(withUpstreamHeaderPolicy(c.Request.Context(), policy))
+	}
+}
+
+// forwardedHeaders lists the headers of source that may go upstream.
+// Headers named in its Connection header are hop-by-hop as well.
+func forwardedHeaders(source *http.Request) []string {
+	policy, _ := source.Context().Value(upstreamHeaderPolicyKey{}).(UpstreamHeaderPolicy)
+
+	connection := []string{}
+	for _, v := range source.Header.Values("Connection") {
+		connection = append(connection, strings.Split(v, ",")...)
+	}
+
+	res := []string{}
+	for name := range source.Header {
+		if policy.forwards(name) && !matchesHeader(connection, name) {
+			res = append(res, name)
+		}
+	}
+
+	return res
+}
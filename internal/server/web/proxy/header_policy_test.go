@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCopyHttpHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   UpstreamHeaderPolicy
+		expected []string
+	}{
+		{
+			name:     "internal and hop-by-hop headers are dropped",
+			expected: []string{"Accept-Encoding", "Authorization", "Content-Type", "Openai-Organization", "X-Custom"},
+		},
+		{
+			name:     "allowlist",
+			policy:   UpstreamHeaderPolicy{Allow: []string{"content-type", "Authorization", "OpenAI-*", "Cookie"}},
+			expected: []string{"Accept-Encoding", "Authorization", "Content-Type", "Openai-Organization"},
+		},
+		{
+			name:     "denylist",
+			policy:   UpstreamHeaderPolicy{Deny: []string{"X-Custom", "openai-*"}},
+			expected: []string{"Accept-Encoding", "Authorization", "Content-Type"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := httptest.NewRequest(http.MethodPost, "/", nil)
+			for name, value := range map[string]string{
+				"Content-Type":        "application/json",
+				"Authorization":       "Bearer sk-test",
+				"OpenAI-Organization": "org-1",
+				"X-Custom":            "1",
+				"Cookie":              "session=secret",
+				"X-Conversation-Id":   "conv-1",
+				"X-Forwarded-For":     "10.0.0.1",
+				"Connection":          "keep-alive, X-Hop",
+				"Keep-Alive":          "timeout=5",
+				"X-Hop":               "1",
+				"Upgrade":             "websocket",
+			} {
+				source.Header.Set(name, value)
+			}
+			source = source.WithContext(withUpstreamHeaderPolicy(source.Context(), tt.policy))
+
+			dest := httptest.NewRequest(http.MethodPost, "/", nil)
+			dest.Header = http.Header{}
+			copyHttpHeaders(source, dest, false)
+			got := []string{}
+			for name := range dest.Header {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Fatalf("expected forwarded headers %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
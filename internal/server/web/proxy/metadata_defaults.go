@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// ParseDefaultMetadata reads "key=value" entries, e.g. "source=web", into the
+// metadata object new conversations start from. Values are strings.
+func ParseDefaultMetadata(entries []string) (map[string]string, error) {
+	var defaults map[string]string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || len(key) == 0 {
+			return nil, fmt.Errorf("default metadata entry %q must look like key=value", entry)
+		}
+
+		if defaults == nil {
+			defaults = map[string]string{}
+		}
+		defaults[key] = strings.TrimSpace(value)
+	}
+
+	return defaults, nil
+}
+
+// withDefaultMetadata returns meta with the defaults it lacks added, so
+// keys the client sent win. Missing or null metadata becomes an object
+// holding just the defaults, and "{}" without any.
+func withDefaultMetadata(meta json.RawMessage, defaults map[string]string) (json.RawMessage, error) {
+	if len(meta) == 0 || gjson.ParseBytes(meta).Type == gjson.Null {
+		meta = json.RawMessage(`{}`)
+	}
+	if len(defaults) == 0 {
+		return meta, nil
+	}
+
+	if !gjson.ValidBytes(meta) || !gjson.ParseBytes(meta).IsObject() {
+		return nil, fmt.Errorf("metadata must be a JSON object")
+	}
+
+	merged := map[string]json.RawMessage{}
+	if err := json.Unmarshal(meta, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range defaults {
+		if _, ok := merged[key]; ok {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		merged[key] = raw
+	}
+
+	return json.Marshal(merged)
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDefaultMetadata(t *testing.T) {
+	defaults, err := ParseDefaultMetadata([]string{"source=web", " client = dicta-ui ", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defaults) != 2 || defaults["source"] != "web" || defaults["client"] != "dicta-ui" {
+		t.Fatalf("unexpected defaults %v", defaults)
+	}
+
+	for _, entry := range []string{"source", "=web"} {
+		if _, err := ParseDefaultMetadata([]string{entry}); err == nil {
+			t.Fatalf("expected %q to be rejected", entry)
+		}
+	}
+}
+
+func TestWithDefaultMetadata(t *testing.T) {
+	defaults := map[string]string{"source": "web"}
+
+	tests := []struct {
+		name          string
+		meta          string
+		defaults      map[string]string
+		expected      string
+		expectedError bool
+	}{
+		{name: "missing metadata without defaults", expected: `{}`},
+		{name: "null metadata without defaults", meta: `null`, expected: `{}`},
+		{name: "client metadata without defaults", meta: `["kept"]`, expected: `["kept"]`},
+		{name: "missing metadata", defaults: defaults, expected: `{"source":"web"}`},
+		{name: "merged into client metadata", meta: `{"folder":"work"}`, defaults: defaults, expected: `{"folder":"work","source":"web"}`},
+		{name: "client keys win", meta: `{"source":"cli"}`, defaults: defaults, expected: `{"source":"cli"}`},
+		{name: "not an object", meta: `["folder"]`, defaults: defaults, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := withDefaultMetadata(json.RawMessage(tt.meta), tt.defaults)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Fatalf("expected metadata %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMetadataSchema_ValidateDefaults(t *testing.T) {
+	schema := MetadataSchema{"source": "string", "stars": "number"}
+
+	if err := schema.validateDefaults(map[string]string{"source": "web"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := MetadataSchema(nil).validateDefaults(map[string]string{"anything": "x"}); err != nil {
+		t.Fatalf("unexpected error without a schema: %v", err)
+	}
+	for _, key := range []string{"stars", "color"} {
+		if err := schema.validateDefaults(map[string]string{key: "x"}); err == nil {
+			t.Fatalf("expected default %q to be rejected", key)
+		}
+	}
+}
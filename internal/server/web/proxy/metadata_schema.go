@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// metadataTypes are the value types a MetadataSchema can require.
+var metadataTypes = []string{"string", "number", "boolean", "object", "array"}
+
+// MetadataSchema maps the top-level conversation metadata keys clients may
+// set to the type of their values.
+type MetadataSchema map[string]string
+
+// ParseMetadataSchema reads "key:type" entries, e.g. "folder:string". No
+// entries yield a nil schema, which accepts any metadata.
+func ParseMetadataSchema(entries []string) (MetadataSchema, error) {
+	var schema MetadataSchema
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		key, typ, ok := strings.Cut(entry, ":")
+		key, typ = strings.TrimSpace(key), strings.TrimSpace(typ)
+		if !ok || len(key) == 0 {
+			return nil, fmt.Errorf("metadata schema entry %q must look like key:type", entry)
+		}
+		if !isMetadataType(typ) {
+			return nil, fmt.Errorf("metadata schema entry %q has unknown type %q, valid types are: %s", entry, typ, strings.Join(metadataTypes, ", "))
+		}
+
+		if schema == nil {
+			schema = MetadataSchema{}
+		}
+		schema[key] = typ
+	}
+
+	return schema, nil
+}
+
+func isMetadataType(typ string) bool {
+	for _, t := range metadataTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func metadataType(v gjson.Result) string {
+	switch {
+	case v.IsObject():
+		return "object"
+	case v.IsArray():
+		return "array"
+	case v.IsBool():
+		return "boolean"
+	case v.Type == gjson.Number:
+		return "number"
+	case v.Type == gjson.String:
+		return "string"
+	}
+	return "null"
+}
+
+// validate checks that meta is an object whose keys are all in the schema
+// with values of the declared types. Missing or null metadata is accepted.
+func (s MetadataSchema) validate(meta json.RawMessage) error {
+	if len(s) == 0 || len(meta) == 0 {
+		return nil
+	}
+
+	if !gjson.ValidBytes(meta) {
+		return fmt.Errorf("metadata must be valid JSON")
+	}
+
+	parsed := gjson.ParseBytes(meta)
+	if parsed.Type == gjson.Null {
+		return nil
+	}
+	if !parsed.IsObject() {
+		return fmt.Errorf("metadata must be a JSON object")
+	}
+
+	var err error
+	keys := []string{}
+	parsed.ForEach(func(k, v gjson.Result) bool {
+		typ, ok := s[k.String()]
+		if !ok {
+			for key := range s {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			err = fmt.Errorf("metadata key %q is not allowed, allowed keys are: %s", k.String(), strings.Join(keys, ", "))
+			return false
+		}
+		if got := metadataType(v); got != typ {
+			err = fmt.Errorf("metadata key %q must be of type %s, got %s", k.String(), typ, got)
+			return false
+		}
+		return true
+	})
+
+	return err
+}
+
+// validateDefaults checks that the string defaults of ParseDefaultMetadata
+// would pass the schema, so a misconfiguration fails at startup instead of
+// on every new conversation.
+func (s MetadataSchema) validateDefaults(defaults map[string]string) error {
+	if len(s) == 0 {
+		return nil
+	}
+
+	for key := range defaults {
+		if typ, ok := s[key]; !ok || typ != "string" {
+			return fmt.Errorf("default metadata key %q must be a string key of the metadata schema", key)
+		}
+	}
+
+	return nil
+}
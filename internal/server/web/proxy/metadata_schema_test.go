@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseMetadataSchema(t *testing.T) {
+	tests := []struct {
+		name          string
+		entries       []string
+		expected      MetadataSchema
+		expectedError bool
+	}{
+		{name: "no entries", entries: nil, expected: nil},
+		{name: "entries", entries: []string{"folder:string", " tags : array ", ""}, expected: MetadataSchema{"folder": "string", "tags": "array"}},
+		{name: "missing type", entries: []string{"folder"}, expectedError: true},
+		{name: "missing key", entries: []string{":string"}, expectedError: true},
+		{name: "unknown type", entries: []string{"folder:text"}, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := ParseMetadataSchema(tt.entries)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got schema %v", schema)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(schema) != len(tt.expected) {
+				t.Fatalf("expected schema %v, got %v", tt.expected, schema)
+			}
+			for k, v := range tt.expected {
+				if schema[k] != v {
+					t.Fatalf("expected schema %v, got %v", tt.expected, schema)
+				}
+			}
+		})
+	}
+}
+
+func TestMetadataSchema_Validate(t *testing.T) {
+	schema := MetadataSchema{"folder": "string", "stars": "number", "starred": "boolean", "tags": "array", "extra": "object"}
+
+	tests := []struct {
+		name          string
+		schema        MetadataSchema
+		meta          string
+		expectedError string
+	}{
+		{name: "no schema accepts anything", schema: nil, meta: `{"anything":1}`},
+		{name: "missing metadata", schema: schema, meta: ``},
+		{name: "null metadata", schema: schema, meta: `null`},
+		{name: "matching metadata", schema: schema, meta: `{"folder":"work","stars":3,"starred":true,"tags":["a"],"extra":{"k":"v"}}`},
+		{name: "unknown key", schema: schema, meta: `{"folder":"work","color":"red"}`, expectedError: `"color" is not allowed`},
+		{name: "wrong type", schema: schema, meta: `{"stars":"three"}`, expectedError: `"stars" must be of type number, got string`},
+		{name: "null value", schema: schema, meta: `{"folder":null}`, expectedError: `"folder" must be of type string, got null`},
+		{name: "not an object", schema: schema, meta: `["folder"]`, expectedError: "must be a JSON object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schema.validate(json.RawMessage(tt.meta))
+			if len(tt.expectedError) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Fatalf("expected an error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
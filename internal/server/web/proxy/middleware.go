@@ -182,6 +182,10 @@ func getMiddleware(cpm CustomProvidersManager, rm routeManager, pm PoliciesManag
 			return
 		}
 
+		if c.FullPath() == metricsPath {
+			return
+		}
+
 		if removeUserAgent {
 			c.Set("removeUserAgent", removeUserAgent)
 		}
@@ -189,7 +193,10 @@ func getMiddleware(cpm CustomProvidersManager, rm routeManager, pm PoliciesManag
 		blw := &responseWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
 		c.Writer = blw
 
-		cid := util.NewUuid()
+		cid := c.GetString(util.STRING_CORRELATION_ID)
+		if len(cid) == 0 {
+			cid = util.NewUuid()
+		}
 		c.Set(util.STRING_CORRELATION_ID, cid)
 		logWithCid := log.With(zap.String(util.STRING_CORRELATION_ID, cid))
 		util.SetLogToCtx(c, logWithCid)
@@ -197,6 +204,16 @@ func getMiddleware(cpm CustomProvidersManager, rm routeManager, pm PoliciesManag
 		start := time.Now()
 		c.Set("startTime", start)
 
+		// shared conversation links are public and carry no key
+		if c.FullPath() == "/shared/:token" {
+			return
+		}
+
+		// the debug endpoint checks the admin key itself
+		if c.FullPath() == "/debug/exchanges" {
+			return
+		}
+
 		enrichedEvent := &event.EventWithRequestAndContent{}
 		requestBytes := []byte(`{}`)
 		responseBytes := []byte(`{}`)
@@ -334,6 +351,7 @@ func getMiddleware(cpm CustomProvidersManager, rm routeManager, pm PoliciesManag
 
 		c.Set("key", kc)
 		c.Set("settings", settings)
+		c.Set("isAdmin", kc != nil && contains(kc.Tags, adminKeyTag))
 
 		if len(settings) >= 1 {
 			selected := settings[0]
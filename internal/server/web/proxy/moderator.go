@@ -0,0 +1,10 @@
+package proxy
+
+import "context"
+
+// Moderator decides whether a prompt may be forwarded upstream. It can be
+// backed by OpenAI's moderation endpoint or a local classifier; a nil
+// Moderator disables the check.
+type Moderator interface {
+	Check(ctx context.Context, text string) (allowed bool, reason string, err error)
+}
@@ -1,37 +1,759 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
 	"github.com/bricks-cloud/bricksllm/internal/telemetry"
 	"github.com/bricks-cloud/bricksllm/internal/util"
 	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
 )
 
-func getChatCompletionAliasHandler(prod, private bool, client http.Client) gin.HandlerFunc {
+const (
+	conversationIdHeader = "X-Conversation-Id"
+	openAiAliasBaseUrl   = "https://api.openai.com"
+	// defaultAliasRequestTimeout applies when no timeout is configured, as a
+	// zero deadline would cancel the upstream call immediately.
+	defaultAliasRequestTimeout = 120 * time.Second
+	defaultAliasMaxBodyBytes   = 10 << 20
+)
+
+// AliasConfig holds the tunables of the OpenAI compatible alias routes.
+type AliasConfig struct {
+	LogBodies bool
+	Moderator Moderator
+	// StreamTransformer rewrites the events of streamed chat and text
+	// completions. Nil relays them unchanged.
+	StreamTransformer   StreamTransformer
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	// RequestTimeout and StreamRequestTimeout override the server wide
+	// timeout for non-streaming and streaming chat completions.
+	RequestTimeout       time.Duration
+	StreamRequestTimeout time.Duration
+	// ModelTimeouts lists "model=duration" entries, e.g. "llama-70b=15m",
+	// that replace both timeouts for requests to that model.
+	ModelTimeouts []string
+	modelTimeouts map[string]time.Duration
+	// DefaultModel replaces a missing or "default" model, which llama.cpp
+	// ignores but OpenAI rejects.
+	DefaultModel string
+	// AllowedModels limits which models clients may request. Empty allows
+	// every model.
+	AllowedModels []string
+	// MaxBodyBytes caps request bodies, defaulting to
+	// defaultAliasMaxBodyBytes when zero.
+	MaxBodyBytes int64
+	// TitleModel and TitlePrompt drive conversation auto titles. TitleModel
+	// falls back to DefaultModel.
+	TitleModel  string
+	TitlePrompt string
+	// RateLimit is the number of chat completions per second each client
+	// may send, with bursts of up to RateBurst. Zero disables the limiter.
+	RateLimit float64
+	RateBurst int
+	// HistoryMaxMessages and HistoryMaxTokens bound the stored history sent
+	// upstream when a client leaves it to the server. Zero disables a limit.
+	HistoryMaxMessages int
+	HistoryMaxTokens   int
+	// HistorySummarize replaces the messages trimming drops with a summary
+	// written by the model, falling back to plain trimming when that fails.
+	HistorySummarize bool
+	// TokenEstimator counts tokens when trimming history, defaulting to the
+	// four characters per token estimate.
+	TokenEstimator TokenEstimator
+	// MetadataSchema lists the "key:type" entries conversation metadata is
+	// validated against. Empty accepts any metadata.
+	MetadataSchema []string
+	// DefaultMetadata lists the "key=value" entries added to the metadata of
+	// new conversations that do not set those keys.
+	DefaultMetadata []string
+	// MessageDedupWindow makes creating a message that repeats the role and
+	// content of the conversation's latest message, created at most this
+	// long before, return that message instead. Zero turns it off.
+	MessageDedupWindow time.Duration
+	// MaxMessageContentLength caps the content of messages clients create,
+	// counted in runes. Zero accepts any length.
+	MaxMessageContentLength int
+	// MessageEvents pushes messages created in a conversation to the
+	// clients of GET /api/v1/conversations/:id/ws. Nil turns the endpoint off.
+	MessageEvents MessageSubscriber
+	// JSONModeRetries is how many more times a non-streaming chat completion
+	// requested in JSON mode is sent when its reply does not parse as JSON.
+	JSONModeRetries int
+	// DebugCaptureSize is how many recent chat completion exchanges are kept
+	// for GET /debug/exchanges, with bodies capped at DebugCaptureMaxBodyBytes.
+	// Zero turns the capture and the endpoint off. DebugCaptureToken, the
+	// admin password, must be sent in X-API-KEY to read them.
+	DebugCaptureSize         int
+	DebugCaptureMaxBodyBytes int
+	DebugCaptureToken        string
+	// RetryPayloadMaxCount chat completion payloads are kept for up to
+	// RetryPayloadTTL so POST /chat/retry/:requestId can send them again.
+	// Zero of either turns retries off.
+	RetryPayloadMaxCount int
+	RetryPayloadTTL      time.Duration
+	// BaseUrls are the OpenAI compatible upstreams in order of preference.
+	// Chat completions fail over to the next one on connection errors and
+	// 5xx replies, every other alias route uses the first. Empty means
+	// OpenAI.
+	BaseUrls []string
+	// UpstreamMaxConcurrency caps the chat completions in flight to each of
+	// BaseUrls, zero meaning no cap. Requests over the cap wait up to
+	// UpstreamQueueTimeout for a slot, or are turned away with a 503 at once
+	// when it is zero.
+	UpstreamMaxConcurrency int
+	UpstreamQueueTimeout   time.Duration
+	// MockMode answers chat and text completions with an echo of the prompt
+	// instead of calling an upstream, for developing clients without a
+	// model. Streams send a word every MockTokenDelay.
+	MockMode       bool
+	MockTokenDelay time.Duration
+	// UpstreamApiKey, when set, is sent as the bearer token of every request
+	// to BaseUrls in place of the client's Authorization header.
+	UpstreamApiKey string
+	// UpstreamDefaultHeaders lists "name=value" headers, e.g.
+	// "OpenAI-Organization=org-123", sent with every request to BaseUrls.
+	// They replace headers of the same name the client sent.
+	UpstreamDefaultHeaders []string
+	upstreamDefaultHeaders http.Header
+	// AnthropicBaseUrl is where /v1/anthropic/chat/completions sends the
+	// translated requests. Empty means Anthropic's API.
+	AnthropicBaseUrl string
+	// AnthropicPromptCaching marks the system prompt of requests translated
+	// for Anthropic as cacheable, cutting the cost of long prompts that
+	// repeat across requests.
+	AnthropicPromptCaching bool
+	// BaseUrlWeights, one per base URL, spread chat completions across the
+	// upstreams instead of always starting with the first.
+	BaseUrlWeights []int
+	// UpstreamFailureThreshold consecutive failures open an upstream's
+	// circuit for UpstreamCooldown, after which a single probe decides
+	// whether it closes again. Requests get a 503 while every circuit is
+	// open. Zero disables the circuit breaker.
+	UpstreamFailureThreshold int
+	UpstreamCooldown         time.Duration
+	// CORS controls which browser origins may call the proxy.
+	CORS CORSConfig
+	// UpstreamHeaders controls which client headers every proxied route
+	// forwards upstream.
+	UpstreamHeaders UpstreamHeaderPolicy
+	// Signature makes every route but the health check and metrics require
+	// an HMAC of the request body.
+	Signature SignatureConfig
+	// StreamSaveInterval is how often the reply of a streamed chat
+	// completion for a conversation is saved while it streams, so a crash
+	// keeps what was received. Zero saves the reply only once it is done.
+	StreamSaveInterval time.Duration
+}
+
+// newAliasRateLimiter returns nil, which disables rate limiting, unless a
+// rate is configured.
+func newAliasRateLimiter(cfg AliasConfig) *clientRateLimiter {
+	if cfg.RateLimit <= 0 {
+		return nil
+	}
+
+	return newClientRateLimiter(cfg.RateLimit, cfg.RateBurst)
+}
+
+// aliasRequestContext derives the upstream call's context from the incoming
+// request, so a client disconnect also cancels the upstream call.
+func aliasRequestContext(c *gin.Context, streaming bool) (context.Context, context.CancelFunc) {
+	timeout := requestTimeoutFor(c, streaming)
+	if timeout <= 0 {
+		timeout = defaultAliasRequestTimeout
+	}
+
+	return context.WithTimeout(c.Request.Context(), timeout)
+}
+
+// injectDefaultModel sets the request's model to model when the client left
+// it empty or asked for "default". A real model is left untouched.
+func injectDefaultModel(body []byte, model string) ([]byte, error) {
+	if len(model) == 0 {
+		return body, nil
+	}
+
+	current := gjson.GetBytes(body, "model").String()
+	if len(current) != 0 && current != "default" {
+		return body, nil
+	}
+
+	return sjson.SetBytes(body, "model", model)
+}
+
+// checkAllowedModel rejects the request with 403 when its model is not in
+// the configured allowlist. It reports whether the request may proceed.
+func checkAllowedModel(c *gin.Context, body []byte, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	model := gjson.GetBytes(body, "model").String()
+	for _, m := range allowed {
+		if m == model {
+			return true
+		}
+	}
+
+	telemetry.Incr("bricksllm.proxy.alias.model_not_allowed", nil, 1)
+	JSON(c, http.StatusForbidden, fmt.Sprintf("[BricksLLM] model %q is not allowed, allowed models are: %s", model, strings.Join(allowed, ", ")))
+	return false
+}
+
+// limitAliasBody bounds how much of the request body can be read, so an
+// oversized body fails while it is being read instead of being buffered.
+func limitAliasBody(c *gin.Context, cfg AliasConfig) {
+	limit := cfg.MaxBodyBytes
+	if limit <= 0 {
+		limit = defaultAliasMaxBodyBytes
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+}
+
+// setUpstreamApiKey replaces the Authorization the client sent, which then
+// only authenticates it against this proxy, with the configured upstream
+// key so browsers never hold it.
+func setUpstreamApiKey(req *http.Request, cfg AliasConfig) {
+	if len(cfg.UpstreamApiKey) != 0 {
+		req.Header.Set("Authorization", "Bearer "+cfg.UpstreamApiKey)
+	}
+}
+
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// prependSystemPrompt inserts a system message at the head of the request's
+// messages unless the client already supplied one.
+func prependSystemPrompt(body []byte, prompt string) ([]byte, error) {
+	if len(prompt) == 0 || gjson.GetBytes(body, `messages.#(role=="system")`).Exists() {
+		return body, nil
+	}
+
+	system, err := json.Marshal(map[string]string{
+		"role":    "system",
+		"content": prompt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []json.RawMessage{system}
+	for _, m := range gjson.GetBytes(body, "messages").Array() {
+		messages = append(messages, json.RawMessage(m.Raw))
+	}
+
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	return sjson.SetRawBytes(body, "messages", data)
+}
+
+func getChatCompletionAliasHandler(prod, private bool, client http.Client, upstreams *upstreamPool, cs conversationsStore, streams *streamRegistry, exchanges *exchangeRecorder, payloads *retryPayloadStore, cfg AliasConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log := util.GetLogFromCtx(c)
-		telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.requests", nil, 1)
+		telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.requests", requestIdTags(c), 1)
 
 		if c == nil || c.Request == nil {
 			JSON(c, http.StatusInternalServerError, "[BricksLLM] context is empty")
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), c.GetDuration("requestTimeout"))
+		limitAliasBody(c, cfg)
+		body, err := io.ReadAll(c.Request.Body)
+		if isBodyTooLarge(err) {
+			JSON(c, http.StatusRequestEntityTooLarge, "[BricksLLM] request body is too large")
+			return
+		}
+		if err != nil {
+			logError(log, "error when reading openai alias request body", prod, err)
+			JSON(c, http.StatusBadRequest, "[BricksLLM] failed to read request body")
+			return
+		}
+
+		body, err = injectDefaultModel(body, cfg.DefaultModel)
+		if err != nil {
+			logError(log, "error when injecting default model for openai alias", prod, err)
+			JSON(c, http.StatusBadRequest, "[BricksLLM] failed to set default model")
+			return
+		}
+
+		if !checkAllowedModel(c, body, cfg.AllowedModels) {
+			return
+		}
+
+		serverHistory := isServerHistoryRequest(body)
+		if serverHistory {
+			if cs == nil {
+				JSON(c, http.StatusBadRequest, "[BricksLLM] conversation history is not available")
+				return
+			}
+
+			cid := gjson.GetBytes(body, "conversation_id").String()
+			history, err := cs.GetMessagesForUser(cid, c.GetString("userId"))
+			if err != nil {
+				if _, ok := err.(notFoundError); ok {
+					JSON(c, http.StatusNotFound, "[BricksLLM] conversation is not found")
+					return
+				}
+
+				logError(log, "error when retrieving conversation history for openai alias", prod, err)
+				JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to retrieve conversation history")
+				return
+			}
+			history = primaryMessages(history)
+
+			conv, err := cs.GetConversation(cid)
+			if err != nil {
+				logError(log, "error when retrieving conversation for openai alias", prod, err)
+				JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to retrieve conversation")
+				return
+			}
+
+			var compress historyCompressor
+			if cfg.HistorySummarize {
+				compress = newHistorySummarizer(c, client, upstreams.primary(), cfg, cs, conv, gjson.GetBytes(body, "model").String(), prod)
+			}
+
+			systemPrompt, err := conversationSystemPrompt(conv, c.GetString("userId"))
+			if err != nil {
+				JSON(c, http.StatusBadRequest, "[BricksLLM] "+err.Error())
+				return
+			}
+
+			body, err = serverHistoryRequestBody(body, systemPrompt, history, cfg, compress)
+			if err != nil {
+				JSON(c, http.StatusBadRequest, "[BricksLLM] "+err.Error())
+				return
+			}
+
+			// from here on the request is handled like one for this conversation
+			c.Request.Header.Set(conversationIdHeader, cid)
+		}
+
+		isStreaming := c.GetBool("stream") || gjson.GetBytes(body, "stream").Bool()
+		applyModelTimeout(c, cfg.modelTimeouts, gjson.GetBytes(body, "model").String())
+		ctx, cancel := aliasRequestContext(c, isStreaming)
 		defer cancel()
 
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/chat/completions", c.Request.Body)
+		if isStreaming && streams != nil {
+			requestId := c.GetString(util.STRING_CORRELATION_ID)
+			if len(requestId) == 0 {
+				requestId = util.NewUuid()
+			}
+
+			release, ok := streams.track(requestId, callerKeyId(c), cancel)
+			if !ok {
+				telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.duplicate_request_id", nil, 1)
+				JSON(c, http.StatusConflict, "[BricksLLM] a streaming request with this id is already in flight")
+				return
+			}
+			defer release()
+			c.Header(requestIdHeader, requestId)
+		}
+
+		if cfg.Moderator != nil {
+			if prompt, ok := lastUserMessage(body); ok {
+				allowed, reason, err := cfg.Moderator.Check(ctx, prompt)
+				if err != nil {
+					telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.moderation_error", nil, 1)
+					logError(log, "error when moderating openai alias prompt", prod, err)
+					JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to moderate prompt")
+					return
+				}
+
+				if !allowed {
+					telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.moderation_blocked", nil, 1)
+					JSON(c, http.StatusUnavailableForLegalReasons, "[BricksLLM] prompt blocked by moderation: "+reason)
+					return
+				}
+			}
+		}
+
+		var conv *postgresql.Conversation
+		cid := c.GetHeader(conversationIdHeader)
+		if len(cid) != 0 && cs != nil {
+			conv, err = cs.GetConversation(cid)
+			if err != nil {
+				if _, ok := err.(notFoundError); ok {
+					JSON(c, http.StatusNotFound, "[BricksLLM] conversation is not found")
+					return
+				}
+
+				logError(log, "error when retrieving conversation for openai alias", prod, err)
+				JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to retrieve conversation")
+				return
+			}
+
+			if conv.UserID != c.GetString("userId") {
+				permission, err := cs.GetConversationPermission(cid, c.GetString("userId"))
+				if err != nil {
+					if _, ok := err.(notFoundError); ok {
+						JSON(c, http.StatusNotFound, "[BricksLLM] conversation is not found")
+						return
+					}
+
+					logError(log, "error when retrieving conversation permission for openai alias", prod, err)
+					JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to retrieve conversation")
+					return
+				}
+
+				if permission == postgresql.PermissionRead {
+					JSON(c, http.StatusForbidden, "[BricksLLM] conversation is shared read-only")
+					return
+				}
+			}
+
+			if conv.OverBudget() {
+				telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.conversation_over_budget", nil, 1)
+				JSON(c, http.StatusPaymentRequired, fmt.Sprintf("[BricksLLM] conversation token budget exhausted: %d of %d tokens used", conv.TokensUsed, conv.TokenBudget))
+				return
+			}
+
+			systemPrompt, err := conversationSystemPrompt(conv, c.GetString("userId"))
+			if err != nil {
+				JSON(c, http.StatusBadRequest, "[BricksLLM] "+err.Error())
+				return
+			}
+
+			body, err = prependSystemPrompt(body, systemPrompt)
+			if err != nil {
+				logError(log, "error when prepending conversation system prompt", prod, err)
+				JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to apply conversation system prompt")
+				return
+			}
+
+			body, err = applyDefaultParams(body, conv.DefaultParams)
+			if err != nil {
+				logError(log, "error when applying conversation default params", prod, err)
+				JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to apply conversation default params")
+				return
+			}
+
+			// the new turn is recorded before forwarding so it survives an upstream failure
+			turn := newTurnMessages(body)
+			if serverHistory {
+				// only the prompt is new, the rest of the turn is already stored
+				turn = turn[len(turn)-1:]
+			}
+			for _, msg := range turn {
+				msg.ConversationID = conv.ID
+				if err := cs.CreateMessage(msg); err != nil {
+					if _, ok := err.(validationError); ok {
+						JSON(c, http.StatusBadRequest, "[BricksLLM] "+err.Error())
+						return
+					}
+					logError(log, "error when persisting "+msg.Role+" message for openai alias", prod, err)
+					JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to persist "+msg.Role+" message")
+					return
+				}
+			}
+		}
+
+		payloads.put(c.GetString(util.STRING_CORRELATION_ID), callerKeyId(c), body)
+
+		// the usage chunk makes the stored token counts exact instead of estimated
+		upstreamBody := body
+		injectedUsage := false
+		if isStreaming {
+			upstreamBody, injectedUsage, err = injectStreamUsage(body)
+			if err != nil {
+				logError(log, "error when requesting stream usage for openai alias", prod, err)
+				JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to request stream usage")
+				return
+			}
+		}
+
+		newRequest := func(baseUrl string) (*http.Request, error) {
+			reqBody := upstreamBody
+			if injectedUsage && !upstreams.streamUsageSupported(baseUrl) {
+				reqBody = body
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseUrl+"/v1/chat/completions", bytes.NewReader(reqBody))
+			if err != nil {
+				return nil, err
+			}
+
+			copyHttpHeaders(c.Request, req, c.GetBool("removeUserAgent"))
+			setUpstreamDefaultHeaders(req, cfg)
+			setUpstreamApiKey(req, cfg)
+			forwardRequestId(c, req)
+			// let the transport negotiate and undo compression, the reply is re-served plain
+			req.Header.Del("Accept-Encoding")
+			if isStreaming {
+				req.Header.Set("Accept", "text/event-stream")
+				req.Header.Set("Cache-Control", "no-cache")
+				req.Header.Set("Connection", "keep-alive")
+			}
+			return req, nil
+		}
+
+		// nothing has been relayed yet, so streams can fail over too
+		start := time.Now()
+		res, served, err := upstreams.send(ctx, client, newRequest)
+		if errors.Is(err, errCircuitOpen) {
+			JSON(c, http.StatusServiceUnavailable, "[BricksLLM] openai alias upstreams are unavailable")
+			return
+		}
+		if errors.Is(err, errUpstreamBusy) {
+			telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.upstream_busy", nil, 1)
+			JSON(c, http.StatusServiceUnavailable, "[BricksLLM] openai alias upstreams are busy, try again later")
+			return
+		}
 		if err != nil {
-			logError(log, "error when creating openai alias http request", prod, err)
-			JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to create openai alias http request")
+			logError(log, "error when sending http request to openai via alias", prod, err)
+			JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to send http request to openai via alias")
+			return
+		}
+		defer res.Body.Close()
+		telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.served", upstreamTags(served), 1)
+
+		resBody, err := decodedAliasBody(res)
+		if err != nil {
+			logError(log, "error when decoding openai alias response body", prod, err)
+			JSON(c, http.StatusBadGateway, "[BricksLLM] failed to decode openai alias response body")
+			return
+		}
+		defer resBody.Close()
+
+		// a request sent again goes to the upstream that served it
+		resend := func() (*http.Response, error) {
+			req, err := newRequest(served)
+			if err != nil {
+				return nil, err
+			}
+			return upstreams.do(ctx, client, served, req)
+		}
+
+		if injectedUsage && upstreams.streamUsageSupported(served) {
+			rejected, errBody, err := rejectsStreamOptions(res, resBody)
+			if err != nil {
+				logError(log, "error when reading openai alias response body", prod, err)
+				JSON(c, http.StatusBadGateway, "[BricksLLM] failed to read openai alias response body")
+				return
+			}
+			resBody = errBody
+
+			if rejected {
+				telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.stream_usage_unsupported", upstreamTags(served), 1)
+				upstreams.disableStreamUsage(served)
+
+				res, err = resend()
+				if err != nil {
+					logError(log, "error when sending http request to openai via alias", prod, err)
+					JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to send http request to openai via alias")
+					return
+				}
+				defer res.Body.Close()
+
+				resBody, err = decodedAliasBody(res)
+				if err != nil {
+					logError(log, "error when decoding openai alias response body", prod, err)
+					JSON(c, http.StatusBadGateway, "[BricksLLM] failed to decode openai alias response body")
+					return
+				}
+				defer resBody.Close()
+			}
+		}
+
+		resBody, err = wrapNonJSONErrorReply(res, resBody)
+		if err != nil {
+			logError(log, "error when reading openai alias error reply", prod, err)
+			JSON(c, http.StatusBadGateway, "[BricksLLM] failed to read openai alias response body")
+			return
+		}
+
+		if !isStreaming && jsonModeRequested(body) {
+			var data []byte
+			var valid bool
+			res, data, valid, err = retryJSONModeReply(resend, res, resBody, cfg.JSONModeRetries)
+			if err != nil {
+				logError(log, "error when reading openai alias json mode reply", prod, err)
+				JSON(c, http.StatusBadGateway, "[BricksLLM] failed to read openai alias response body")
+				return
+			}
+			if !valid {
+				telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.json_mode_invalid", nil, 1)
+				JSON(c, http.StatusBadGateway, "[BricksLLM] upstream reply is not valid JSON although JSON mode was requested")
+				return
+			}
+			resBody = io.NopCloser(bytes.NewReader(data))
+		}
+
+		for name, values := range res.Header {
+			for _, value := range values {
+				c.Header(name, value)
+			}
+		}
+
+		if ct := res.Header.Get("Content-Type"); len(ct) != 0 {
+			c.Writer.Header().Set("Content-Type", ct)
+		}
+		c.Status(res.StatusCode)
+
+		captured := bytes.NewBuffer(nil)
+		var copyErr error
+		var partial *postgresql.Message
+		if isStreaming && res.StatusCode == http.StatusOK {
+			var w io.Writer = c.Writer
+			if conv != nil && cfg.StreamSaveInterval > 0 {
+				msg := newConversationMessage(conv.ID, "assistant", "")
+				msg.Streaming = true
+				msg.Model = gjson.GetBytes(body, "model").String()
+				if err := cs.CreateMessage(msg); err != nil {
+					telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.persist_assistant_message_error", nil, 1)
+					logError(log, "error when persisting streaming assistant message for openai alias", prod, err)
+				} else {
+					partial = &msg
+					w = newPartialReplyWriter(c.Writer, captured, cfg.StreamSaveInterval, func(content string) {
+						if err := cs.UpdateStreamingMessage(msg.ID, content); err != nil {
+							telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.save_partial_reply_error", nil, 1)
+							logError(log, "error when saving partial assistant message for openai alias", prod, err)
+						}
+					})
+				}
+			}
+
+			timer := newStreamTimer(resBody, start)
+			copyErr = relayAliasStream(w, newStreamTransformReader(timer, cfg.StreamTransformer), captured, func() []byte {
+				return estimatedUsageEvent(body, captured.Bytes())
+			})
+			if copyErr != nil {
+				logError(log, "error when relaying openai alias stream", prod, copyErr)
+				writeStreamErrorEvent(c.Writer, ctx, copyErr)
+				timer.observe(0, upstreamTags(served))
+			} else {
+				completion := parseAliasCompletion(captured.Bytes(), true)
+				completion.estimateUsage(body)
+				timer.observe(completion.completionTokens, upstreamTags(served))
+			}
+		} else if !cfg.LogBodies && conv == nil && exchanges == nil {
+			_, _ = io.Copy(c.Writer, resBody)
+			return
+		} else {
+			_, copyErr = io.Copy(io.MultiWriter(c.Writer, captured), resBody)
+		}
+
+		if partial != nil {
+			// the reply is kept even if the stream broke off, marked as such
+			completion := parseAliasCompletion(captured.Bytes(), true)
+			completion.estimateUsage(body)
+
+			partial.Content = completion.content
+			partial.PromptTokens = completion.promptTokens
+			partial.CompletionTokens = completion.completionTokens
+			partial.TokensEstimated = completion.estimated
+			partial.FinishReason = completion.finishReason
+			if copyErr != nil && len(partial.FinishReason) == 0 {
+				partial.FinishReason = postgresql.FinishReasonInterrupted
+			}
+			if err := cs.CompleteStreamingMessage(*partial); err != nil {
+				telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.persist_assistant_message_error", nil, 1)
+				logError(log, "error when completing streaming assistant message for openai alias", prod, err)
+			}
+			persistAliasVariants(log, prod, cs, partial.ConversationID, body, completion)
+		} else if conv != nil && copyErr == nil && res.StatusCode == http.StatusOK {
+			completion := parseAliasCompletion(captured.Bytes(), isStreaming)
+			completion.estimateUsage(body)
+
+			msg := newConversationMessage(conv.ID, "assistant", completion.content)
+			msg.Model = gjson.GetBytes(body, "model").String()
+			msg.PromptTokens = completion.promptTokens
+			msg.CompletionTokens = completion.completionTokens
+			msg.TokensEstimated = completion.estimated
+			msg.FinishReason = completion.finishReason
+			if err := cs.CreateMessage(msg); err != nil {
+				telemetry.Incr("bricksllm.proxy.get_chat_completion_alias_handler.persist_assistant_message_error", nil, 1)
+				logError(log, "error when persisting assistant message for openai alias", prod, err)
+			}
+			persistAliasVariants(log, prod, cs, conv.ID, body, completion)
+		}
+
+		if !cfg.LogBodies && exchanges == nil {
+			return
+		}
+
+		ex := &aliasExchange{
+			method:       c.Request.Method,
+			path:         c.Request.URL.Path,
+			header:       c.Request.Header,
+			request:      body,
+			response:     captured.Bytes(),
+			status:       res.StatusCode,
+			duration:     time.Since(start),
+			streaming:    isStreaming,
+			conversation: cid,
+		}
+		exchanges.record(c.GetString(util.STRING_CORRELATION_ID), private, ex)
+		if cfg.LogBodies {
+			logAliasExchange(log, private, ex)
+		}
+	}
+}
+
+// getCompletionsAliasHandler forwards legacy text completions, streaming or
+// not, so older tooling works against the same proxy as chat clients.
+func getCompletionsAliasHandler(prod bool, client http.Client, baseUrl string, cfg AliasConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := util.GetLogFromCtx(c)
+		telemetry.Incr("bricksllm.proxy.completions_alias.requests", requestIdTags(c), 1)
+
+		if c == nil || c.Request == nil {
+			JSON(c, http.StatusInternalServerError, "[BricksLLM] context is empty")
+			return
+		}
+
+		limitAliasBody(c, cfg)
+		body, err := io.ReadAll(c.Request.Body)
+		if isBodyTooLarge(err) {
+			JSON(c, http.StatusRequestEntityTooLarge, "[BricksLLM] request body is too large")
+			return
+		}
+		if err != nil {
+			logError(log, "error when reading completions alias request body", prod, err)
+			JSON(c, http.StatusBadRequest, "[BricksLLM] failed to read request body")
+			return
+		}
+
+		if !checkAllowedModel(c, body, cfg.AllowedModels) {
+			return
+		}
+
+		isStreaming := c.GetBool("stream") || gjson.GetBytes(body, "stream").Bool()
+		applyModelTimeout(c, cfg.modelTimeouts, gjson.GetBytes(body, "model").String())
+		ctx, cancel := aliasRequestContext(c, isStreaming)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseUrl+"/v1/completions", bytes.NewReader(body))
+		if err != nil {
+			logError(log, "error when creating completions alias http request", prod, err)
+			JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to create completions alias http request")
 			return
 		}
 
 		copyHttpHeaders(c.Request, req, c.GetBool("removeUserAgent"))
-		isStreaming := c.GetBool("stream")
+		setUpstreamDefaultHeaders(req, cfg)
+		setUpstreamApiKey(req, cfg)
+		forwardRequestId(c, req)
+		req.Header.Del("Accept-Encoding")
 		if isStreaming {
 			req.Header.Set("Accept", "text/event-stream")
 			req.Header.Set("Cache-Control", "no-cache")
@@ -40,22 +762,101 @@ func getChatCompletionAliasHandler(prod, private bool, client http.Client) gin.H
 
 		res, err := client.Do(req)
 		if err != nil {
-			logError(log, "error when sending http request to openai via alias", prod, err)
-			JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to send http request to openai via alias")
+			logError(log, "error when sending http request to completions alias upstream", prod, err)
+			JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to send http request to completions alias upstream")
 			return
 		}
 		defer res.Body.Close()
 
+		resBody, err := decodedAliasBody(res)
+		if err != nil {
+			logError(log, "error when decoding completions alias response body", prod, err)
+			JSON(c, http.StatusBadGateway, "[BricksLLM] failed to decode completions alias response body")
+			return
+		}
+		defer resBody.Close()
+
+		resBody, err = wrapNonJSONErrorReply(res, resBody)
+		if err != nil {
+			logError(log, "error when reading completions alias error reply", prod, err)
+			JSON(c, http.StatusBadGateway, "[BricksLLM] failed to read completions alias response body")
+			return
+		}
+
 		for name, values := range res.Header {
 			for _, value := range values {
 				c.Header(name, value)
 			}
 		}
 
-		if ct := res.Header.Get("Content-Type"); len(ct) != 0 {
-			c.Writer.Header().Set("Content-Type", ct)
+		c.Status(res.StatusCode)
+		if isStreaming && res.StatusCode == http.StatusOK {
+			if err := relayAliasStream(c.Writer, newStreamTransformReader(resBody, cfg.StreamTransformer), nil, nil); err != nil {
+				logError(log, "error when relaying completions alias stream", prod, err)
+				writeStreamErrorEvent(c.Writer, ctx, err)
+			}
+			return
+		}
+
+		_, _ = io.Copy(c.Writer, resBody)
+	}
+}
+
+func getEmbeddingsAliasHandler(prod bool, client http.Client, baseUrl string, cfg AliasConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := util.GetLogFromCtx(c)
+		telemetry.Incr("bricksllm.proxy.embeddings_alias.requests", requestIdTags(c), 1)
+
+		if c == nil || c.Request == nil {
+			JSON(c, http.StatusInternalServerError, "[BricksLLM] context is empty")
+			return
+		}
+
+		ctx, cancel := aliasRequestContext(c, false)
+		defer cancel()
+
+		// the body is streamed to the upstream, so the limit trips mid-send
+		limitAliasBody(c, cfg)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseUrl+"/v1/embeddings", c.Request.Body)
+		if err != nil {
+			logError(log, "error when creating embeddings alias http request", prod, err)
+			JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to create embeddings alias http request")
+			return
+		}
+
+		copyHttpHeaders(c.Request, req, c.GetBool("removeUserAgent"))
+		setUpstreamDefaultHeaders(req, cfg)
+		setUpstreamApiKey(req, cfg)
+		forwardRequestId(c, req)
+		req.Header.Del("Accept-Encoding")
+
+		res, err := client.Do(req)
+		if isBodyTooLarge(err) {
+			JSON(c, http.StatusRequestEntityTooLarge, "[BricksLLM] request body is too large")
+			return
 		}
+		if err != nil {
+			logError(log, "error when sending http request to embeddings alias upstream", prod, err)
+			JSON(c, http.StatusInternalServerError, "[BricksLLM] failed to send http request to embeddings alias upstream")
+			return
+		}
+		defer res.Body.Close()
+
+		resBody, err := decodedAliasBody(res)
+		if err != nil {
+			logError(log, "error when decoding embeddings alias response body", prod, err)
+			JSON(c, http.StatusBadGateway, "[BricksLLM] failed to decode embeddings alias response body")
+			return
+		}
+		defer resBody.Close()
+
+		for name, values := range res.Header {
+			for _, value := range values {
+				c.Header(name, value)
+			}
+		}
+
 		c.Status(res.StatusCode)
-		_, _ = io.Copy(c.Writer, res.Body)
+		_, _ = io.Copy(c.Writer, resBody)
 	}
 }
@@ -0,0 +1,773 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/bricks-cloud/bricksllm/internal/util"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap"
+)
+
+func newAliasTestRouter(method, path string, handlers ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(getTimeoutMiddleware(time.Minute))
+	router.Use(func(c *gin.Context) {
+		util.SetLogToCtx(c, zap.NewNop())
+	})
+	router.Handle(method, path, handlers...)
+	return router
+}
+
+func TestEmbeddingsAliasHandler_ForwardsBodyUnmodified(t *testing.T) {
+	payload := []byte(`{"model":"text-embedding-3-small","input":["שלום","hello"]}`)
+
+	var gotPath string
+	var gotBody []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"list","data":[]}`))
+	}))
+	defer upstream.Close()
+
+	router := newAliasTestRouter(http.MethodPost, "/v1/embeddings", getEmbeddingsAliasHandler(false, http.Client{}, upstream.URL, AliasConfig{}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/embeddings", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if gotPath != "/v1/embeddings" {
+		t.Fatalf("expected upstream path /v1/embeddings, got %s", gotPath)
+	}
+	if !bytes.Equal(gotBody, payload) {
+		t.Fatalf("expected body %s to be forwarded unmodified, got %s", payload, gotBody)
+	}
+	if rec.Body.String() != `{"object":"list","data":[]}` {
+		t.Fatalf("unexpected response body %s", rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected content type application/json, got %s", ct)
+	}
+}
+
+type persistingStore struct {
+	conversationsStore
+	conv     postgresql.Conversation
+	messages []postgresql.Message
+}
+
+func (s *persistingStore) GetConversation(id string) (*postgresql.Conversation, error) {
+	return &s.conv, nil
+}
+
+// GetConversationPermission shares the conversation with no one.
+func (s *persistingStore) GetConversationPermission(id, userID string) (string, error) {
+	return "", missingConversation()
+}
+
+func (s *persistingStore) CreateMessage(m postgresql.Message) error {
+	s.messages = append(s.messages, m)
+	return nil
+}
+
+func TestChatCompletionAliasHandler_PersistsConversationTurns(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		response       string
+		stream         bool
+		expectedRoles  []string
+		expectedReply  string
+		expectedFinish string
+		expectedStatus int
+	}{
+		{
+			name:           "non streaming reply is stored",
+			status:         http.StatusOK,
+			response:       `{"choices":[{"message":{"role":"assistant","content":"שלום!"},"finish_reason":"stop"}]}`,
+			expectedRoles:  []string{"user", "assistant"},
+			expectedReply:  "שלום!",
+			expectedFinish: "stop",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "streaming reply is assembled from deltas",
+			status:         http.StatusOK,
+			stream:         true,
+			response:       "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"},\"finish_reason\":null}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"length\"}]}\n\ndata: [DONE]\n\n",
+			expectedRoles:  []string{"user", "assistant"},
+			expectedReply:  "Hello",
+			expectedFinish: "length",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "failed upstream keeps only the user message",
+			status:         http.StatusBadGateway,
+			response:       `{"error":{"message":"bad gateway"}}`,
+			expectedRoles:  []string{"user"},
+			expectedStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer upstream.Close()
+
+			store := &persistingStore{conv: postgresql.Conversation{ID: "conv-1"}}
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{}))
+
+			body := `{"model":"default","stream":` + strconv.FormatBool(tt.stream) + `,"messages":[{"role":"user","content":"hi"}]}`
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set(conversationIdHeader, "conv-1")
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if len(store.messages) != len(tt.expectedRoles) {
+				t.Fatalf("expected %d persisted messages, got %d", len(tt.expectedRoles), len(store.messages))
+			}
+			for i, role := range tt.expectedRoles {
+				if store.messages[i].Role != role {
+					t.Fatalf("expected message %d to have role %s, got %s", i, role, store.messages[i].Role)
+				}
+				if store.messages[i].ConversationID != "conv-1" {
+					t.Fatalf("expected message %d to belong to conv-1, got %s", i, store.messages[i].ConversationID)
+				}
+			}
+			if store.messages[0].Content != "hi" {
+				t.Fatalf("expected user content hi, got %s", store.messages[0].Content)
+			}
+			if len(tt.expectedRoles) == 2 && store.messages[1].Content != tt.expectedReply {
+				t.Fatalf("expected assistant content %s, got %s", tt.expectedReply, store.messages[1].Content)
+			}
+			if len(tt.expectedRoles) == 2 && store.messages[1].FinishReason != tt.expectedFinish {
+				t.Fatalf("expected finish reason %q, got %q", tt.expectedFinish, store.messages[1].FinishReason)
+			}
+			if len(tt.expectedRoles) == 2 && store.messages[1].Model != "default" {
+				t.Fatalf("expected the requested model to be stored, got %q", store.messages[1].Model)
+			}
+		})
+	}
+}
+
+func TestChatCompletionAliasHandler_OtherUsersConversation(t *testing.T) {
+	called := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer upstream.Close()
+
+	store := &persistingStore{conv: postgresql.Conversation{ID: "conv-1", UserID: "owner", SystemPrompt: "secret"}}
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set(conversationIdHeader, "conv-1")
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+	if called {
+		t.Fatal("expected another user's conversation not to reach the upstream")
+	}
+	if len(store.messages) != 0 {
+		t.Fatalf("expected nothing to be persisted, got %+v", store.messages)
+	}
+}
+
+func TestChatCompletionAliasHandler_ConversationOwnership(t *testing.T) {
+	tests := []struct {
+		name           string
+		store          *mockConversationsStore
+		expectedStatus int
+		expectedCalls  []string
+	}{
+		{
+			name: "missing conversation",
+			store: &mockConversationsStore{getConversationFunc: func(id string) (*postgresql.Conversation, error) {
+				return nil, missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetConversation"},
+		},
+		{
+			name: "another user's conversation",
+			store: &mockConversationsStore{getConversationFunc: otherConversation, getPermissionFunc: func(id, userID string) (string, error) {
+				return "", missingConversation()
+			}},
+			expectedStatus: http.StatusNotFound,
+			expectedCalls:  []string{"GetConversation", "GetConversationPermission"},
+		},
+		{
+			name: "read-only collaborator",
+			store: &mockConversationsStore{getConversationFunc: otherConversation, getPermissionFunc: func(id, userID string) (string, error) {
+				return postgresql.PermissionRead, nil
+			}},
+			expectedStatus: http.StatusForbidden,
+			expectedCalls:  []string{"GetConversation", "GetConversationPermission"},
+		},
+		{
+			name: "store error",
+			store: &mockConversationsStore{getConversationFunc: func(id string) (*postgresql.Conversation, error) {
+				return nil, failingStore()
+			}},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  []string{"GetConversation"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+			}))
+			defer upstream.Close()
+
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions",
+				func(c *gin.Context) { c.Set("userId", "user-1") },
+				getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), tt.store, nil, nil, nil, AliasConfig{}),
+			)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+			req.Header.Set(conversationIdHeader, "conv-1")
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if called {
+				t.Fatal("expected a rejected conversation not to reach the upstream")
+			}
+			if strings.Join(tt.store.calls, ",") != strings.Join(tt.expectedCalls, ",") {
+				t.Fatalf("expected store calls %v, got %v", tt.expectedCalls, tt.store.calls)
+			}
+		})
+	}
+}
+
+type keywordModerator struct {
+	blocked string
+}
+
+func (m keywordModerator) Check(ctx context.Context, text string) (bool, string, error) {
+	if strings.Contains(text, m.blocked) {
+		return false, "contains " + m.blocked, nil
+	}
+	return true, "", nil
+}
+
+func TestChatCompletionAliasHandler_Moderation(t *testing.T) {
+	called := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, AliasConfig{
+		Moderator: keywordModerator{blocked: "forbidden"},
+	}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages":[{"role":"user","content":"something forbidden"}]}`))
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnavailableForLegalReasons {
+		t.Fatalf("expected status 451, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "contains forbidden") {
+		t.Fatalf("expected the moderation reason in the response, got %s", rec.Body.String())
+	}
+	if called {
+		t.Fatal("expected a blocked prompt not to reach the upstream")
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages":[{"role":"user","content":"something fine"}]}`))
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || !called {
+		t.Fatalf("expected an allowed prompt to be forwarded, got status %d", rec.Code)
+	}
+}
+
+func TestChatCompletionAliasHandler_ReconstructsStreamingUsage(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hello there\"}}]}\n\ndata: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	store := &persistingStore{conv: postgresql.Conversation{ID: "conv-1"}}
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set(conversationIdHeader, "conv-1")
+	router.ServeHTTP(rec, req)
+
+	out := rec.Body.String()
+	usageAt := strings.Index(out, `"usage"`)
+	doneAt := strings.Index(out, "data: [DONE]")
+	if usageAt == -1 || doneAt == -1 || usageAt > doneAt {
+		t.Fatalf("expected a usage event before [DONE], got %q", out)
+	}
+	if !strings.Contains(out, `"estimated":true`) {
+		t.Fatalf("expected the usage event to be flagged as estimated, got %q", out)
+	}
+
+	if len(store.messages) != 2 {
+		t.Fatalf("expected 2 persisted messages, got %d", len(store.messages))
+	}
+	reply := store.messages[1]
+	if !reply.TokensEstimated || reply.CompletionTokens != estimateTokens("Hello there") || reply.PromptTokens == 0 {
+		t.Fatalf("expected estimated token counts on the reply, got %+v", reply)
+	}
+}
+
+func TestChatCompletionAliasHandler_PersistsToolResults(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"It is sunny."}}]}`))
+	}))
+	defer upstream.Close()
+
+	store := &persistingStore{conv: postgresql.Conversation{ID: "conv-1"}}
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), store, nil, nil, nil, AliasConfig{}))
+
+	body := `{"messages":[
+		{"role":"user","content":"weather?"},
+		{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{}"}}]},
+		{"role":"tool","tool_call_id":"call_1","name":"weather","content":"sunny"}
+	]}`
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set(conversationIdHeader, "conv-1")
+	router.ServeHTTP(rec, req)
+
+	if len(store.messages) != 2 {
+		t.Fatalf("expected the tool result and the reply to be persisted, got %d messages", len(store.messages))
+	}
+	tool := store.messages[0]
+	if tool.Role != "tool" || tool.ToolCallID != "call_1" || tool.Name != "weather" || tool.Content != "sunny" {
+		t.Fatalf("unexpected persisted tool message %+v", tool)
+	}
+	if store.messages[1].Role != "assistant" || store.messages[1].Content != "It is sunny." {
+		t.Fatalf("unexpected persisted reply %+v", store.messages[1])
+	}
+}
+
+func TestChatCompletionAliasHandler_ClientCancelPropagatesUpstream(t *testing.T) {
+	received := make(chan struct{})
+	upstreamCancelled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		close(received)
+		select {
+		case <-r.Context().Done():
+			close(upstreamCancelled)
+		case <-time.After(5 * time.Second):
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer upstream.Close()
+
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, AliasConfig{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o-mini","messages":[]}`)).WithContext(ctx)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case <-upstreamCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("expected a client disconnect to cancel the upstream request")
+	}
+}
+
+func TestChatCompletionAliasHandler_UpstreamStreamBreaksOff(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// a chunked reply that ends without its terminating chunk
+		event := "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n"
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/event-stream\r\nTransfer-Encoding: chunked\r\n\r\n")
+		buf.WriteString(strconv.FormatInt(int64(len(event)), 16) + "\r\n" + event + "\r\n")
+		buf.Flush()
+	}))
+	defer upstream.Close()
+
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, AliasConfig{}))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o-mini","stream":true,"messages":[]}`)))
+
+	events := strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n")
+	if len(events) != 2 || !strings.Contains(events[0], "Hel") {
+		t.Fatalf("expected the relayed chunk followed by an error event, got %q", rec.Body.String())
+	}
+	last := strings.TrimPrefix(events[1], "data: ")
+	if code := gjson.Get(last, "error.code").String(); code != "stream_interrupted" {
+		t.Fatalf("expected a stream_interrupted error event, got %q", events[1])
+	}
+}
+
+func TestStreamErrorEvent(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+
+	tests := []struct {
+		name            string
+		ctx             context.Context
+		err             error
+		expectedMessage string
+	}{
+		{
+			name:            "upstream read failure",
+			ctx:             context.Background(),
+			err:             &streamReadError{err: io.ErrUnexpectedEOF},
+			expectedMessage: "[BricksLLM] upstream stream ended unexpectedly",
+		},
+		{
+			name:            "upstream timeout",
+			ctx:             expired,
+			err:             &streamReadError{err: context.DeadlineExceeded},
+			expectedMessage: "[BricksLLM] upstream stream timed out",
+		},
+		{
+			name: "client cancelled",
+			ctx:  cancelled,
+			err:  &streamReadError{err: context.Canceled},
+		},
+		{
+			name: "client write failure",
+			ctx:  context.Background(),
+			err:  io.ErrClosedPipe,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := streamErrorEvent(tt.ctx, tt.err)
+			if len(tt.expectedMessage) == 0 {
+				if event != nil {
+					t.Fatalf("expected no error event, got %q", event)
+				}
+				return
+			}
+
+			message := gjson.GetBytes(bytes.TrimPrefix(event, []byte("data: ")), "error.message").String()
+			if message != tt.expectedMessage {
+				t.Fatalf("expected message %q, got %q", tt.expectedMessage, message)
+			}
+		})
+	}
+}
+
+func TestChatCompletionAliasHandler_ZeroTimeoutFallsBackToDefault(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions",
+		func(c *gin.Context) {
+			c.Set("requestTimeout", time.Duration(0))
+		},
+		getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, AliasConfig{}),
+	)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o-mini","messages":[]}`))
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected a zero timeout not to cancel the upstream call, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCompletionsAliasHandler_Forwards(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		response     string
+		contentType  string
+		expectedBody string
+	}{
+		{
+			name:         "non streaming",
+			body:         `{"model":"gpt-3.5-turbo-instruct","prompt":"Say hi"}`,
+			response:     `{"object":"text_completion","choices":[{"text":"hi"}]}`,
+			contentType:  "application/json",
+			expectedBody: `{"object":"text_completion","choices":[{"text":"hi"}]}`,
+		},
+		{
+			name:         "streaming",
+			body:         `{"model":"gpt-3.5-turbo-instruct","prompt":"Say hi","stream":true}`,
+			response:     "data: {\"choices\":[{\"text\":\"h\"}]}\n\ndata: {\"choices\":[{\"text\":\"i\"}]}\n\ndata: [DONE]\n\n",
+			contentType:  "text/event-stream",
+			expectedBody: "data: {\"choices\":[{\"text\":\"h\"}]}\n\ndata: {\"choices\":[{\"text\":\"i\"}]}\n\ndata: [DONE]\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotAccept string
+			var gotBody []byte
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotAccept = r.Header.Get("Accept")
+				gotBody, _ = io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.response))
+			}))
+			defer upstream.Close()
+
+			router := newAliasTestRouter(http.MethodPost, "/v1/completions", getCompletionsAliasHandler(false, http.Client{}, upstream.URL, AliasConfig{}))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(tt.body))
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rec.Code)
+			}
+			if gotPath != "/v1/completions" {
+				t.Fatalf("expected upstream path /v1/completions, got %s", gotPath)
+			}
+			if string(gotBody) != tt.body {
+				t.Fatalf("expected body %s to be forwarded, got %s", tt.body, gotBody)
+			}
+			if tt.contentType == "text/event-stream" && gotAccept != "text/event-stream" {
+				t.Fatalf("expected a streaming accept header, got %s", gotAccept)
+			}
+			if rec.Body.String() != tt.expectedBody {
+				t.Fatalf("expected response %q, got %q", tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestChatCompletionAliasHandler_DefaultModel(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		defaultModel  string
+		expectedModel string
+	}{
+		{name: "default placeholder is replaced", body: `{"model":"default","messages":[]}`, defaultModel: "gpt-4o-mini", expectedModel: "gpt-4o-mini"},
+		{name: "missing model is filled in", body: `{"messages":[]}`, defaultModel: "gpt-4o-mini", expectedModel: "gpt-4o-mini"},
+		{name: "empty model is filled in", body: `{"model":"","messages":[]}`, defaultModel: "gpt-4o-mini", expectedModel: "gpt-4o-mini"},
+		{name: "real model is kept", body: `{"model":"gpt-4o","messages":[]}`, defaultModel: "gpt-4o-mini", expectedModel: "gpt-4o"},
+		{name: "no default configured", body: `{"model":"default","messages":[]}`, expectedModel: "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody []byte
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotBody, _ = io.ReadAll(r.Body)
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+			defer upstream.Close()
+
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, AliasConfig{
+				DefaultModel: tt.defaultModel,
+			}))
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body)))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rec.Code)
+			}
+			if got := gjson.GetBytes(gotBody, "model").String(); got != tt.expectedModel {
+				t.Fatalf("expected model %s to be forwarded, got %s", tt.expectedModel, got)
+			}
+			if tt.expectedModel == "gpt-4o" && string(gotBody) != tt.body {
+				t.Fatalf("expected a body with a real model to be forwarded unmodified, got %s", gotBody)
+			}
+		})
+	}
+}
+
+func TestAliasHandlers_UpstreamApiKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		apiKey       string
+		expectedAuth string
+	}{
+		{name: "client bearer forwarded without a server key", expectedAuth: "Bearer client-key"},
+		{name: "server key replaces the client bearer", apiKey: "sk-server", expectedAuth: "Bearer sk-server"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAuth []string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+				w.Write([]byte(`{"choices":[],"data":[]}`))
+			}))
+			defer upstream.Close()
+
+			cfg := AliasConfig{UpstreamApiKey: tt.apiKey}
+			routes := map[string]gin.HandlerFunc{
+				"/v1/chat/completions": getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, cfg),
+				"/v1/completions":      getCompletionsAliasHandler(false, http.Client{}, upstream.URL, cfg),
+				"/v1/embeddings":       getEmbeddingsAliasHandler(false, http.Client{}, upstream.URL, cfg),
+			}
+			for path, handler := range routes {
+				router := newAliasTestRouter(http.MethodPost, path, handler)
+				req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"model":"gpt-4o","messages":[],"prompt":"hi","input":"hi"}`))
+				req.Header.Set("Authorization", "Bearer client-key")
+				router.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			if len(gotAuth) != len(routes) {
+				t.Fatalf("expected %d upstream requests, got %d", len(routes), len(gotAuth))
+			}
+			for _, auth := range gotAuth {
+				if auth != tt.expectedAuth {
+					t.Fatalf("expected upstream Authorization %q, got %q", tt.expectedAuth, auth)
+				}
+			}
+		})
+	}
+}
+
+func TestChatCompletionAliasHandler_AllowedModels(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		allowed        []string
+		defaultModel   string
+		expectedStatus int
+	}{
+		{name: "empty allowlist permits everything", body: `{"model":"gpt-4","messages":[]}`, expectedStatus: http.StatusOK},
+		{name: "allowed model", body: `{"model":"gpt-4o-mini","messages":[]}`, allowed: []string{"gpt-4o-mini"}, expectedStatus: http.StatusOK},
+		{name: "disallowed model", body: `{"model":"gpt-4","messages":[]}`, allowed: []string{"gpt-4o-mini", "gpt-3.5-turbo"}, expectedStatus: http.StatusForbidden},
+		{name: "injected default is checked", body: `{"model":"default","messages":[]}`, allowed: []string{"gpt-4o-mini"}, defaultModel: "gpt-4o-mini", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+			defer upstream.Close()
+
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, AliasConfig{
+				AllowedModels: tt.allowed,
+				DefaultModel:  tt.defaultModel,
+			}))
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus == http.StatusForbidden {
+				if called {
+					t.Fatal("expected a disallowed model not to reach the upstream")
+				}
+				if !strings.Contains(rec.Body.String(), "gpt-4o-mini, gpt-3.5-turbo") {
+					t.Fatalf("expected the allowed models to be listed, got %s", rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestAliasHandlers_BodySizeLimit(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	cfg := AliasConfig{MaxBodyBytes: 64}
+	tests := []struct {
+		name           string
+		path           string
+		handler        gin.HandlerFunc
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "chat body within the limit",
+			path:           "/v1/chat/completions",
+			handler:        getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, cfg),
+			body:           `{"messages":[]}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "chat body over the limit",
+			path:           "/v1/chat/completions",
+			handler:        getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, cfg),
+			body:           `{"messages":[{"role":"user","content":"` + strings.Repeat("a", 128) + `"}]}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "streamed embeddings body over the limit",
+			path:           "/v1/embeddings",
+			handler:        getEmbeddingsAliasHandler(false, http.Client{}, upstream.URL, cfg),
+			body:           `{"input":"` + strings.Repeat("a", 128) + `"}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newAliasTestRouter(http.MethodPost, tt.path, tt.handler)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
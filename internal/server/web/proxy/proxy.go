@@ -37,8 +37,11 @@ type PoliciesManager interface {
 }
 
 type ProxyServer struct {
-	server *http.Server
-	log    *zap.Logger
+	server   *http.Server
+	log      *zap.Logger
+	requests *shutdownCoordinator
+	// gracePeriod is how long Shutdown waits for in-flight requests.
+	gracePeriod time.Duration
 }
 
 type recorder interface {
@@ -61,35 +64,42 @@ type Scanner interface {
 	Scan(input []string) (*pii.Result, error)
 }
 
-func CorsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		a_or_b := func(a, b string) string {
-			if a != "" {
-				return a
-			} else {
-				return b
-			}
-		}
-		c.Header("Access-Control-Allow-Origin", a_or_b(c.GetHeader("Origin"), "*"))
-		if c.Request.Method == "OPTIONS" {
-			c.Header("Access-Control-Allow-Methods", a_or_b(c.GetHeader("Access-Control-Request-Method"), "*"))
-			c.Header("Access-Control-Allow-Headers", a_or_b(c.GetHeader("Access-Control-Request-Headers"), "*"))
-			c.Header("Access-Control-Max-Age", "3600")
-			c.AbortWithStatus(204)
-		}
-	}
-}
+// metricsPath serves the Prometheus registry. Scrapers are not expected to
+// hold a key, so it bypasses authentication.
+const metricsPath = "/metrics"
 
-func NewProxyServer(log *zap.Logger, mode, privacyMode string, c cache, m KeyManager, rm routeManager, a authenticator, psm ProviderSettingsManager, cpm CustomProvidersManager, ks keyStorage, e estimator, ae anthropicEstimator, aoe azureEstimator, v validator, r recorder, pub publisher, rlm rateLimitManager, timeout time.Duration, ac accessCache, uac userAccessCache, pm PoliciesManager, scanner Scanner, cd CustomPolicyDetector, die deepinfraEstimator, um userManager, removeAgentHeaders bool) (*ProxyServer, error) {
+func NewProxyServer(log *zap.Logger, mode, privacyMode string, c cache, m KeyManager, rm routeManager, a authenticator, psm ProviderSettingsManager, cpm CustomProvidersManager, ks keyStorage, e estimator, ae anthropicEstimator, aoe azureEstimator, v validator, r recorder, pub publisher, rlm rateLimitManager, timeout time.Duration, ac accessCache, uac userAccessCache, pm PoliciesManager, scanner Scanner, cd CustomPolicyDetector, die deepinfraEstimator, um userManager, removeAgentHeaders bool, shutdownGracePeriod time.Duration, aliasCfg AliasConfig) (*ProxyServer, error) {
 	router := gin.New()
 	prod := mode == "production"
 	private := privacyMode == "strict"
+	requests := newShutdownCoordinator()
 
-	router.Use(CorsMiddleware())
+	router.Use(requests.middleware())
+	router.Use(CorsMiddleware(aliasCfg.CORS))
 	router.Use(getTimeoutMiddleware(timeout))
+	router.Use(getRequestIdMiddleware())
+	router.Use(getUpstreamHeaderPolicyMiddleware(aliasCfg.UpstreamHeaders))
+	router.Use(getSignatureVerificationMiddleware(aliasCfg.Signature))
 	router.Use(getMiddleware(cpm, rm, pm, a, prod, private, log, pub, "proxy", ac, uac, http.Client{}, scanner, cd, um, removeAgentHeaders))
 
 	client := http.Client{}
+	aliasClient := newAliasHttpClient(aliasCfg)
+	aliasUpstreams, err := newAliasUpstreamPool(aliasCfg)
+	if err != nil {
+		return nil, err
+	}
+	aliasCfg.modelTimeouts, err = ParseModelTimeouts(aliasCfg.ModelTimeouts)
+	if err != nil {
+		return nil, err
+	}
+	aliasCfg.upstreamDefaultHeaders, err = ParseUpstreamDefaultHeaders(aliasCfg.UpstreamDefaultHeaders)
+	if err != nil {
+		return nil, err
+	}
+	aliasBaseUrl := aliasUpstreams.primary()
+	streams := newStreamRegistry()
+	exchanges := newExchangeRecorder(aliasCfg.DebugCaptureSize, aliasCfg.DebugCaptureMaxBodyBytes)
+	retryPayloads := newRetryPayloadStore(aliasCfg.RetryPayloadMaxCount, aliasCfg.RetryPayloadTTL)
 
 	// health check
 	router.POST("/api/health", getGetHealthCheckHandler())
@@ -97,12 +107,70 @@ func NewProxyServer(log *zap.Logger, mode, privacyMode string, c cache, m KeyMan
 	// health check
 	router.GET("/api/health", getGetHealthCheckHandler())
 
+	// prometheus metrics
+	if h := telemetry.Handler(); h != nil {
+		router.GET(metricsPath, gin.WrapH(h))
+	}
+
 	// conversations (versioned, internal)
-	ch := NewConversationHandler(ks.(*postgresql.Store))
+	cs := postgresql.NewInstrumentedStore(ks.(*postgresql.Store))
+	metadataSchema, err := ParseMetadataSchema(aliasCfg.MetadataSchema)
+	if err != nil {
+		return nil, err
+	}
+	defaultMetadata, err := ParseDefaultMetadata(aliasCfg.DefaultMetadata)
+	if err != nil {
+		return nil, err
+	}
+	if err := metadataSchema.validateDefaults(defaultMetadata); err != nil {
+		return nil, err
+	}
+	ch := NewConversationHandler(cs, WithMetadataSchema(metadataSchema), WithDefaultMetadata(defaultMetadata), WithAuditLog(cs), WithMessageDedupWindow(aliasCfg.MessageDedupWindow), WithMaxMessageContentLength(aliasCfg.MaxMessageContentLength), WithMessageSubscriber(aliasCfg.MessageEvents))
 	router.GET("/api/v1/conversations", ch.ListConversations)
 	router.POST("/api/v1/conversations", ch.CreateConversation)
+	router.DELETE("/api/v1/conversations/all", ch.DeleteAllConversations)
+	router.POST("/api/v1/conversations/bulk-delete", ch.DeleteConversations)
+	router.GET("/api/v1/conversations/sync", ch.SyncConversations)
+	router.GET("/api/v1/conversations/:id", ch.GetConversation)
+	router.DELETE("/api/v1/conversations/:id", ch.DeleteConversation)
+	router.POST("/api/v1/conversations/:id/restore", ch.RestoreConversation)
+	router.POST("/api/v1/conversations/from-template/:templateId", ch.CreateConversationFromTemplate)
+	router.GET("/api/v1/conversations/:id/export.md", ch.ExportConversationMarkdown)
+	router.PUT("/api/v1/conversations/:id/metadata", ch.UpdateConversationMetadata)
+	router.POST("/api/v1/conversations/:id/pin", ch.PinConversation)
+	router.POST("/api/v1/conversations/:id/archive", ch.ArchiveConversation)
+	router.POST("/api/v1/conversations/:id/unarchive", ch.UnarchiveConversation)
+	router.POST("/api/v1/conversations/:id/read", ch.MarkConversationRead)
+	router.POST("/api/v1/conversations/:id/autotitle", WithRequestTimeout(aliasCfg.RequestTimeout), getAutoTitleHandler(prod, aliasClient, aliasBaseUrl, cs, cs, newTitleLimiter(autoTitleInterval), aliasCfg))
+	router.POST("/api/v1/conversations/:id/fork", ch.ForkConversation)
+	router.POST("/api/v1/conversations/:id/merge", ch.MergeConversation)
+	router.GET("/api/v1/conversations/:id/collaborators", ch.ListCollaborators)
+	router.PUT("/api/v1/conversations/:id/collaborators/:userId", ch.GrantCollaborator)
+	router.DELETE("/api/v1/conversations/:id/collaborators/:userId", ch.RevokeCollaborator)
+	router.POST("/api/v1/conversations/:id/share", ch.CreateShareLink)
+	router.DELETE("/api/v1/conversations/:id/share", ch.RevokeShareLink)
 	router.GET("/api/v1/conversations/:id/messages", ch.ListMessages)
 	router.POST("/api/v1/conversations/:id/messages", ch.CreateMessage)
+	router.GET("/api/v1/conversations/:id/ws", ch.StreamMessages)
+	router.GET("/api/v1/conversations/:id/messages/:messageId/react", ch.GetMessageReaction)
+	router.POST("/api/v1/conversations/:id/messages/:messageId/react", ch.ReactToMessage)
+	router.PUT("/api/v1/conversations/:id/messages/:messageId/metadata", ch.UpdateMessageMetadata)
+	router.GET("/api/v1/conversations/:id/messages/:messageId/thread", ch.GetMessageThread)
+	router.POST("/api/v1/conversations/:id/regenerate", WithRequestTimeout(aliasCfg.RequestTimeout), getRegenerateHandler(prod, aliasClient, aliasBaseUrl, cs, aliasCfg))
+	router.POST("/api/v1/conversations/:id/continue", WithRequestTimeout(aliasCfg.RequestTimeout), getContinueHandler(prod, aliasClient, aliasBaseUrl, cs, aliasCfg))
+	router.PUT("/api/v1/conversations/:id/folder", ch.SetConversationFolder)
+	router.PUT("/api/v1/conversations/:id/params", ch.UpdateConversationParams)
+	router.GET("/api/v1/folders", ch.ListFolders)
+	router.POST("/api/v1/folders", ch.CreateFolder)
+	router.PUT("/api/v1/folders/:id", ch.RenameFolder)
+	router.DELETE("/api/v1/folders/:id", ch.DeleteFolder)
+	router.GET("/api/v1/templates", ch.ListTemplates)
+	router.POST("/api/v1/templates", ch.CreateTemplate)
+	router.DELETE("/api/v1/templates/:id", ch.DeleteTemplate)
+	router.GET("/api/v1/stats", ch.GetUserStats)
+	router.GET("/api/v1/stats/models", ch.GetUserModelUsage)
+	router.GET("/shared/:token", ch.GetSharedConversation)
+	router.GET("/admin/conversations", ch.AdminListConversations)
 
 	// audios
 	router.POST("/api/providers/openai/v1/audio/speech", getSpeechHandler(prod, client))
@@ -111,11 +179,22 @@ func NewProxyServer(log *zap.Logger, mode, privacyMode string, c cache, m KeyMan
 
 	// completions
 	router.POST("/api/providers/openai/v1/chat/completions", getChatCompletionHandler(prod, private, client, e))
-	router.POST("/v1/chat/completions", getChatCompletionAliasHandler(prod, private, client))
-	router.POST("/v1/completions", getCompletionHandler(prod, private, client))
+	chatRateLimit := getRateLimitMiddleware(newAliasRateLimiter(aliasCfg))
+	chatAlias := getChatCompletionAliasHandler(prod, private, aliasClient, aliasUpstreams, cs, streams, exchanges, retryPayloads, aliasCfg)
+	router.POST("/v1/chat/completions", chatRateLimit, WithRequestTimeout(aliasCfg.RequestTimeout), WithStreamRequestTimeout(aliasCfg.StreamRequestTimeout), chatAlias)
+	router.POST("/chat/cancel/:requestId", getStreamCancelHandler(streams))
+	if retryPayloads != nil {
+		router.POST("/chat/retry/:requestId", chatRateLimit, WithRequestTimeout(aliasCfg.RequestTimeout), WithStreamRequestTimeout(aliasCfg.StreamRequestTimeout), getChatRetryHandler(retryPayloads, chatAlias))
+	}
+	if exchanges != nil {
+		router.GET("/debug/exchanges", getDebugExchangesHandler(exchanges, aliasCfg.DebugCaptureToken))
+	}
+	router.POST("/v1/anthropic/chat/completions", WithRequestTimeout(aliasCfg.RequestTimeout), WithStreamRequestTimeout(aliasCfg.StreamRequestTimeout), getAnthropicChatCompletionAliasHandler(prod, aliasClient, anthropicAliasUpstream(aliasCfg), aliasCfg))
+	router.POST("/v1/completions", WithRequestTimeout(aliasCfg.RequestTimeout), WithStreamRequestTimeout(aliasCfg.StreamRequestTimeout), getCompletionsAliasHandler(prod, aliasClient, aliasBaseUrl, aliasCfg))
 
 	// embeddings
 	router.POST("/api/providers/openai/v1/embeddings", getEmbeddingHandler(prod, private, client, e))
+	router.POST("/v1/embeddings", getEmbeddingsAliasHandler(prod, aliasClient, aliasBaseUrl, aliasCfg))
 
 	// moderations
 	router.POST("/api/providers/openai/v1/moderations", getPassThroughHandler(prod, private, client))
@@ -125,6 +204,7 @@ func NewProxyServer(log *zap.Logger, mode, privacyMode string, c cache, m KeyMan
 	router.GET("/api/providers/openai/v1/models/:model", getPassThroughHandler(prod, private, client))
 	router.DELETE("/api/providers/openai/v1/models/:model", getPassThroughHandler(prod, private, client))
 	router.GET("/v1/models", getModelsAliasHandler())
+	router.POST("/tokenize", getTokenizeHandler())
 
 	// assistants
 	router.POST("/api/providers/openai/v1/assistants", getPassThroughHandler(prod, private, client))
@@ -237,8 +317,10 @@ func NewProxyServer(log *zap.Logger, mode, privacyMode string, c cache, m KeyMan
 	}
 
 	return &ProxyServer{
-		log:    log,
-		server: srv,
+		log:         log,
+		server:      srv,
+		requests:    requests,
+		gracePeriod: shutdownGracePeriod,
 	}, nil
 }
 
@@ -983,6 +1065,9 @@ func (ps *ProxyServer) Run() {
 
 		// health check
 		ps.log.Info("PORT 8002 | GET    | /api/health is ready")
+		if telemetry.Handler() != nil {
+			ps.log.Info("PORT 8002 | GET    | /metrics is ready")
+		}
 		ps.log.Info("PORT 8002 | GET    | /v1/models is ready")
 
 		// audio
@@ -993,6 +1078,7 @@ func (ps *ProxyServer) Run() {
 		// chat completions
 		ps.log.Info("PORT 8002 | POST   | /api/providers/openai/v1/chat/completions is ready for forwarding chat completion requests to openai")
 		ps.log.Info("PORT 8002 | POST   | /v1/chat/completions is ready for OpenAI-compatible chat completions")
+		ps.log.Info("PORT 8002 | POST   | /v1/anthropic/chat/completions is ready for OpenAI-compatible chat completions served by anthropic")
 		ps.log.Info("PORT 8002 | POST   | /v1/completions is ready for OpenAI-compatible completions")
 
 		// embeddings
@@ -1420,6 +1506,16 @@ func logError(log *zap.Logger, msg string, prod bool, err error) {
 	log.Debug(fmt.Sprintf("%s | %v", msg, err))
 }
 
+// Drain turns away new requests and waits up to the grace period for the
+// in-flight ones, e.g. streaming replies, to finish. It is meant to run
+// before Shutdown so deploys do not truncate assistant replies.
+func (ps *ProxyServer) Drain() {
+	ps.log.Sugar().Infof("draining in-flight proxy requests for up to %v", ps.gracePeriod)
+	if !ps.requests.drain(ps.gracePeriod) {
+		ps.log.Sugar().Infof("proxy requests still in flight after the %v grace period, closing anyway", ps.gracePeriod)
+	}
+}
+
 func (ps *ProxyServer) Shutdown(ctx context.Context) error {
 	if err := ps.server.Shutdown(ctx); err != nil {
 		ps.log.Sugar().Infof("error shutting down proxy server: %v", err)
@@ -1427,5 +1523,12 @@ func (ps *ProxyServer) Shutdown(ctx context.Context) error {
 		return err
 	}
 
+	// the metrics listener outlives the proxy so the drain stays observable
+	if err := telemetry.Shutdown(ctx); err != nil {
+		ps.log.Sugar().Infof("error shutting down prometheus metrics server: %v", err)
+
+		return err
+	}
+
 	return nil
 }
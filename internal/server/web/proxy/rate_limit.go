@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/key"
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitCleanupInterval is how often idle buckets are swept. A bucket is
+// idle once it would have refilled completely.
+const rateLimitCleanupInterval = time.Minute
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// clientRateLimiter is an in-memory token bucket limiter with one bucket per
+// client. Buckets refill at rate tokens per second up to burst.
+type clientRateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newClientRateLimiter(rate float64, burst int) *clientRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &clientRateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// allow takes a token from the client's bucket. When the bucket is empty it
+// returns false and how long until the next token is available.
+func (l *clientRateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitCleanupInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets that have refilled, they are equivalent to a new
+// bucket and only take up memory.
+func (l *clientRateLimiter) sweep(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for k, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, k)
+		}
+	}
+
+	l.lastSweep = now
+}
+
+// rateLimitClient identifies the caller by its API key when the request was
+// authenticated with one, and by its IP address otherwise.
+func rateLimitClient(c *gin.Context) string {
+	if raw, exists := c.Get("key"); exists {
+		if kc, ok := raw.(*key.ResponseKey); ok && kc != nil && len(kc.KeyId) != 0 {
+			return "key:" + kc.KeyId
+		}
+	}
+
+	return "ip:" + c.ClientIP()
+}
+
+// getRateLimitMiddleware throttles each client to the limiter's rate. A nil
+// limiter lets every request through.
+func getRateLimitMiddleware(limiter *clientRateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			return
+		}
+
+		allowed, retryAfter := limiter.allow(rateLimitClient(c))
+		if allowed {
+			return
+		}
+
+		telemetry.Incr("bricksllm.proxy.rate_limit_middleware.throttled", requestIdTags(c), 1)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		JSON(c, http.StatusTooManyRequests, "[BricksLLM] too many requests")
+		c.Abort()
+	}
+}
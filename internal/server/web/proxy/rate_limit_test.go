@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/key"
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newClientRateLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.allow("a"); !ok {
+			t.Fatalf("expected request %d to fit in the burst", i+1)
+		}
+	}
+
+	ok, retryAfter := limiter.allow("a")
+	if ok {
+		t.Fatal("expected the request past the burst to be throttled")
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Fatalf("expected a retry within a second, got %v", retryAfter)
+	}
+
+	if ok, _ := limiter.allow("b"); !ok {
+		t.Fatal("expected another client to have its own bucket")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := limiter.allow("a"); !ok {
+		t.Fatal("expected the bucket to refill over time")
+	}
+
+	now = now.Add(rateLimitCleanupInterval)
+	limiter.allow("c")
+	if _, ok := limiter.buckets["a"]; ok {
+		t.Fatal("expected idle buckets to be swept")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		keyIds        []string
+		expectedCodes []int
+	}{
+		{
+			name:          "same client is throttled",
+			keyIds:        []string{"", "", ""},
+			expectedCodes: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:          "keys are limited separately from the shared ip",
+			keyIds:        []string{"k1", "k1", "k2"},
+			expectedCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var keyId string
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions",
+				func(c *gin.Context) {
+					if len(keyId) != 0 {
+						c.Set("key", &key.ResponseKey{KeyId: keyId})
+					}
+				},
+				getRateLimitMiddleware(newClientRateLimiter(0.001, 2)),
+				func(c *gin.Context) {
+					c.Status(http.StatusOK)
+				},
+			)
+
+			for i, id := range tt.keyIds {
+				keyId = id
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+
+				if rec.Code != tt.expectedCodes[i] {
+					t.Fatalf("expected request %d to get status %d, got %d", i+1, tt.expectedCodes[i], rec.Code)
+				}
+				if rec.Code == http.StatusTooManyRequests && len(rec.Header().Get("Retry-After")) == 0 {
+					t.Fatal("expected a throttled response to carry Retry-After")
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware_DisabledWithoutRate(t *testing.T) {
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions",
+		getRateLimitMiddleware(newAliasRateLimiter(AliasConfig{})),
+		func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		},
+	)
+
+	for i := 0; i < 100; i++ {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected no limit without a configured rate, got %d", rec.Code)
+		}
+	}
+}
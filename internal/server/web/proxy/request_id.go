@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/bricks-cloud/bricksllm/internal/util"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestIdHeader       = "X-Request-Id"
+	maxRequestIdHeaderLen = 128
+)
+
+// validRequestId accepts client supplied ids that are short and printable,
+// so they cannot forge log lines or bloat headers.
+func validRequestId(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIdHeaderLen {
+		return false
+	}
+
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getRequestIdMiddleware adopts the client's X-Request-Id, or generates one,
+// as the request's correlation id and echoes it back, so a browser request
+// can be matched with proxy logs and upstream calls.
+func getRequestIdMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIdHeader)
+		if !validRequestId(id) {
+			id = util.NewUuid()
+		}
+
+		c.Set(util.STRING_CORRELATION_ID, id)
+		c.Header(requestIdHeader, id)
+	}
+}
+
+func requestIdTags(c *gin.Context) []string {
+	if id := c.GetString(util.STRING_CORRELATION_ID); len(id) != 0 {
+		return []string{"request_id:" + id}
+	}
+
+	return nil
+}
+
+// forwardRequestId passes the correlation id on to the upstream.
+func forwardRequestId(c *gin.Context, req *http.Request) {
+	if id := c.GetString(util.STRING_CORRELATION_ID); len(id) != 0 {
+		req.Header.Set(requestIdHeader, id)
+	}
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIdPropagation(t *testing.T) {
+	tests := []struct {
+		name       string
+		incoming   string
+		expectKept bool
+	}{
+		{name: "client id is kept", incoming: "browser-req-123", expectKept: true},
+		{name: "missing id is generated"},
+		{name: "malformed id is replaced", incoming: "bad id\twith spaces"},
+		{name: "oversized id is replaced", incoming: strings.Repeat("a", maxRequestIdHeaderLen+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstreamId string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamId = r.Header.Get(requestIdHeader)
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+			defer upstream.Close()
+
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions",
+				getRequestIdMiddleware(),
+				getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, AliasConfig{}),
+			)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages":[]}`))
+			if len(tt.incoming) != 0 {
+				req.Header.Set(requestIdHeader, tt.incoming)
+			}
+			router.ServeHTTP(rec, req)
+
+			echoed := rec.Header().Get(requestIdHeader)
+			if len(echoed) == 0 {
+				t.Fatal("expected the request id to be echoed back")
+			}
+			if upstreamId != echoed {
+				t.Fatalf("expected upstream to receive %s, got %s", echoed, upstreamId)
+			}
+			if tt.expectKept != (echoed == tt.incoming) {
+				t.Fatalf("unexpected request id %q for incoming %q", echoed, tt.incoming)
+			}
+		})
+	}
+}
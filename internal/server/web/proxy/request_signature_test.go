@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSignatureVerificationMiddleware(t *testing.T) {
+	body := `{"event":"ping"}`
+	signature := signRequestBody("secret", []byte(body))
+
+	tests := []struct {
+		name           string
+		cfg            SignatureConfig
+		path           string
+		header         string
+		signature      string
+		expectedStatus int
+	}{
+		{name: "valid signature", cfg: SignatureConfig{Secret: "secret"}, header: "X-Signature", signature: signature, expectedStatus: http.StatusOK},
+		{name: "prefixed signature", cfg: SignatureConfig{Secret: "secret"}, header: "X-Signature", signature: "sha256=" + strings.ToUpper(signature), expectedStatus: http.StatusOK},
+		{name: "custom header", cfg: SignatureConfig{Secret: "secret", Header: "X-Hub-Signature"}, header: "X-Hub-Signature", signature: signature, expectedStatus: http.StatusOK},
+		{name: "wrong secret", cfg: SignatureConfig{Secret: "secret"}, header: "X-Signature", signature: signRequestBody("other", []byte(body)), expectedStatus: http.StatusUnauthorized},
+		{name: "missing signature", cfg: SignatureConfig{Secret: "secret"}, expectedStatus: http.StatusUnauthorized},
+		{name: "no secret configured", expectedStatus: http.StatusOK},
+		{name: "health check", cfg: SignatureConfig{Secret: "secret"}, path: "/api/health", expectedStatus: http.StatusOK},
+		{name: "metrics", cfg: SignatureConfig{Secret: "secret"}, path: metricsPath, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path
+			if len(path) == 0 {
+				path = "/webhook"
+			}
+
+			var received string
+			router := newAliasTestRouter(http.MethodPost, path,
+				getSignatureVerificationMiddleware(tt.cfg),
+				func(c *gin.Context) {
+					data, _ := io.ReadAll(c.Request.Body)
+					received = string(data)
+					c.Status(http.StatusOK)
+				},
+			)
+
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			if len(tt.header) != 0 {
+				req.Header.Set(tt.header, tt.signature)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK && received != body {
+				t.Fatalf("expected the handler to read the full body, got %q", received)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/gin-gonic/gin"
+)
+
+// shutdownCoordinator tracks in-flight proxy requests so shutdown can let
+// them, streams in particular, finish before the server closes.
+type shutdownCoordinator struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	draining bool
+}
+
+func newShutdownCoordinator() *shutdownCoordinator {
+	return &shutdownCoordinator{}
+}
+
+// middleware counts the request as in flight until it completes. Once
+// draining has begun new requests are turned away with 503.
+func (s *shutdownCoordinator) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.mu.Lock()
+		if s.draining {
+			s.mu.Unlock()
+			telemetry.Incr("bricksllm.proxy.shutdown_middleware.rejected", nil, 1)
+			c.Header("Connection", "close")
+			JSON(c, http.StatusServiceUnavailable, "[BricksLLM] server is shutting down")
+			c.Abort()
+			return
+		}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		defer s.wg.Done()
+		c.Next()
+	}
+}
+
+// drain stops new requests and waits up to grace for the in-flight ones to
+// complete. It reports whether they all did.
+func (s *shutdownCoordinator) drain(grace time.Duration) bool {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(grace):
+		return false
+	}
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestShutdownCoordinator_DrainsInFlightRequests(t *testing.T) {
+	requests := newShutdownCoordinator()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions",
+		requests.middleware(),
+		func(c *gin.Context) {
+			close(started)
+			<-release
+			c.Status(http.StatusOK)
+		},
+	)
+
+	inFlight := httptest.NewRecorder()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		router.ServeHTTP(inFlight, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	}()
+	<-started
+
+	drained := make(chan bool)
+	go func() {
+		drained <- requests.drain(time.Second)
+	}()
+
+	// wait for draining to begin, then a new request must be turned away
+	for {
+		requests.mu.Lock()
+		draining := requests.draining
+		requests.mu.Unlock()
+		if draining {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected a new request during shutdown to get 503, got %d", rec.Code)
+	}
+
+	select {
+	case <-drained:
+		t.Fatal("expected drain to wait for the in-flight request")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if !<-drained {
+		t.Fatal("expected drain to report the in-flight request finished")
+	}
+	<-served
+	if inFlight.Code != http.StatusOK {
+		t.Fatalf("expected the in-flight request to complete, got %d", inFlight.Code)
+	}
+}
+
+func TestShutdownCoordinator_GivesUpAfterGracePeriod(t *testing.T) {
+	requests := newShutdownCoordinator()
+	requests.wg.Add(1)
+	defer requests.wg.Done()
+
+	start := time.Now()
+	if requests.drain(20 * time.Millisecond) {
+		t.Fatal("expected drain to report the request still in flight")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("expected drain to stop waiting at the grace period")
+	}
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/bricks-cloud/bricksllm/internal/key"
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/gin-gonic/gin"
+)
+
+// trackedStream is an in-flight streaming request and the key that sent it.
+type trackedStream struct {
+	keyId  string
+	cancel context.CancelFunc
+}
+
+// streamRegistry tracks the cancel functions of in-flight streaming
+// requests so a client can stop a generation from a separate request. A
+// stream can only be cancelled with the key that started it.
+type streamRegistry struct {
+	mu      sync.Mutex
+	streams map[string]*trackedStream
+}
+
+func newStreamRegistry() *streamRegistry {
+	return &streamRegistry{streams: map[string]*trackedStream{}}
+}
+
+// track registers cancel under id for keyId and returns the function that
+// removes it again once the request completes. It reports false, tracking
+// nothing, when another stream is already in flight under id, since clients
+// may choose their request ids.
+func (r *streamRegistry) track(id, keyId string, cancel context.CancelFunc) (func(), bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.streams[id]; ok {
+		return nil, false
+	}
+
+	stream := &trackedStream{keyId: keyId, cancel: cancel}
+	r.streams[id] = stream
+
+	return func() {
+		r.mu.Lock()
+		if r.streams[id] == stream {
+			delete(r.streams, id)
+		}
+		r.mu.Unlock()
+	}, true
+}
+
+// cancel aborts the request registered under id by keyId and reports
+// whether one was in flight. Streams of other keys are left running and
+// reported as unknown.
+func (r *streamRegistry) cancel(id, keyId string) bool {
+	r.mu.Lock()
+	stream, ok := r.streams[id]
+	ok = ok && stream.keyId == keyId
+	if ok {
+		delete(r.streams, id)
+	}
+	r.mu.Unlock()
+
+	if ok {
+		stream.cancel()
+	}
+
+	return ok
+}
+
+// callerKeyId returns the id of the key the auth middleware resolved.
+func callerKeyId(c *gin.Context) string {
+	if kc, ok := c.Get("key"); ok {
+		if k, ok := kc.(*key.ResponseKey); ok && k != nil {
+			return k.KeyId
+		}
+	}
+
+	return ""
+}
+
+func getStreamCancelHandler(streams *streamRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		telemetry.Incr("bricksllm.proxy.stream_cancel_handler.requests", nil, 1)
+
+		if !streams.cancel(c.Param("requestId"), callerKeyId(c)) {
+			JSON(c, http.StatusNotFound, "[BricksLLM] no streaming request in flight with this id")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("requestId"), "cancelled": true})
+	}
+}
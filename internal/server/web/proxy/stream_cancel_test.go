@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamCancelHandler_AbortsUpstream(t *testing.T) {
+	upstreamCancelled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-r.Context().Done():
+			close(upstreamCancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer upstream.Close()
+
+	streams := newStreamRegistry()
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, streams, nil, nil, AliasConfig{}))
+	router.POST("/chat/cancel/:requestId", getStreamCancelHandler(streams))
+	proxy := httptest.NewServer(router)
+	defer proxy.Close()
+
+	res, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"model":"default","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	requestId := res.Header.Get(requestIdHeader)
+	if len(requestId) == 0 {
+		t.Fatal("expected a request id header on the streaming response")
+	}
+
+	// wait for the first event so the stream is known to be in flight
+	if _, err := bufio.NewReader(res.Body).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelRes, err := http.Post(proxy.URL+"/chat/cancel/"+requestId, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelRes.Body.Close()
+	if cancelRes.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", cancelRes.StatusCode)
+	}
+
+	select {
+	case <-upstreamCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("expected cancelling the stream to abort the upstream request")
+	}
+
+	again, err := http.Post(proxy.URL+"/chat/cancel/"+requestId, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.Body.Close()
+	if again.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected a finished stream to be unknown, got %d", again.StatusCode)
+	}
+}
+
+func TestStreamRegistry_Cancel(t *testing.T) {
+	streams := newStreamRegistry()
+	cancelled := 0
+	release, ok := streams.track("req-1", "key-1", func() { cancelled++ })
+	if !ok {
+		t.Fatal("expected the stream to be tracked")
+	}
+	defer release()
+
+	if streams.cancel("req-1", "key-2") {
+		t.Fatal("expected another key not to cancel the stream")
+	}
+	if cancelled != 0 {
+		t.Fatal("expected the stream to keep running")
+	}
+	if !streams.cancel("req-1", "key-1") || cancelled != 1 {
+		t.Fatal("expected the key that started the stream to cancel it")
+	}
+	if streams.cancel("req-1", "key-1") {
+		t.Fatal("expected a cancelled stream to be unknown")
+	}
+}
+
+func TestStreamRegistry_DuplicateIds(t *testing.T) {
+	streams := newStreamRegistry()
+	release, ok := streams.track("req-1", "key-1", func() {})
+	if !ok {
+		t.Fatal("expected the stream to be tracked")
+	}
+	if _, ok := streams.track("req-1", "key-2", func() {}); ok {
+		t.Fatal("expected a second stream under the same id to be rejected")
+	}
+
+	// a stream tracked after a cancel must outlive the first one's release
+	streams.cancel("req-1", "key-1")
+	next, ok := streams.track("req-1", "key-2", func() {})
+	if !ok {
+		t.Fatal("expected the id to be free once the stream was cancelled")
+	}
+	defer next()
+	release()
+	if !streams.cancel("req-1", "key-2") {
+		t.Fatal("expected the first stream's release to leave the second in place")
+	}
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/tidwall/gjson"
+)
+
+// RenderSystemPrompt fills in the variables of a system prompt template.
+// Variables can be written as {{user_name}} or {{.user_name}}, and a
+// template referencing one that is not in vars fails instead of rendering
+// an empty string. Prompts without any "{{" are returned as they are.
+func RenderSystemPrompt(tmpl string, vars map[string]string) (string, error) {
+	if !strings.Contains(tmpl, "{{") {
+		return tmpl, nil
+	}
+
+	funcs := template.FuncMap{}
+	for name, value := range vars {
+		if isTemplateIdentifier(name) {
+			value := value
+			funcs[name] = func() string { return value }
+		}
+	}
+
+	t, err := template.New("system_prompt").Option("missingkey=error").Funcs(funcs).Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid system prompt template: %w", err)
+	}
+
+	sb := strings.Builder{}
+	if err := t.Execute(&sb, vars); err != nil {
+		return "", fmt.Errorf("invalid system prompt template: %w", err)
+	}
+
+	return sb.String(), nil
+}
+
+// isTemplateIdentifier reports whether name can be called as a template
+// function. Other metadata keys are still reachable with {{index . "key"}}.
+func isTemplateIdentifier(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// systemPromptVars collects the variables a conversation's system prompt
+// can use: the top level keys of its metadata, then the request values
+// user_id, conversation_id, title, date and time, which win over metadata
+// keys of the same name.
+func systemPromptVars(meta json.RawMessage, conversationID, title, userID string, now time.Time) map[string]string {
+	vars := map[string]string{}
+	if parsed := gjson.ParseBytes(meta); parsed.IsObject() {
+		parsed.ForEach(func(key, value gjson.Result) bool {
+			vars[key.String()] = value.String()
+			return true
+		})
+	}
+
+	vars["user_id"] = userID
+	vars["conversation_id"] = conversationID
+	vars["title"] = title
+	vars["date"] = now.UTC().Format(time.DateOnly)
+	vars["time"] = now.UTC().Format(time.RFC3339)
+
+	return vars
+}
+
+// conversationSystemPrompt renders conv's system prompt for a request made
+// by userID.
+func conversationSystemPrompt(conv *postgresql.Conversation, userID string) (string, error) {
+	return RenderSystemPrompt(conv.SystemPrompt, systemPromptVars(conv.Metadata, conv.ID, conv.Title, userID, time.Now()))
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRenderSystemPrompt(t *testing.T) {
+	vars := map[string]string{"user_name": "Dana", "date": "2024-05-14", "team-name": "search"}
+
+	tests := []struct {
+		name     string
+		tmpl     string
+		expected string
+		err      bool
+	}{
+		{name: "plain prompt", tmpl: "Be brief.", expected: "Be brief."},
+		{name: "function style variables", tmpl: "Talking to {{user_name}} on {{date}}.", expected: "Talking to Dana on 2024-05-14."},
+		{name: "field style variables", tmpl: "Talking to {{.user_name}}.", expected: "Talking to Dana."},
+		{name: "keys that are not identifiers", tmpl: `Team {{index . "team-name"}}.`, expected: "Team search."},
+		{name: "undefined function style variable", tmpl: "Hi {{nickname}}.", err: true},
+		{name: "undefined field style variable", tmpl: "Hi {{.nickname}}.", err: true},
+		{name: "malformed template", tmpl: "Hi {{user_name", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderSystemPrompt(tt.tmpl, vars)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSystemPromptVars(t *testing.T) {
+	now := time.Date(2024, 5, 14, 9, 30, 0, 0, time.UTC)
+	vars := systemPromptVars(json.RawMessage(`{"user_name":"Dana","user_id":"spoofed","age":30}`), "conv-1", "hello", "user-1", now)
+
+	expected := map[string]string{
+		"user_name":       "Dana",
+		"age":             "30",
+		"user_id":         "user-1",
+		"conversation_id": "conv-1",
+		"title":           "hello",
+		"date":            "2024-05-14",
+		"time":            "2024-05-14T09:30:00Z",
+	}
+	for key, value := range expected {
+		if vars[key] != value {
+			t.Fatalf("expected %s to be %q, got %q", key, value, vars[key])
+		}
+	}
+}
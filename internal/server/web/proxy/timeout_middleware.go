@@ -1,12 +1,38 @@
 package proxy
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// maxRequestTimeout caps the timeout a client can ask for through the
+// x-request-timeout header.
+const maxRequestTimeout = 10 * time.Minute
+
+// parseTimeoutHeader returns the clamped x-request-timeout override, if the
+// client sent one.
+func parseTimeoutHeader(c *gin.Context) (time.Duration, bool, error) {
+	timeoutHeader := c.GetHeader("x-request-timeout")
+	if len(timeoutHeader) == 0 {
+		return 0, false, nil
+	}
+
+	parsed, err := time.ParseDuration(timeoutHeader)
+	if err != nil || parsed <= 0 {
+		return 0, false, err
+	}
+
+	if parsed > maxRequestTimeout {
+		parsed = maxRequestTimeout
+	}
+
+	return parsed, true, nil
+}
+
 func getTimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if c == nil || c.Request == nil {
@@ -15,19 +41,102 @@ func getTimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
 			return
 		}
 
-		timeoutHeader := c.GetHeader("x-request-timeout")
 		parsedTimeout := timeout
-		if len(timeoutHeader) != 0 {
-			parsed, err := time.ParseDuration(timeoutHeader)
-			if err != nil {
-				JSON(c, http.StatusBadRequest, "[BricksLLM] invalid timeout")
-				c.Abort()
-				return
-			}
+		parsed, ok, err := parseTimeoutHeader(c)
+		if err != nil {
+			JSON(c, http.StatusBadRequest, "[BricksLLM] invalid timeout")
+			c.Abort()
+			return
+		}
 
+		if ok {
 			parsedTimeout = parsed
 		}
 
 		c.Set("requestTimeout", parsedTimeout)
 	}
 }
+
+// WithRequestTimeout overrides the server wide request timeout for a single
+// route. A zero duration keeps the server wide timeout, and an
+// x-request-timeout header still takes precedence.
+func WithRequestTimeout(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok, _ := parseTimeoutHeader(c); ok || d <= 0 {
+			return
+		}
+
+		c.Set("requestTimeout", d)
+	}
+}
+
+// WithStreamRequestTimeout sets the timeout used instead of the request
+// timeout when the route serves a streaming response, which legitimately
+// stays open much longer than a single JSON reply.
+func WithStreamRequestTimeout(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok, _ := parseTimeoutHeader(c); ok || d <= 0 {
+			return
+		}
+
+		c.Set("streamRequestTimeout", d)
+	}
+}
+
+// requestTimeoutFor picks the timeout a handler should apply once it knows
+// whether the response is streamed.
+func requestTimeoutFor(c *gin.Context, streaming bool) time.Duration {
+	timeout := c.GetDuration("requestTimeout")
+	if streaming {
+		if st := c.GetDuration("streamRequestTimeout"); st > timeout {
+			return st
+		}
+	}
+
+	return timeout
+}
+
+// ParseModelTimeouts reads "model=duration" entries, e.g. "llama-70b=15m".
+// The model is everything before the last "=", as model names like
+// "llama3:8b" may contain other separators.
+func ParseModelTimeouts(entries []string) (map[string]time.Duration, error) {
+	var timeouts map[string]time.Duration
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("model timeout entry %q must look like model=duration", entry)
+		}
+		model := strings.TrimSpace(entry[:i])
+		timeout, err := time.ParseDuration(strings.TrimSpace(entry[i+1:]))
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("model timeout entry %q has an invalid duration", entry)
+		}
+
+		if timeouts == nil {
+			timeouts = map[string]time.Duration{}
+		}
+		timeouts[model] = timeout
+	}
+
+	return timeouts, nil
+}
+
+// applyModelTimeout replaces the request and stream timeouts with the one
+// configured for model. An x-request-timeout header still takes precedence.
+func applyModelTimeout(c *gin.Context, timeouts map[string]time.Duration, model string) {
+	timeout, ok := timeouts[model]
+	if !ok {
+		return
+	}
+	if _, set, _ := parseTimeoutHeader(c); set {
+		return
+	}
+
+	c.Set("requestTimeout", timeout)
+	c.Set("streamRequestTimeout", timeout)
+}
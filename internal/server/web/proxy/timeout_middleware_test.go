@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChatCompletionAliasHandler_CancelsSlowUpstreamAtDeadline(t *testing.T) {
+	upstreamDone := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(upstreamDone)
+		// the server only notices a closed connection once the body is consumed
+		io.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer upstream.Close()
+
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions",
+		WithRequestTimeout(50*time.Millisecond),
+		getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, AliasConfig{}),
+	)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o-mini","messages":[]}`))
+	start := time.Now()
+	router.ServeHTTP(rec, req)
+	elapsed := time.Since(start)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if elapsed > time.Second {
+		t.Fatalf("expected the upstream call to be cancelled at the 50ms deadline, took %v", elapsed)
+	}
+
+	select {
+	case <-upstreamDone:
+	case <-time.After(time.Second):
+		t.Fatal("expected the upstream request to observe the cancellation")
+	}
+}
+
+func TestRequestTimeoutFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		streaming bool
+		expected  time.Duration
+	}{
+		{name: "route timeout", expected: 30 * time.Second},
+		{name: "stream timeout", streaming: true, expected: 5 * time.Minute},
+		{name: "header override", header: "2s", expected: 2 * time.Second},
+		{name: "header override applies to streams", header: "2s", streaming: true, expected: 2 * time.Second},
+		{name: "header is clamped", header: "24h", expected: maxRequestTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got time.Duration
+			router := newAliasTestRouter(http.MethodGet, "/",
+				WithRequestTimeout(30*time.Second),
+				WithStreamRequestTimeout(5*time.Minute),
+				func(c *gin.Context) {
+					got = requestTimeoutFor(c, tt.streaming)
+				},
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if len(tt.header) != 0 {
+				req.Header.Set("x-request-timeout", tt.header)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.expected {
+				t.Fatalf("expected timeout %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseModelTimeouts(t *testing.T) {
+	timeouts, err := ParseModelTimeouts([]string{"llama3:70b=15m", " gpt-4o-mini = 30s ", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeouts["llama3:70b"] != 15*time.Minute || timeouts["gpt-4o-mini"] != 30*time.Second || len(timeouts) != 2 {
+		t.Fatalf("unexpected timeouts %v", timeouts)
+	}
+
+	for _, entry := range []string{"llama3", "=15m", "llama3=soon", "llama3=-1s"} {
+		if _, err := ParseModelTimeouts([]string{entry}); err == nil {
+			t.Fatalf("expected %q to be rejected", entry)
+		}
+	}
+}
+
+func TestApplyModelTimeout(t *testing.T) {
+	timeouts := map[string]time.Duration{"llama3:70b": 15 * time.Minute}
+
+	tests := []struct {
+		name      string
+		model     string
+		header    string
+		streaming bool
+		expected  time.Duration
+	}{
+		{name: "configured model", model: "llama3:70b", expected: 15 * time.Minute},
+		{name: "configured model streaming", model: "llama3:70b", streaming: true, expected: 15 * time.Minute},
+		{name: "other model", model: "gpt-4o-mini", expected: 30 * time.Second},
+		{name: "header override", model: "llama3:70b", header: "2s", expected: 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got time.Duration
+			router := newAliasTestRouter(http.MethodGet, "/",
+				WithRequestTimeout(30*time.Second),
+				WithStreamRequestTimeout(5*time.Minute),
+				func(c *gin.Context) {
+					applyModelTimeout(c, timeouts, tt.model)
+					got = requestTimeoutFor(c, tt.streaming)
+				},
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if len(tt.header) != 0 {
+				req.Header.Set("x-request-timeout", tt.header)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.expected {
+				t.Fatalf("expected timeout %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+)
+
+// TokenEstimator returns the number of tokens text takes up for a model's
+// tokenizer. It lets history trimming use an exact tokenizer once one is
+// wired in instead of the character based estimate.
+type TokenEstimator func(text string) int
+
+// estimateTokens approximates a token count without a tokenizer, assuming
+// roughly four characters per token. Counts derived from it are reported as
+// estimated wherever they surface.
+func estimateTokens(text string) int {
+	n := utf8.RuneCountInString(text)
+	if n == 0 {
+		return 0
+	}
+
+	return (n + 3) / 4
+}
+
+// estimatePromptTokens approximates the prompt size of a chat completion
+// request, including the few tokens of framing every message carries.
+func estimatePromptTokens(body []byte) int {
+	total := 3
+	for _, m := range gjson.GetBytes(body, "messages").Array() {
+		total += 4 + estimateTokens(m.Get("content").String())
+	}
+
+	return total
+}
+
+// tokenStrategy estimates token counts for a family of models from how many
+// characters their tokenizers fit into a token. Scripts other than Latin,
+// such as Hebrew, split into far more tokens per character.
+type tokenStrategy struct {
+	family             string
+	latinCharsPerToken float64
+	otherCharsPerToken float64
+	// messageOverhead is the framing every chat message adds.
+	messageOverhead int
+}
+
+var defaultTokenStrategy = tokenStrategy{family: "generic", latinCharsPerToken: 4, otherCharsPerToken: 4, messageOverhead: 4}
+
+// tokenStrategies are matched in order against the start of a model name.
+var tokenStrategies = []struct {
+	prefixes []string
+	strategy tokenStrategy
+}{
+	{
+		prefixes: []string{"gpt-4o", "gpt-4.1", "gpt-5", "o1", "o3", "o4"},
+		strategy: tokenStrategy{family: "openai-o200k", latinCharsPerToken: 4.2, otherCharsPerToken: 2.5, messageOverhead: 4},
+	},
+	{
+		prefixes: []string{"gpt-"},
+		strategy: tokenStrategy{family: "openai-cl100k", latinCharsPerToken: 4, otherCharsPerToken: 1.5, messageOverhead: 4},
+	},
+	{
+		prefixes: []string{"claude"},
+		strategy: tokenStrategy{family: "claude", latinCharsPerToken: 3.5, otherCharsPerToken: 1.5, messageOverhead: 5},
+	},
+	{
+		prefixes: []string{"llama", "meta-llama", "mistral", "mixtral", "qwen", "gemma", "dicta"},
+		strategy: tokenStrategy{family: "open-weights", latinCharsPerToken: 3.5, otherCharsPerToken: 2, messageOverhead: 5},
+	},
+}
+
+// tokenStrategyFor picks the strategy of model's family, falling back to
+// the generic four characters per token.
+func tokenStrategyFor(model string) tokenStrategy {
+	model = strings.ToLower(model)
+	for _, s := range tokenStrategies {
+		for _, prefix := range s.prefixes {
+			if strings.HasPrefix(model, prefix) {
+				return s.strategy
+			}
+		}
+	}
+
+	return defaultTokenStrategy
+}
+
+// count estimates the tokens text takes up.
+func (s tokenStrategy) count(text string) int {
+	latin, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			latin++
+		} else {
+			other++
+		}
+	}
+	if latin+other == 0 {
+		return 0
+	}
+
+	return int(math.Ceil(float64(latin)/s.latinCharsPerToken + float64(other)/s.otherCharsPerToken))
+}
+
+// countMessages estimates the prompt size of chat messages, whose content
+// is either a string or an array of parts of which only text is counted.
+func (s tokenStrategy) countMessages(messages gjson.Result) int {
+	total := 3
+	for _, m := range messages.Array() {
+		total += s.messageOverhead + s.count(m.Get("name").String())
+		content := m.Get("content")
+		if !content.IsArray() {
+			total += s.count(content.String())
+			continue
+		}
+		for _, part := range content.Array() {
+			if part.Get("type").String() == "text" {
+				total += s.count(part.Get("text").String())
+			}
+		}
+	}
+
+	return total
+}
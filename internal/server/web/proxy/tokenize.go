@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// getTokenizeHandler estimates how many tokens a text or chat messages take
+// up for a model without calling it, e.g. for a counter shown while typing.
+// No tokenizer is run, so the count is always reported as an estimate.
+func getTokenizeHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		telemetry.Incr("bricksllm.proxy.tokenize_handler.requests", nil, 1)
+
+		var req struct {
+			Model    string          `json:"model"`
+			Text     *string         `json:"text"`
+			Messages json.RawMessage `json:"messages"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			JSON(c, http.StatusBadRequest, "[BricksLLM] invalid tokenize request body")
+			return
+		}
+		messages := gjson.ParseBytes(req.Messages)
+		if (req.Text == nil) == (len(req.Messages) == 0) {
+			JSON(c, http.StatusBadRequest, "[BricksLLM] tokenize requires either text or messages")
+			return
+		}
+		if len(req.Messages) != 0 && !messages.IsArray() {
+			JSON(c, http.StatusBadRequest, "[BricksLLM] messages must be an array")
+			return
+		}
+
+		strategy := tokenStrategyFor(req.Model)
+		tokens := 0
+		if req.Text != nil {
+			tokens = strategy.count(*req.Text)
+		} else {
+			tokens = strategy.countMessages(messages)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"model":     req.Model,
+			"family":    strategy.family,
+			"tokens":    tokens,
+			"estimated": true,
+		})
+	}
+}
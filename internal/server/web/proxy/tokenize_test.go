@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTokenStrategyFor(t *testing.T) {
+	tests := map[string]string{
+		"gpt-4o-mini":         "openai-o200k",
+		"gpt-3.5-turbo":       "openai-cl100k",
+		"claude-3-5-sonnet":   "claude",
+		"Meta-Llama-3-8B":     "open-weights",
+		"dictalm2.0-instruct": "open-weights",
+		"some-unknown-model":  "generic",
+		"":                    "generic",
+	}
+
+	for model, family := range tests {
+		if got := tokenStrategyFor(model).family; got != family {
+			t.Fatalf("%q: expected family %s, got %s", model, family, got)
+		}
+	}
+}
+
+func TestTokenStrategy_Count(t *testing.T) {
+	s := tokenStrategyFor("gpt-3.5-turbo")
+	if got := s.count(""); got != 0 {
+		t.Fatalf("expected no tokens for empty text, got %d", got)
+	}
+	if got := s.count("abcdefgh"); got != 2 {
+		t.Fatalf("expected 2 tokens, got %d", got)
+	}
+	// Hebrew splits into more tokens than Latin text of the same length
+	if latin, hebrew := s.count("shalom olam"), s.count("שלום עולם יפה"); hebrew <= latin {
+		t.Fatalf("expected hebrew to take more tokens, got %d for latin and %d for hebrew", latin, hebrew)
+	}
+}
+
+func TestTokenizeHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedTokens int
+	}{
+		{
+			name:           "text",
+			body:           `{"model":"gpt-3.5-turbo","text":"abcdefgh"}`,
+			expectedStatus: http.StatusOK,
+			expectedTokens: 2,
+		},
+		{
+			name:           "messages",
+			body:           `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"abcd"},{"role":"user","content":[{"type":"text","text":"abcd"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]}`,
+			expectedStatus: http.StatusOK,
+			expectedTokens: 3 + 2*(4+1),
+		},
+		{
+			name:           "neither text nor messages",
+			body:           `{"model":"gpt-3.5-turbo"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "both text and messages",
+			body:           `{"text":"hi","messages":[]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "messages is not an array",
+			body:           `{"messages":{"role":"user"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid body",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newAliasTestRouter(http.MethodPost, "/tokenize", getTokenizeHandler())
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tokenize", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var res struct {
+				Tokens    int  `json:"tokens"`
+				Estimated bool `json:"estimated"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Tokens != tt.expectedTokens || !res.Estimated {
+				t.Fatalf("expected an estimate of %d tokens, got %s", tt.expectedTokens, rec.Body.String())
+			}
+		})
+	}
+}
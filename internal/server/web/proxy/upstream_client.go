@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// newAliasHttpClient builds the client shared by the alias routes. A single
+// tuned transport keeps idle upstream connections around instead of dialing
+// per request, which matters once a deployment pushes real traffic. In mock
+// mode no upstream is called at all.
+func newAliasHttpClient(cfg AliasConfig) http.Client {
+	if cfg.MockMode {
+		return http.Client{Transport: &mockUpstream{delay: cfg.MockTokenDelay}}
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	return http.Client{Transport: transport}
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAliasHttpClient_ReusesIdleConnections(t *testing.T) {
+	var dials int32
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"list","data":[]}`))
+	}))
+	upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&dials, 1)
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+
+	client := newAliasHttpClient(AliasConfig{
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     time.Minute,
+	})
+	router := newAliasTestRouter(http.MethodPost, "/v1/embeddings", getEmbeddingsAliasHandler(false, client, upstream.URL, AliasConfig{}))
+
+	for i := 0; i < 50; i++ {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/embeddings", bytes.NewReader([]byte(`{"input":"hi"}`)))
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status 200, got %d", i, rec.Code)
+		}
+	}
+
+	if n := atomic.LoadInt32(&dials); n != 1 {
+		t.Fatalf("expected a single upstream connection to be reused, got %d", n)
+	}
+}
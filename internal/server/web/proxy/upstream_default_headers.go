@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ParseUpstreamDefaultHeaders reads "name=value" entries, e.g.
+// "OpenAI-Organization=org-123", into the headers sent with every alias
+// request upstream. The name ends at the first "=", the value may hold more.
+func ParseUpstreamDefaultHeaders(entries []string) (http.Header, error) {
+	var headers http.Header
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		name, value, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || len(name) == 0 || strings.ContainsAny(name, " \t:") {
+			return nil, fmt.Errorf("upstream header entry %q must look like name=value", entry)
+		}
+
+		if headers == nil {
+			headers = http.Header{}
+		}
+		headers.Set(name, strings.TrimSpace(value))
+	}
+
+	return headers, nil
+}
+
+// setUpstreamDefaultHeaders sets the configured default headers on req. It
+// runs after copyHttpHeaders so they replace what the client sent.
+func setUpstreamDefaultHeaders(req *http.Request, cfg AliasConfig) {
+	for name, values := range cfg.upstreamDefaultHeaders {
+		req.Header[name] = append([]string(nil), values...)
+	}
+}
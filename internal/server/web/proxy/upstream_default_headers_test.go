@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseUpstreamDefaultHeaders(t *testing.T) {
+	headers, err := ParseUpstreamDefaultHeaders([]string{" OpenAI-Organization = org-123 ", "anthropic-version=2023-06-01", "X-Token=a=b", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headers.Get("Openai-Organization") != "org-123" || headers.Get("Anthropic-Version") != "2023-06-01" || headers.Get("X-Token") != "a=b" {
+		t.Fatalf("unexpected headers %v", headers)
+	}
+
+	for _, entry := range []string{"OpenAI-Organization", "=org-123", "Bad Name=1", "Bad:Name=1"} {
+		if _, err := ParseUpstreamDefaultHeaders([]string{entry}); err == nil {
+			t.Fatalf("expected %q to be rejected", entry)
+		}
+	}
+
+	headers, err = ParseUpstreamDefaultHeaders(nil)
+	if err != nil || headers != nil {
+		t.Fatalf("expected no headers, got %v (%v)", headers, err)
+	}
+}
+
+func TestChatCompletionAliasHandler_UpstreamDefaultHeaders(t *testing.T) {
+	var received http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer upstream.Close()
+
+	cfg := AliasConfig{UpstreamApiKey: "sk-upstream"}
+	var err error
+	cfg.upstreamDefaultHeaders, err = ParseUpstreamDefaultHeaders([]string{"OpenAI-Organization=org-123", "anthropic-version=2023-06-01", "Authorization=Bearer sk-default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(upstream.URL), nil, nil, nil, nil, cfg))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("OpenAI-Organization", "org-client")
+	req.Header.Set("X-Custom", "1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if received == nil {
+		t.Fatal("expected the request to reach the upstream")
+	}
+	if values := received.Values("Openai-Organization"); len(values) != 1 || values[0] != "org-123" {
+		t.Fatalf("expected the configured header to replace the client's, got %v", values)
+	}
+	if received.Get("Anthropic-Version") != "2023-06-01" {
+		t.Fatalf("expected the configured header to be added, got %v", received)
+	}
+	if received.Get("X-Custom") != "1" {
+		t.Fatalf("expected other client headers to be kept, got %v", received)
+	}
+	if received.Get("Authorization") != "Bearer sk-upstream" {
+		t.Fatalf("expected the upstream API key to win over default headers, got %q", received.Get("Authorization"))
+	}
+}
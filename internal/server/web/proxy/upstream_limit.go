@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+)
+
+// errUpstreamBusy is returned instead of calling upstreams that are all at
+// their concurrency limit.
+var errUpstreamBusy = errors.New("upstreams are at their concurrency limit")
+
+// upstreamLimiter caps the requests in flight to one upstream, for model
+// servers such as a single GPU llama.cpp that cannot serve many at once. A
+// request holds its slot until its reply has been read. A nil
+// upstreamLimiter has no cap.
+type upstreamLimiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+// newUpstreamLimiter returns nil unless max is positive. A zero
+// queueTimeout turns requests away as soon as max are in flight, otherwise
+// they wait up to queueTimeout for a slot.
+func newUpstreamLimiter(max int, queueTimeout time.Duration) *upstreamLimiter {
+	if max <= 0 {
+		return nil
+	}
+
+	return &upstreamLimiter{slots: make(chan struct{}, max), queueTimeout: queueTimeout}
+}
+
+// acquire takes a slot, queueing for one if wait is set. It reports false
+// when no slot was free, or freed up before the queue timeout or ctx ended.
+func (l *upstreamLimiter) acquire(ctx context.Context, wait bool, tags []string) bool {
+	if l == nil {
+		return true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if !wait || l.queueTimeout <= 0 {
+		telemetry.Incr("bricksllm.proxy.upstream_pool.queue.rejected", tags, 1)
+		return false
+	}
+
+	telemetry.Incr("bricksllm.proxy.upstream_pool.queue.enqueued", tags, 1)
+	start := time.Now()
+	defer func() {
+		telemetry.Incr("bricksllm.proxy.upstream_pool.queue.dequeued", tags, 1)
+		telemetry.Timing("bricksllm.proxy.upstream_pool.queue.wait", time.Since(start), tags, 1)
+	}()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		telemetry.Incr("bricksllm.proxy.upstream_pool.queue.rejected", tags, 1)
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *upstreamLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
+
+// do sends req with a slot already acquired, which is released once the
+// reply is closed or right away when there is none.
+func (l *upstreamLimiter) do(client http.Client, req *http.Request) (*http.Response, error) {
+	res, err := client.Do(req)
+	if err != nil {
+		l.release()
+		return nil, err
+	}
+
+	if l != nil {
+		res.Body = &releasingBody{ReadCloser: res.Body, release: l.release}
+	}
+	return res, nil
+}
+
+// releasingBody gives back a request's slot once its reply is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamLimiter(t *testing.T) {
+	require.True(t, (*upstreamLimiter)(nil).acquire(context.Background(), true, nil))
+	require.Nil(t, newUpstreamLimiter(0, time.Second))
+
+	l := newUpstreamLimiter(1, 0)
+	require.True(t, l.acquire(context.Background(), true, nil))
+	require.False(t, l.acquire(context.Background(), true, nil))
+	l.release()
+	require.True(t, l.acquire(context.Background(), false, nil))
+}
+
+func TestUpstreamLimiter_Queue(t *testing.T) {
+	l := newUpstreamLimiter(1, time.Second)
+	require.True(t, l.acquire(context.Background(), true, nil))
+	require.False(t, l.acquire(context.Background(), false, nil), "expected no queueing without wait")
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		l.release()
+	}()
+	require.True(t, l.acquire(context.Background(), true, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.False(t, l.acquire(ctx, true, nil))
+
+	short := newUpstreamLimiter(1, 10*time.Millisecond)
+	require.True(t, short.acquire(context.Background(), true, nil))
+	require.False(t, short.acquire(context.Background(), true, nil))
+}
+
+func TestChatCompletionAliasHandler_UpstreamConcurrencyLimit(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	proceed := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-proceed
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstream.Close()
+
+	cfg := AliasConfig{BaseUrls: []string{upstream.URL}, UpstreamMaxConcurrency: 1}
+	upstreams, err := newAliasUpstreamPool(cfg)
+	require.NoError(t, err)
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, upstreams, nil, nil, nil, nil, cfg))
+
+	send := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"llama","messages":[]}`)))
+		return rec
+	}
+
+	first := make(chan int)
+	go func() { first <- send().Code }()
+	<-arrived
+
+	rec := send()
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Contains(t, rec.Body.String(), "busy")
+
+	proceed <- struct{}{}
+	require.Equal(t, http.StatusOK, <-first)
+
+	// the slot is free again once the first reply was relayed
+	go func() { proceed <- struct{}{} }()
+	rec = send()
+	<-arrived
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestChatCompletionAliasHandler_UpstreamQueue(t *testing.T) {
+	arrived := make(chan struct{}, 2)
+	proceed := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-proceed
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstream.Close()
+
+	cfg := AliasConfig{BaseUrls: []string{upstream.URL}, UpstreamMaxConcurrency: 1, UpstreamQueueTimeout: 5 * time.Second}
+	upstreams, err := newAliasUpstreamPool(cfg)
+	require.NoError(t, err)
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, upstreams, nil, nil, nil, nil, cfg))
+
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"llama","messages":[]}`)))
+			codes <- rec.Code
+		}()
+	}
+
+	<-arrived
+	select {
+	case <-arrived:
+		t.Fatal("expected the second request to queue instead of reaching the upstream")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	proceed <- struct{}{}
+	<-arrived
+	proceed <- struct{}{}
+	require.Equal(t, http.StatusOK, <-codes)
+	require.Equal(t, http.StatusOK, <-codes)
+}
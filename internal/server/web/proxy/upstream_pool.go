@@ -0,0 +1,286 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+)
+
+type upstream struct {
+	baseUrl string
+	weight  int
+	// current is the smooth weighted round-robin state.
+	current int
+	breaker *circuitBreaker
+	limiter *upstreamLimiter
+	// noStreamUsage is set once the upstream rejected stream_options.
+	noStreamUsage bool
+}
+
+// upstreamPool is the list of OpenAI compatible base URLs chat completions
+// are sent to. Without weights the first is the primary and the rest are
+// tried in order when the ones before them fail. With weights the first
+// attempt is spread across upstreams by smooth weighted round-robin, with the
+// others as failover. Each upstream sits behind a circuit breaker.
+type upstreamPool struct {
+	mu        sync.Mutex
+	upstreams []*upstream
+	weighted  bool
+}
+
+// newUpstreamPool drops empty entries and trailing slashes from baseUrls
+// and falls back to OpenAI when none are left.
+func newUpstreamPool(baseUrls ...string) *upstreamPool {
+	p, _ := newWeightedUpstreamPool(baseUrls, nil)
+	return p
+}
+
+// newWeightedUpstreamPool pairs baseUrls with weights, which are either
+// empty or one per base URL. A weight of 0 keeps an upstream for failover
+// only.
+func newWeightedUpstreamPool(baseUrls []string, weights []int) (*upstreamPool, error) {
+	if len(weights) != 0 && len(weights) != len(baseUrls) {
+		return nil, fmt.Errorf("got %d upstream weights for %d upstreams", len(weights), len(baseUrls))
+	}
+
+	p := &upstreamPool{weighted: len(weights) != 0}
+	total := 0
+	for i, u := range baseUrls {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if len(u) == 0 {
+			continue
+		}
+
+		weight := 1
+		if p.weighted {
+			weight = weights[i]
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("upstream %s has negative weight %d", u, weight)
+		}
+		total += weight
+
+		p.upstreams = append(p.upstreams, &upstream{baseUrl: u, weight: weight, breaker: newCircuitBreaker(u, 0, 0)})
+	}
+
+	if len(p.upstreams) == 0 {
+		p.upstreams = []*upstream{{baseUrl: openAiAliasBaseUrl, weight: 1, breaker: newCircuitBreaker(openAiAliasBaseUrl, 0, 0)}}
+		p.weighted = false
+	}
+	if p.weighted && total == 0 {
+		return nil, errors.New("at least one upstream needs a positive weight")
+	}
+
+	return p, nil
+}
+
+// newAliasUpstreamPool builds the chat completion upstreams from cfg.
+func newAliasUpstreamPool(cfg AliasConfig) (*upstreamPool, error) {
+	p, err := newWeightedUpstreamPool(cfg.BaseUrls, cfg.BaseUrlWeights)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range p.upstreams {
+		u.breaker.threshold = cfg.UpstreamFailureThreshold
+		u.breaker.cooldown = cfg.UpstreamCooldown
+		u.limiter = newUpstreamLimiter(cfg.UpstreamMaxConcurrency, cfg.UpstreamQueueTimeout)
+	}
+	return p, nil
+}
+
+// primary is the upstream of requests that are neither balanced nor failed
+// over.
+func (p *upstreamPool) primary() string {
+	return p.upstreams[0].baseUrl
+}
+
+// attempts returns the base URLs to try for a request, in order, leaving
+// out upstreams whose circuit is open.
+func (p *upstreamPool) attempts() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	available := []*upstream{}
+	for _, u := range p.upstreams {
+		if u.breaker.available() {
+			available = append(available, u)
+		}
+	}
+
+	first := -1
+	if p.weighted {
+		total := 0
+		for i, u := range available {
+			if u.weight == 0 {
+				continue
+			}
+			u.current += u.weight
+			total += u.weight
+			if first == -1 || u.current > available[first].current {
+				first = i
+			}
+		}
+		if first != -1 {
+			available[first].current -= total
+		}
+	}
+
+	res := make([]string, 0, len(available))
+	if first != -1 {
+		res = append(res, available[first].baseUrl)
+	}
+	for i, u := range available {
+		if i != first {
+			res = append(res, u.baseUrl)
+		}
+	}
+
+	return res
+}
+
+func (p *upstreamPool) breaker(baseUrl string) *circuitBreaker {
+	for _, u := range p.upstreams {
+		if u.baseUrl == baseUrl {
+			return u.breaker
+		}
+	}
+	return nil
+}
+
+func (p *upstreamPool) limiter(baseUrl string) *upstreamLimiter {
+	for _, u := range p.upstreams {
+		if u.baseUrl == baseUrl {
+			return u.limiter
+		}
+	}
+	return nil
+}
+
+// send tries the request built by newRequest against each upstream in turn
+// until one answers without a 5xx. The last upstream's reply is returned
+// whatever its status, along with the base URL that served it. A request
+// whose ctx is done is not failed over, as the client gave up or timed out.
+// When every circuit is open, send returns errCircuitOpen without calling
+// any upstream. Upstreams at their concurrency limit are skipped, except
+// that the last one is queued for; when none had a slot send returns
+// errUpstreamBusy.
+func (p *upstreamPool) send(ctx context.Context, client http.Client, newRequest func(baseUrl string) (*http.Request, error)) (*http.Response, string, error) {
+	attempts := []string{}
+	for _, baseUrl := range p.attempts() {
+		if p.breaker(baseUrl).allow() {
+			attempts = append(attempts, baseUrl)
+		}
+	}
+	if len(attempts) == 0 {
+		telemetry.Incr("bricksllm.proxy.upstream_pool.rejected", nil, 1)
+		return nil, "", errCircuitOpen
+	}
+
+	var lastErr error
+	for i, baseUrl := range attempts {
+		breaker := p.breaker(baseUrl)
+		if ctx.Err() != nil {
+			breaker.release()
+			if lastErr == nil {
+				lastErr = ctx.Err()
+			}
+			continue
+		}
+
+		last := i == len(attempts)-1
+		limiter := p.limiter(baseUrl)
+		if !limiter.acquire(ctx, last, upstreamTags(baseUrl)) {
+			breaker.release()
+			lastErr = errUpstreamBusy
+			continue
+		}
+
+		req, err := newRequest(baseUrl)
+		if err != nil {
+			limiter.release()
+			for _, rest := range attempts[i:] {
+				p.breaker(rest).release()
+			}
+			return nil, "", err
+		}
+
+		telemetry.Incr("bricksllm.proxy.upstream_pool.requests", upstreamTags(baseUrl), 1)
+		res, err := limiter.do(client, req)
+		ok := err == nil && res.StatusCode < http.StatusInternalServerError
+		switch {
+		case ctx.Err() != nil:
+			breaker.release()
+		case ok:
+			breaker.success()
+		default:
+			telemetry.Incr("bricksllm.proxy.upstream_pool.failures", upstreamTags(baseUrl), 1)
+			breaker.failure()
+		}
+
+		if err == nil && (ok || last) {
+			for _, rest := range attempts[i+1:] {
+				p.breaker(rest).release()
+			}
+			return res, baseUrl, nil
+		}
+
+		if err == nil {
+			res.Body.Close()
+			err = fmt.Errorf("upstream %s responded with status %d", baseUrl, res.StatusCode)
+		}
+		lastErr = err
+
+		if !last && ctx.Err() == nil {
+			telemetry.Incr("bricksllm.proxy.upstream_pool.failover", upstreamTags(baseUrl), 1)
+		}
+	}
+
+	return nil, "", lastErr
+}
+
+// do sends req to baseUrl outside of send, e.g. to ask again after a reply
+// was rejected, holding one of its slots like send does.
+func (p *upstreamPool) do(ctx context.Context, client http.Client, baseUrl string, req *http.Request) (*http.Response, error) {
+	limiter := p.limiter(baseUrl)
+	if !limiter.acquire(ctx, true, upstreamTags(baseUrl)) {
+		return nil, errUpstreamBusy
+	}
+
+	return limiter.do(client, req)
+}
+
+// streamUsageSupported reports whether baseUrl may be sent
+// stream_options, which every upstream is until it rejects them.
+func (p *upstreamPool) streamUsageSupported(baseUrl string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, u := range p.upstreams {
+		if u.baseUrl == baseUrl {
+			return !u.noStreamUsage
+		}
+	}
+	return true
+}
+
+func (p *upstreamPool) disableStreamUsage(baseUrl string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, u := range p.upstreams {
+		if u.baseUrl == baseUrl {
+			u.noStreamUsage = true
+		}
+	}
+}
+
+// upstreamTags names the upstream that served a request in telemetry.
+func upstreamTags(baseUrl string) []string {
+	return []string{"upstream:" + baseUrl}
+}
@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewUpstreamPool(t *testing.T) {
+	if got := newUpstreamPool().attempts(); len(got) != 1 || got[0] != openAiAliasBaseUrl {
+		t.Fatalf("expected OpenAI without configured upstreams, got %v", got)
+	}
+
+	got := newUpstreamPool(" http://llama:8080/ ", "", "https://api.openai.com").attempts()
+	if strings.Join(got, ",") != "http://llama:8080,https://api.openai.com" {
+		t.Fatalf("expected cleaned up base urls, got %v", got)
+	}
+}
+
+func TestNewWeightedUpstreamPool_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		baseUrls []string
+		weights  []int
+	}{
+		{name: "weight count mismatch", baseUrls: []string{"http://a", "http://b"}, weights: []int{1}},
+		{name: "negative weight", baseUrls: []string{"http://a", "http://b"}, weights: []int{1, -1}},
+		{name: "no positive weight", baseUrls: []string{"http://a", "http://b"}, weights: []int{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newWeightedUpstreamPool(tt.baseUrls, tt.weights); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestUpstreamPool_Weights(t *testing.T) {
+	p, err := newWeightedUpstreamPool([]string{"http://local", "http://openai", "http://backup"}, []int{4, 1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firsts := []string{}
+	for i := 0; i < 5; i++ {
+		attempts := p.attempts()
+		if len(attempts) != 3 {
+			t.Fatalf("expected every upstream to be attempted, got %v", attempts)
+		}
+		firsts = append(firsts, strings.TrimPrefix(attempts[0], "http://"))
+	}
+
+	// smooth weighted round-robin interleaves instead of sending bursts
+	if got := strings.Join(firsts, ","); got != "local,local,openai,local,local" {
+		t.Fatalf("expected a 4:1 interleaved split with backup only for failover, got %s", got)
+	}
+}
+
+func TestUpstreamPool_SkipsOpenCircuits(t *testing.T) {
+	p := newUpstreamPool("http://a", "http://b")
+	for _, u := range p.upstreams {
+		u.breaker.threshold = 1
+		u.breaker.cooldown = time.Minute
+	}
+
+	p.breaker("http://a").failure()
+	if got := strings.Join(p.attempts(), ","); got != "http://b" {
+		t.Fatalf("expected the failing upstream to be skipped, got %s", got)
+	}
+
+	p.breaker("http://b").failure()
+	if got := p.attempts(); len(got) != 0 {
+		t.Fatalf("expected no upstream to be attempted, got %v", got)
+	}
+}
+
+func TestUpstreamPool_SendCancelled(t *testing.T) {
+	p := newUpstreamPool("http://a", "http://b")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	res, _, err := p.send(ctx, http.Client{}, func(baseUrl string) (*http.Request, error) {
+		t.Fatalf("expected no request to %s once the context is done", baseUrl)
+		return nil, nil
+	})
+	if res != nil || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the context's error, got %v (%v)", err, res)
+	}
+	if got := strings.Join(p.attempts(), ","); got != "http://a,http://b" {
+		t.Fatalf("expected every circuit to be released, got %s", got)
+	}
+}
+
+func TestChatCompletionAliasHandler_CircuitOpen(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	upstreams, err := newAliasUpstreamPool(AliasConfig{BaseUrls: []string{upstream.URL}, UpstreamFailureThreshold: 2, UpstreamCooldown: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, upstreams, nil, nil, nil, nil, AliasConfig{}))
+
+	expected := []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusServiceUnavailable}
+	for i, status := range expected {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o-mini","messages":[]}`)))
+		if rec.Code != status {
+			t.Fatalf("request %d: expected status %d, got %d: %s", i, status, rec.Code, rec.Body.String())
+		}
+	}
+
+	if calls != 2 {
+		t.Fatalf("expected the open circuit to stop upstream calls, got %d calls", calls)
+	}
+}
+
+func TestChatCompletionAliasHandler_Failover(t *testing.T) {
+	tests := []struct {
+		name              string
+		primaryStatus     int
+		primaryDown       bool
+		secondaryStatus   int
+		stream            bool
+		expectedStatus    int
+		expectedSecondary int
+	}{
+		{
+			name:              "primary unreachable",
+			primaryDown:       true,
+			expectedStatus:    http.StatusOK,
+			expectedSecondary: 1,
+		},
+		{
+			name:              "primary 5xx",
+			primaryStatus:     http.StatusServiceUnavailable,
+			expectedStatus:    http.StatusOK,
+			expectedSecondary: 1,
+		},
+		{
+			name:              "primary 5xx before a stream starts",
+			primaryStatus:     http.StatusBadGateway,
+			stream:            true,
+			expectedStatus:    http.StatusOK,
+			expectedSecondary: 1,
+		},
+		{
+			name:           "primary 4xx is not failed over",
+			primaryStatus:  http.StatusBadRequest,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:              "every upstream fails",
+			primaryStatus:     http.StatusInternalServerError,
+			secondaryStatus:   http.StatusServiceUnavailable,
+			expectedStatus:    http.StatusServiceUnavailable,
+			expectedSecondary: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := func(status int) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					if status != 0 {
+						w.WriteHeader(status)
+						return
+					}
+					if tt.stream {
+						w.Header().Set("Content-Type", "text/event-stream")
+						w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n"))
+						return
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+				}
+			}
+
+			primary := httptest.NewServer(reply(tt.primaryStatus))
+			if tt.primaryDown {
+				primary.Close()
+			} else {
+				defer primary.Close()
+			}
+
+			secondaryCalls := 0
+			secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				secondaryCalls++
+				reply(tt.secondaryStatus)(w, r)
+			}))
+			defer secondary.Close()
+
+			router := newAliasTestRouter(http.MethodPost, "/v1/chat/completions", getChatCompletionAliasHandler(false, false, http.Client{}, newUpstreamPool(primary.URL, secondary.URL), nil, nil, nil, nil, AliasConfig{}))
+
+			body := `{"model":"gpt-4o-mini","messages":[]}`
+			if tt.stream {
+				body = `{"model":"gpt-4o-mini","stream":true,"messages":[]}`
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if secondaryCalls != tt.expectedSecondary {
+				t.Fatalf("expected %d calls to the secondary, got %d", tt.expectedSecondary, secondaryCalls)
+			}
+			if tt.expectedStatus == http.StatusOK && !strings.Contains(rec.Body.String(), "hi") {
+				t.Fatalf("expected the secondary's reply, got %s", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEntry records a mutating action a user took on one of their
+// conversations, messages or folders.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	UserID    string          `json:"user_id"`
+	Action    string          `json:"action"`
+	TargetID  string          `json:"target_id"`
+	Detail    json.RawMessage `json:"detail,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// RecordAudit appends e to the audit log. CreatedAt defaults to now.
+func (s *Store) RecordAudit(e AuditEntry) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	detail := e.Detail
+	if len(detail) == 0 {
+		detail = json.RawMessage(`{}`)
+	}
+
+	_, err := s.db.Exec(`INSERT INTO audit_log (user_id, action, target_id, detail, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		e.UserID, e.Action, e.TargetID, detail, e.CreatedAt)
+	return err
+}
+
+// GetAuditEntries lists the audit log newest first, filtered by userID and
+// targetID when they are set. A positive limit caps the number of entries.
+func (s *Store) GetAuditEntries(userID, targetID string, limit int) ([]AuditEntry, error) {
+	conds := []string{}
+	args := []interface{}{}
+	if len(userID) != 0 {
+		args = append(args, userID)
+		conds = append(conds, fmt.Sprintf("user_id=$%d", len(args)))
+	}
+	if len(targetID) != 0 {
+		args = append(args, targetID)
+		conds = append(conds, fmt.Sprintf("target_id=$%d", len(args)))
+	}
+
+	query := `SELECT id, user_id, action, target_id, detail, created_at FROM audit_log`
+	if len(conds) != 0 {
+		query += ` WHERE ` + strings.Join(conds, " AND ")
+	}
+	query += ` ORDER BY created_at DESC, id DESC`
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var detail []byte
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Action, &e.TargetID, &detail, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Detail = json.RawMessage(detail)
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
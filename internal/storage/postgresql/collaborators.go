@@ -0,0 +1,111 @@
+package postgresql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+)
+
+// Permissions a user can have on a conversation. Owners can do anything,
+// collaborators with write access can add messages and with read access
+// only read them.
+const (
+	PermissionOwner = "owner"
+	PermissionWrite = "write"
+	PermissionRead  = "read"
+)
+
+// IsValidSharePermission reports whether permission can be granted to a
+// collaborator.
+func IsValidSharePermission(permission string) bool {
+	return permission == PermissionRead || permission == PermissionWrite
+}
+
+// ConversationShare gives a user other than the owner access to a
+// conversation.
+type ConversationShare struct {
+	ConversationID   string    `json:"conversation_id"`
+	SharedWithUserID string    `json:"shared_with_user_id"`
+	Permission       string    `json:"permission"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// accessibleBy is the condition on conversations for those a user owns or
+// was given access to, with the user id as query parameter $n.
+func accessibleBy(n int) string {
+	return fmt.Sprintf(`(user_id=$%d OR id IN (SELECT conversation_id FROM conversation_shares WHERE shared_with_user_id=$%d))`, n, n)
+}
+
+// GrantConversationAccess gives userID permission on one of ownerID's
+// conversations, replacing any permission granted before.
+func (s *Store) GrantConversationAccess(id, ownerID, userID, permission string) error {
+	if !IsValidSharePermission(permission) {
+		return internal_errors.NewValidationError("permission must be read or write")
+	}
+	if userID == ownerID {
+		return internal_errors.NewValidationError("cannot share a conversation with its owner")
+	}
+
+	res, err := s.db.Exec(`INSERT INTO conversation_shares (conversation_id, shared_with_user_id, permission, created_at)
+		SELECT id, $3, $4, NOW() FROM conversations WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL
+		ON CONFLICT (conversation_id, shared_with_user_id) DO UPDATE SET permission=EXCLUDED.permission`,
+		id, ownerID, userID, permission)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "conversation is not found")
+}
+
+// RevokeConversationAccess takes back what userID was granted on one of
+// ownerID's conversations.
+func (s *Store) RevokeConversationAccess(id, ownerID, userID string) error {
+	res, err := s.db.Exec(`DELETE FROM conversation_shares cs USING conversations c WHERE cs.conversation_id=c.id AND c.id=$1 AND c.user_id=$2 AND cs.shared_with_user_id=$3`, id, ownerID, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "collaborator is not found")
+}
+
+// GetConversationShares lists who one of ownerID's conversations is shared
+// with, in the order access was granted.
+func (s *Store) GetConversationShares(id, ownerID string) ([]ConversationShare, error) {
+	var owned bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM conversations WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL)`, id, ownerID).Scan(&owned); err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, internal_errors.NewNotFoundError("conversation is not found")
+	}
+
+	rows, err := s.db.Query(`SELECT conversation_id, shared_with_user_id, permission, created_at FROM conversation_shares WHERE conversation_id=$1 ORDER BY created_at ASC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []ConversationShare{}
+	for rows.Next() {
+		var share ConversationShare
+		if err := rows.Scan(&share.ConversationID, &share.SharedWithUserID, &share.Permission, &share.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, share)
+	}
+	return res, rows.Err()
+}
+
+// GetConversationPermission returns what userID may do with a conversation:
+// PermissionOwner, PermissionWrite or PermissionRead. Conversations userID
+// has no access to are reported as not found.
+func (s *Store) GetConversationPermission(id, userID string) (string, error) {
+	var permission string
+	err := s.db.QueryRow(`SELECT CASE WHEN c.user_id=$2 THEN 'owner' ELSE cs.permission END FROM conversations c
+		LEFT JOIN conversation_shares cs ON cs.conversation_id=c.id AND cs.shared_with_user_id=$2
+		WHERE c.id=$1 AND c.deleted_at IS NULL AND (c.user_id=$2 OR cs.permission IS NOT NULL)`, id, userID).Scan(&permission)
+	if err == sql.ErrNoRows {
+		return "", internal_errors.NewNotFoundError("conversation is not found")
+	}
+	return permission, err
+}
@@ -1,94 +1,661 @@
 package postgresql
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type Conversation struct {
-	ID        string          `json:"id"`
-	Title     string          `json:"title"`
-	UserID    string          `json:"user_id"`
-	CreatedAt time.Time       `json:"created_at"`
-	UpdatedAt time.Time       `json:"updated_at"`
-	Metadata  json.RawMessage `json:"metadata"`
+	ID           string          `json:"id"`
+	Title        string          `json:"title"`
+	UserID       string          `json:"user_id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	Metadata     json.RawMessage `json:"metadata"`
+	SystemPrompt string          `json:"system_prompt"`
+	Pinned       bool            `json:"pinned"`
+	Archived     bool            `json:"archived"`
+	TokenBudget  int             `json:"token_budget"`
+	TokensUsed   int             `json:"tokens_used"`
+	LastReadAt   *time.Time      `json:"last_read_at"`
+	FolderID     string          `json:"folder_id,omitempty"`
+	// DefaultParams fill in sampling parameters requests leave out.
+	DefaultParams *SamplingParams `json:"default_params,omitempty"`
+	// DeletedAt is set while the conversation is in the trash.
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	UnreadCount int        `json:"unread_count"` // only computed by the list queries
+}
+
+// OverBudget reports whether the conversation has exhausted its token budget.
+// A budget of zero means unlimited.
+func (c *Conversation) OverBudget() bool {
+	return c.TokenBudget > 0 && c.TokensUsed >= c.TokenBudget
+}
+
+// MessageRoles lists the roles the messages table accepts.
+var MessageRoles = []string{"user", "assistant", "system", "tool", "function"}
+
+func IsValidMessageRole(role string) bool {
+	for _, r := range MessageRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func invalidMessageRoleError(role string) error {
+	return internal_errors.NewValidationError(fmt.Sprintf("invalid role %q, valid roles are: %s", role, strings.Join(MessageRoles, ", ")))
+}
+
+// ContentTooLongError is returned for message content over limit runes.
+func ContentTooLongError(limit int) error {
+	return internal_errors.NewValidationError(fmt.Sprintf("content cannot be longer than %d characters", limit))
+}
+
+func (s *Store) validateMessageContent(m Message) error {
+	if s.maxContentLength > 0 && m.Role != "assistant" && utf8.RuneCountInString(m.Content) > s.maxContentLength {
+		return ContentTooLongError(s.maxContentLength)
+	}
+	return nil
+}
+
+// Attachment describes a file or image attached to a message.
+type Attachment struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
 }
 
 type Message struct {
-	ID             string    `json:"id"`
-	ConversationID string    `json:"conversation_id"`
-	Role           string    `json:"role"`
-	Content        string    `json:"content"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
-}
-
-func (s *Store) CreateConversationTables() error {
-	query := `
-		CREATE TABLE IF NOT EXISTS conversations (
-			id VARCHAR(255) PRIMARY KEY,
-			title VARCHAR(500) NOT NULL DEFAULT 'New Conversation',
-			user_id VARCHAR(255) NOT NULL,
-			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			metadata JSONB DEFAULT '{}'::jsonb
-		);
-		CREATE INDEX IF NOT EXISTS idx_conversations_user_id ON conversations(user_id);
-
-		CREATE TABLE IF NOT EXISTS messages (
-			id VARCHAR(255) PRIMARY KEY,
-			conversation_id VARCHAR(255) NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
-			role VARCHAR(50) NOT NULL CHECK (role IN ('user', 'assistant', 'system')),
-			content TEXT NOT NULL,
-			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
-		);
-		CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages(conversation_id);
-	`
-
-	_, err := s.db.Exec(query)
-	return err
+	ID               string       `json:"id"`
+	ConversationID   string       `json:"conversation_id"`
+	Role             string       `json:"role"`
+	Content          string       `json:"content"`
+	Name             string       `json:"name,omitempty"`
+	ToolCallID       string       `json:"tool_call_id,omitempty"`
+	CreatedAt        time.Time    `json:"created_at"`
+	UpdatedAt        time.Time    `json:"updated_at"`
+	PromptTokens     int          `json:"prompt_tokens"`
+	CompletionTokens int          `json:"completion_tokens"`
+	TokensEstimated  bool         `json:"tokens_estimated"`
+	Attachments      []Attachment `json:"attachments"`
+	// FinishReason is why the model stopped, e.g. "stop" or "length". It is
+	// only set on assistant messages.
+	FinishReason string `json:"finish_reason,omitempty"`
+	// Seq orders the messages of a conversation, starting at 1. It is set by
+	// the store on insert.
+	Seq int64 `json:"seq"`
+	// Streaming marks an assistant reply that is still being streamed. Its
+	// content is what has been received so far.
+	Streaming bool `json:"streaming,omitempty"`
+	// Model is the model that wrote an assistant reply, as requested.
+	Model string `json:"model,omitempty"`
+	// Metadata is a JSON object of structured data about the message, e.g.
+	// the sources cited by a reply.
+	Metadata json.RawMessage `json:"metadata"`
+	// ParentMessageID is the message this one replies to, in the same
+	// conversation. It is empty for messages of a flat conversation.
+	ParentMessageID string `json:"parent_message_id,omitempty"`
+	// VariantIndex is the choice an assistant reply was when more than one
+	// was requested with n. Choice 0 is the reply the conversation goes on
+	// from, the others are kept as alternatives.
+	VariantIndex int `json:"variant_index,omitempty"`
+	// ContentJSON is the content parts array of a multimodal message, e.g.
+	// text and image_url parts. Content then holds its text rendering.
+	ContentJSON json.RawMessage `json:"content_json,omitempty"`
+}
+
+const conversationColumns = `id, title, user_id, created_at, updated_at, metadata, system_prompt, pinned, archived, token_budget, tokens_used, last_read_at, folder_id, default_params, deleted_at`
+
+// conversationListColumns adds the number of replies, i.e. messages not
+// authored by the user, that arrived after the conversation was last read.
+const conversationListColumns = conversationColumns + `, (SELECT COUNT(*) FROM messages m WHERE m.conversation_id=conversations.id AND m.role<>'user' AND m.created_at > COALESCE(conversations.last_read_at, 'epoch'::timestamp))`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanConversation(row rowScanner) (Conversation, error) {
+	return scanConversationWith(row)
+}
+
+// scanConversationWith scans conversationColumns followed by extra columns
+// into the given destinations.
+func scanConversationWith(row rowScanner, extra ...any) (Conversation, error) {
+	var c Conversation
+	var meta sql.NullString
+	var systemPrompt sql.NullString
+	var tokenBudget sql.NullInt64
+	var lastReadAt sql.NullTime
+	var folderID sql.NullString
+	var defaultParams sql.NullString
+	var deletedAt sql.NullTime
+	dest := append([]any{&c.ID, &c.Title, &c.UserID, &c.CreatedAt, &c.UpdatedAt, &meta, &systemPrompt, &c.Pinned, &c.Archived, &tokenBudget, &c.TokensUsed, &lastReadAt, &folderID, &defaultParams, &deletedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return c, err
+	}
+	params, err := scanSamplingParams(defaultParams)
+	if err != nil {
+		return c, err
+	}
+	c.DefaultParams = params
+	c.TokenBudget = int(tokenBudget.Int64)
+	if lastReadAt.Valid {
+		c.LastReadAt = &lastReadAt.Time
+	}
+	if deletedAt.Valid {
+		c.DeletedAt = &deletedAt.Time
+	}
+	if meta.Valid {
+		c.Metadata = json.RawMessage(meta.String)
+	}
+	c.SystemPrompt = systemPrompt.String
+	c.FolderID = folderID.String
+	return c, nil
+}
+
+// GetConversationsByUser lists either the active or the archived
+// conversations of a user, never both. Conversations shared with the user
+// are included.
+func (s *Store) GetConversationsByUser(userID string, archived bool) ([]Conversation, error) {
+	return s.listConversations(`SELECT `+conversationListColumns+` FROM conversations WHERE `+accessibleBy(1)+` AND archived=$2 AND deleted_at IS NULL ORDER BY pinned DESC, updated_at DESC`, userID, archived)
+}
+
+// GetConversationsByUserFiltered lists the conversations of a user whose
+// metadata contains metaKey set to metaValue, e.g. {"folder": "work"}.
+func (s *Store) GetConversationsByUserFiltered(userID string, archived bool, metaKey, metaValue string) ([]Conversation, error) {
+	filter, err := json.Marshal(map[string]string{metaKey: metaValue})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.listConversations(`SELECT `+conversationListColumns+` FROM conversations WHERE `+accessibleBy(1)+` AND archived=$2 AND deleted_at IS NULL AND metadata @> $3::jsonb ORDER BY pinned DESC, updated_at DESC`, userID, archived, string(filter))
+}
+
+// ConversationPreview is a conversation as the sidebar shows it, with the
+// start of its latest message.
+type ConversationPreview struct {
+	Conversation
+	LastMessage   string     `json:"last_message"`
+	LastMessageAt *time.Time `json:"last_message_at"`
 }
 
-func (s *Store) GetConversationsByUser(userID string) ([]Conversation, error) {
-	rows, err := s.db.Query(`SELECT id, title, user_id, created_at, updated_at, metadata FROM conversations WHERE user_id=$1 ORDER BY updated_at DESC`, userID)
+const conversationPreviewLength = 200
+
+// GetConversationPreviewsByUser lists a user's conversations together with
+// their latest message in a single query, instead of one message query per
+// conversation. An empty metaKey disables the metadata filter and an empty
+// folderID the folder filter. Zero createdAfter and createdBefore leave the
+// creation time range open on that side; createdBefore is exclusive.
+// Conversations shared with the user are included.
+func (s *Store) GetConversationPreviewsByUser(userID string, archived bool, metaKey, metaValue, folderID string, createdAfter, createdBefore time.Time) ([]ConversationPreview, error) {
+	query := `SELECT ` + conversationListColumns + `, lm.last_message, lm.last_message_at FROM conversations
+		LEFT JOIN LATERAL (
+			SELECT LEFT(content, ` + fmt.Sprint(conversationPreviewLength) + `) AS last_message, created_at AS last_message_at
+			FROM messages WHERE conversation_id=conversations.id ORDER BY seq DESC LIMIT 1
+		) lm ON true
+		WHERE ` + accessibleBy(1) + ` AND archived=$2 AND deleted_at IS NULL`
+	args := []any{userID, archived}
+	if len(metaKey) != 0 {
+		filter, err := json.Marshal(map[string]string{metaKey: metaValue})
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, string(filter))
+		query += fmt.Sprintf(` AND metadata @> $%d::jsonb`, len(args))
+	}
+	if len(folderID) != 0 {
+		args = append(args, folderID)
+		query += fmt.Sprintf(` AND folder_id=$%d`, len(args))
+	}
+	if !createdAfter.IsZero() {
+		args = append(args, createdAfter)
+		query += fmt.Sprintf(` AND created_at >= $%d`, len(args))
+	}
+	if !createdBefore.IsZero() {
+		args = append(args, createdBefore)
+		query += fmt.Sprintf(` AND created_at < $%d`, len(args))
+	}
+	query += ` ORDER BY pinned DESC, updated_at DESC`
+
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var res []Conversation
+	var res []ConversationPreview
 	for rows.Next() {
-		var c Conversation
-		var meta sql.NullString
-		if err := rows.Scan(&c.ID, &c.Title, &c.UserID, &c.CreatedAt, &c.UpdatedAt, &meta); err != nil {
+		var unread int
+		var lastMessage sql.NullString
+		var lastMessageAt sql.NullTime
+		c, err := scanConversationWith(rows, &unread, &lastMessage, &lastMessageAt)
+		if err != nil {
 			return nil, err
 		}
-		if meta.Valid {
-			c.Metadata = json.RawMessage(meta.String)
+		c.UnreadCount = unread
+		p := ConversationPreview{Conversation: c, LastMessage: lastMessage.String}
+		if lastMessageAt.Valid {
+			p.LastMessageAt = &lastMessageAt.Time
+		}
+		res = append(res, p)
+	}
+	return res, rows.Err()
+}
+
+// GetAllConversations lists the conversations of every user, most recently
+// updated first, for operators. A zero beforeUpdatedAt starts at the newest
+// conversation, otherwise only ones after (beforeUpdatedAt, beforeID) in that
+// order are returned, so the updated_at and id of the last conversation of a
+// page request the next one. The id breaks ties between conversations
+// updated at the same time; an empty one skips them all.
+func (s *Store) GetAllConversations(limit int, beforeUpdatedAt time.Time, beforeID string) ([]Conversation, error) {
+	query := `SELECT ` + conversationColumns + ` FROM conversations`
+	args := []any{}
+	if !beforeUpdatedAt.IsZero() {
+		args = append(args, beforeUpdatedAt, beforeID)
+		query += ` WHERE (updated_at, id) < ($1, $2)`
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` ORDER BY updated_at DESC, id DESC LIMIT $%d`, len(args))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Conversation{}
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
 		}
 		res = append(res, c)
 	}
 	return res, rows.Err()
 }
 
+func (s *Store) listConversations(query string, args ...any) ([]Conversation, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []Conversation
+	for rows.Next() {
+		var unread int
+		c, err := scanConversationWith(rows, &unread)
+		if err != nil {
+			return nil, err
+		}
+		c.UnreadCount = unread
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
+
+func (s *Store) GetConversation(id string) (*Conversation, error) {
+	c, err := scanConversation(s.db.QueryRow(`SELECT `+conversationColumns+` FROM conversations WHERE id=$1 AND deleted_at IS NULL`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, internal_errors.NewNotFoundError("conversation is not found")
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
 func (s *Store) CreateConversation(c Conversation) error {
-	_, err := s.db.Exec(`INSERT INTO conversations (id, title, user_id, created_at, updated_at, metadata) VALUES ($1, $2, $3, $4, $5, $6)`,
-		c.ID, c.Title, c.UserID, c.CreatedAt, c.UpdatedAt, c.Metadata)
-	return err
+	return s.CreateConversationWithMessages(c, nil)
+}
+
+// CreateConversationWithMessages creates a conversation already holding
+// msgs, in order, in a single transaction.
+func (s *Store) CreateConversationWithMessages(c Conversation, msgs []Message) error {
+	if err := c.DefaultParams.Validate(); err != nil {
+		return err
+	}
+	params, err := nullSamplingParams(c.DefaultParams)
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if !IsValidMessageRole(m.Role) {
+			return invalidMessageRoleError(m.Role)
+		}
+		if err := s.validateMessageContent(m); err != nil {
+			return err
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO conversations (id, title, user_id, created_at, updated_at, metadata, system_prompt, token_budget, default_params) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		c.ID, c.Title, c.UserID, c.CreatedAt, c.UpdatedAt, c.Metadata, nullString(c.SystemPrompt), sql.NullInt64{Int64: int64(c.TokenBudget), Valid: c.TokenBudget > 0}, params); err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		m.ConversationID = c.ID
+		if err := insertMessage(tx, m); err != nil {
+			return err
+		}
+	}
+	if len(msgs) != 0 {
+		if err := notifyMessage(tx, c.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) UpdateConversationTitle(id, userID, title string) error {
+	res, err := s.db.Exec(`UPDATE conversations SET title=$3 WHERE id=$1 AND user_id=$2`, id, userID, title)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "conversation is not found")
+}
+
+func (s *Store) UpdateConversationMetadata(id, userID string, metadata json.RawMessage) error {
+	res, err := s.db.Exec(`UPDATE conversations SET metadata=$3 WHERE id=$1 AND user_id=$2`, id, userID, metadata)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "conversation is not found")
+}
+
+func (s *Store) SetConversationPinned(id, userID string, pinned bool) error {
+	res, err := s.db.Exec(`UPDATE conversations SET pinned=$3 WHERE id=$1 AND user_id=$2`, id, userID, pinned)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "conversation is not found")
+}
+
+// MarkConversationRead records that the user has seen every message of the
+// conversation so far.
+func (s *Store) MarkConversationRead(id, userID string) error {
+	res, err := s.db.Exec(`UPDATE conversations SET last_read_at=NOW() WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "conversation is not found")
+}
+
+func (s *Store) SetConversationArchived(id, userID string, archived bool) error {
+	res, err := s.db.Exec(`UPDATE conversations SET archived=$3 WHERE id=$1 AND user_id=$2`, id, userID, archived)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "conversation is not found")
+}
+
+// CreateShareLink assigns the conversation a fresh random share token,
+// replacing any earlier one so old links stop working.
+func (s *Store) CreateShareLink(id, userID string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	res, err := s.db.Exec(`UPDATE conversations SET share_token=$3 WHERE id=$1 AND user_id=$2`, id, userID, token)
+	if err != nil {
+		return "", err
+	}
+	if err := requireAffected(res, "conversation is not found"); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *Store) RevokeShareLink(id, userID string) error {
+	res, err := s.db.Exec(`UPDATE conversations SET share_token=NULL WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "conversation is not found")
+}
+
+func (s *Store) GetConversationByShareToken(token string) (*Conversation, error) {
+	c, err := scanConversation(s.db.QueryRow(`SELECT `+conversationColumns+` FROM conversations WHERE share_token=$1 AND deleted_at IS NULL`, token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, internal_errors.NewNotFoundError("shared conversation is not found")
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ForkConversation copies a conversation, its metadata, system prompt,
+// sampling defaults and folder, and its messages up to and including
+// uptoMessageID into a new conversation owned by the same user. An empty
+// uptoMessageID copies every message. The fork starts with a fresh token
+// budget.
+func (s *Store) ForkConversation(id, userID string, uptoMessageID string) (string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	src, err := scanConversation(tx.QueryRow(`SELECT `+conversationColumns+` FROM conversations WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL`, id, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", internal_errors.NewNotFoundError("conversation is not found")
+		}
+		return "", err
+	}
+
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE conversation_id=$1 ORDER BY seq ASC`
+	args := []any{id}
+	if len(uptoMessageID) != 0 {
+		var cutoff int64
+		if err := tx.QueryRow(`SELECT seq FROM messages WHERE id=$1 AND conversation_id=$2`, uptoMessageID, id).Scan(&cutoff); err != nil {
+			if err == sql.ErrNoRows {
+				return "", internal_errors.NewNotFoundError("message is not found")
+			}
+			return "", err
+		}
+		query = `SELECT ` + messageColumns + ` FROM messages WHERE conversation_id=$1 AND seq<=$2 ORDER BY seq ASC`
+		args = append(args, cutoff)
+	}
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return "", err
+	}
+	var msgs []Message
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			rows.Close()
+			return "", err
+		}
+		msgs = append(msgs, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	fork := src
+	fork.ID = uuid.NewString()
+	fork.CreatedAt = now
+	fork.UpdatedAt = now
+	params, err := nullSamplingParams(fork.DefaultParams)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`INSERT INTO conversations (id, title, user_id, created_at, updated_at, metadata, system_prompt, token_budget, folder_id, default_params) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		fork.ID, fork.Title, fork.UserID, fork.CreatedAt, fork.UpdatedAt, fork.Metadata, nullString(fork.SystemPrompt), sql.NullInt64{Int64: int64(fork.TokenBudget), Valid: fork.TokenBudget > 0}, nullString(fork.FolderID), params); err != nil {
+		return "", err
+	}
+
+	// replies point at the copies of their parents; a parent left out of
+	// the fork leaves the reply without one
+	copies := make(map[string]string, len(msgs))
+	for _, m := range msgs {
+		copies[m.ID] = uuid.NewString()
+	}
+	for _, m := range msgs {
+		attachments, err := json.Marshal(m.Attachments)
+		if err != nil {
+			return "", err
+		}
+		// timestamps and sequence numbers are kept so the copied history
+		// stays in order
+		if _, err := tx.Exec(`INSERT INTO messages (`+messageColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)`,
+			copies[m.ID], fork.ID, m.Role, m.Content, m.CreatedAt, m.UpdatedAt, m.PromptTokens, m.CompletionTokens, m.TokensEstimated, nullString(m.Name), nullString(m.ToolCallID), attachments, nullString(m.FinishReason), m.Seq, m.Streaming, nullString(m.Model), messageMetadata(m.Metadata), nullString(copies[m.ParentMessageID]), m.VariantIndex, nullContentJSON(m.ContentJSON)); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return fork.ID, nil
+}
+
+// DeleteConversations erases the conversations in ids that belong to userID,
+// and through the cascade their messages, in one statement. IDs of other
+// users' conversations or of none are ignored. It returns how many were
+// deleted.
+func (s *Store) DeleteConversations(ids []string, userID string) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM conversations WHERE id = ANY($1) AND user_id=$2`, pq.Array(ids), userID)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// DeleteAllConversationsForUser erases every conversation of a user, and
+// through the cascade their messages, in a single transaction. The user's
+// folders, templates, reactions to messages of other users' conversations
+// and access to conversations shared with them go with them.
+func (s *Store) DeleteAllConversationsForUser(userID string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM conversations WHERE user_id=$1`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM reactions WHERE user_id=$1`, userID); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM folders WHERE user_id=$1`, userID); err != nil {
+		return 0, err
+	}
+
+	// global templates have no user_id and are kept
+	if _, err := tx.Exec(`DELETE FROM templates WHERE user_id=$1`, userID); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM conversation_shares WHERE shared_with_user_id=$1`, userID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// requireAffected turns an update that matched no rows into a not found
+// error, which is how ownership mismatches surface to handlers.
+func requireAffected(res sql.Result, msg string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return internal_errors.NewNotFoundError(msg)
+	}
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: len(s) != 0}
+}
+
+const messageColumns = `id, conversation_id, role, content, created_at, updated_at, prompt_tokens, completion_tokens, tokens_estimated, name, tool_call_id, attachments, finish_reason, seq, streaming, model, metadata, parent_message_id, variant_index, content_json`
+
+func scanMessage(row rowScanner) (Message, error) {
+	var m Message
+	var name, toolCallID, finishReason, model, parentID sql.NullString
+	var attachments, meta, contentJSON []byte
+	if err := row.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &m.CreatedAt, &m.UpdatedAt, &m.PromptTokens, &m.CompletionTokens, &m.TokensEstimated, &name, &toolCallID, &attachments, &finishReason, &m.Seq, &m.Streaming, &model, &meta, &parentID, &m.VariantIndex, &contentJSON); err != nil {
+		return m, err
+	}
+	m.Name = name.String
+	m.ToolCallID = toolCallID.String
+	m.FinishReason = finishReason.String
+	m.Model = model.String
+	m.Metadata = messageMetadata(meta)
+	m.ParentMessageID = parentID.String
+	if len(contentJSON) != 0 {
+		m.ContentJSON = contentJSON
+	}
+	m.Attachments = []Attachment{}
+	if len(attachments) != 0 {
+		if err := json.Unmarshal(attachments, &m.Attachments); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
 }
 
 func (s *Store) GetMessages(conversationID string) ([]Message, error) {
-	rows, err := s.db.Query(`SELECT id, conversation_id, role, content, created_at, updated_at FROM messages WHERE conversation_id=$1 ORDER BY created_at ASC`, conversationID)
+	rows, err := s.db.Query(`SELECT `+messageColumns+` FROM messages WHERE conversation_id=$1 ORDER BY seq ASC`, conversationID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var res []Message
 	for rows.Next() {
-		var m Message
-		if err := rows.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &m.CreatedAt, &m.UpdatedAt); err != nil {
+		m, err := scanMessage(rows)
+		if err != nil {
 			return nil, err
 		}
 		res = append(res, m)
@@ -96,9 +663,219 @@ func (s *Store) GetMessages(conversationID string) ([]Message, error) {
 	return res, rows.Err()
 }
 
+// GetMessagesForUser lists a conversation's messages only when the
+// conversation belongs to or is shared with userID. Ownership is part of the message query
+// itself, so no messages can be read between a separate check and the read.
+// An empty result is disambiguated afterwards to tell an empty conversation
+// from one that is missing or owned by someone else.
+func (s *Store) GetMessagesForUser(conversationID, userID string) ([]Message, error) {
+	return s.getMessagesForUser(conversationID, userID, "")
+}
+
+// GetMessagesForUserByRole is GetMessagesForUser narrowed to the messages
+// with the given role, e.g. just the user prompts.
+func (s *Store) GetMessagesForUserByRole(conversationID, userID, role string) ([]Message, error) {
+	if !IsValidMessageRole(role) {
+		return nil, invalidMessageRoleError(role)
+	}
+
+	return s.getMessagesForUser(conversationID, userID, role)
+}
+
+func (s *Store) getMessagesForUser(conversationID, userID, role string) ([]Message, error) {
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE conversation_id IN (SELECT id FROM conversations WHERE id=$1 AND ` + accessibleBy(2) + ` AND deleted_at IS NULL)`
+	args := []interface{}{conversationID, userID}
+	if len(role) != 0 {
+		query += ` AND role=$3`
+		args = append(args, role)
+	}
+
+	rows, err := s.db.Query(query+` ORDER BY seq ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Message
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(res) == 0 {
+		var owned bool
+		if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM conversations WHERE id=$1 AND `+accessibleBy(2)+` AND deleted_at IS NULL)`, conversationID, userID).Scan(&owned); err != nil {
+			return nil, err
+		}
+		if !owned {
+			return nil, internal_errors.NewNotFoundError("conversation is not found")
+		}
+	}
+
+	return res, nil
+}
+
+// CreateMessage inserts the message and bumps the parent conversation's
+// updated_at and token usage in the same transaction, so a failed insert
+// leaves ordering and quotas intact.
 func (s *Store) CreateMessage(m Message) error {
-	_, err := s.db.Exec(`INSERT INTO messages (id, conversation_id, role, content, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)`,
-		m.ID, m.ConversationID, m.Role, m.Content, m.CreatedAt, m.UpdatedAt)
-	return err
+	if !IsValidMessageRole(m.Role) {
+		return invalidMessageRoleError(m.Role)
+	}
+	if err := s.validateMessageContent(m); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertMessage(tx, m); err != nil {
+		return err
+	}
+	if err := notifyMessage(tx, m.ConversationID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
+// CreateMessageUnlessDuplicate inserts m unless the latest message of its
+// conversation has the same role and content and was created at most window
+// before m. That message is returned instead and nothing is written. The
+// conversation row is locked first so concurrent duplicates see each other.
+func (s *Store) CreateMessageUnlessDuplicate(m Message, window time.Duration) (*Message, error) {
+	if !IsValidMessageRole(m.Role) {
+		return nil, invalidMessageRoleError(m.Role)
+	}
+	if err := s.validateMessageContent(m); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT 1 FROM conversations WHERE id=$1 FOR UPDATE`, m.ConversationID); err != nil {
+		return nil, err
+	}
+
+	latest, err := scanMessage(tx.QueryRow(`SELECT `+messageColumns+` FROM messages WHERE conversation_id=$1 ORDER BY seq DESC LIMIT 1`, m.ConversationID))
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil && latest.Role == m.Role && latest.Content == m.Content && latest.ParentMessageID == m.ParentMessageID && !latest.CreatedAt.Before(m.CreatedAt.Add(-window)) {
+		return &latest, nil
+	}
+
+	if err := insertMessage(tx, m); err != nil {
+		return nil, err
+	}
+	if err := notifyMessage(tx, m.ConversationID); err != nil {
+		return nil, err
+	}
+
+	return nil, tx.Commit()
+}
+
+// ReplaceLastAssistantMessage deletes the assistant reply previousID and
+// inserts m in its place in one transaction. An empty previousID only
+// inserts. If previousID is already gone, e.g. because a concurrent
+// regenerate replaced it first, nothing is written and a not found error is
+// returned.
+func (s *Store) ReplaceLastAssistantMessage(previousID string, m Message) error {
+	if !IsValidMessageRole(m.Role) {
+		return invalidMessageRoleError(m.Role)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(previousID) != 0 {
+		res, err := tx.Exec(`DELETE FROM messages WHERE id=$1 AND conversation_id=$2 AND role='assistant'`, previousID, m.ConversationID)
+		if err != nil {
+			return err
+		}
+		if err := requireAffected(res, "message is not found"); err != nil {
+			return err
+		}
+	}
+
+	if err := insertMessage(tx, m); err != nil {
+		return err
+	}
+	if err := notifyMessage(tx, m.ConversationID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateMessageContent extends an assistant message that was cut off at the
+// length limit with its continuation. The continuation's completion tokens
+// are added to the message and its conversation. A message that is gone or
+// no longer truncated is reported as not found.
+func (s *Store) UpdateMessageContent(id, content, finishReason string, completionTokens int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var conversationID string
+	if err := tx.QueryRow(`UPDATE messages SET content=$2, finish_reason=$3, completion_tokens=completion_tokens+$4, updated_at=NOW() WHERE id=$1 AND role='assistant' AND finish_reason='length' RETURNING conversation_id`,
+		id, content, nullString(finishReason), completionTokens).Scan(&conversationID); err != nil {
+		if err == sql.ErrNoRows {
+			return internal_errors.NewNotFoundError("message is not found")
+		}
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE conversations SET updated_at=NOW(), tokens_used=tokens_used+$2 WHERE id=$1`, conversationID, completionTokens); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertMessage appends m to its conversation with the next sequence
+// number. Updating the conversation first locks its row, so concurrent
+// inserts into the same conversation take turns and cannot pick the same
+// number.
+func insertMessage(tx *sql.Tx, m Message) error {
+	if m.Attachments == nil {
+		m.Attachments = []Attachment{}
+	}
+	attachments, err := json.Marshal(m.Attachments)
+	if err != nil {
+		return err
+	}
+
+	if err := validateParentMessage(tx, m); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE conversations SET updated_at=NOW(), tokens_used=tokens_used+$2 WHERE id=$1`, m.ConversationID, m.PromptTokens+m.CompletionTokens); err != nil {
+		return err
+	}
+
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(seq), 0) + 1 FROM messages WHERE conversation_id=$1`, m.ConversationID).Scan(&m.Seq); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO messages (`+messageColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)`,
+		m.ID, m.ConversationID, m.Role, m.Content, m.CreatedAt, m.UpdatedAt, m.PromptTokens, m.CompletionTokens, m.TokensEstimated, nullString(m.Name), nullString(m.ToolCallID), attachments, nullString(m.FinishReason), m.Seq, m.Streaming, nullString(m.Model), messageMetadata(m.Metadata), nullString(m.ParentMessageID), m.VariantIndex, nullContentJSON(m.ContentJSON))
+	return err
+}
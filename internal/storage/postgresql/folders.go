@@ -0,0 +1,85 @@
+package postgresql
+
+import (
+	"time"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+)
+
+// Folder groups a user's conversations.
+type Folder struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MaxFolderNameLength matches the folders.name column.
+const MaxFolderNameLength = 255
+
+func (s *Store) CreateFolder(f Folder) error {
+	_, err := s.db.Exec(`INSERT INTO folders (id, user_id, name, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`,
+		f.ID, f.UserID, f.Name, f.CreatedAt, f.UpdatedAt)
+	return err
+}
+
+// GetFoldersByUser lists a user's folders by name.
+func (s *Store) GetFoldersByUser(userID string) ([]Folder, error) {
+	rows, err := s.db.Query(`SELECT id, user_id, name, created_at, updated_at FROM folders WHERE user_id=$1 ORDER BY name ASC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Folder{}
+	for rows.Next() {
+		var f Folder
+		if err := rows.Scan(&f.ID, &f.UserID, &f.Name, &f.CreatedAt, &f.UpdatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, f)
+	}
+	return res, rows.Err()
+}
+
+func (s *Store) RenameFolder(id, userID, name string) error {
+	res, err := s.db.Exec(`UPDATE folders SET name=$3, updated_at=NOW() WHERE id=$1 AND user_id=$2`, id, userID, name)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "folder is not found")
+}
+
+// DeleteFolder removes one of userID's folders. Its conversations are kept
+// and become unfiled, as folder_id is set to null on delete.
+func (s *Store) DeleteFolder(id, userID string) error {
+	res, err := s.db.Exec(`DELETE FROM folders WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "folder is not found")
+}
+
+// SetConversationFolder moves one of userID's conversations into one of
+// their folders. An empty folderID takes it out of its folder.
+func (s *Store) SetConversationFolder(id, userID, folderID string) error {
+	if len(folderID) != 0 {
+		var owned bool
+		if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM folders WHERE id=$1 AND user_id=$2)`, folderID, userID).Scan(&owned); err != nil {
+			return err
+		}
+		if !owned {
+			return internal_errors.NewNotFoundError("folder is not found")
+		}
+	}
+
+	// the folder check is repeated in the update so a concurrently deleted
+	// or foreign folder is never assigned
+	res, err := s.db.Exec(`UPDATE conversations SET folder_id=$3 WHERE id=$1 AND user_id=$2 AND ($3::varchar IS NULL OR EXISTS (SELECT 1 FROM folders WHERE id=$3 AND user_id=$2))`,
+		id, userID, nullString(folderID))
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "conversation is not found")
+}
@@ -0,0 +1,412 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/telemetry"
+	metricname "github.com/bricks-cloud/bricksllm/internal/telemetry/metric_name"
+)
+
+// InstrumentedStore records the latency and errors of the conversation
+// queries of the Store it wraps. Every other method passes straight through.
+type InstrumentedStore struct {
+	*Store
+}
+
+func NewInstrumentedStore(s *Store) *InstrumentedStore {
+	return &InstrumentedStore{Store: s}
+}
+
+func observeQuery(operation string, start time.Time, err error) {
+	tags := []string{"operation:" + operation}
+	telemetry.Timing(metricname.HISTOGRAM_STORE_QUERY_DURATION, time.Since(start), tags, 1)
+	if err != nil {
+		telemetry.Incr(metricname.COUNTER_STORE_QUERY_ERROR, tags, 1)
+	}
+}
+
+func (s *InstrumentedStore) GetConversationsByUser(userID string, archived bool) ([]Conversation, error) {
+	start := time.Now()
+	res, err := s.Store.GetConversationsByUser(userID, archived)
+	observeQuery("get_conversations_by_user", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetConversationsByUserFiltered(userID string, archived bool, metaKey, metaValue string) ([]Conversation, error) {
+	start := time.Now()
+	res, err := s.Store.GetConversationsByUserFiltered(userID, archived, metaKey, metaValue)
+	observeQuery("get_conversations_by_user_filtered", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetConversationPreviewsByUser(userID string, archived bool, metaKey, metaValue, folderID string, createdAfter, createdBefore time.Time) ([]ConversationPreview, error) {
+	start := time.Now()
+	res, err := s.Store.GetConversationPreviewsByUser(userID, archived, metaKey, metaValue, folderID, createdAfter, createdBefore)
+	observeQuery("get_conversation_previews_by_user", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetAllConversations(limit int, beforeUpdatedAt time.Time, beforeID string) ([]Conversation, error) {
+	start := time.Now()
+	res, err := s.Store.GetAllConversations(limit, beforeUpdatedAt, beforeID)
+	observeQuery("get_all_conversations", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetConversation(id string) (*Conversation, error) {
+	start := time.Now()
+	res, err := s.Store.GetConversation(id)
+	observeQuery("get_conversation", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) CreateConversation(c Conversation) error {
+	start := time.Now()
+	err := s.Store.CreateConversation(c)
+	observeQuery("create_conversation", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) UpdateConversationTitle(id, userID, title string) error {
+	start := time.Now()
+	err := s.Store.UpdateConversationTitle(id, userID, title)
+	observeQuery("update_conversation_title", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) UpdateConversationMetadata(id, userID string, metadata json.RawMessage) error {
+	start := time.Now()
+	err := s.Store.UpdateConversationMetadata(id, userID, metadata)
+	observeQuery("update_conversation_metadata", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) SetConversationPinned(id, userID string, pinned bool) error {
+	start := time.Now()
+	err := s.Store.SetConversationPinned(id, userID, pinned)
+	observeQuery("set_conversation_pinned", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) SetConversationArchived(id, userID string, archived bool) error {
+	start := time.Now()
+	err := s.Store.SetConversationArchived(id, userID, archived)
+	observeQuery("set_conversation_archived", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) MarkConversationRead(id, userID string) error {
+	start := time.Now()
+	err := s.Store.MarkConversationRead(id, userID)
+	observeQuery("mark_conversation_read", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) ForkConversation(id, userID string, uptoMessageID string) (string, error) {
+	start := time.Now()
+	res, err := s.Store.ForkConversation(id, userID, uptoMessageID)
+	observeQuery("fork_conversation", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) CreateShareLink(id, userID string) (string, error) {
+	start := time.Now()
+	res, err := s.Store.CreateShareLink(id, userID)
+	observeQuery("create_share_link", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) RevokeShareLink(id, userID string) error {
+	start := time.Now()
+	err := s.Store.RevokeShareLink(id, userID)
+	observeQuery("revoke_share_link", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetConversationByShareToken(token string) (*Conversation, error) {
+	start := time.Now()
+	res, err := s.Store.GetConversationByShareToken(token)
+	observeQuery("get_conversation_by_share_token", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) DeleteConversations(ids []string, userID string) (int, error) {
+	start := time.Now()
+	res, err := s.Store.DeleteConversations(ids, userID)
+	observeQuery("delete_conversations", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) DeleteAllConversationsForUser(userID string) (int, error) {
+	start := time.Now()
+	res, err := s.Store.DeleteAllConversationsForUser(userID)
+	observeQuery("delete_all_conversations_for_user", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetMessages(conversationID string) ([]Message, error) {
+	start := time.Now()
+	res, err := s.Store.GetMessages(conversationID)
+	observeQuery("get_messages", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetMessagesForUser(conversationID, userID string) ([]Message, error) {
+	start := time.Now()
+	res, err := s.Store.GetMessagesForUser(conversationID, userID)
+	observeQuery("get_messages_for_user", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetMessagesForUserByRole(conversationID, userID, role string) ([]Message, error) {
+	start := time.Now()
+	res, err := s.Store.GetMessagesForUserByRole(conversationID, userID, role)
+	observeQuery("get_messages_for_user_by_role", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) CreateMessage(m Message) error {
+	start := time.Now()
+	err := s.Store.CreateMessage(m)
+	observeQuery("create_message", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) CreateMessageUnlessDuplicate(m Message, window time.Duration) (*Message, error) {
+	start := time.Now()
+	res, err := s.Store.CreateMessageUnlessDuplicate(m, window)
+	observeQuery("create_message_unless_duplicate", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) UpdateMessageContent(id, content, finishReason string, completionTokens int) error {
+	start := time.Now()
+	err := s.Store.UpdateMessageContent(id, content, finishReason, completionTokens)
+	observeQuery("update_message_content", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) ReplaceLastAssistantMessage(previousID string, m Message) error {
+	start := time.Now()
+	err := s.Store.ReplaceLastAssistantMessage(previousID, m)
+	observeQuery("replace_last_assistant_message", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) SetMessageReaction(conversationID, messageID, userID string, value int) error {
+	start := time.Now()
+	err := s.Store.SetMessageReaction(conversationID, messageID, userID, value)
+	observeQuery("set_message_reaction", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetMessageReaction(conversationID, messageID, userID string) (*Reaction, error) {
+	start := time.Now()
+	res, err := s.Store.GetMessageReaction(conversationID, messageID, userID)
+	observeQuery("get_message_reaction", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) CreateFolder(f Folder) error {
+	start := time.Now()
+	err := s.Store.CreateFolder(f)
+	observeQuery("create_folder", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetFoldersByUser(userID string) ([]Folder, error) {
+	start := time.Now()
+	res, err := s.Store.GetFoldersByUser(userID)
+	observeQuery("get_folders_by_user", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) RenameFolder(id, userID, name string) error {
+	start := time.Now()
+	err := s.Store.RenameFolder(id, userID, name)
+	observeQuery("rename_folder", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) DeleteFolder(id, userID string) error {
+	start := time.Now()
+	err := s.Store.DeleteFolder(id, userID)
+	observeQuery("delete_folder", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) SetConversationFolder(id, userID, folderID string) error {
+	start := time.Now()
+	err := s.Store.SetConversationFolder(id, userID, folderID)
+	observeQuery("set_conversation_folder", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) RecordAudit(e AuditEntry) error {
+	start := time.Now()
+	err := s.Store.RecordAudit(e)
+	observeQuery("record_audit", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetAuditEntries(userID, targetID string, limit int) ([]AuditEntry, error) {
+	start := time.Now()
+	res, err := s.Store.GetAuditEntries(userID, targetID, limit)
+	observeQuery("get_audit_entries", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) UpdateStreamingMessage(id, content string) error {
+	start := time.Now()
+	err := s.Store.UpdateStreamingMessage(id, content)
+	observeQuery("update_streaming_message", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) CompleteStreamingMessage(m Message) error {
+	start := time.Now()
+	err := s.Store.CompleteStreamingMessage(m)
+	observeQuery("complete_streaming_message", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetUserModelUsage(userID string) ([]ModelUsage, error) {
+	start := time.Now()
+	res, err := s.Store.GetUserModelUsage(userID)
+	observeQuery("get_user_model_usage", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetUserStats(userID string) (UserStats, error) {
+	start := time.Now()
+	res, err := s.Store.GetUserStats(userID)
+	observeQuery("get_user_stats", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) UpdateConversationDefaultParams(id, userID string, params *SamplingParams) error {
+	start := time.Now()
+	err := s.Store.UpdateConversationDefaultParams(id, userID, params)
+	observeQuery("update_conversation_default_params", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) SoftDeleteConversation(id, userID string) error {
+	start := time.Now()
+	err := s.Store.SoftDeleteConversation(id, userID)
+	observeQuery("soft_delete_conversation", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) RestoreConversation(id, userID string) error {
+	start := time.Now()
+	err := s.Store.RestoreConversation(id, userID)
+	observeQuery("restore_conversation", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetTrashedConversationsByUser(userID string) ([]Conversation, error) {
+	start := time.Now()
+	res, err := s.Store.GetTrashedConversationsByUser(userID)
+	observeQuery("get_trashed_conversations_by_user", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) CreateConversationWithMessages(c Conversation, msgs []Message) error {
+	start := time.Now()
+	err := s.Store.CreateConversationWithMessages(c, msgs)
+	observeQuery("create_conversation_with_messages", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) CreateTemplate(t Template) error {
+	start := time.Now()
+	err := s.Store.CreateTemplate(t)
+	observeQuery("create_template", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetTemplatesForUser(userID string) ([]Template, error) {
+	start := time.Now()
+	res, err := s.Store.GetTemplatesForUser(userID)
+	observeQuery("get_templates_for_user", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetTemplateForUser(id, userID string) (*Template, error) {
+	start := time.Now()
+	res, err := s.Store.GetTemplateForUser(id, userID)
+	observeQuery("get_template_for_user", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) DeleteTemplate(id, userID string) error {
+	start := time.Now()
+	err := s.Store.DeleteTemplate(id, userID)
+	observeQuery("delete_template", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) UpdateMessageMetadata(conversationID, messageID, userID string, metadata json.RawMessage) error {
+	start := time.Now()
+	err := s.Store.UpdateMessageMetadata(conversationID, messageID, userID, metadata)
+	observeQuery("update_message_metadata", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) MergeConversations(targetID, sourceID, userID string) error {
+	start := time.Now()
+	err := s.Store.MergeConversations(targetID, sourceID, userID)
+	observeQuery("merge_conversations", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetConversationsUpdatedSince(userID string, since time.Time) ([]Conversation, error) {
+	start := time.Now()
+	res, err := s.Store.GetConversationsUpdatedSince(userID, since)
+	observeQuery("get_conversations_updated_since", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetMessagesUpdatedSince(userID string, since time.Time) ([]Message, error) {
+	start := time.Now()
+	res, err := s.Store.GetMessagesUpdatedSince(userID, since)
+	observeQuery("get_messages_updated_since", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GrantConversationAccess(id, ownerID, userID, permission string) error {
+	start := time.Now()
+	err := s.Store.GrantConversationAccess(id, ownerID, userID, permission)
+	observeQuery("grant_conversation_access", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) RevokeConversationAccess(id, ownerID, userID string) error {
+	start := time.Now()
+	err := s.Store.RevokeConversationAccess(id, ownerID, userID)
+	observeQuery("revoke_conversation_access", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetConversationShares(id, ownerID string) ([]ConversationShare, error) {
+	start := time.Now()
+	res, err := s.Store.GetConversationShares(id, ownerID)
+	observeQuery("get_conversation_shares", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetConversationPermission(id, userID string) (string, error) {
+	start := time.Now()
+	res, err := s.Store.GetConversationPermission(id, userID)
+	observeQuery("get_conversation_permission", start, err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetMessageThread(rootID string) ([]Message, error) {
+	start := time.Now()
+	res, err := s.Store.GetMessageThread(rootID)
+	observeQuery("get_message_thread", start, err)
+	return res, err
+}
@@ -0,0 +1,68 @@
+package postgresql
+
+import (
+	"database/sql"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+)
+
+// MergeConversations moves the messages of sourceID into targetID, both of
+// userID's, and deletes sourceID. The merged messages interleave by when
+// they were created, ties keeping the target's first, and are renumbered
+// from 1. The source's token usage is added to the target's.
+func (s *Store) MergeConversations(targetID, sourceID, userID string) error {
+	if targetID == sourceID {
+		return internal_errors.NewValidationError("cannot merge a conversation into itself")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var sourceTokens int
+	if err := tx.QueryRow(`SELECT tokens_used FROM conversations WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL FOR UPDATE`, sourceID, userID).Scan(&sourceTokens); err != nil {
+		if err == sql.ErrNoRows {
+			return internal_errors.NewNotFoundError("conversation is not found")
+		}
+		return err
+	}
+
+	res, err := tx.Exec(`UPDATE conversations SET tokens_used=tokens_used+$3, updated_at=NOW() WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL`, targetID, userID, sourceTokens)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res, "conversation is not found"); err != nil {
+		return err
+	}
+
+	var targetMax int64
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(seq), 0) FROM messages WHERE conversation_id=$1`, targetID).Scan(&targetMax); err != nil {
+		return err
+	}
+
+	// (conversation_id, seq) is unique and checked row by row, so both
+	// conversations' messages are parked at distinct negative numbers,
+	// the source's below the target's, before being renumbered
+	if _, err := tx.Exec(`UPDATE messages SET seq=-seq WHERE conversation_id=$1`, targetID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE messages SET conversation_id=$1, seq=-(seq+$3) WHERE conversation_id=$2`, targetID, sourceID, targetMax); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE messages SET seq=numbered.seq, updated_at=NOW() FROM (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY created_at ASC, seq DESC) AS seq FROM messages WHERE conversation_id=$1
+		) AS numbered WHERE messages.id=numbered.id`, targetID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM conversations WHERE id=$1`, sourceID); err != nil {
+		return err
+	}
+	if err := notifyMessage(tx, targetID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,42 @@
+package postgresql
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// nullContentJSON stores messages without content parts as NULL.
+func nullContentJSON(parts json.RawMessage) interface{} {
+	trimmed := bytes.TrimSpace(parts)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return nil
+	}
+	return string(trimmed)
+}
+
+// ContentText renders a content parts array as text for search, previews
+// and models without vision. Text parts are kept as they are, one per line,
+// and other parts are named in brackets, e.g. [image].
+func ContentText(parts json.RawMessage) string {
+	var decoded []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(parts, &decoded); err != nil {
+		return ""
+	}
+
+	lines := make([]string, 0, len(decoded))
+	for _, part := range decoded {
+		switch part.Type {
+		case "text":
+			lines = append(lines, part.Text)
+		case "image_url":
+			lines = append(lines, "[image]")
+		default:
+			lines = append(lines, "["+part.Type+"]")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
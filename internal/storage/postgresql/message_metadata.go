@@ -0,0 +1,28 @@
+package postgresql
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// messageMetadata stands in an empty object for missing or null message
+// metadata, matching the column default.
+func messageMetadata(meta json.RawMessage) json.RawMessage {
+	trimmed := bytes.TrimSpace(meta)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return json.RawMessage(`{}`)
+	}
+	return meta
+}
+
+// UpdateMessageMetadata replaces the metadata of a message of one of
+// userID's conversations, e.g. to attach the sources of a reply after it
+// was stored.
+func (s *Store) UpdateMessageMetadata(conversationID, messageID, userID string, metadata json.RawMessage) error {
+	res, err := s.db.Exec(`UPDATE messages m SET metadata=$4, updated_at=NOW() FROM conversations c WHERE c.id=m.conversation_id AND m.id=$1 AND m.conversation_id=$2 AND c.user_id=$3 AND c.deleted_at IS NULL`,
+		messageID, conversationID, userID, messageMetadata(metadata))
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "message is not found")
+}
@@ -0,0 +1,294 @@
+package postgresql
+
+import (
+	"database/sql"
+	"sort"
+)
+
+// Migration is a single versioned schema change. Versions are applied in
+// ascending order and each one runs in its own transaction.
+type Migration struct {
+	Version int
+	Up      func(*sql.Tx) error
+}
+
+func execMigration(query string) func(*sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// migrations holds the conversation schema history. Append new entries with
+// the next version number; never edit one that has shipped.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Up: execMigration(`
+			CREATE TABLE IF NOT EXISTS conversations (
+				id VARCHAR(255) PRIMARY KEY,
+				title VARCHAR(500) NOT NULL DEFAULT 'New Conversation',
+				user_id VARCHAR(255) NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				metadata JSONB DEFAULT '{}'::jsonb
+			);
+			CREATE INDEX IF NOT EXISTS idx_conversations_user_id ON conversations(user_id);
+
+			CREATE TABLE IF NOT EXISTS messages (
+				id VARCHAR(255) PRIMARY KEY,
+				conversation_id VARCHAR(255) NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+				role VARCHAR(50) NOT NULL CHECK (role IN ('user', 'assistant', 'system')),
+				content TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages(conversation_id);
+		`),
+	},
+	{
+		// The role CHECK constraint is replaced by dropping and re-adding it
+		// under its default name, messages_role_check. Deployments that
+		// renamed the constraint must drop it by hand before upgrading,
+		// otherwise tool and function messages keep being rejected.
+		Version: 2,
+		Up: execMigration(`
+			ALTER TABLE conversations ADD COLUMN IF NOT EXISTS system_prompt TEXT, ADD COLUMN IF NOT EXISTS pinned BOOLEAN NOT NULL DEFAULT false, ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT false, ADD COLUMN IF NOT EXISTS token_budget INT, ADD COLUMN IF NOT EXISTS tokens_used INT NOT NULL DEFAULT 0;
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS prompt_tokens INT NOT NULL DEFAULT 0, ADD COLUMN IF NOT EXISTS completion_tokens INT NOT NULL DEFAULT 0, ADD COLUMN IF NOT EXISTS tokens_estimated BOOLEAN NOT NULL DEFAULT false, ADD COLUMN IF NOT EXISTS name VARCHAR(255), ADD COLUMN IF NOT EXISTS tool_call_id VARCHAR(255);
+			ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_role_check;
+			ALTER TABLE messages ADD CONSTRAINT messages_role_check CHECK (role IN ('user', 'assistant', 'system', 'tool', 'function'));
+		`),
+	},
+	{
+		Version: 3,
+		Up: execMigration(`
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS attachments JSONB DEFAULT '[]'::jsonb;
+		`),
+	},
+	{
+		Version: 4,
+		Up: execMigration(`
+			ALTER TABLE conversations ADD COLUMN IF NOT EXISTS share_token VARCHAR(64) UNIQUE NULL;
+		`),
+	},
+	{
+		Version: 5,
+		Up: execMigration(`
+			CREATE INDEX IF NOT EXISTS idx_conversations_metadata ON conversations USING GIN (metadata);
+		`),
+	},
+	{
+		Version: 6,
+		Up: execMigration(`
+			ALTER TABLE conversations ADD COLUMN IF NOT EXISTS last_read_at TIMESTAMP NULL;
+		`),
+	},
+	{
+		Version: 7,
+		Up: execMigration(`
+			CREATE TABLE IF NOT EXISTS reactions (
+				message_id VARCHAR(255) NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+				user_id VARCHAR(255) NOT NULL,
+				value SMALLINT NOT NULL CHECK (value IN (-1, 1)),
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (message_id, user_id)
+			);
+		`),
+	},
+	{
+		Version: 8,
+		Up: execMigration(`
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS finish_reason VARCHAR(50);
+		`),
+	},
+	{
+		Version: 9,
+		Up: execMigration(`
+			CREATE TABLE IF NOT EXISTS folders (
+				id VARCHAR(255) PRIMARY KEY,
+				user_id VARCHAR(255) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS idx_folders_user_id ON folders (user_id);
+			ALTER TABLE conversations ADD COLUMN IF NOT EXISTS folder_id VARCHAR(255) NULL REFERENCES folders(id) ON DELETE SET NULL;
+			CREATE INDEX IF NOT EXISTS idx_conversations_folder_id ON conversations (folder_id);
+		`),
+	},
+	{
+		Version: 10,
+		Up: execMigration(`
+			CREATE TABLE IF NOT EXISTS audit_log (
+				id BIGSERIAL PRIMARY KEY,
+				user_id VARCHAR(255) NOT NULL,
+				action VARCHAR(100) NOT NULL,
+				target_id VARCHAR(255) NOT NULL,
+				detail JSONB NOT NULL DEFAULT '{}',
+				created_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log (user_id, created_at);
+			CREATE INDEX IF NOT EXISTS idx_audit_log_target_id ON audit_log (target_id, created_at);
+		`),
+	},
+	{
+		// seq orders messages within a conversation where created_at can tie
+		// for rapid inserts. Existing messages are numbered by created_at.
+		Version: 11,
+		Up: execMigration(`
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS seq BIGINT;
+			UPDATE messages SET seq=numbered.seq FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY conversation_id ORDER BY created_at ASC, id ASC) AS seq FROM messages
+			) AS numbered WHERE messages.id=numbered.id AND messages.seq IS NULL;
+			ALTER TABLE messages ALTER COLUMN seq SET NOT NULL;
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_conversation_id_seq ON messages (conversation_id, seq);
+		`),
+	},
+	{
+		Version: 12,
+		Up: execMigration(`
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS streaming BOOLEAN NOT NULL DEFAULT FALSE;
+			CREATE INDEX IF NOT EXISTS idx_messages_streaming ON messages (updated_at) WHERE streaming;
+		`),
+	},
+	{
+		// serves the per-day message counts of GetUserStats
+		Version: 13,
+		Up: execMigration(`
+			CREATE INDEX IF NOT EXISTS idx_messages_conversation_id_created_at ON messages (conversation_id, created_at);
+		`),
+	},
+	{
+		Version: 14,
+		Up: execMigration(`
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS model VARCHAR(255);
+		`),
+	},
+	{
+		Version: 15,
+		Up: execMigration(`
+			ALTER TABLE conversations ADD COLUMN IF NOT EXISTS default_params JSONB;
+		`),
+	},
+	{
+		Version: 16,
+		Up: execMigration(`
+			ALTER TABLE conversations ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+			CREATE INDEX IF NOT EXISTS idx_conversations_deleted_at ON conversations (deleted_at) WHERE deleted_at IS NOT NULL;
+		`),
+	},
+	{
+		Version: 17,
+		Up: execMigration(`
+			CREATE TABLE IF NOT EXISTS templates (
+				id VARCHAR(255) PRIMARY KEY,
+				user_id VARCHAR(255) NULL,
+				name VARCHAR(255) NOT NULL,
+				system_prompt TEXT,
+				seed_messages JSONB NOT NULL DEFAULT '[]'::jsonb,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS idx_templates_user_id ON templates (user_id);
+		`),
+	},
+	{
+		Version: 18,
+		Up: execMigration(`
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+		`),
+	},
+	{
+		Version: 19,
+		Up: execMigration(`
+			CREATE TABLE IF NOT EXISTS conversation_shares (
+				conversation_id VARCHAR(255) NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+				shared_with_user_id VARCHAR(255) NOT NULL,
+				permission VARCHAR(10) NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (conversation_id, shared_with_user_id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_conversation_shares_shared_with_user_id ON conversation_shares (shared_with_user_id);
+		`),
+	},
+	{
+		// the reference is deferred so a fork can copy a thread in seq
+		// order even where a reply sorts before its parent
+		Version: 20,
+		Up: execMigration(`
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS parent_message_id VARCHAR(255) NULL REFERENCES messages(id) ON DELETE SET NULL DEFERRABLE INITIALLY DEFERRED;
+			CREATE INDEX IF NOT EXISTS idx_messages_parent_message_id ON messages (parent_message_id) WHERE parent_message_id IS NOT NULL;
+		`),
+	},
+	{
+		Version: 21,
+		Up: execMigration(`
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS variant_index INT NOT NULL DEFAULT 0;
+		`),
+	},
+	{
+		Version: 22,
+		Up: execMigration(`
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS content_json JSONB NULL;
+		`),
+	},
+}
+
+// Migrate applies every migration that is not yet recorded in
+// schema_migrations. The table lock serializes concurrent boots so each
+// version runs exactly once.
+func (s *Store) Migrate() error {
+	if _, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`); err != nil {
+		return err
+	}
+
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	for _, m := range sorted {
+		if err := s.applyMigration(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) applyMigration(m Migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`LOCK TABLE schema_migrations IN EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+
+	applied := false
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version=$1)`, m.Version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	if err := m.Up(tx); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, m.Version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
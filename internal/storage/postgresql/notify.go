@@ -0,0 +1,119 @@
+package postgresql
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// messageChannel is the NOTIFY channel message creation announces the
+// conversation id on.
+const messageChannel = "conversation_messages"
+
+// notifyMessage announces a new message of conversationID. Sent inside the
+// transaction that inserts the message, it is delivered once that commits.
+func notifyMessage(tx *sql.Tx, conversationID string) error {
+	_, err := tx.Exec(`SELECT pg_notify($1, $2)`, messageChannel, conversationID)
+	return err
+}
+
+// MessageListener LISTENs for new messages and wakes the subscribers of
+// their conversations. Wake ups carry no message, subscribers read what is
+// new themselves, so several notifications may collapse into one.
+type MessageListener struct {
+	listener *pq.Listener
+	log      *zap.Logger
+
+	mu   sync.Mutex
+	subs map[string]map[chan struct{}]struct{}
+}
+
+func NewMessageListener(connStr string, log *zap.Logger) (*MessageListener, error) {
+	l := &MessageListener{
+		log:  log,
+		subs: map[string]map[chan struct{}]struct{}{},
+	}
+
+	l.listener = pq.NewListener(connStr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Sugar().Infof("conversation message listener: %v", err)
+		}
+	})
+	if err := l.listener.Listen(messageChannel); err != nil {
+		l.listener.Close()
+		return nil, err
+	}
+
+	go l.run()
+
+	return l, nil
+}
+
+func (l *MessageListener) run() {
+	for n := range l.listener.NotificationChannel() {
+		// a nil notification follows a reconnect, anything may have been missed
+		if n == nil {
+			l.wakeAll()
+			continue
+		}
+		l.wake(n.Extra)
+	}
+}
+
+// Subscribe returns a channel that receives after messages are created in
+// conversationID, and a func that must be called to stop the subscription.
+func (l *MessageListener) Subscribe(conversationID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	l.mu.Lock()
+	if l.subs[conversationID] == nil {
+		l.subs[conversationID] = map[chan struct{}]struct{}{}
+	}
+	l.subs[conversationID][ch] = struct{}{}
+	l.mu.Unlock()
+
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		delete(l.subs[conversationID], ch)
+		if len(l.subs[conversationID]) == 0 {
+			delete(l.subs, conversationID)
+		}
+	}
+}
+
+func (l *MessageListener) wake(conversationID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ch := range l.subs[conversationID] {
+		signal(ch)
+	}
+}
+
+func (l *MessageListener) wakeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, subs := range l.subs {
+		for ch := range subs {
+			signal(ch)
+		}
+	}
+}
+
+// signal wakes ch unless a wake up is already pending.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (l *MessageListener) Close() error {
+	return l.listener.Close()
+}
@@ -0,0 +1,77 @@
+package postgresql
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+)
+
+// SamplingParams are the sampling parameters a conversation defaults to
+// when a request leaves them out. Nil fields have no default.
+type SamplingParams struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+}
+
+// Validate checks the params against the ranges OpenAI accepts.
+func (p *SamplingParams) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > 2) {
+		return internal_errors.NewValidationError("temperature must be between 0 and 2")
+	}
+	if p.TopP != nil && (*p.TopP < 0 || *p.TopP > 1) {
+		return internal_errors.NewValidationError("top_p must be between 0 and 1")
+	}
+	if p.MaxTokens != nil && *p.MaxTokens < 1 {
+		return internal_errors.NewValidationError("max_tokens must be positive")
+	}
+	return nil
+}
+
+func (p *SamplingParams) empty() bool {
+	return p == nil || (p.Temperature == nil && p.TopP == nil && p.MaxTokens == nil)
+}
+
+// nullSamplingParams stores empty params as NULL.
+func nullSamplingParams(p *SamplingParams) (sql.NullString, error) {
+	if p.empty() {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func scanSamplingParams(data sql.NullString) (*SamplingParams, error) {
+	if !data.Valid {
+		return nil, nil
+	}
+	p := &SamplingParams{}
+	if err := json.Unmarshal([]byte(data.String), p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UpdateConversationDefaultParams replaces the sampling defaults of one of
+// userID's conversations. Nil params clear them.
+func (s *Store) UpdateConversationDefaultParams(id, userID string, params *SamplingParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	data, err := nullSamplingParams(params)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(`UPDATE conversations SET default_params=$3 WHERE id=$1 AND user_id=$2`, id, userID, data)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "conversation is not found")
+}
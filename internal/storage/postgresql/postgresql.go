@@ -13,6 +13,8 @@ type Store struct {
 	db *sql.DB
 	wt time.Duration
 	rt time.Duration
+	// maxContentLength caps message content in runes, zero meaning no cap.
+	maxContentLength int
 }
 
 func NewStore(connStr string, wt time.Duration, rt time.Duration) (*Store, error) {
@@ -28,6 +30,13 @@ func NewStore(connStr string, wt time.Duration, rt time.Duration) (*Store, error
 	}, nil
 }
 
+// SetMaxMessageContentLength makes message creation reject content longer
+// than n runes. Assistant replies are exempt as they come from the model. Zero
+// turns the check off.
+func (s *Store) SetMaxMessageContentLength(n int) {
+	s.maxContentLength = n
+}
+
 type NullArray struct {
 	Array []string
 	Valid bool
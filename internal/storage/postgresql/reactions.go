@@ -0,0 +1,81 @@
+package postgresql
+
+import (
+	"database/sql"
+	"time"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+)
+
+// Reaction is a user's thumbs up (1) or thumbs down (-1) on a message.
+type Reaction struct {
+	MessageID string    `json:"message_id"`
+	UserID    string    `json:"user_id"`
+	Value     int       `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsValidReactionValue reports whether value can be stored as a reaction. A
+// value of 0 is accepted by SetMessageReaction to clear a reaction.
+func IsValidReactionValue(value int) bool {
+	return value == 1 || value == -1
+}
+
+// SetMessageReaction records userID's reaction to a message of one of their
+// conversations, replacing any earlier one. A value of 0 removes it. The
+// ownership check is part of the query, so a message in another user's
+// conversation is reported as not found.
+func (s *Store) SetMessageReaction(conversationID, messageID, userID string, value int) error {
+	if value != 0 && !IsValidReactionValue(value) {
+		return internal_errors.NewValidationError("reaction value must be 1 or -1, or 0 to clear it")
+	}
+
+	if value == 0 {
+		// only the caller's own reaction can be deleted, the ownership check
+		// just reports foreign messages as not found
+		owned, err := s.ownsMessage(conversationID, messageID, userID)
+		if err != nil {
+			return err
+		}
+		if !owned {
+			return internal_errors.NewNotFoundError("message is not found")
+		}
+		_, err = s.db.Exec(`DELETE FROM reactions WHERE message_id=$1 AND user_id=$2`, messageID, userID)
+		return err
+	}
+
+	now := time.Now()
+	res, err := s.db.Exec(`INSERT INTO reactions (message_id, user_id, value, created_at, updated_at)
+		SELECT m.id, $3, $4::smallint, $5::timestamp, $5::timestamp FROM messages m JOIN conversations c ON c.id=m.conversation_id WHERE m.id=$1 AND m.conversation_id=$2 AND c.user_id=$3
+		ON CONFLICT (message_id, user_id) DO UPDATE SET value=EXCLUDED.value, updated_at=EXCLUDED.updated_at`,
+		messageID, conversationID, userID, value, now)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "message is not found")
+}
+
+// GetMessageReaction returns userID's reaction to a message of one of their
+// conversations.
+func (s *Store) GetMessageReaction(conversationID, messageID, userID string) (*Reaction, error) {
+	var r Reaction
+	err := s.db.QueryRow(`SELECT r.message_id, r.user_id, r.value, r.created_at, r.updated_at
+		FROM reactions r JOIN messages m ON m.id=r.message_id JOIN conversations c ON c.id=m.conversation_id
+		WHERE r.message_id=$1 AND m.conversation_id=$2 AND c.user_id=$3 AND r.user_id=$3`,
+		messageID, conversationID, userID).Scan(&r.MessageID, &r.UserID, &r.Value, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, internal_errors.NewNotFoundError("reaction is not found")
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Store) ownsMessage(conversationID, messageID, userID string) (bool, error) {
+	var owned bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM messages m JOIN conversations c ON c.id=m.conversation_id WHERE m.id=$1 AND m.conversation_id=$2 AND c.user_id=$3)`,
+		messageID, conversationID, userID).Scan(&owned)
+	return owned, err
+}
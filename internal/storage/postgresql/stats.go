@@ -0,0 +1,108 @@
+package postgresql
+
+import "time"
+
+// userStatsDays is how many days of message counts GetUserStats returns.
+const userStatsDays = 30
+
+// DailyMessageCount is the number of messages sent on a day, in UTC.
+type DailyMessageCount struct {
+	Date     string `json:"date"`
+	Messages int    `json:"messages"`
+}
+
+// UserStats sums up a user's conversations.
+type UserStats struct {
+	Conversations    int                 `json:"conversations"`
+	Messages         int                 `json:"messages"`
+	PromptTokens     int                 `json:"prompt_tokens"`
+	CompletionTokens int                 `json:"completion_tokens"`
+	TotalTokens      int                 `json:"total_tokens"`
+	MessagesPerDay   []DailyMessageCount `json:"messages_per_day"`
+}
+
+// ModelUsage is the number of assistant replies a model wrote for a user and
+// the tokens they used.
+type ModelUsage struct {
+	Model        string `json:"model"`
+	MessageCount int    `json:"message_count"`
+	TotalTokens  int    `json:"total_tokens"`
+}
+
+// GetUserStats aggregates userID's conversations, messages and token usage,
+// along with the messages of each of the last 30 days, oldest first. Days
+// without messages, and users without any data, are reported as zeros.
+func (s *Store) GetUserStats(userID string) (UserStats, error) {
+	stats := UserStats{}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM conversations WHERE user_id=$1 AND deleted_at IS NULL`, userID).Scan(&stats.Conversations); err != nil {
+		return stats, err
+	}
+
+	if err := s.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(m.prompt_tokens), 0), COALESCE(SUM(m.completion_tokens), 0)
+		FROM messages m JOIN conversations c ON c.id=m.conversation_id
+		WHERE c.user_id=$1`, userID).Scan(&stats.Messages, &stats.PromptTokens, &stats.CompletionTokens); err != nil {
+		return stats, err
+	}
+	stats.TotalTokens = stats.PromptTokens + stats.CompletionTokens
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, -(userStatsDays - 1))
+	rows, err := s.db.Query(`
+		SELECT TO_CHAR(DATE_TRUNC('day', m.created_at), 'YYYY-MM-DD'), COUNT(*)
+		FROM messages m JOIN conversations c ON c.id=m.conversation_id
+		WHERE c.user_id=$1 AND m.created_at >= $2
+		GROUP BY 1`, userID, since)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var date string
+		var n int
+		if err := rows.Scan(&date, &n); err != nil {
+			return stats, err
+		}
+		counts[date] = n
+	}
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	stats.MessagesPerDay = make([]DailyMessageCount, 0, userStatsDays)
+	for day := since; !day.After(today); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		stats.MessagesPerDay = append(stats.MessagesPerDay, DailyMessageCount{Date: date, Messages: counts[date]})
+	}
+
+	return stats, nil
+}
+
+// GetUserModelUsage breaks userID's token usage down by the model of the
+// assistant replies, most tokens first. Replies stored before models were
+// recorded are grouped under an empty model.
+func (s *Store) GetUserModelUsage(userID string) ([]ModelUsage, error) {
+	rows, err := s.db.Query(`
+		SELECT COALESCE(m.model, ''), COUNT(*), COALESCE(SUM(m.prompt_tokens + m.completion_tokens), 0)
+		FROM messages m JOIN conversations c ON c.id=m.conversation_id
+		WHERE c.user_id=$1 AND m.role='assistant'
+		GROUP BY 1
+		ORDER BY 3 DESC, 1 ASC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []ModelUsage{}
+	for rows.Next() {
+		var u ModelUsage
+		if err := rows.Scan(&u.Model, &u.MessageCount, &u.TotalTokens); err != nil {
+			return nil, err
+		}
+		res = append(res, u)
+	}
+
+	return res, rows.Err()
+}
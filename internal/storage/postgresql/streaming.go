@@ -0,0 +1,62 @@
+package postgresql
+
+import (
+	"database/sql"
+	"time"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+)
+
+// FinishReasonInterrupted marks an assistant reply whose stream ended
+// before the model finished, e.g. because the upstream or the proxy went
+// away.
+const FinishReasonInterrupted = "interrupted"
+
+// UpdateStreamingMessage saves the reply received so far for a message
+// that is still streaming.
+func (s *Store) UpdateStreamingMessage(id, content string) error {
+	res, err := s.db.Exec(`UPDATE messages SET content=$2, updated_at=NOW() WHERE id=$1 AND streaming`, id, content)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "message is not found")
+}
+
+// CompleteStreamingMessage stores the final reply, usage and finish reason
+// of a streaming message and adds its tokens to the conversation.
+func (s *Store) CompleteStreamingMessage(m Message) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var conversationID string
+	if err := tx.QueryRow(`UPDATE messages SET content=$2, prompt_tokens=$3, completion_tokens=$4, tokens_estimated=$5, finish_reason=$6, streaming=FALSE, updated_at=NOW() WHERE id=$1 AND streaming RETURNING conversation_id`,
+		m.ID, m.Content, m.PromptTokens, m.CompletionTokens, m.TokensEstimated, nullString(m.FinishReason)).Scan(&conversationID); err != nil {
+		if err == sql.ErrNoRows {
+			return internal_errors.NewNotFoundError("message is not found")
+		}
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE conversations SET updated_at=NOW(), tokens_used=tokens_used+$2 WHERE id=$1`, conversationID, m.PromptTokens+m.CompletionTokens); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CompleteStaleStreamingMessages marks messages that are still streaming
+// but have not been saved for olderThan as interrupted, keeping whatever
+// reply they got. It recovers replies whose stream died with the process.
+func (s *Store) CompleteStaleStreamingMessages(olderThan time.Duration) (int, error) {
+	res, err := s.db.Exec(`UPDATE messages SET streaming=FALSE, finish_reason=COALESCE(finish_reason, $2) WHERE streaming AND updated_at < $1`,
+		time.Now().Add(-olderThan), FinishReasonInterrupted)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,33 @@
+package postgresql
+
+import "time"
+
+// GetConversationsUpdatedSince lists the conversations userID owns or was
+// given access to that changed after since, oldest change first, for
+// clients syncing incrementally. Trashed conversations are included with
+// their deletion time so clients can drop them, but conversations erased
+// for good are not reported.
+func (s *Store) GetConversationsUpdatedSince(userID string, since time.Time) ([]Conversation, error) {
+	return s.listConversations(`SELECT `+conversationListColumns+` FROM conversations WHERE `+accessibleBy(1)+` AND (updated_at > $2 OR deleted_at > $2) ORDER BY updated_at ASC`, userID, since)
+}
+
+// GetMessagesUpdatedSince lists the messages of the conversations userID
+// can access, leaving out trashed ones, that were written or changed after
+// since, in conversation order.
+func (s *Store) GetMessagesUpdatedSince(userID string, since time.Time) ([]Message, error) {
+	rows, err := s.db.Query(`SELECT `+messageColumns+` FROM messages WHERE updated_at > $2 AND conversation_id IN (SELECT id FROM conversations WHERE `+accessibleBy(1)+` AND deleted_at IS NULL) ORDER BY conversation_id, seq ASC`, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Message{}
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
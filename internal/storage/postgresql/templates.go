@@ -0,0 +1,111 @@
+package postgresql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+)
+
+// Template seeds new conversations with a system prompt and opening
+// messages, e.g. a translator's greeting. Templates without a user are
+// global: every user can start from them but none can change them.
+type Template struct {
+	ID           string            `json:"id"`
+	UserID       string            `json:"user_id,omitempty"`
+	Name         string            `json:"name"`
+	SystemPrompt string            `json:"system_prompt"`
+	SeedMessages []TemplateMessage `json:"seed_messages"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// TemplateMessage is a message every conversation started from a template
+// opens with.
+type TemplateMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// MaxTemplateNameLength matches the templates.name column.
+const MaxTemplateNameLength = 255
+
+const templateColumns = `id, user_id, name, system_prompt, seed_messages, created_at, updated_at`
+
+func scanTemplate(row rowScanner) (Template, error) {
+	var t Template
+	var userID, systemPrompt sql.NullString
+	var seeds []byte
+	if err := row.Scan(&t.ID, &userID, &t.Name, &systemPrompt, &seeds, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal(seeds, &t.SeedMessages); err != nil {
+		return t, err
+	}
+	t.UserID = userID.String
+	t.SystemPrompt = systemPrompt.String
+	return t, nil
+}
+
+// CreateTemplate stores t, which is global when it has no user.
+func (s *Store) CreateTemplate(t Template) error {
+	for _, m := range t.SeedMessages {
+		if !IsValidMessageRole(m.Role) {
+			return invalidMessageRoleError(m.Role)
+		}
+	}
+	if t.SeedMessages == nil {
+		t.SeedMessages = []TemplateMessage{}
+	}
+	seeds, err := json.Marshal(t.SeedMessages)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO templates (`+templateColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		t.ID, nullString(t.UserID), t.Name, nullString(t.SystemPrompt), seeds, t.CreatedAt, t.UpdatedAt)
+	return err
+}
+
+// GetTemplatesForUser lists the global templates followed by userID's own,
+// each by name.
+func (s *Store) GetTemplatesForUser(userID string) ([]Template, error) {
+	rows, err := s.db.Query(`SELECT `+templateColumns+` FROM templates WHERE user_id IS NULL OR user_id=$1 ORDER BY user_id IS NOT NULL, name ASC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Template{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
+
+// GetTemplateForUser returns a global template or one of userID's own.
+func (s *Store) GetTemplateForUser(id, userID string) (*Template, error) {
+	t, err := scanTemplate(s.db.QueryRow(`SELECT `+templateColumns+` FROM templates WHERE id=$1 AND (user_id IS NULL OR user_id=$2)`, id, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, internal_errors.NewNotFoundError("template is not found")
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// DeleteTemplate removes one of userID's templates. Global templates are
+// never removed this way.
+func (s *Store) DeleteTemplate(id, userID string) error {
+	res, err := s.db.Exec(`DELETE FROM templates WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "template is not found")
+}
@@ -0,0 +1,55 @@
+package postgresql
+
+import (
+	"database/sql"
+
+	internal_errors "github.com/bricks-cloud/bricksllm/internal/errors"
+)
+
+// validateParentMessage checks that the message m replies to, if any, is in
+// the same conversation.
+func validateParentMessage(tx *sql.Tx, m Message) error {
+	if len(m.ParentMessageID) == 0 {
+		return nil
+	}
+
+	var found bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM messages WHERE id=$1 AND conversation_id=$2)`, m.ParentMessageID, m.ConversationID).Scan(&found); err != nil {
+		return err
+	}
+	if !found {
+		return internal_errors.NewValidationError("parent message is not found in the conversation")
+	}
+	return nil
+}
+
+// GetMessageThread returns the message rootID followed by every reply to it,
+// directly or through other replies, in conversation order.
+func (s *Store) GetMessageThread(rootID string) ([]Message, error) {
+	rows, err := s.db.Query(`WITH RECURSIVE thread AS (
+			SELECT id FROM messages WHERE id=$1
+			UNION
+			SELECT m.id FROM messages m JOIN thread t ON m.parent_message_id=t.id
+		)
+		SELECT `+messageColumns+` FROM messages WHERE id IN (SELECT id FROM thread) ORDER BY id=$1 DESC, seq ASC`, rootID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []Message
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, internal_errors.NewNotFoundError("message is not found")
+	}
+	return res, nil
+}
@@ -0,0 +1,76 @@
+package postgresql
+
+import (
+	"errors"
+	"time"
+)
+
+// trashPurgeLock is the advisory lock key, "trash" in ASCII, held while
+// trash is purged so only one purge runs at a time across all instances.
+const trashPurgeLock = 0x7472617368
+
+// ErrPurgeInProgress is returned by PurgeTrash when another purge is
+// already running.
+var ErrPurgeInProgress = errors.New("a trash purge is already in progress")
+
+// SoftDeleteConversation moves one of userID's conversations to the trash.
+// Trashed conversations keep their messages but are left out of lists and
+// lookups until restored or purged.
+func (s *Store) SoftDeleteConversation(id, userID string) error {
+	res, err := s.db.Exec(`UPDATE conversations SET deleted_at=NOW(), updated_at=NOW() WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL`, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "conversation is not found")
+}
+
+// RestoreConversation takes one of userID's conversations back out of the
+// trash.
+func (s *Store) RestoreConversation(id, userID string) error {
+	res, err := s.db.Exec(`UPDATE conversations SET deleted_at=NULL, updated_at=NOW() WHERE id=$1 AND user_id=$2 AND deleted_at IS NOT NULL`, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res, "conversation is not found in the trash")
+}
+
+// GetTrashedConversationsByUser lists a user's trashed conversations, most
+// recently deleted first.
+func (s *Store) GetTrashedConversationsByUser(userID string) ([]Conversation, error) {
+	return s.listConversations(`SELECT `+conversationListColumns+` FROM conversations WHERE user_id=$1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`, userID)
+}
+
+// PurgeTrash erases the conversations trashed more than olderThan ago, and
+// through the cascade their messages. It returns how many were erased, or
+// ErrPurgeInProgress without erasing any when another purge is running.
+func (s *Store) PurgeTrash(olderThan time.Duration) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRow(`SELECT pg_try_advisory_xact_lock($1)`, trashPurgeLock).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, ErrPurgeInProgress
+	}
+
+	res, err := tx.Exec(`DELETE FROM conversations WHERE deleted_at < $1`, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,64 @@
+package postgresql
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TrashPurger runs PurgeTrash every interval, erasing conversations that
+// have been in the trash for longer than retention.
+type TrashPurger struct {
+	store     *Store
+	interval  time.Duration
+	retention time.Duration
+	log       *zap.Logger
+	done      chan struct{}
+}
+
+func NewTrashPurger(store *Store, interval, retention time.Duration, log *zap.Logger) *TrashPurger {
+	return &TrashPurger{
+		store:     store,
+		interval:  interval,
+		retention: retention,
+		log:       log,
+		done:      make(chan struct{}),
+	}
+}
+
+// Run starts purging in the background until Stop is called.
+func (p *TrashPurger) Run() {
+	ticker := time.NewTicker(p.interval)
+	p.log.Sugar().Infof("purging conversations trashed for over %s every %s", p.retention, p.interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.purge()
+			}
+		}
+	}()
+}
+
+func (p *TrashPurger) purge() {
+	n, err := p.store.PurgeTrash(p.retention)
+	if err == ErrPurgeInProgress {
+		p.log.Debug("skipped trash purge, another one is in progress")
+		return
+	}
+	if err != nil {
+		p.log.Sugar().Infof("error purging trashed conversations: %v", err)
+		return
+	}
+
+	p.log.Sugar().Infof("purged %d trashed conversations", n)
+}
+
+func (p *TrashPurger) Stop() {
+	close(p.done)
+}
@@ -5,7 +5,10 @@ package metricname
 // counter metric names
 const (
 	COUNTER_AUTHENTICATOR_FOUND_KEY_FROM_MEMDB string = "bricksllm.authenticator.authenticate_http_request.found_key_from_memdb"
+	COUNTER_STORE_QUERY_ERROR                  string = "bricksllm.store.query.error"
 )
 
 // histogram metric names
-const ()
+const (
+	HISTOGRAM_STORE_QUERY_DURATION string = "bricksllm.store.query.duration"
+)
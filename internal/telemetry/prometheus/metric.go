@@ -1,22 +1,91 @@
 package prometheus
 
 import (
-	metricname "github.com/bricks-cloud/bricksllm/internal/telemetry/metric_name"
+	"strings"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-func (c *Client) initMetrics() {
-	{
-		metricName := metricname.COUNTER_AUTHENTICATOR_FOUND_KEY_FROM_MEMDB
-		c.CounterMetrics[metricName] = prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: metricName,
-			},
-			[]string{},
-		)
-		prometheus.MustRegister(c.CounterMetrics[metricName])
+// Metric names carry request ids and upstream urls in their tags, so the
+// registry aggregates on the name alone: every stat lands in one of a fixed
+// set of vectors labelled by its name.
+const nameLabel = "name"
+
+var latencyBuckets = prometheus.ExponentialBuckets(0.01, 2, 16)
+
+type metrics struct {
+	requests    *prometheus.CounterVec
+	errors      *prometheus.CounterVec
+	retries     *prometheus.CounterVec
+	cacheHits   *prometheus.CounterVec
+	cacheMisses *prometheus.CounterVec
+	tokens      *prometheus.CounterVec
+	events      *prometheus.CounterVec
+	latency     *prometheus.HistogramVec
+	ttft        *prometheus.HistogramVec
+	durations   *prometheus.HistogramVec
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	counter := func(name, help string) *prometheus.CounterVec {
+		c := prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: "bricksllm", Name: name, Help: help}, []string{nameLabel})
+		reg.MustRegister(c)
+		return c
 	}
-	{
-		// TODO add other metrics here
+	histogram := func(name, help string) *prometheus.HistogramVec {
+		h := prometheus.NewHistogramVec(prometheus.HistogramOpts{Namespace: "bricksllm", Name: name, Help: help, Buckets: latencyBuckets}, []string{nameLabel})
+		reg.MustRegister(h)
+		return h
 	}
+
+	return &metrics{
+		requests:    counter("requests_total", "Requests received, by handler."),
+		errors:      counter("errors_total", "Errors, by the stat that reported them."),
+		retries:     counter("retries_total", "Retries and upstream failovers."),
+		cacheHits:   counter("cache_hits_total", "Cache hits."),
+		cacheMisses: counter("cache_misses_total", "Cache misses."),
+		tokens:      counter("tokens_total", "Prompt and completion tokens of recorded events."),
+		events:      counter("events_total", "Other counted stats."),
+		latency:     histogram("latency_seconds", "Handler and upstream latency."),
+		ttft:        histogram("ttft_seconds", "Time to the first token of streamed replies."),
+		durations:   histogram("duration_seconds", "Other timed stats."),
+	}
+}
+
+func lastSegment(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func (m *metrics) counterFor(name string) *prometheus.CounterVec {
+	last := lastSegment(name)
+
+	switch {
+	case last == "requests" || last == "request" || strings.HasSuffix(last, "_requests"):
+		return m.requests
+	case last == "error" || strings.HasSuffix(last, "_error") || strings.HasSuffix(last, "_err") || last == "error_response":
+		return m.errors
+	case strings.Contains(last, "retry") || last == "failover":
+		return m.retries
+	case last == "cache_hit":
+		return m.cacheHits
+	case last == "cache_miss":
+		return m.cacheMisses
+	case strings.HasSuffix(last, "tokens"):
+		return m.tokens
+	}
+
+	return m.events
+}
+
+func (m *metrics) histogramFor(name string) *prometheus.HistogramVec {
+	last := lastSegment(name)
+
+	switch {
+	case last == "ttft":
+		return m.ttft
+	case strings.Contains(last, "latency"):
+		return m.latency
+	}
+
+	return m.durations
 }
@@ -1,64 +1,105 @@
 package prometheus
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
 )
 
 type Config struct {
 	Enabled bool
-	Port    string
+	// Port, when set, serves the registry on its own listener in addition
+	// to the proxy's /metrics route.
+	Port string
 }
 
 type Client struct {
-	Config           Config
-	CounterMetrics   map[string]*prometheus.CounterVec
-	HistogramMetrics map[string]*prometheus.HistogramVec
+	Config   Config
+	registry *prometheus.Registry
+	metrics  *metrics
+	// server is the listener on Config.Port, if any.
+	server *http.Server
 }
 
-func Init(cfg Config) (*Client, error) {
+func Init(cfg Config, log *zap.Logger) (*Client, error) {
 	c := &Client{
-		Config:           cfg,
-		CounterMetrics:   make(map[string]*prometheus.CounterVec),
-		HistogramMetrics: make(map[string]*prometheus.HistogramVec),
+		Config: cfg,
 	}
 
-	c.initMetrics()
+	if !cfg.Enabled {
+		return c, nil
+	}
+
+	c.registry = prometheus.NewRegistry()
+	c.metrics = newMetrics(c.registry)
+
+	if len(cfg.Port) != 0 {
+		ln, err := net.Listen("tcp", ":"+cfg.Port)
+		if err != nil {
+			return nil, err
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", c.Handler())
+		c.server = &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       time.Minute,
+		}
 
-	http.Handle("/metrics", promhttp.Handler())
-	err := http.ListenAndServe(":"+cfg.Port, nil)
-	if err != nil {
-		return nil, err
+		go func() {
+			if err := c.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+				log.Sugar().Errorf("error prometheus metrics server listening: %v", err)
+			}
+		}()
 	}
 
 	return c, nil
 }
 
-func (c *Client) Incr(name string, tags []string, rate float64) {
-	if c == nil {
-		return
+// Shutdown stops the listener on Config.Port. It is a no-op when there is
+// none.
+func (c *Client) Shutdown(ctx context.Context) error {
+	if c == nil || c.server == nil {
+		return nil
 	}
 
-	counterMetric, exists := c.CounterMetrics[name]
-	if !exists {
-		return
+	return c.server.Shutdown(ctx)
+}
+
+// Handler serves the registry in the Prometheus exposition format. It is nil
+// when the client is disabled.
+func (c *Client) Handler() http.Handler {
+	if c == nil || c.registry == nil {
+		return nil
 	}
 
-	counterMetric.WithLabelValues(tags...).Inc()
+	return promhttp.HandlerFor(c.registry, promhttp.HandlerOpts{})
 }
 
-func (c *Client) Timing(name string, value time.Duration, tags []string, rate float64) {
-	if c == nil {
+func (c *Client) Incr(name string, tags []string, rate float64) {
+	c.Count(name, 1, tags, rate)
+}
+
+func (c *Client) Count(name string, value int64, tags []string, rate float64) {
+	if c == nil || c.metrics == nil || value <= 0 {
 		return
 	}
 
-	histogramMetric, exists := c.HistogramMetrics[name]
-	if !exists {
+	c.metrics.counterFor(name).WithLabelValues(name).Add(float64(value))
+}
+
+func (c *Client) Timing(name string, value time.Duration, tags []string, rate float64) {
+	if c == nil || c.metrics == nil {
 		return
 	}
 
-	histogramMetric.WithLabelValues(tags...).Observe(float64(value))
+	c.metrics.histogramFor(name).WithLabelValues(name).Observe(value.Seconds())
 }
@@ -0,0 +1,89 @@
+package prometheus
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestClient_Handler(t *testing.T) {
+	c, err := Init(Config{Enabled: true}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Incr("bricksllm.proxy.get_chat_completion_handler.requests", []string{"request_id:1"}, 1)
+	c.Incr("bricksllm.proxy.get_chat_completion_handler.requests", []string{"request_id:2"}, 1)
+	c.Incr("bricksllm.proxy.get_chat_completion_handler.openai_http_client_error", nil, 1)
+	c.Incr("bricksllm.proxy.get_chat_completion_alias_handler.json_mode_retry", nil, 1)
+	c.Incr("bricksllm.proxy.upstream_pool.failover", nil, 1)
+	c.Incr("bricksllm.proxy.get_embedding_handler.cache_hit", nil, 1)
+	c.Count("bricksllm.message.handler.handle_event_with_request_and_response.prompt_tokens", 12, nil, 1)
+	c.Count("bricksllm.message.handler.handle_event_with_request_and_response.completion_tokens", 0, nil, 1)
+	c.Incr("bricksllm.proxy.get_chat_completion_handler.success", nil, 1)
+	c.Timing("bricksllm.proxy.get_chat_completion_handler.latency", 1500*time.Millisecond, nil, 1)
+	c.Timing("bricksllm.proxy.alias.ttft", 200*time.Millisecond, nil, 1)
+	c.Timing("bricksllm.proxy.alias.stream_duration", time.Second, nil, 1)
+
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	data, _ := io.ReadAll(rec.Body)
+	body := string(data)
+
+	for _, expected := range []string{
+		`bricksllm_requests_total{name="bricksllm.proxy.get_chat_completion_handler.requests"} 2`,
+		`bricksllm_errors_total{name="bricksllm.proxy.get_chat_completion_handler.openai_http_client_error"} 1`,
+		`bricksllm_retries_total{name="bricksllm.proxy.get_chat_completion_alias_handler.json_mode_retry"} 1`,
+		`bricksllm_retries_total{name="bricksllm.proxy.upstream_pool.failover"} 1`,
+		`bricksllm_cache_hits_total{name="bricksllm.proxy.get_embedding_handler.cache_hit"} 1`,
+		`bricksllm_tokens_total{name="bricksllm.message.handler.handle_event_with_request_and_response.prompt_tokens"} 12`,
+		`bricksllm_events_total{name="bricksllm.proxy.get_chat_completion_handler.success"} 1`,
+		`bricksllm_latency_seconds_sum{name="bricksllm.proxy.get_chat_completion_handler.latency"} 1.5`,
+		`bricksllm_ttft_seconds_count{name="bricksllm.proxy.alias.ttft"} 1`,
+		`bricksllm_duration_seconds_count{name="bricksllm.proxy.alias.stream_duration"} 1`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %q in:\n%s", expected, body)
+		}
+	}
+	if strings.Contains(body, "completion_tokens") {
+		t.Fatalf("expected zero counts not to create series, got:\n%s", body)
+	}
+}
+
+func TestClient_Disabled(t *testing.T) {
+	c, err := Init(Config{Enabled: false, Port: "0"}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Handler() != nil {
+		t.Fatal("expected no handler for a disabled client")
+	}
+
+	c.Incr("bricksllm.proxy.get_chat_completion_handler.requests", nil, 1)
+	c.Timing("bricksllm.proxy.alias.ttft", time.Second, nil, 1)
+}
+
+func TestClient_Shutdown(t *testing.T) {
+	c, err := Init(Config{Enabled: true, Port: "0"}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("expected the metrics listener to shut down, got %v", err)
+	}
+
+	disabled, err := Init(Config{Enabled: false}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := disabled.Shutdown(context.Background()); err != nil {
+		t.Fatalf("expected shutting down a client without a listener to be a no-op, got %v", err)
+	}
+}
@@ -34,6 +34,12 @@ func (c *Client) Incr(name string, tags []string, rate float64) {
 	}
 }
 
+func (c *Client) Count(name string, value int64, tags []string, rate float64) {
+	if c != nil && c.config.Enabled {
+		c.statsdc.Count(name, value, tags, rate)
+	}
+}
+
 func (c *Client) Timing(name string, value time.Duration, tags []string, rate float64) {
 	if c != nil && c.config.Enabled {
 		c.statsdc.Timing(name, value, tags, rate)
@@ -1,12 +1,15 @@
 package telemetry
 
 import (
+	"context"
 	"errors"
+	"net/http"
 	"time"
 
 	configPkg "github.com/bricks-cloud/bricksllm/internal/config"
 	"github.com/bricks-cloud/bricksllm/internal/telemetry/prometheus"
 	"github.com/bricks-cloud/bricksllm/internal/telemetry/stats"
+	"go.uber.org/zap"
 )
 
 type ProviderType string
@@ -18,16 +21,43 @@ const (
 
 type Provider interface {
 	Incr(name string, tags []string, rate float64)
+	Count(name string, value int64, tags []string, rate float64)
 	Timing(name string, value time.Duration, tags []string, rate float64)
 }
 
 type Client struct {
 	Provider Provider
+	// Metrics serves the Prometheus registry the stats are aggregated in. It
+	// is nil when Prometheus is disabled.
+	Metrics http.Handler
+	// prometheus owns the metrics listener on its own port, if any.
+	prometheus *prometheus.Client
+}
+
+// providers fans every stat out to each of its providers.
+type providers []Provider
+
+func (ps providers) Incr(name string, tags []string, rate float64) {
+	for _, p := range ps {
+		p.Incr(name, tags, rate)
+	}
+}
+
+func (ps providers) Count(name string, value int64, tags []string, rate float64) {
+	for _, p := range ps {
+		p.Count(name, value, tags, rate)
+	}
+}
+
+func (ps providers) Timing(name string, value time.Duration, tags []string, rate float64) {
+	for _, p := range ps {
+		p.Timing(name, value, tags, rate)
+	}
 }
 
 var Singleton *Client
 
-func Init(cfg *configPkg.Config) error {
+func Init(cfg *configPkg.Config, log *zap.Logger) error {
 	if cfg == nil {
 		return errors.New("config is empty")
 	}
@@ -46,6 +76,21 @@ func Init(cfg *configPkg.Config) error {
 			Provider: c,
 		}
 
+		if cfg.PrometheusEnabled {
+			p, err := prometheus.Init(prometheus.Config{
+				Enabled: true,
+			}, log)
+
+			if err != nil {
+				return err
+			}
+
+			Singleton = &Client{
+				Provider: providers{c, p},
+				Metrics:  p.Handler(),
+			}
+		}
+
 		return nil
 	}
 
@@ -53,14 +98,16 @@ func Init(cfg *configPkg.Config) error {
 		p, err := prometheus.Init(prometheus.Config{
 			Enabled: cfg.PrometheusEnabled,
 			Port:    cfg.PrometheusPort,
-		})
+		}, log)
 
 		if err != nil {
 			return err
 		}
 
 		Singleton = &Client{
-			Provider: p,
+			Provider:   p,
+			Metrics:    p.Handler(),
+			prometheus: p,
 		}
 
 		return nil
@@ -75,8 +122,33 @@ func Incr(name string, tags []string, rate float64) {
 	}
 }
 
+func Count(name string, value int64, tags []string, rate float64) {
+	if Singleton != nil {
+		Singleton.Provider.Count(name, value, tags, rate)
+	}
+}
+
 func Timing(name string, value time.Duration, tags []string, rate float64) {
 	if Singleton != nil {
 		Singleton.Provider.Timing(name, value, tags, rate)
 	}
 }
+
+// Handler serves the aggregated stats in the Prometheus exposition format, or
+// is nil when Prometheus is disabled.
+func Handler() http.Handler {
+	if Singleton != nil {
+		return Singleton.Metrics
+	}
+
+	return nil
+}
+
+// Shutdown stops the Prometheus metrics listener, if one was started.
+func Shutdown(ctx context.Context) error {
+	if Singleton != nil {
+		return Singleton.prometheus.Shutdown(ctx)
+	}
+
+	return nil
+}
@@ -0,0 +1,1305 @@
+package testing
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bricks-cloud/bricksllm/internal/storage/postgresql"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func connectToConversationStore(t testing.TB) *postgresql.Store {
+	store, err := postgresql.NewStore("postgresql:///?sslmode=disable&user=postgres&password=postgres&host=localhost&port=5432", 5*time.Second, 10*time.Second)
+	require.Nil(t, err)
+	require.Nil(t, store.Migrate())
+	return store
+}
+
+func createTestConversation(t testing.TB, store *postgresql.Store, userID string, updatedAt time.Time) postgresql.Conversation {
+	conv := postgresql.Conversation{
+		ID:        uuid.NewString(),
+		Title:     "test",
+		UserID:    userID,
+		CreatedAt: updatedAt,
+		UpdatedAt: updatedAt,
+	}
+	require.Nil(t, store.CreateConversation(conv))
+	return conv
+}
+
+func TestConversation_MessageBumpsUpdatedAt(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	t.Run("when a message is added the conversation moves to the top", func(t *testing.T) {
+		older := createTestConversation(t, store, userID, time.Now().Add(-2*time.Hour))
+		newer := createTestConversation(t, store, userID, time.Now().Add(-1*time.Hour))
+
+		convs, err := store.GetConversationsByUser(userID, false)
+		require.Nil(t, err)
+		require.Len(t, convs, 2)
+		require.Equal(t, newer.ID, convs[0].ID)
+
+		now := time.Now()
+		err = store.CreateMessage(postgresql.Message{
+			ID:             uuid.NewString(),
+			ConversationID: older.ID,
+			Role:           "user",
+			Content:        "hello",
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+		require.Nil(t, err)
+
+		convs, err = store.GetConversationsByUser(userID, false)
+		require.Nil(t, err)
+		require.Len(t, convs, 2)
+		require.Equal(t, older.ID, convs[0].ID)
+	})
+
+	t.Run("when a message insert fails the conversation is not bumped", func(t *testing.T) {
+		convs, err := store.GetConversationsByUser(userID, false)
+		require.Nil(t, err)
+		before := convs[0].UpdatedAt
+
+		err = store.CreateMessage(postgresql.Message{
+			ID:             uuid.NewString(),
+			ConversationID: convs[0].ID,
+			Role:           "not-a-role",
+			Content:        "hello",
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		})
+		require.NotNil(t, err)
+
+		conv, err := store.GetConversation(convs[0].ID)
+		require.Nil(t, err)
+		require.Equal(t, before, conv.UpdatedAt)
+	})
+}
+
+func TestConversation_MigrateIsIdempotent(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+
+	t.Run("when migrations run again nothing is reapplied", func(t *testing.T) {
+		var before int
+		require.Nil(t, db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&before))
+
+		require.Nil(t, store.Migrate())
+
+		var after int
+		require.Nil(t, db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&after))
+		require.Equal(t, before, after)
+		require.NotZero(t, after)
+	})
+}
+
+func TestConversation_FilterByMetadata(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	t.Run("when filtering by a metadata tag only matching conversations are listed", func(t *testing.T) {
+		now := time.Now()
+		work := postgresql.Conversation{ID: uuid.NewString(), Title: "work", UserID: userID, CreatedAt: now, UpdatedAt: now, Metadata: []byte(`{"folder":"work","color":"red"}`)}
+		home := postgresql.Conversation{ID: uuid.NewString(), Title: "home", UserID: userID, CreatedAt: now, UpdatedAt: now, Metadata: []byte(`{"folder":"home"}`)}
+		require.Nil(t, store.CreateConversation(work))
+		require.Nil(t, store.CreateConversation(home))
+
+		convs, err := store.GetConversationsByUserFiltered(userID, false, "folder", "work")
+		require.Nil(t, err)
+		require.Len(t, convs, 1)
+		require.Equal(t, work.ID, convs[0].ID)
+	})
+}
+
+func TestConversation_Fork(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	now := time.Now()
+	src := postgresql.Conversation{ID: uuid.NewString(), Title: "source", UserID: userID, CreatedAt: now, UpdatedAt: now, Metadata: []byte(`{"folder":"work"}`), SystemPrompt: "be brief"}
+	require.Nil(t, store.CreateConversation(src))
+
+	var ids []string
+	for i, role := range []string{"user", "assistant", "user"} {
+		at := now.Add(time.Duration(i) * time.Second)
+		m := postgresql.Message{ID: uuid.NewString(), ConversationID: src.ID, Role: role, Content: role, CreatedAt: at, UpdatedAt: at}
+		require.Nil(t, store.CreateMessage(m))
+		ids = append(ids, m.ID)
+	}
+
+	t.Run("when forking without upto every message is copied", func(t *testing.T) {
+		forkID, err := store.ForkConversation(src.ID, userID, "")
+		require.Nil(t, err)
+		require.NotEqual(t, src.ID, forkID)
+
+		fork, err := store.GetConversation(forkID)
+		require.Nil(t, err)
+		require.Equal(t, userID, fork.UserID)
+		require.Equal(t, "be brief", fork.SystemPrompt)
+		require.JSONEq(t, `{"folder":"work"}`, string(fork.Metadata))
+
+		msgs, err := store.GetMessages(forkID)
+		require.Nil(t, err)
+		require.Len(t, msgs, 3)
+	})
+
+	t.Run("when forking up to a message later ones are left out", func(t *testing.T) {
+		forkID, err := store.ForkConversation(src.ID, userID, ids[1])
+		require.Nil(t, err)
+
+		msgs, err := store.GetMessages(forkID)
+		require.Nil(t, err)
+		require.Len(t, msgs, 2)
+		require.Equal(t, "assistant", msgs[1].Role)
+	})
+
+	t.Run("when another user forks the conversation it is not found", func(t *testing.T) {
+		_, err := store.ForkConversation(src.ID, uuid.NewString(), "")
+		require.NotNil(t, err)
+	})
+}
+
+func TestConversation_UnreadCount(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	conv := createTestConversation(t, store, userID, time.Now())
+	addMessage := func(role string, at time.Time) {
+		require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: role, Content: role, CreatedAt: at, UpdatedAt: at}))
+	}
+
+	t.Run("when replies arrive they are unread until the conversation is read", func(t *testing.T) {
+		addMessage("user", time.Now().Add(-time.Minute))
+		addMessage("assistant", time.Now().Add(-time.Minute))
+
+		convs, err := store.GetConversationsByUser(userID, false)
+		require.Nil(t, err)
+		require.Len(t, convs, 1)
+		require.Equal(t, 1, convs[0].UnreadCount)
+		require.Nil(t, convs[0].LastReadAt)
+
+		require.Nil(t, store.MarkConversationRead(conv.ID, userID))
+
+		convs, err = store.GetConversationsByUser(userID, false)
+		require.Nil(t, err)
+		require.Equal(t, 0, convs[0].UnreadCount)
+		require.NotNil(t, convs[0].LastReadAt)
+	})
+
+	t.Run("when another user marks the conversation read it is not found", func(t *testing.T) {
+		require.NotNil(t, store.MarkConversationRead(conv.ID, uuid.NewString()))
+	})
+}
+
+func TestConversation_PreviewsIncludeLatestMessage(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	t.Run("when listing previews each conversation carries its latest message", func(t *testing.T) {
+		empty := createTestConversation(t, store, userID, time.Now().Add(-time.Hour))
+		conv := createTestConversation(t, store, userID, time.Now().Add(-2*time.Hour))
+		for i, content := range []string{"first", "latest"} {
+			at := time.Now().Add(time.Duration(i) * time.Second)
+			require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "user", Content: content, CreatedAt: at, UpdatedAt: at}))
+		}
+
+		previews, err := store.GetConversationPreviewsByUser(userID, false, "", "", "", time.Time{}, time.Time{})
+		require.Nil(t, err)
+		require.Len(t, previews, 2)
+		require.Equal(t, conv.ID, previews[0].ID)
+		require.Equal(t, "latest", previews[0].LastMessage)
+		require.NotNil(t, previews[0].LastMessageAt)
+		require.Equal(t, empty.ID, previews[1].ID)
+		require.Empty(t, previews[1].LastMessage)
+		require.Nil(t, previews[1].LastMessageAt)
+	})
+}
+
+func TestConversation_MessagesForUser(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	empty := createTestConversation(t, store, userID, time.Now())
+	conv := createTestConversation(t, store, userID, time.Now())
+	require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "user", Content: "hi", CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+
+	t.Run("when the owner lists messages they are returned", func(t *testing.T) {
+		msgs, err := store.GetMessagesForUser(conv.ID, userID)
+		require.Nil(t, err)
+		require.Len(t, msgs, 1)
+
+		msgs, err = store.GetMessagesForUser(empty.ID, userID)
+		require.Nil(t, err)
+		require.Empty(t, msgs)
+	})
+
+	t.Run("when another user lists messages the conversation is not found", func(t *testing.T) {
+		msgs, err := store.GetMessagesForUser(conv.ID, uuid.NewString())
+		require.NotNil(t, err)
+		require.Empty(t, msgs)
+
+		msgs, err = store.GetMessagesForUserByRole(conv.ID, uuid.NewString(), "user")
+		require.NotNil(t, err)
+		require.Empty(t, msgs)
+	})
+
+	t.Run("when the owner lists messages by role only that role is returned", func(t *testing.T) {
+		msgs, err := store.GetMessagesForUserByRole(conv.ID, userID, "user")
+		require.Nil(t, err)
+		require.Len(t, msgs, 1)
+
+		msgs, err = store.GetMessagesForUserByRole(conv.ID, userID, "assistant")
+		require.Nil(t, err)
+		require.Empty(t, msgs)
+
+		_, err = store.GetMessagesForUserByRole(conv.ID, userID, "developer")
+		require.NotNil(t, err)
+	})
+}
+
+func TestConversation_MessageReactions(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	conv := createTestConversation(t, store, userID, time.Now())
+	msg := postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "assistant", Content: "hi", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.Nil(t, store.CreateMessage(msg))
+
+	t.Run("when the owner reacts the latest reaction is kept", func(t *testing.T) {
+		require.Nil(t, store.SetMessageReaction(conv.ID, msg.ID, userID, 1))
+		require.Nil(t, store.SetMessageReaction(conv.ID, msg.ID, userID, -1))
+
+		r, err := store.GetMessageReaction(conv.ID, msg.ID, userID)
+		require.Nil(t, err)
+		require.Equal(t, -1, r.Value)
+	})
+
+	t.Run("when the reaction is cleared it is not found", func(t *testing.T) {
+		require.Nil(t, store.SetMessageReaction(conv.ID, msg.ID, userID, 0))
+
+		_, err := store.GetMessageReaction(conv.ID, msg.ID, userID)
+		require.NotNil(t, err)
+	})
+
+	t.Run("when another user reacts the message is not found", func(t *testing.T) {
+		require.NotNil(t, store.SetMessageReaction(conv.ID, msg.ID, uuid.NewString(), 1))
+		require.NotNil(t, store.SetMessageReaction(conv.ID, msg.ID, uuid.NewString(), 0))
+	})
+
+	t.Run("when the value is not a thumbs up or down it is rejected", func(t *testing.T) {
+		require.NotNil(t, store.SetMessageReaction(conv.ID, msg.ID, userID, 2))
+	})
+}
+
+func TestConversation_UpdateMessageContent(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	conv := createTestConversation(t, store, userID, time.Now())
+	truncated := postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "assistant", Content: "once upon", CompletionTokens: 3, FinishReason: "length", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.Nil(t, store.CreateMessage(truncated))
+
+	t.Run("when a truncated reply is continued its content and tokens are extended", func(t *testing.T) {
+		require.Nil(t, store.UpdateMessageContent(truncated.ID, "once upon a time", "stop", 2))
+
+		msgs, err := store.GetMessages(conv.ID)
+		require.Nil(t, err)
+		require.Len(t, msgs, 1)
+		require.Equal(t, "once upon a time", msgs[0].Content)
+		require.Equal(t, "stop", msgs[0].FinishReason)
+		require.Equal(t, 5, msgs[0].CompletionTokens)
+
+		got, err := store.GetConversation(conv.ID)
+		require.Nil(t, err)
+		require.Equal(t, 5, got.TokensUsed)
+	})
+
+	t.Run("when the reply is no longer truncated it is not found", func(t *testing.T) {
+		require.NotNil(t, store.UpdateMessageContent(truncated.ID, "again", "stop", 1))
+	})
+}
+
+func TestConversation_Folders(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM folders WHERE user_id=$1", userID)
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	now := time.Now()
+	folder := postgresql.Folder{ID: uuid.NewString(), UserID: userID, Name: "work", CreatedAt: now, UpdatedAt: now}
+	require.Nil(t, store.CreateFolder(folder))
+	filed := createTestConversation(t, store, userID, now)
+	createTestConversation(t, store, userID, now)
+
+	t.Run("when a conversation is filed it is listed by its folder", func(t *testing.T) {
+		require.Nil(t, store.SetConversationFolder(filed.ID, userID, folder.ID))
+
+		previews, err := store.GetConversationPreviewsByUser(userID, false, "", "", folder.ID, time.Time{}, time.Time{})
+		require.Nil(t, err)
+		require.Len(t, previews, 1)
+		require.Equal(t, filed.ID, previews[0].ID)
+		require.Equal(t, folder.ID, previews[0].FolderID)
+	})
+
+	t.Run("when another user files into the folder it is not found", func(t *testing.T) {
+		other := createTestConversation(t, store, uuid.NewString(), now)
+		defer db.Exec("DELETE FROM conversations WHERE id=$1", other.ID)
+
+		require.NotNil(t, store.SetConversationFolder(other.ID, other.UserID, folder.ID))
+		require.NotNil(t, store.RenameFolder(folder.ID, other.UserID, "stolen"))
+		require.NotNil(t, store.DeleteFolder(folder.ID, other.UserID))
+	})
+
+	t.Run("when the folder is deleted its conversations are unfiled", func(t *testing.T) {
+		require.Nil(t, store.DeleteFolder(folder.ID, userID))
+
+		folders, err := store.GetFoldersByUser(userID)
+		require.Nil(t, err)
+		require.Len(t, folders, 0)
+
+		got, err := store.GetConversation(filed.ID)
+		require.Nil(t, err)
+		require.Empty(t, got.FolderID)
+	})
+}
+
+func TestConversation_MessageSequence(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	t.Run("when messages share a timestamp they keep their insert order", func(t *testing.T) {
+		conv := createTestConversation(t, store, userID, time.Now())
+		now := time.Now()
+		ids := []string{}
+		for i := 0; i < 5; i++ {
+			id := uuid.NewString()
+			ids = append(ids, id)
+			require.Nil(t, store.CreateMessage(postgresql.Message{ID: id, ConversationID: conv.ID, Role: "user", Content: "hi", CreatedAt: now, UpdatedAt: now}))
+		}
+
+		msgs, err := store.GetMessages(conv.ID)
+		require.Nil(t, err)
+		require.Len(t, msgs, 5)
+		for i, m := range msgs {
+			require.Equal(t, ids[i], m.ID)
+			require.Equal(t, int64(i+1), m.Seq)
+		}
+	})
+
+	t.Run("when messages are inserted concurrently every one gets its own number", func(t *testing.T) {
+		conv := createTestConversation(t, store, userID, time.Now())
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "user", Content: "hi", CreatedAt: time.Now(), UpdatedAt: time.Now()})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.Nil(t, err)
+		}
+
+		msgs, err := store.GetMessages(conv.ID)
+		require.Nil(t, err)
+		require.Len(t, msgs, 10)
+		for i, m := range msgs {
+			require.Equal(t, int64(i+1), m.Seq)
+		}
+	})
+}
+
+func TestConversation_StreamingMessages(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	conv := createTestConversation(t, store, userID, time.Now())
+
+	t.Run("when a streaming message is completed its usage is counted", func(t *testing.T) {
+		m := postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "assistant", CreatedAt: time.Now(), UpdatedAt: time.Now(), Streaming: true}
+		require.Nil(t, store.CreateMessage(m))
+		require.Nil(t, store.UpdateStreamingMessage(m.ID, "Hel"))
+
+		msgs, err := store.GetMessages(conv.ID)
+		require.Nil(t, err)
+		require.Len(t, msgs, 1)
+		require.True(t, msgs[0].Streaming)
+		require.Equal(t, "Hel", msgs[0].Content)
+
+		m.Content = "Hello"
+		m.CompletionTokens = 2
+		m.FinishReason = "stop"
+		require.Nil(t, store.CompleteStreamingMessage(m))
+		require.NotNil(t, store.UpdateStreamingMessage(m.ID, "late"))
+
+		msgs, err = store.GetMessages(conv.ID)
+		require.Nil(t, err)
+		require.False(t, msgs[0].Streaming)
+		require.Equal(t, "Hello", msgs[0].Content)
+
+		got, err := store.GetConversation(conv.ID)
+		require.Nil(t, err)
+		require.Equal(t, 2, got.TokensUsed)
+	})
+
+	t.Run("when a streaming message goes stale it is marked interrupted", func(t *testing.T) {
+		stale := postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "assistant", Content: "partial", CreatedAt: time.Now().Add(-time.Hour), UpdatedAt: time.Now().Add(-time.Hour), Streaming: true}
+		fresh := postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "assistant", CreatedAt: time.Now(), UpdatedAt: time.Now(), Streaming: true}
+		require.Nil(t, store.CreateMessage(stale))
+		require.Nil(t, store.CreateMessage(fresh))
+
+		_, err := store.CompleteStaleStreamingMessages(time.Minute)
+		require.Nil(t, err)
+
+		msgs, err := store.GetMessages(conv.ID)
+		require.Nil(t, err)
+		require.Len(t, msgs, 3)
+		require.False(t, msgs[1].Streaming)
+		require.Equal(t, postgresql.FinishReasonInterrupted, msgs[1].FinishReason)
+		require.Equal(t, "partial", msgs[1].Content)
+		require.True(t, msgs[2].Streaming)
+	})
+}
+
+func TestConversation_UserStats(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	t.Run("when the user has no data every count is zero", func(t *testing.T) {
+		stats, err := store.GetUserStats(userID)
+		require.Nil(t, err)
+		require.Equal(t, 0, stats.Conversations)
+		require.Equal(t, 0, stats.TotalTokens)
+		require.Len(t, stats.MessagesPerDay, 30)
+		require.Equal(t, 0, stats.MessagesPerDay[29].Messages)
+	})
+
+	t.Run("when the user has messages they are summed up", func(t *testing.T) {
+		conv := createTestConversation(t, store, userID, time.Now())
+		createTestConversation(t, store, userID, time.Now())
+		require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "user", Content: "hi", PromptTokens: 3, CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+		require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "assistant", Content: "hello", CompletionTokens: 4, CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+		require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "user", Content: "old", CreatedAt: time.Now().AddDate(0, 0, -60), UpdatedAt: time.Now()}))
+
+		stats, err := store.GetUserStats(userID)
+		require.Nil(t, err)
+		require.Equal(t, 2, stats.Conversations)
+		require.Equal(t, 3, stats.Messages)
+		require.Equal(t, 7, stats.TotalTokens)
+
+		recent := 0
+		for _, day := range stats.MessagesPerDay {
+			recent += day.Messages
+		}
+		require.Equal(t, 2, recent)
+	})
+}
+
+func TestConversation_MessageDedup(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	newMessage := func(conversationID, content string, createdAt time.Time) postgresql.Message {
+		return postgresql.Message{ID: uuid.NewString(), ConversationID: conversationID, Role: "user", Content: content, CreatedAt: createdAt, UpdatedAt: createdAt}
+	}
+
+	t.Run("when the latest message repeats within the window it is returned", func(t *testing.T) {
+		conv := createTestConversation(t, store, userID, time.Now())
+		first := newMessage(conv.ID, "hi", time.Now())
+		existing, err := store.CreateMessageUnlessDuplicate(first, 5*time.Second)
+		require.Nil(t, err)
+		require.Nil(t, existing)
+
+		existing, err = store.CreateMessageUnlessDuplicate(newMessage(conv.ID, "hi", time.Now()), 5*time.Second)
+		require.Nil(t, err)
+		require.NotNil(t, existing)
+		require.Equal(t, first.ID, existing.ID)
+
+		msgs, err := store.GetMessages(conv.ID)
+		require.Nil(t, err)
+		require.Len(t, msgs, 1)
+	})
+
+	t.Run("when the latest message differs or is older than the window a new one is created", func(t *testing.T) {
+		conv := createTestConversation(t, store, userID, time.Now())
+		require.Nil(t, store.CreateMessage(newMessage(conv.ID, "hi", time.Now().Add(-time.Minute))))
+
+		existing, err := store.CreateMessageUnlessDuplicate(newMessage(conv.ID, "hi", time.Now()), 5*time.Second)
+		require.Nil(t, err)
+		require.Nil(t, existing)
+
+		existing, err = store.CreateMessageUnlessDuplicate(newMessage(conv.ID, "hello", time.Now()), 5*time.Second)
+		require.Nil(t, err)
+		require.Nil(t, existing)
+
+		msgs, err := store.GetMessages(conv.ID)
+		require.Nil(t, err)
+		require.Len(t, msgs, 3)
+	})
+}
+
+func TestConversation_MaxMessageContentLength(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	store.SetMaxMessageContentLength(4)
+
+	conv := createTestConversation(t, store, userID, time.Now())
+	newMessage := func(role, content string) postgresql.Message {
+		return postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: role, Content: content, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	}
+
+	require.Nil(t, store.CreateMessage(newMessage("user", "שלום")))
+	require.NotNil(t, store.CreateMessage(newMessage("user", "שלום!")))
+	require.Nil(t, store.CreateMessage(newMessage("assistant", "a longer reply from the model")))
+
+	msgs, err := store.GetMessages(conv.ID)
+	require.Nil(t, err)
+	require.Len(t, msgs, 2)
+}
+
+func TestConversation_DeleteConversations(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID, otherUserID := uuid.NewString(), uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1 OR user_id=$2", userID, otherUserID)
+
+	first := createTestConversation(t, store, userID, time.Now())
+	second := createTestConversation(t, store, userID, time.Now())
+	kept := createTestConversation(t, store, userID, time.Now())
+	other := createTestConversation(t, store, otherUserID, time.Now())
+	require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: first.ID, Role: "user", Content: "hi", CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+
+	n, err := store.DeleteConversations([]string{first.ID, second.ID, other.ID, uuid.NewString()}, userID)
+	require.Nil(t, err)
+	require.Equal(t, 2, n)
+
+	_, err = store.GetConversation(first.ID)
+	require.NotNil(t, err)
+	_, err = store.GetConversation(kept.ID)
+	require.Nil(t, err)
+	_, err = store.GetConversation(other.ID)
+	require.Nil(t, err)
+
+	msgs, err := store.GetMessages(first.ID)
+	require.Nil(t, err)
+	require.Len(t, msgs, 0)
+}
+
+func TestConversation_DeleteAllConversationsForUser(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID, otherUserID := uuid.NewString(), uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1 OR user_id=$2", userID, otherUserID)
+
+	first := createTestConversation(t, store, userID, time.Now())
+	second := createTestConversation(t, store, userID, time.Now())
+	other := createTestConversation(t, store, otherUserID, time.Now())
+	require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: first.ID, Role: "user", Content: "hi", CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+
+	otherMsg := postgresql.Message{ID: uuid.NewString(), ConversationID: other.ID, Role: "assistant", Content: "hi", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.Nil(t, store.CreateMessage(otherMsg))
+	require.Nil(t, store.SetMessageReaction(other.ID, otherMsg.ID, otherUserID, 1))
+	_, err := db.Exec("INSERT INTO reactions (message_id, user_id, value) VALUES ($1, $2, 1)", otherMsg.ID, userID)
+	require.Nil(t, err)
+
+	now := time.Now()
+	require.Nil(t, store.CreateFolder(postgresql.Folder{ID: uuid.NewString(), UserID: userID, Name: "work", CreatedAt: now, UpdatedAt: now}))
+	require.Nil(t, store.CreateTemplate(postgresql.Template{ID: uuid.NewString(), UserID: userID, Name: "Translator", CreatedAt: now, UpdatedAt: now}))
+	require.Nil(t, store.GrantConversationAccess(other.ID, otherUserID, userID, postgresql.PermissionRead))
+
+	n, err := store.DeleteAllConversationsForUser(userID)
+	require.Nil(t, err)
+	require.Equal(t, 2, n)
+
+	_, err = store.GetConversation(first.ID)
+	require.NotNil(t, err)
+	_, err = store.GetConversation(second.ID)
+	require.NotNil(t, err)
+	_, err = store.GetConversation(other.ID)
+	require.Nil(t, err)
+
+	msgs, err := store.GetMessages(first.ID)
+	require.Nil(t, err)
+	require.Len(t, msgs, 0)
+
+	var reactions int
+	require.Nil(t, db.QueryRow("SELECT COUNT(*) FROM reactions WHERE user_id=$1", userID).Scan(&reactions))
+	require.Zero(t, reactions)
+	_, err = store.GetMessageReaction(other.ID, otherMsg.ID, otherUserID)
+	require.Nil(t, err)
+
+	folders, err := store.GetFoldersByUser(userID)
+	require.Nil(t, err)
+	require.Empty(t, folders)
+
+	templates, err := store.GetTemplatesForUser(userID)
+	require.Nil(t, err)
+	for _, tmpl := range templates {
+		require.NotEqual(t, userID, tmpl.UserID)
+	}
+
+	shares, err := store.GetConversationShares(other.ID, otherUserID)
+	require.Nil(t, err)
+	require.Empty(t, shares)
+}
+
+func TestConversation_UserModelUsage(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	conv := createTestConversation(t, store, userID, time.Now())
+	newReply := func(model string, tokens int) postgresql.Message {
+		return postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "assistant", Content: "hi", Model: model, PromptTokens: tokens, CompletionTokens: tokens, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	}
+	require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "user", Content: "hi", PromptTokens: 100, CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+	require.Nil(t, store.CreateMessage(newReply("llama3", 5)))
+	require.Nil(t, store.CreateMessage(newReply("gpt-4o-mini", 20)))
+	require.Nil(t, store.CreateMessage(newReply("llama3", 5)))
+
+	usage, err := store.GetUserModelUsage(userID)
+	require.Nil(t, err)
+	require.Equal(t, []postgresql.ModelUsage{
+		{Model: "gpt-4o-mini", MessageCount: 1, TotalTokens: 40},
+		{Model: "llama3", MessageCount: 2, TotalTokens: 20},
+	}, usage)
+
+	msgs, err := store.GetMessages(conv.ID)
+	require.Nil(t, err)
+	require.Equal(t, "llama3", msgs[1].Model)
+
+	usage, err = store.GetUserModelUsage(uuid.NewString())
+	require.Nil(t, err)
+	require.Len(t, usage, 0)
+}
+
+func TestConversation_PreviewsByDateRange(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	now := time.Now()
+	old := createTestConversation(t, store, userID, now.Add(-10*24*time.Hour))
+	lastWeek := createTestConversation(t, store, userID, now.Add(-6*24*time.Hour))
+	today := createTestConversation(t, store, userID, now)
+
+	ids := func(previews []postgresql.ConversationPreview) []string {
+		res := []string{}
+		for _, p := range previews {
+			res = append(res, p.ID)
+		}
+		return res
+	}
+
+	previews, err := store.GetConversationPreviewsByUser(userID, false, "", "", "", now.Add(-7*24*time.Hour), now.Add(-5*24*time.Hour))
+	require.Nil(t, err)
+	require.Equal(t, []string{lastWeek.ID}, ids(previews))
+
+	previews, err = store.GetConversationPreviewsByUser(userID, false, "", "", "", now.Add(-7*24*time.Hour), time.Time{})
+	require.Nil(t, err)
+	require.Equal(t, []string{today.ID, lastWeek.ID}, ids(previews))
+
+	previews, err = store.GetConversationPreviewsByUser(userID, false, "", "", "", time.Time{}, now.Add(-7*24*time.Hour))
+	require.Nil(t, err)
+	require.Equal(t, []string{old.ID}, ids(previews))
+}
+
+func TestConversation_GetAllConversationsTies(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	// far in the future so other tests' conversations sort after these
+	at := time.Now().Add(200 * 365 * 24 * time.Hour).Truncate(time.Second)
+	expected := []string{}
+	for i := 0; i < 3; i++ {
+		expected = append(expected, createTestConversation(t, store, userID, at).ID)
+	}
+
+	first, err := store.GetAllConversations(2, time.Time{}, "")
+	require.Nil(t, err)
+	require.Len(t, first, 2)
+	require.True(t, first[1].UpdatedAt.Equal(at))
+
+	second, err := store.GetAllConversations(2, first[1].UpdatedAt, first[1].ID)
+	require.Nil(t, err)
+	require.NotEmpty(t, second)
+
+	// the third conversation shares the boundary's updated_at and must not
+	// be skipped
+	require.ElementsMatch(t, expected, []string{first[0].ID, first[1].ID, second[0].ID})
+}
+
+func TestConversation_GetAllConversations(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userA, userB := uuid.NewString(), uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1 OR user_id=$2", userA, userB)
+
+	// far in the future so other tests' conversations sort after these
+	base := time.Now().Add(100 * 365 * 24 * time.Hour)
+	oldest := createTestConversation(t, store, userA, base)
+	middle := createTestConversation(t, store, userB, base.Add(time.Minute))
+	newest := createTestConversation(t, store, userA, base.Add(2*time.Minute))
+
+	page, err := store.GetAllConversations(2, time.Time{}, "")
+	require.Nil(t, err)
+	require.Len(t, page, 2)
+	require.Equal(t, newest.ID, page[0].ID)
+	require.Equal(t, middle.ID, page[1].ID)
+	require.Equal(t, userB, page[1].UserID)
+
+	page, err = store.GetAllConversations(2, page[1].UpdatedAt, page[1].ID)
+	require.Nil(t, err)
+	require.NotEmpty(t, page)
+	require.Equal(t, oldest.ID, page[0].ID)
+}
+
+func TestConversation_MessageNotifications(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	listener, err := postgresql.NewMessageListener("postgresql:///?sslmode=disable&user=postgres&password=postgres&host=localhost&port=5432", zap.NewNop())
+	require.Nil(t, err)
+	defer listener.Close()
+
+	conv := createTestConversation(t, store, userID, time.Now())
+	other := createTestConversation(t, store, userID, time.Now())
+	wake, unsubscribe := listener.Subscribe(conv.ID)
+	defer unsubscribe()
+
+	now := time.Now()
+	require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: other.ID, Role: "user", Content: "elsewhere", CreatedAt: now, UpdatedAt: now}))
+	select {
+	case <-wake:
+		t.Fatal("expected no wake up for another conversation")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "user", Content: "hi", CreatedAt: now, UpdatedAt: now}))
+	select {
+	case <-wake:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a wake up after creating a message")
+	}
+}
+
+func TestConversation_DefaultParams(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	conv := createTestConversation(t, store, userID, time.Now())
+	got, err := store.GetConversation(conv.ID)
+	require.Nil(t, err)
+	require.Nil(t, got.DefaultParams)
+
+	temperature, maxTokens := 0.4, 128
+	require.Nil(t, store.UpdateConversationDefaultParams(conv.ID, userID, &postgresql.SamplingParams{Temperature: &temperature, MaxTokens: &maxTokens}))
+	got, err = store.GetConversation(conv.ID)
+	require.Nil(t, err)
+	require.Equal(t, temperature, *got.DefaultParams.Temperature)
+	require.Nil(t, got.DefaultParams.TopP)
+	require.Equal(t, maxTokens, *got.DefaultParams.MaxTokens)
+
+	forkID, err := store.ForkConversation(conv.ID, userID, "")
+	require.Nil(t, err)
+	fork, err := store.GetConversation(forkID)
+	require.Nil(t, err)
+	require.Equal(t, got.DefaultParams, fork.DefaultParams)
+
+	tooHot := 2.5
+	require.NotNil(t, store.UpdateConversationDefaultParams(conv.ID, userID, &postgresql.SamplingParams{Temperature: &tooHot}))
+	require.NotNil(t, store.UpdateConversationDefaultParams(conv.ID, uuid.NewString(), nil))
+
+	require.Nil(t, store.UpdateConversationDefaultParams(conv.ID, userID, &postgresql.SamplingParams{}))
+	got, err = store.GetConversation(conv.ID)
+	require.Nil(t, err)
+	require.Nil(t, got.DefaultParams)
+}
+
+func TestConversation_SoftDeleteAndRestore(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	conv := createTestConversation(t, store, userID, time.Now())
+	kept := createTestConversation(t, store, userID, time.Now())
+	require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "user", Content: "hi", CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+
+	require.NotNil(t, store.SoftDeleteConversation(conv.ID, uuid.NewString()))
+	require.NotNil(t, store.RestoreConversation(conv.ID, userID))
+	require.Nil(t, store.SoftDeleteConversation(conv.ID, userID))
+	require.NotNil(t, store.SoftDeleteConversation(conv.ID, userID))
+
+	list, err := store.GetConversationsByUser(userID, false)
+	require.Nil(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, kept.ID, list[0].ID)
+
+	_, err = store.GetConversation(conv.ID)
+	require.NotNil(t, err)
+	_, err = store.GetMessagesForUser(conv.ID, userID)
+	require.NotNil(t, err)
+
+	trash, err := store.GetTrashedConversationsByUser(userID)
+	require.Nil(t, err)
+	require.Len(t, trash, 1)
+	require.Equal(t, conv.ID, trash[0].ID)
+	require.NotNil(t, trash[0].DeletedAt)
+
+	require.Nil(t, store.RestoreConversation(conv.ID, userID))
+	restored, err := store.GetConversation(conv.ID)
+	require.Nil(t, err)
+	require.Nil(t, restored.DeletedAt)
+	msgs, err := store.GetMessagesForUser(conv.ID, userID)
+	require.Nil(t, err)
+	require.Len(t, msgs, 1)
+}
+
+func TestConversation_PurgeTrash(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	old := createTestConversation(t, store, userID, time.Now())
+	recent := createTestConversation(t, store, userID, time.Now())
+	active := createTestConversation(t, store, userID, time.Now())
+	require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: old.ID, Role: "user", Content: "hi", CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+	require.Nil(t, store.SoftDeleteConversation(old.ID, userID))
+	require.Nil(t, store.SoftDeleteConversation(recent.ID, userID))
+	_, err := db.Exec("UPDATE conversations SET deleted_at=NOW() - INTERVAL '2 days' WHERE id=$1", old.ID)
+	require.Nil(t, err)
+
+	// another purge holding the lock makes this one skip
+	tx, err := db.Begin()
+	require.Nil(t, err)
+	_, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", int64(0x7472617368))
+	require.Nil(t, err)
+	_, err = store.PurgeTrash(24 * time.Hour)
+	require.Equal(t, postgresql.ErrPurgeInProgress, err)
+	require.Nil(t, tx.Rollback())
+
+	n, err := store.PurgeTrash(24 * time.Hour)
+	require.Nil(t, err)
+	require.GreaterOrEqual(t, n, 1)
+
+	trash, err := store.GetTrashedConversationsByUser(userID)
+	require.Nil(t, err)
+	require.Len(t, trash, 1)
+	require.Equal(t, recent.ID, trash[0].ID)
+
+	var messages int
+	require.Nil(t, db.QueryRow("SELECT COUNT(*) FROM messages WHERE conversation_id=$1", old.ID).Scan(&messages))
+	require.Zero(t, messages)
+
+	_, err = store.GetConversation(active.ID)
+	require.Nil(t, err)
+}
+
+func TestConversation_Templates(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	otherID := uuid.NewString()
+	defer db.Exec("DELETE FROM templates WHERE user_id IN ($1, $2)", userID, otherID)
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	now := time.Now()
+	global := postgresql.Template{ID: uuid.NewString(), Name: "Code Reviewer", SystemPrompt: "Review the code.", CreatedAt: now, UpdatedAt: now}
+	require.Nil(t, store.CreateTemplate(global))
+	defer db.Exec("DELETE FROM templates WHERE id=$1", global.ID)
+	own := postgresql.Template{ID: uuid.NewString(), UserID: userID, Name: "Translator", SystemPrompt: "Translate to French.", SeedMessages: []postgresql.TemplateMessage{{Role: "assistant", Content: "What should I translate?"}}, CreatedAt: now, UpdatedAt: now}
+	require.Nil(t, store.CreateTemplate(own))
+	require.NotNil(t, store.CreateTemplate(postgresql.Template{ID: uuid.NewString(), UserID: userID, Name: "bad", SeedMessages: []postgresql.TemplateMessage{{Role: "robot"}}, CreatedAt: now, UpdatedAt: now}))
+
+	templates, err := store.GetTemplatesForUser(userID)
+	require.Nil(t, err)
+	ids := []string{}
+	for _, tmpl := range templates {
+		ids = append(ids, tmpl.ID)
+	}
+	require.Contains(t, ids, global.ID)
+	require.Contains(t, ids, own.ID)
+
+	// other users read global templates but not each other's
+	_, err = store.GetTemplateForUser(global.ID, otherID)
+	require.Nil(t, err)
+	_, err = store.GetTemplateForUser(own.ID, otherID)
+	require.NotNil(t, err)
+	require.NotNil(t, store.DeleteTemplate(global.ID, userID))
+	require.NotNil(t, store.DeleteTemplate(own.ID, otherID))
+
+	tmpl, err := store.GetTemplateForUser(own.ID, userID)
+	require.Nil(t, err)
+	require.Equal(t, own.SeedMessages, tmpl.SeedMessages)
+
+	conv := postgresql.Conversation{ID: uuid.NewString(), Title: tmpl.Name, UserID: userID, CreatedAt: now, UpdatedAt: now, SystemPrompt: tmpl.SystemPrompt}
+	seed := postgresql.Message{ID: uuid.NewString(), Role: "assistant", Content: tmpl.SeedMessages[0].Content, CreatedAt: now, UpdatedAt: now}
+	require.Nil(t, store.CreateConversationWithMessages(conv, []postgresql.Message{seed}))
+
+	messages, err := store.GetMessagesForUser(conv.ID, userID)
+	require.Nil(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, "What should I translate?", messages[0].Content)
+
+	require.Nil(t, store.DeleteTemplate(own.ID, userID))
+	_, err = store.GetTemplateForUser(own.ID, userID)
+	require.NotNil(t, err)
+}
+
+func TestConversation_MessageMetadata(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	conv := createTestConversation(t, store, userID, time.Now())
+	plain := postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "user", Content: "hi", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.Nil(t, store.CreateMessage(plain))
+	cited := postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "assistant", Content: "hello", CreatedAt: time.Now(), UpdatedAt: time.Now(), Metadata: json.RawMessage(`{"citations":[{"url":"https://example.com"}]}`)}
+	require.Nil(t, store.CreateMessage(cited))
+
+	messages, err := store.GetMessagesForUser(conv.ID, userID)
+	require.Nil(t, err)
+	require.Len(t, messages, 2)
+	require.JSONEq(t, `{}`, string(messages[0].Metadata))
+	require.JSONEq(t, `{"citations":[{"url":"https://example.com"}]}`, string(messages[1].Metadata))
+
+	require.NotNil(t, store.UpdateMessageMetadata(conv.ID, plain.ID, uuid.NewString(), json.RawMessage(`{"x":1}`)))
+	require.Nil(t, store.UpdateMessageMetadata(conv.ID, plain.ID, userID, json.RawMessage(`{"x":1}`)))
+
+	forkID, err := store.ForkConversation(conv.ID, userID, "")
+	require.Nil(t, err)
+	forked, err := store.GetMessagesForUser(forkID, userID)
+	require.Nil(t, err)
+	require.Len(t, forked, 2)
+	require.JSONEq(t, `{"x":1}`, string(forked[0].Metadata))
+	require.JSONEq(t, string(cited.Metadata), string(forked[1].Metadata))
+}
+
+func TestConversation_Merge(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	target := createTestConversation(t, store, userID, time.Now())
+	source := createTestConversation(t, store, userID, time.Now())
+	other := createTestConversation(t, store, uuid.NewString(), time.Now())
+	defer db.Exec("DELETE FROM conversations WHERE id=$1", other.ID)
+
+	base := time.Now().Add(-time.Hour)
+	add := func(conversationID, content string, offset time.Duration) {
+		require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conversationID, Role: "user", Content: content, CreatedAt: base.Add(offset), UpdatedAt: base.Add(offset)}))
+	}
+	add(target.ID, "t1", 0)
+	add(source.ID, "s1", time.Minute)
+	add(target.ID, "t2", 2*time.Minute)
+	add(source.ID, "s2", 2*time.Minute)
+	add(source.ID, "s3", 3*time.Minute)
+
+	require.NotNil(t, store.MergeConversations(target.ID, target.ID, userID))
+	require.NotNil(t, store.MergeConversations(target.ID, other.ID, userID))
+	require.NotNil(t, store.MergeConversations(target.ID, source.ID, uuid.NewString()))
+
+	require.Nil(t, store.MergeConversations(target.ID, source.ID, userID))
+
+	messages, err := store.GetMessagesForUser(target.ID, userID)
+	require.Nil(t, err)
+	contents := []string{}
+	for i, m := range messages {
+		require.Equal(t, int64(i+1), m.Seq)
+		contents = append(contents, m.Content)
+	}
+	require.Equal(t, []string{"t1", "s1", "t2", "s2", "s3"}, contents)
+
+	_, err = store.GetConversation(source.ID)
+	require.NotNil(t, err)
+}
+
+func TestConversation_UpdatedSince(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	old := createTestConversation(t, store, userID, time.Now().Add(-time.Hour))
+	trashed := createTestConversation(t, store, userID, time.Now().Add(-time.Hour))
+	since := time.Now().Add(-time.Minute)
+
+	fresh := createTestConversation(t, store, userID, time.Now())
+	require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: fresh.ID, Role: "user", Content: "hi", CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+	require.Nil(t, store.SoftDeleteConversation(trashed.ID, userID))
+
+	conversations, err := store.GetConversationsUpdatedSince(userID, since)
+	require.Nil(t, err)
+	ids := map[string]bool{}
+	for _, c := range conversations {
+		ids[c.ID] = true
+	}
+	require.True(t, ids[fresh.ID])
+	require.True(t, ids[trashed.ID])
+	require.False(t, ids[old.ID])
+
+	messages, err := store.GetMessagesUpdatedSince(userID, since)
+	require.Nil(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, fresh.ID, messages[0].ConversationID)
+
+	messages, err = store.GetMessagesUpdatedSince(uuid.NewString(), since)
+	require.Nil(t, err)
+	require.Empty(t, messages)
+}
+
+func TestConversation_Collaborators(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	ownerID := uuid.NewString()
+	collaboratorID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", ownerID)
+
+	conv := createTestConversation(t, store, ownerID, time.Now())
+	require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "user", Content: "hi", CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+
+	_, err := store.GetConversationPermission(conv.ID, collaboratorID)
+	require.NotNil(t, err)
+	_, err = store.GetMessagesForUser(conv.ID, collaboratorID)
+	require.NotNil(t, err)
+
+	require.NotNil(t, store.GrantConversationAccess(conv.ID, ownerID, ownerID, postgresql.PermissionRead))
+	require.NotNil(t, store.GrantConversationAccess(conv.ID, collaboratorID, collaboratorID, postgresql.PermissionRead))
+	require.Nil(t, store.GrantConversationAccess(conv.ID, ownerID, collaboratorID, postgresql.PermissionRead))
+
+	permission, err := store.GetConversationPermission(conv.ID, collaboratorID)
+	require.Nil(t, err)
+	require.Equal(t, postgresql.PermissionRead, permission)
+	permission, err = store.GetConversationPermission(conv.ID, ownerID)
+	require.Nil(t, err)
+	require.Equal(t, postgresql.PermissionOwner, permission)
+
+	messages, err := store.GetMessagesForUser(conv.ID, collaboratorID)
+	require.Nil(t, err)
+	require.Len(t, messages, 1)
+
+	shared, err := store.GetConversationsByUser(collaboratorID, false)
+	require.Nil(t, err)
+	require.Len(t, shared, 1)
+	require.Equal(t, conv.ID, shared[0].ID)
+
+	require.Nil(t, store.GrantConversationAccess(conv.ID, ownerID, collaboratorID, postgresql.PermissionWrite))
+	shares, err := store.GetConversationShares(conv.ID, ownerID)
+	require.Nil(t, err)
+	require.Len(t, shares, 1)
+	require.Equal(t, postgresql.PermissionWrite, shares[0].Permission)
+
+	require.Nil(t, store.RevokeConversationAccess(conv.ID, ownerID, collaboratorID))
+	require.NotNil(t, store.RevokeConversationAccess(conv.ID, ownerID, collaboratorID))
+	shared, err = store.GetConversationsByUser(collaboratorID, false)
+	require.Nil(t, err)
+	require.Empty(t, shared)
+}
+
+func TestConversation_MessageThread(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	conv := createTestConversation(t, store, userID, time.Now())
+	other := createTestConversation(t, store, userID, time.Now())
+	add := func(conversationID, parentID, content string) postgresql.Message {
+		m := postgresql.Message{ID: uuid.NewString(), ConversationID: conversationID, ParentMessageID: parentID, Role: "user", Content: content, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		require.Nil(t, store.CreateMessage(m))
+		return m
+	}
+	root := add(conv.ID, "", "root")
+	a := add(conv.ID, root.ID, "a")
+	b := add(conv.ID, root.ID, "b")
+	add(conv.ID, a.ID, "a1")
+	add(conv.ID, "", "flat")
+	elsewhere := add(other.ID, "", "elsewhere")
+
+	err := store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, ParentMessageID: elsewhere.ID, Role: "user", Content: "x", CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	require.NotNil(t, err)
+
+	thread, err := store.GetMessageThread(root.ID)
+	require.Nil(t, err)
+	contents := []string{}
+	for _, m := range thread {
+		contents = append(contents, m.Content)
+	}
+	require.Equal(t, []string{"root", "a", "b", "a1"}, contents)
+	require.Equal(t, root.ID, thread[1].ParentMessageID)
+
+	thread, err = store.GetMessageThread(b.ID)
+	require.Nil(t, err)
+	require.Len(t, thread, 1)
+
+	_, err = store.GetMessageThread(uuid.NewString())
+	require.NotNil(t, err)
+
+	messages, err := store.GetMessagesForUser(conv.ID, userID)
+	require.Nil(t, err)
+	require.Len(t, messages, 5)
+	require.Empty(t, messages[4].ParentMessageID)
+}
+
+func TestConversation_ReplyVariants(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	conv := createTestConversation(t, store, userID, time.Now())
+	for i, content := range []string{"Bonjour", "Salut"} {
+		require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "assistant", Content: content, VariantIndex: i, CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+	}
+
+	messages, err := store.GetMessagesForUser(conv.ID, userID)
+	require.Nil(t, err)
+	require.Len(t, messages, 2)
+	require.Equal(t, 0, messages[0].VariantIndex)
+	require.Equal(t, 1, messages[1].VariantIndex)
+}
+
+func TestConversation_ContentParts(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	defer db.Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	conv := createTestConversation(t, store, userID, time.Now())
+	parts := json.RawMessage(`[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}]`)
+	require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "user", Content: postgresql.ContentText(parts), ContentJSON: parts, CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+	require.Nil(t, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "assistant", Content: "A cat.", CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+
+	messages, err := store.GetMessagesForUser(conv.ID, userID)
+	require.Nil(t, err)
+	require.Len(t, messages, 2)
+	require.Equal(t, "What is this?\n[image]", messages[0].Content)
+	require.JSONEq(t, string(parts), string(messages[0].ContentJSON))
+	require.Empty(t, messages[1].ContentJSON)
+}
+
+func TestConversation_AuditLog(t *testing.T) {
+	store := connectToConversationStore(t)
+	db := connectToPostgreSqlDb()
+	userID := uuid.NewString()
+	targetID := uuid.NewString()
+	defer db.Exec("DELETE FROM audit_log WHERE user_id=$1", userID)
+
+	now := time.Now()
+	require.Nil(t, store.RecordAudit(postgresql.AuditEntry{UserID: userID, Action: "conversation.create", TargetID: targetID, CreatedAt: now.Add(-time.Minute)}))
+	require.Nil(t, store.RecordAudit(postgresql.AuditEntry{UserID: userID, Action: "conversation.pin", TargetID: targetID, Detail: []byte(`{"pinned":true}`), CreatedAt: now}))
+	require.Nil(t, store.RecordAudit(postgresql.AuditEntry{UserID: userID, Action: "folder.create", TargetID: uuid.NewString(), CreatedAt: now}))
+
+	t.Run("when filtered by user every entry is listed newest first", func(t *testing.T) {
+		entries, err := store.GetAuditEntries(userID, "", 0)
+		require.Nil(t, err)
+		require.Len(t, entries, 3)
+		require.Equal(t, "conversation.create", entries[2].Action)
+	})
+
+	t.Run("when filtered by target only its entries are listed", func(t *testing.T) {
+		entries, err := store.GetAuditEntries("", targetID, 0)
+		require.Nil(t, err)
+		require.Len(t, entries, 2)
+		require.Equal(t, "conversation.pin", entries[0].Action)
+		require.JSONEq(t, `{"pinned":true}`, string(entries[0].Detail))
+		require.JSONEq(t, `{}`, string(entries[1].Detail))
+	})
+
+	t.Run("when limited only the newest entries are listed", func(t *testing.T) {
+		entries, err := store.GetAuditEntries(userID, targetID, 1)
+		require.Nil(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, "conversation.pin", entries[0].Action)
+	})
+}
+
+func seedPreviewBenchmark(b *testing.B) (*postgresql.Store, string) {
+	store := connectToConversationStore(b)
+	userID := uuid.NewString()
+	for i := 0; i < 50; i++ {
+		conv := createTestConversation(b, store, userID, time.Now())
+		for j := 0; j < 10; j++ {
+			now := time.Now()
+			require.Nil(b, store.CreateMessage(postgresql.Message{ID: uuid.NewString(), ConversationID: conv.ID, Role: "user", Content: "hello", CreatedAt: now, UpdatedAt: now}))
+		}
+	}
+	return store, userID
+}
+
+// BenchmarkConversationPreviews_Joined and _Naive compare the single joined
+// preview query with listing conversations and fetching messages per row.
+func BenchmarkConversationPreviews_Joined(b *testing.B) {
+	store, userID := seedPreviewBenchmark(b)
+	defer connectToPostgreSqlDb().Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := store.GetConversationPreviewsByUser(userID, false, "", "", "", time.Time{}, time.Time{})
+		require.Nil(b, err)
+	}
+}
+
+func BenchmarkConversationPreviews_Naive(b *testing.B) {
+	store, userID := seedPreviewBenchmark(b)
+	defer connectToPostgreSqlDb().Exec("DELETE FROM conversations WHERE user_id=$1", userID)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		convs, err := store.GetConversationsByUser(userID, false)
+		require.Nil(b, err)
+		for _, c := range convs {
+			_, err := store.GetMessages(c.ID)
+			require.Nil(b, err)
+		}
+	}
+}